@@ -0,0 +1,118 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"text2sql-skill/core"
+)
+
+const apikeyUsage = `Usage: text2sql-skill apikey <command> [options]
+
+Commands:
+  generate  Generate a new API key and its config entry (生成新的 API key)
+  hash      Hash an existing token read from stdin (对已有令牌计算哈希)
+`
+
+// runAPIKeyCommand 处理 apikey 子命令，返回进程退出码
+func runAPIKeyCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, apikeyUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "generate":
+		return runAPIKeyGenerate(args[1:])
+	case "hash":
+		return runAPIKeyHash(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown apikey command: %s\n\n%s", args[0], apikeyUsage)
+		return 2
+	}
+}
+
+func runAPIKeyGenerate(args []string) int {
+	fs := flag.NewFlagSet("apikey generate", flag.ContinueOnError)
+	name := fs.String("name", "", "Key name, used as the caller identity (key 名称)")
+	scopes := fs.String("scopes", "execute", "Comma separated scopes: execute, schema, audit, admin")
+	tenant := fs.String("tenant", "", "Bind the key to a tenant")
+	expires := fs.String("expires-at", "", "Expiry time (RFC3339)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *name == "" {
+		fmt.Fprintln(os.Stderr, "ERROR: -name is required")
+		return 2
+	}
+
+	token, hash, err := core.GenerateAPIKey()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+
+	// 令牌只显示一次，配置中只保存哈希
+	fmt.Fprintf(os.Stderr, "Token (shown once): %s\n\n", token)
+	fmt.Printf("    - name: %q\n", *name)
+	fmt.Printf("      hash: %q\n", hash)
+	fmt.Printf("      scopes: [%s]\n", quoteList(*scopes))
+	if *tenant != "" {
+		fmt.Printf("      tenant: %q\n", *tenant)
+	}
+	if *expires != "" {
+		fmt.Printf("      expires_at: %q\n", *expires)
+	}
+	return 0
+}
+
+func runAPIKeyHash(args []string) int {
+	fs := flag.NewFlagSet("apikey hash", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	token := strings.TrimSpace(line)
+	if token == "" {
+		fmt.Fprintf(os.Stderr, "ERROR: no token on stdin: %v\n", err)
+		return 2
+	}
+	hash, err := core.HashAPIKey(token)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	fmt.Println(hash)
+	return 0
+}
+
+func quoteList(list string) string {
+	var quoted []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			quoted = append(quoted, fmt.Sprintf("%q", item))
+		}
+	}
+	return strings.Join(quoted, ", ")
+}
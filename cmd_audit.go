@@ -0,0 +1,253 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+)
+
+const auditUsage = `Usage: text2sql-skill audit <command> [options]
+
+Commands:
+  verify    Verify the audit log hash chain (校验审计日志哈希链)
+  query     Query audit entries from file or sqlite storage (查询审计记录)
+  shadow    Summarize decisions of monitor-mode guards (汇总 monitor 模式守卫的影子决定)
+`
+
+// runAuditCommand 处理 audit 子命令，返回进程退出码
+func runAuditCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, auditUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "verify":
+		return runAuditVerify(args[1:])
+	case "query":
+		return runAuditQuery(args[1:])
+	case "shadow":
+		return runAuditShadow(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown audit command: %s\n\n%s", args[0], auditUsage)
+		return 2
+	}
+}
+
+func runAuditVerify(args []string) int {
+	fs := flag.NewFlagSet("audit verify", flag.ContinueOnError)
+	configPath := fs.String("config", "", "Path to configuration file (used for audit path and HMAC key)")
+	keyFile := fs.String("key-file", "", "Read HMAC key from file (overrides config)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: text2sql-skill audit verify [-config config.yaml] [-key-file path] [audit dir or file]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var path string
+	var integrity config.AuditIntegrity
+	if *configPath != "" {
+		cfg, err := config.LoadConfig(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: Failed to load config: %v\n", err)
+			return 1
+		}
+		path = cfg.Audit.Storage.Path
+		integrity = cfg.Audit.Integrity
+	}
+	if fs.NArg() > 0 {
+		path = fs.Arg(0)
+	}
+	if *keyFile != "" {
+		integrity = config.AuditIntegrity{HMACKeyFile: *keyFile}
+	}
+	if path == "" {
+		fs.Usage()
+		return 2
+	}
+
+	key, err := integrity.LoadKey()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: Failed to load HMAC key: %v\n", err)
+		return 1
+	}
+
+	result, err := core.VerifyAuditLogWithKey(path, key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Files:   %d\n", len(result.Files))
+	fmt.Printf("Entries: %d (seq %d..%d)\n", result.Entries, result.FirstSeq, result.LastSeq)
+	if result.OK() {
+		fmt.Println("Result:  OK")
+		return 0
+	}
+
+	fmt.Printf("Result:  FAILED (%d problem(s))\n", len(result.Problems))
+	for _, problem := range result.Problems {
+		fmt.Println("  " + problem.String())
+	}
+	return 1
+}
+
+func runAuditQuery(args []string) int {
+	fs := flag.NewFlagSet("audit query", flag.ContinueOnError)
+	configPath := fs.String("config", "./config.yaml", "Path to configuration file")
+	var filter core.AuditFilter
+	fs.StringVar(&filter.QueryID, "query-id", "", "Filter by query ID")
+	fs.StringVar(&filter.EventType, "event", "", "Filter by event type")
+	fs.StringVar(&filter.User, "user", "", "Filter by user")
+	fs.StringVar(&filter.Status, "status", "", "Filter by status")
+	since := fs.String("since", "", "Start time (RFC3339) or duration ago, e.g. 1h")
+	until := fs.String("until", "", "End time (RFC3339), exclusive")
+	fs.IntVar(&filter.Limit, "limit", 100, "Return at most N most recent entries (0 = unlimited)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var err error
+	if filter.Since, err = parseAuditTime(*since); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: invalid -since: %v\n", err)
+		return 2
+	}
+	if filter.Until, err = parseAuditTime(*until); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: invalid -until: %v\n", err)
+		return 2
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: Failed to load config: %v\n", err)
+		return 1
+	}
+
+	querier, closer, err := core.OpenAuditQuerier(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	defer closer.Close()
+
+	entries, err := querier.Query(filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	for _, entry := range entries {
+		encoder.Encode(entry)
+	}
+	return 0
+}
+
+func runAuditShadow(args []string) int {
+	fs := flag.NewFlagSet("audit shadow", flag.ContinueOnError)
+	configPath := fs.String("config", "./config.yaml", "Path to configuration file")
+	filter := core.AuditFilter{EventType: "shadow_decision"}
+	fs.StringVar(&filter.User, "user", "", "Filter by user")
+	guard := fs.String("guard", "", "Only report this guard")
+	since := fs.String("since", "24h", "Start time (RFC3339) or duration ago, e.g. 1h")
+	until := fs.String("until", "", "End time (RFC3339), exclusive")
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var err error
+	if filter.Since, err = parseAuditTime(*since); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: invalid -since: %v\n", err)
+		return 2
+	}
+	if filter.Until, err = parseAuditTime(*until); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: invalid -until: %v\n", err)
+		return 2
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: Failed to load config: %v\n", err)
+		return 1
+	}
+
+	querier, closer, err := core.OpenAuditQuerier(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	defer closer.Close()
+
+	entries, err := querier.Query(filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	if *guard != "" {
+		var selected []*core.AuditEntry
+		for _, entry := range entries {
+			if entry.Data["guard"] == *guard {
+				selected = append(selected, entry)
+			}
+		}
+		entries = selected
+	}
+
+	report := core.SummarizeShadowDecisions(entries)
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+		return 0
+	}
+
+	fmt.Printf("Shadow decisions: %d across %d queries\n", report.Total, report.Queries)
+	if report.Total == 0 {
+		return 0
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "GUARD\tPHASE\tWOULD\tCODE\tCOUNT\tUSERS\tLAST\tEXAMPLE")
+	for _, summary := range report.Summaries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n", summary.Guard, summary.Phase, summary.Action,
+			summary.Code, summary.Count, summary.Users, summary.Last.Format(time.RFC3339), summary.Example)
+	}
+	w.Flush()
+	return 0
+}
+
+// parseAuditTime 支持 RFC3339 时间或相对当前时间的持续时间
+func parseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
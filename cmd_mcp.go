@@ -0,0 +1,123 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+	"text2sql-skill/mcp"
+)
+
+// runMCPCommand 以 MCP 服务端运行，返回进程退出码。
+// stdio 模式下标准输出只写协议消息，日志和其他输出写到标准错误
+func runMCPCommand(args []string) int {
+	fs := flag.NewFlagSet("mcp", flag.ContinueOnError)
+	configPath := fs.String("config", "./config.yaml", "Path to configuration file")
+	transport := fs.String("transport", "stdio", "Transport: stdio, http or unix")
+	addr := fs.String("addr", "", "Listen address for the http transport (default server.address)")
+	socket := fs.String("socket", "/tmp/text2sql-mcp.sock", "Socket path for the unix transport")
+	user := fs.String("user", "", "Caller identity of the stdio session (stdio 会话的调用方)")
+	roles := fs.String("roles", "", "Comma separated roles of -user")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	switch *transport {
+	case "stdio", "http", "unix":
+	default:
+		fmt.Fprintf(os.Stderr, "ERROR: unknown transport %q (stdio, http, unix)\n", *transport)
+		return 2
+	}
+
+	// 保留真正的标准输出给协议消息，例如 console 审计输出改写到标准错误
+	protocolOut := os.Stdout
+	if *transport == "stdio" {
+		os.Stdout = os.Stderr
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: Failed to load config: %v\n", err)
+		return 1
+	}
+	if err := setupLogging(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: Invalid redaction config: %v\n", err)
+		return 1
+	}
+
+	skill, err := newSkill(cfg)
+	if err != nil {
+		log.Printf("ERROR: Failed to create skill: %v", err)
+		return 1
+	}
+	defer skill.SafeShutdown()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	server := mcp.NewServer(cfg, skill)
+	errCh := make(chan error, 1)
+	go func() {
+		switch *transport {
+		case "http":
+			address := *addr
+			if address == "" {
+				address = cfg.Server.Address
+			}
+			if address == "" {
+				address = ":8080"
+			}
+			errCh <- server.StartServer(address)
+		case "unix":
+			errCh <- server.StartUnixSocketServer(*socket)
+		default:
+			sessionCtx := ctx
+			if *user != "" {
+				var roleList []string
+				for _, role := range strings.Split(*roles, ",") {
+					if role = strings.TrimSpace(role); role != "" {
+						roleList = append(roleList, role)
+					}
+				}
+				sessionCtx = core.WithPrincipal(ctx, core.NewPrincipal(*user, roleList...))
+			}
+			log.Printf("INFO: MCP stdio server started (%s v%s)", cfg.App.Name, cfg.App.Version)
+			errCh <- server.ServeStream(sessionCtx, os.Stdin, protocolOut)
+		}
+	}()
+
+	// stdio 在宿主关闭标准输入时正常退出
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		log.Println("INFO: Shutting down MCP server...")
+	}
+	if err != nil {
+		log.Printf("ERROR: MCP server stopped: %v", err)
+		return 1
+	}
+	return 0
+}
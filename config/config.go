@@ -18,7 +18,10 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -36,6 +39,9 @@ type Config struct {
 	Monitoring     MonitoringConfig     `yaml:"monitoring"`
 	Logging        LoggingConfig        `yaml:"logging"`
 	Authentication AuthenticationConfig `yaml:"authentication"`
+	MultiTenancy   MultiTenancyConfig   `yaml:"multi_tenancy"`
+	RateLimit      RateLimitConfig      `yaml:"rate_limit"`
+	Server         ServerConfig         `yaml:"server"`
 }
 
 // AppConfig 应用程序基础配置
@@ -90,6 +96,136 @@ type SecurityConfig struct {
 	ForbiddenKeywords []string        `yaml:"forbidden_keywords"`
 	InputValidation   InputValidation `yaml:"input_validation"`
 	ResourceLimits    ResourceLimits  `yaml:"resource_limits"`
+	Redaction         RedactionConfig `yaml:"redaction"`
+	RBAC              RBACConfig      `yaml:"rbac"`
+	Masking           MaskingConfig   `yaml:"masking"`
+	RequireIdentity   bool            `yaml:"require_identity"` // 拒绝 context 中没有调用方身份的请求
+	InjectionGuard    InjectionGuard  `yaml:"injection_guard"`
+	Guards            []GuardConfig   `yaml:"guards"` // 守卫链的顺序与开关，未列出的守卫按默认顺序排在后面
+}
+
+// GuardConfig 单个守卫的配置，name 为内置守卫名称或通过 RegisterGuard 注册的自定义守卫名称
+type GuardConfig struct {
+	Name     string            `yaml:"name"`
+	Enabled  *bool             `yaml:"enabled"`  // 省略时启用
+	Mode     string            `yaml:"mode"`     // enforce（默认）或 monitor：只记录本应拒绝或改写的决定，不影响请求
+	Settings map[string]string `yaml:"settings"` // 传给自定义守卫的 Configure
+}
+
+// IsEnabled 未设置 enabled 时视为启用
+func (g GuardConfig) IsEnabled() bool {
+	return g.Enabled == nil || *g.Enabled
+}
+
+// IsMonitor 是否为 monitor（影子）模式
+func (g GuardConfig) IsMonitor() bool {
+	return g.Mode == "monitor"
+}
+
+// InjectionGuard 提示词注入与越狱检测
+type InjectionGuard struct {
+	Enabled       bool            `yaml:"enabled"`
+	BlockSeverity string          `yaml:"block_severity"` // low, medium, high：达到该级别时拒绝，低于该级别只记录告警
+	DisabledRules []string        `yaml:"disabled_rules"` // 关闭的内置规则名称
+	Rules         []InjectionRule `yaml:"rules"`          // 自定义规则
+	FailClosed    bool            `yaml:"fail_closed"`    // 分类器出错时拒绝请求，默认放行并记录告警
+}
+
+// InjectionRule 自定义注入检测规则，pattern 为正则表达式，匹配前输入会转为小写
+type InjectionRule struct {
+	Name     string `yaml:"name"`
+	Pattern  string `yaml:"pattern"`
+	Severity string `yaml:"severity"` // low, medium, high
+}
+
+// MaskingConfig 列脱敏策略，按调用方角色对查询结果中的列值脱敏
+type MaskingConfig struct {
+	Enabled  bool            `yaml:"enabled"`
+	Policies []MaskingPolicy `yaml:"policies"`
+}
+
+// MaskingPolicy 单列脱敏规则，table/column 支持 * 通配
+type MaskingPolicy struct {
+	Table         string   `yaml:"table"`          // table 或 schema.table
+	Column        string   `yaml:"column"`         // 列名
+	Type          string   `yaml:"type"`           // redact, partial, hash, bucket
+	ShowFirst     int      `yaml:"show_first"`     // partial: 保留开头字符数
+	ShowLast      int      `yaml:"show_last"`      // partial: 保留结尾字符数，两者均为 0 时保留最后 4 个
+	BucketSize    float64  `yaml:"bucket_size"`    // bucket: 数值分段大小
+	Salt          string   `yaml:"salt"`           // hash: 盐值
+	UnmaskedRoles []string `yaml:"unmasked_roles"` // 不脱敏的角色
+}
+
+// RBACConfig 基于角色的表、列访问控制，作用于生成的 SQL
+type RBACConfig struct {
+	Enabled     bool                `yaml:"enabled"`
+	PolicyFile  string              `yaml:"policy_file"`  // YAML 策略文件，内容与下方 roles/users 合并
+	DefaultRole string              `yaml:"default_role"` // 调用方没有角色时使用，为空则拒绝
+	Roles       []RoleConfig        `yaml:"roles"`
+	Users       map[string][]string `yaml:"users"` // 用户到角色的绑定
+}
+
+// RBACPolicy 角色策略，策略文件使用同样的结构
+type RBACPolicy struct {
+	Roles []RoleConfig        `yaml:"roles"`
+	Users map[string][]string `yaml:"users"`
+}
+
+// RoleConfig 角色定义
+type RoleConfig struct {
+	Name       string            `yaml:"name"`
+	Grants     []GrantConfig     `yaml:"grants"`
+	RowFilters map[string]string `yaml:"row_filters"` // 表名（可带 schema）到过滤条件，:user.<属性> 绑定调用方属性
+}
+
+// GrantConfig 授权规则，schema/table/columns 支持 * 通配
+type GrantConfig struct {
+	Schema     string   `yaml:"schema"`     // 为空只匹配未限定 schema 的表引用
+	Table      string   `yaml:"table"`      // 表名
+	Columns    []string `yaml:"columns"`    // 允许的列，为空表示全部列
+	Operations []string `yaml:"operations"` // SELECT, INSERT, UPDATE, DELETE，为空表示 SELECT
+}
+
+// LoadPolicy 合并配置中的角色和策略文件中的角色
+func (r RBACConfig) LoadPolicy() (RBACPolicy, error) {
+	policy := RBACPolicy{
+		Roles: append([]RoleConfig(nil), r.Roles...),
+		Users: make(map[string][]string),
+	}
+	for user, roles := range r.Users {
+		policy.Users[user] = append(policy.Users[user], roles...)
+	}
+
+	if r.PolicyFile == "" {
+		return policy, nil
+	}
+	data, err := os.ReadFile(r.PolicyFile)
+	if err != nil {
+		return policy, err
+	}
+	var file RBACPolicy
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return policy, err
+	}
+	policy.Roles = append(policy.Roles, file.Roles...)
+	for user, roles := range file.Users {
+		policy.Users[user] = append(policy.Users[user], roles...)
+	}
+	return policy, nil
+}
+
+// RedactionConfig 敏感信息脱敏配置，作用于审计记录、错误信息和日志
+type RedactionConfig struct {
+	Enabled        bool              `yaml:"enabled"`
+	Detectors      []string          `yaml:"detectors"`       // email, phone, cn_id, credit_card，为空表示全部
+	CustomPatterns []RedactionRegexp `yaml:"custom_patterns"` // 自定义正则
+	Columns        []string          `yaml:"columns"`         // 按列名/字段名整体脱敏，支持 * 通配
+}
+
+// RedactionRegexp 自定义脱敏正则
+type RedactionRegexp struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
 }
 
 // InputValidation 输入验证配置
@@ -140,16 +276,77 @@ type CacheConfig struct {
 
 // AuditConfig 审计配置
 type AuditConfig struct {
-	Enabled bool         `yaml:"enabled"`
-	Level   string       `yaml:"level"`
-	Storage AuditStorage `yaml:"storage"`
+	Enabled   bool                  `yaml:"enabled"`
+	Level     string                `yaml:"level"`
+	Storage   AuditStorage          `yaml:"storage"`
+	Integrity AuditIntegrity        `yaml:"integrity"`
+	Queue     AuditQueue            `yaml:"queue"`
+	Exporters []AuditExporterConfig `yaml:"exporters"`
+}
+
+// AuditExporterConfig 审计日志外部导出配置，批量参数取自 performance.batch_processing
+type AuditExporterConfig struct {
+	Name      string            `yaml:"name"`
+	Type      string            `yaml:"type"`     // syslog, otlp, webhook
+	Network   string            `yaml:"network"`  // syslog: udp, tcp, tls
+	Address   string            `yaml:"address"`  // syslog: host:port
+	Endpoint  string            `yaml:"endpoint"` // otlp, webhook: URL
+	Headers   map[string]string `yaml:"headers"`
+	Secret    string            `yaml:"secret"`   // webhook: HMAC-SHA256 签名密钥
+	AppName   string            `yaml:"app_name"` // syslog APP-NAME / OTLP service.name
+	Facility  int               `yaml:"facility"` // syslog facility，默认 13 (log audit)
+	Timeout   string            `yaml:"timeout"`
+	QueueSize int               `yaml:"queue_size"`
+	TLS       ExporterTLSConfig `yaml:"tls"`
+	Retry     RetryConfig       `yaml:"retry"`
+}
+
+// ExporterTLSConfig 导出器 TLS 客户端配置
+type ExporterTLSConfig struct {
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// AuditQueue 异步审计队列配置
+type AuditQueue struct {
+	Size         int    `yaml:"size"`          // 队列容量
+	Overflow     string `yaml:"overflow"`      // 队列满时的策略: block, drop, spill
+	BlockTimeout string `yaml:"block_timeout"` // block 策略的最长等待时间，超时后丢弃并计数，为空表示一直等待
+	SpillPath    string `yaml:"spill_path"`    // spill 策略的溢出文件路径
+}
+
+// AuditIntegrity 审计日志防篡改配置
+type AuditIntegrity struct {
+	HMACKey     string `yaml:"hmac_key"`      // 用于签名哈希链的密钥，为空时使用 SHA-256
+	HMACKeyFile string `yaml:"hmac_key_file"` // 从文件读取密钥，优先于 hmac_key
+}
+
+// LoadKey 返回配置的 HMAC 密钥，未配置时返回 nil
+func (i AuditIntegrity) LoadKey() ([]byte, error) {
+	if i.HMACKeyFile != "" {
+		data, err := os.ReadFile(i.HMACKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strings.TrimSpace(string(data))), nil
+	}
+	if i.HMACKey != "" {
+		return []byte(i.HMACKey), nil
+	}
+	return nil, nil
 }
 
 // AuditStorage 审计存储配置
 type AuditStorage struct {
-	Type     string        `yaml:"type"`
-	Path     string        `yaml:"path"`
-	Rotation AuditRotation `yaml:"rotation"`
+	Type          string        `yaml:"type"`        // file, sqlite, memory, console
+	Path          string        `yaml:"path"`        // file: 目录; sqlite: 数据库文件或目录
+	MemorySize    int           `yaml:"memory_size"` // memory: 环形缓冲区容量
+	Rotation      AuditRotation `yaml:"rotation"`
+	Fsync         string        `yaml:"fsync"`          // always, interval, never
+	FsyncInterval string        `yaml:"fsync_interval"` // fsync 为 interval 时的刷盘间隔
 }
 
 // AuditRotation 审计日志轮转配置
@@ -166,6 +363,15 @@ type PerformanceConfig struct {
 	WorkerPoolSize  int               `yaml:"worker_pool_size"`
 	BatchProcessing BatchProcessing   `yaml:"batch_processing"`
 	Compression     CompressionConfig `yaml:"compression"`
+	Admission       AdmissionConfig   `yaml:"admission"`
+}
+
+// AdmissionConfig 查询执行的准入控制：最多 worker_pool_size 个查询同时访问数据库，
+// 其余请求排队，队列满或等待超时时返回 overloaded
+type AdmissionConfig struct {
+	QueueSize      int    `yaml:"queue_size"`       // 等待队列容量，0 表示不排队
+	BatchQueueSize int    `yaml:"batch_queue_size"` // batch 请求最多占用的队列位置，为 0 时与 queue_size 相同
+	QueueTimeout   string `yaml:"queue_timeout"`    // 最长排队时间
 }
 
 // BatchProcessing 批处理配置
@@ -205,10 +411,82 @@ type LoggingConfig struct {
 
 // AuthenticationConfig 身份认证配置
 type AuthenticationConfig struct {
-	Enabled      bool   `yaml:"enabled"`
-	Token        string `yaml:"token"`
-	HeaderName   string `yaml:"header_name"`
-	ValidateOnly bool   `yaml:"validate_only"`
+	Enabled         bool           `yaml:"enabled"`
+	Token           string         `yaml:"token"` // 单个明文令牌（兼容旧配置），等同于拥有全部权限的 default key
+	HeaderName      string         `yaml:"header_name"`
+	ValidateOnly    bool           `yaml:"validate_only"`    // 未携带令牌的请求按匿名放行，携带的令牌仍须有效
+	AnonymousScopes []string       `yaml:"anonymous_scopes"` // 未携带凭证的调用（validate_only、stdio、unix socket）的权限，默认无
+	APIKeys         []APIKeyConfig `yaml:"api_keys"`
+	JWT             JWTConfig      `yaml:"jwt"`
+}
+
+// JWTConfig JWT/OIDC bearer token 认证，签名公钥取自 JWKS 文件或 URL
+type JWTConfig struct {
+	Enabled       bool            `yaml:"enabled"`
+	Issuer        string          `yaml:"issuer"`
+	Audiences     []string        `yaml:"audiences"`      // 令牌 aud 至少包含其中之一
+	JWKSFile      string          `yaml:"jwks_file"`      // 本地 JWKS 文件，优先于 jwks_url
+	JWKSURL       string          `yaml:"jwks_url"`       // 例如 https://idp.example.com/.well-known/jwks.json
+	CacheTTL      string          `yaml:"cache_ttl"`      // JWKS 缓存时间，默认 10m
+	Algorithms    []string        `yaml:"algorithms"`     // 允许的签名算法，默认 RS256, ES256
+	ClockSkew     string          `yaml:"clock_skew"`     // 过期时间校验的容差，默认 1m
+	DefaultScopes []string        `yaml:"default_scopes"` // 令牌没有 scope 声明时的权限，默认 execute
+	Claims        JWTClaimMapping `yaml:"claims"`
+}
+
+// JWTClaimMapping 声明到调用方身份的映射，支持 a.b.c 形式的嵌套路径
+type JWTClaimMapping struct {
+	User       string            `yaml:"user"`       // 默认 sub
+	Roles      string            `yaml:"roles"`      // 默认 roles
+	Tenant     string            `yaml:"tenant"`     // 为空时不映射租户
+	Scopes     string            `yaml:"scopes"`     // 默认 scope（空格分隔字符串或数组）
+	Attributes map[string]string `yaml:"attributes"` // 身份属性名到声明路径，供行级安全使用
+}
+
+// APIKeyConfig API key 配置，只保存加盐哈希，由 `text2sql-skill apikey generate` 生成
+type APIKeyConfig struct {
+	Name      string   `yaml:"name"`
+	Hash      string   `yaml:"hash"`       // sha256$<salt>$<digest>
+	Scopes    []string `yaml:"scopes"`     // execute, schema, audit, admin
+	Tenant    string   `yaml:"tenant"`     // 多租户模式下绑定的租户
+	Roles     []string `yaml:"roles"`      // RBAC 角色
+	ExpiresAt string   `yaml:"expires_at"` // RFC 3339，为空表示不过期
+}
+
+// ServerConfig MCP HTTP 服务配置
+type ServerConfig struct {
+	Address string          `yaml:"address"` // 监听地址，默认 :8080
+	TLS     ServerTLSConfig `yaml:"tls"`
+	MCP     MCPServerConfig `yaml:"mcp"`
+}
+
+// MCPServerConfig MCP 请求处理限制，0 表示使用默认值
+type MCPServerConfig struct {
+	MaxRequestBytes  int64 `yaml:"max_request_bytes"` // HTTP 请求体或 stdio 单行消息的最大字节数，默认 1 MiB
+	MaxBatchSize     int   `yaml:"max_batch_size"`    // 批量请求中的最大消息数，默认 50
+	BatchConcurrency int   `yaml:"batch_concurrency"` // 批量请求中同时处理的消息数，默认 4
+	MaxSessions      int   `yaml:"max_sessions"`      // Streamable HTTP 会话数上限，超过时拒绝新的 initialize，默认 1000
+}
+
+// ServerTLSConfig HTTPS 服务端证书与双向 TLS 配置
+type ServerTLSConfig struct {
+	Enabled        bool             `yaml:"enabled"`
+	CertFile       string           `yaml:"cert_file"`
+	KeyFile        string           `yaml:"key_file"`
+	MinVersion     string           `yaml:"min_version"`     // 1.2 或 1.3，默认 1.2
+	CipherSuites   []string         `yaml:"cipher_suites"`   // TLS 1.2 套件名，为空时使用 Go 默认的安全套件
+	ReloadInterval string           `yaml:"reload_interval"` // 检查证书文件变更的间隔，默认 1m，0 表示不热加载
+	ClientAuth     ClientCertConfig `yaml:"client_auth"`
+}
+
+// ClientCertConfig 客户端证书认证，证书主题映射为调用方身份
+type ClientCertConfig struct {
+	Mode        string   `yaml:"mode"`         // none, optional, required
+	CAFile      string   `yaml:"ca_file"`      // 签发客户端证书的 CA
+	UserField   string   `yaml:"user_field"`   // cn, email, dns, uri，默认 cn
+	RolesField  string   `yaml:"roles_field"`  // ou 表示以证书 OU 作为角色，为空不映射
+	TenantField string   `yaml:"tenant_field"` // o 表示以证书 O 作为租户，为空不映射
+	Scopes      []string `yaml:"scopes"`       // 证书身份的权限，默认 execute
 }
 
 // FileLogConfig 文件日志配置
@@ -220,6 +498,132 @@ type FileLogConfig struct {
 	Compress   bool   `yaml:"compress"`
 }
 
+// RateLimitConfig 调用方限流与每日配额
+type RateLimitConfig struct {
+	Enabled         bool            `yaml:"enabled"`
+	Rules           []RateLimitRule `yaml:"rules"`
+	Endpoint        EndpointLimit   `yaml:"endpoint"`         // MCP HTTP 端点按客户端地址限流
+	StatePath       string          `yaml:"state_path"`       // 配额用量持久化文件，为空时重启后清零
+	PersistInterval string          `yaml:"persist_interval"` // 用量写盘的最短间隔，默认 10s
+}
+
+// RateLimitRule 一条限流规则，匹配的调用方各自独立计数，多条规则同时生效
+type RateLimitRule struct {
+	Scope             string  `yaml:"scope"`               // user, tenant, api_key
+	Match             string  `yaml:"match"`               // 调用方名称，支持 * 通配，默认 *
+	RequestsPerSecond float64 `yaml:"requests_per_second"` // 令牌桶速率，0 表示不限
+	Burst             int     `yaml:"burst"`               // 令牌桶容量，默认为速率向上取整
+	DailyQueries      int64   `yaml:"daily_queries"`       // 每日查询次数，0 表示不限
+	DailyRows         int64   `yaml:"daily_rows"`          // 每日返回行数
+	DailyDBTime       string  `yaml:"daily_db_time"`       // 每日数据库耗时，例如 10m
+}
+
+// EndpointLimit HTTP 端点限流，速率为 0 时不限
+type EndpointLimit struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	Burst             int     `yaml:"burst"`
+}
+
+// MultiTenancyConfig 多租户配置，每个租户使用独立的数据库连接池、缓存、审计存储、资源限制和安全策略
+type MultiTenancyConfig struct {
+	Enabled       bool           `yaml:"enabled"`
+	DefaultTenant string         `yaml:"default_tenant"` // 请求未指定租户时使用，为空则拒绝
+	Tenants       []TenantConfig `yaml:"tenants"`
+}
+
+// TenantConfig 单个租户配置，未设置的部分沿用全局配置
+type TenantConfig struct {
+	Name           string           `yaml:"name"`
+	Database       *DatabaseConfig  `yaml:"database"`
+	ResourceLimits *ResourceLimits  `yaml:"resource_limits"`
+	Cache          *CacheConfig     `yaml:"cache"`
+	AuditStorage   *AuditStorage    `yaml:"audit_storage"` // 默认在全局审计路径下的 tenants/<name> 中
+	RBAC           *RBACConfig      `yaml:"rbac"`
+	Masking        *MaskingConfig   `yaml:"masking"`
+	RateLimit      *RateLimitConfig `yaml:"rate_limit"`
+}
+
+// Tenant 返回指定名称的租户配置
+func (m MultiTenancyConfig) Tenant(name string) (TenantConfig, bool) {
+	for _, tenant := range m.Tenants {
+		if tenant.Name == name {
+			return tenant, true
+		}
+	}
+	return TenantConfig{}, false
+}
+
+// ForTenant 生成租户的完整配置：以全局配置为基础，应用租户覆盖项，
+// 并把审计存储和审计导出标识按租户区分
+func (c *Config) ForTenant(name string) (*Config, error) {
+	tenant, ok := c.MultiTenancy.Tenant(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown tenant '%s'", name)
+	}
+
+	derived := *c
+	derived.MultiTenancy = MultiTenancyConfig{}
+	if tenant.Database != nil {
+		derived.Database = *tenant.Database
+	}
+	if tenant.ResourceLimits != nil {
+		derived.Security.ResourceLimits = *tenant.ResourceLimits
+	}
+	if tenant.Cache != nil {
+		derived.Cache = *tenant.Cache
+	}
+	if tenant.RBAC != nil {
+		derived.Security.RBAC = *tenant.RBAC
+	}
+	if tenant.Masking != nil {
+		derived.Security.Masking = *tenant.Masking
+	}
+	if tenant.RateLimit != nil {
+		derived.RateLimit = *tenant.RateLimit
+	} else if c.RateLimit.StatePath != "" {
+		dir, file := filepath.Split(c.RateLimit.StatePath)
+		derived.RateLimit.StatePath = filepath.Join(dir, "tenants", name, file)
+	}
+
+	if tenant.AuditStorage != nil {
+		derived.Audit.Storage = *tenant.AuditStorage
+	} else {
+		derived.Audit.Storage.Path = tenantAuditPath(c.Audit.Storage, name)
+	}
+	if c.Audit.Queue.SpillPath != "" {
+		dir, file := filepath.Split(c.Audit.Queue.SpillPath)
+		derived.Audit.Queue.SpillPath = filepath.Join(dir, "tenants", name, file)
+	}
+
+	// 导出到同一目标时以 APP-NAME / service.name 区分租户
+	derived.Audit.Exporters = make([]AuditExporterConfig, len(c.Audit.Exporters))
+	for i, exporter := range c.Audit.Exporters {
+		if exporter.AppName == "" {
+			exporter.AppName = c.App.Name
+		}
+		exporter.AppName += "-" + name
+		derived.Audit.Exporters[i] = exporter
+	}
+
+	return &derived, nil
+}
+
+// tenantAuditPath 租户审计路径：目录下的 tenants/<name>，sqlite 数据库文件保留文件名
+func tenantAuditPath(storage AuditStorage, name string) string {
+	switch storage.Type {
+	case "file":
+		return filepath.Join(storage.Path, "tenants", name)
+	case "sqlite":
+		if strings.HasSuffix(storage.Path, ".db") || strings.HasSuffix(storage.Path, ".sqlite") {
+			dir, file := filepath.Split(storage.Path)
+			return filepath.Join(dir, "tenants", name, file)
+		}
+		return filepath.Join(storage.Path, "tenants", name)
+	default:
+		return storage.Path
+	}
+}
+
 // LoadConfig 从 YAML 文件加载配置
 func LoadConfig(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
@@ -323,6 +727,11 @@ func DefaultConfig() *Config {
 				"DROP", "DELETE", "INSERT", "UPDATE", "ALTER", "EXEC",
 				"TRUNCATE", "CREATE", "GRANT", "REVOKE",
 			},
+			// 默认关闭，enabled: true 即按下列设置启用
+			InjectionGuard: InjectionGuard{
+				Enabled:       false,
+				BlockSeverity: "medium",
+			},
 			InputValidation: InputValidation{
 				MaxLength:  2048,
 				MinEntropy: 2.5,
@@ -333,6 +742,11 @@ func DefaultConfig() *Config {
 				MaxRows:         1000,
 				MaxResultSizeMB: 10,
 			},
+			Redaction: RedactionConfig{
+				Enabled:   false,
+				Detectors: []string{"email", "phone", "cn_id", "credit_card"},
+				Columns:   []string{"password", "*_token", "*secret*"},
+			},
 		},
 		Execution: ExecutionConfig{
 			IsolationLevel: "full",
@@ -368,6 +782,14 @@ func DefaultConfig() *Config {
 					MaxBackups: 10,
 					Compress:   true,
 				},
+				MemorySize:    10000,
+				Fsync:         "interval",
+				FsyncInterval: "1s",
+			},
+			Queue: AuditQueue{
+				Size:         1000,
+				Overflow:     "block",
+				BlockTimeout: "5s",
 			},
 		},
 		Performance: PerformanceConfig{
@@ -382,6 +804,10 @@ func DefaultConfig() *Config {
 				Enabled:   true,
 				Algorithm: "zlib",
 			},
+			Admission: AdmissionConfig{
+				QueueSize:    100,
+				QueueTimeout: "5s",
+			},
 		},
 		Monitoring: MonitoringConfig{
 			Enabled: true,
@@ -410,6 +836,20 @@ func DefaultConfig() *Config {
 			HeaderName:   "Authorization",
 			ValidateOnly: false,
 		},
+		Server: ServerConfig{
+			Address: ":8080",
+			TLS: ServerTLSConfig{
+				MinVersion:     "1.2",
+				ReloadInterval: "1m",
+				ClientAuth:     ClientCertConfig{Mode: "none", UserField: "cn"},
+			},
+			MCP: MCPServerConfig{
+				MaxRequestBytes:  1 << 20,
+				MaxBatchSize:     50,
+				BatchConcurrency: 4,
+				MaxSessions:      1000,
+			},
+		},
 	}
 }
 
@@ -19,6 +19,10 @@ package config
 
 import (
 	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
 )
 
 // ValidateConfig 验证配置的合法性
@@ -173,6 +177,65 @@ Examples:
 		return fmt.Errorf("security.resource_limits.max_result_size_mb must be positive")
 	}
 
+	if cfg.Security.Redaction.Enabled {
+		for _, detector := range cfg.Security.Redaction.Detectors {
+			switch detector {
+			case "email", "phone", "cn_id", "credit_card":
+			default:
+				return fmt.Errorf("security.redaction.detectors: unknown detector '%s'", detector)
+			}
+		}
+		for _, custom := range cfg.Security.Redaction.CustomPatterns {
+			if custom.Name == "" {
+				return fmt.Errorf("security.redaction.custom_patterns: name cannot be empty")
+			}
+			if _, err := regexp.Compile(custom.Pattern); err != nil {
+				return fmt.Errorf("security.redaction.custom_patterns.%s: %v", custom.Name, err)
+			}
+		}
+		for _, column := range cfg.Security.Redaction.Columns {
+			if _, err := path.Match(column, ""); err != nil {
+				return fmt.Errorf("security.redaction.columns: invalid pattern '%s'", column)
+			}
+		}
+	}
+
+	if cfg.Security.RBAC.Enabled {
+		if err := validateRBAC(cfg.Security.RBAC); err != nil {
+			return fmt.Errorf("security.rbac: %v", err)
+		}
+	}
+
+	if cfg.Security.InjectionGuard.Enabled {
+		if err := validateInjectionGuard(cfg.Security.InjectionGuard); err != nil {
+			return fmt.Errorf("security.injection_guard.%v", err)
+		}
+	}
+
+	guardNames := make(map[string]bool)
+	for i, guard := range cfg.Security.Guards {
+		if guard.Name == "" {
+			return fmt.Errorf("security.guards[%d].name cannot be empty", i)
+		}
+		if guardNames[guard.Name] {
+			return fmt.Errorf("security.guards[%d]: duplicate guard '%s'", i, guard.Name)
+		}
+		guardNames[guard.Name] = true
+		switch guard.Mode {
+		case "", "enforce", "monitor":
+		default:
+			return fmt.Errorf("security.guards[%d].mode must be 'enforce' or 'monitor', got '%s'", i, guard.Mode)
+		}
+	}
+
+	if cfg.Security.Masking.Enabled {
+		for i, policy := range cfg.Security.Masking.Policies {
+			if err := validateMaskingPolicy(policy); err != nil {
+				return fmt.Errorf("security.masking.policies[%d]: %v", i, err)
+			}
+		}
+	}
+
 	// 验证执行配置
 	switch cfg.Execution.IsolationLevel {
 	case "none", "basic", "full":
@@ -233,12 +296,57 @@ Examples:
 			return fmt.Errorf("audit.level must be 'none', 'basic', or 'detailed'")
 		}
 		switch cfg.Audit.Storage.Type {
-		case "file", "console":
+		case "file", "sqlite", "memory", "console":
+		default:
+			return fmt.Errorf("audit.storage.type must be 'file', 'sqlite', 'memory', or 'console'")
+		}
+		if (cfg.Audit.Storage.Type == "file" || cfg.Audit.Storage.Type == "sqlite") && cfg.Audit.Storage.Path == "" {
+			return fmt.Errorf("audit.storage.path cannot be empty when type is '%s'", cfg.Audit.Storage.Type)
+		}
+		if cfg.Audit.Storage.MemorySize < 0 {
+			return fmt.Errorf("audit.storage.memory_size cannot be negative")
+		}
+		rotation := cfg.Audit.Storage.Rotation
+		if rotation.MaxSizeMB < 0 || rotation.MaxAgeDays < 0 || rotation.MaxBackups < 0 {
+			return fmt.Errorf("audit.storage.rotation values cannot be negative")
+		}
+		switch cfg.Audit.Storage.Fsync {
+		case "", "always", "interval", "never":
+		default:
+			return fmt.Errorf("audit.storage.fsync must be 'always', 'interval', or 'never'")
+		}
+		if cfg.Audit.Integrity.HMACKeyFile != "" {
+			if _, err := cfg.Audit.Integrity.LoadKey(); err != nil {
+				return fmt.Errorf("audit.integrity.hmac_key_file: %v", err)
+			}
+		}
+		if cfg.Audit.Queue.Size < 0 {
+			return fmt.Errorf("audit.queue.size cannot be negative")
+		}
+		switch cfg.Audit.Queue.Overflow {
+		case "", "block", "drop", "spill":
 		default:
-			return fmt.Errorf("audit.storage.type must be 'file' or 'console'")
+			return fmt.Errorf("audit.queue.overflow must be 'block', 'drop', or 'spill'")
+		}
+		// 内存和控制台存储没有审计目录，共用临时目录会回放其他进程的记录
+		if cfg.Audit.Queue.Overflow == "spill" && cfg.Audit.Queue.SpillPath == "" &&
+			cfg.Audit.Storage.Type != "file" && cfg.Audit.Storage.Type != "sqlite" {
+			return fmt.Errorf("audit.queue.spill_path is required when overflow is 'spill' and audit.storage.type is '%s'", cfg.Audit.Storage.Type)
+		}
+		if cfg.Audit.Queue.BlockTimeout != "" {
+			if _, err := parseDuration(cfg.Audit.Queue.BlockTimeout); err != nil {
+				return fmt.Errorf("audit.queue.block_timeout: %v", err)
+			}
 		}
-		if cfg.Audit.Storage.Type == "file" && cfg.Audit.Storage.Path == "" {
-			return fmt.Errorf("audit.storage.path cannot be empty when type is 'file'")
+		for i, exporter := range cfg.Audit.Exporters {
+			if err := validateAuditExporter(exporter); err != nil {
+				return fmt.Errorf("audit.exporters[%d]: %v", i, err)
+			}
+		}
+		if cfg.Audit.Storage.FsyncInterval != "" {
+			if _, err := parseDuration(cfg.Audit.Storage.FsyncInterval); err != nil {
+				return fmt.Errorf("audit.storage.fsync_interval: %v", err)
+			}
 		}
 	}
 
@@ -254,6 +362,18 @@ Examples:
 			return fmt.Errorf("performance.batch_processing.flush_interval: %v", err)
 		}
 	}
+	admission := cfg.Performance.Admission
+	if admission.QueueSize < 0 || admission.BatchQueueSize < 0 {
+		return fmt.Errorf("performance.admission.queue_size and batch_queue_size cannot be negative")
+	}
+	if admission.BatchQueueSize > admission.QueueSize {
+		return fmt.Errorf("performance.admission.batch_queue_size cannot exceed queue_size")
+	}
+	if admission.QueueTimeout != "" {
+		if _, err := parseDuration(admission.QueueTimeout); err != nil {
+			return fmt.Errorf("performance.admission.queue_timeout: %v", err)
+		}
+	}
 	if cfg.Performance.Compression.Enabled {
 		switch cfg.Performance.Compression.Algorithm {
 		case "zlib", "gzip", "none":
@@ -297,5 +417,429 @@ Examples:
 		return fmt.Errorf("logging.file.path cannot be empty when output is 'file'")
 	}
 
+	// 验证身份认证配置
+	if cfg.Authentication.Enabled {
+		if err := validateAuthentication(cfg.Authentication); err != nil {
+			return fmt.Errorf("authentication.%v", err)
+		}
+	}
+
+	// 验证限流配置
+	if cfg.RateLimit.Enabled {
+		if err := validateRateLimit(cfg.RateLimit); err != nil {
+			return fmt.Errorf("rate_limit.%v", err)
+		}
+	}
+
+	// 验证多租户配置
+	if cfg.MultiTenancy.Enabled {
+		if err := validateMultiTenancy(cfg); err != nil {
+			return fmt.Errorf("multi_tenancy.%v", err)
+		}
+	}
+
+	// 验证 HTTPS 配置
+	if cfg.Server.TLS.Enabled {
+		if err := validateServerTLS(cfg.Server.TLS); err != nil {
+			return fmt.Errorf("server.tls.%v", err)
+		}
+	}
+
+	// 验证 MCP 请求限制
+	mcp := cfg.Server.MCP
+	if mcp.MaxRequestBytes < 0 {
+		return fmt.Errorf("server.mcp.max_request_bytes must be non-negative")
+	}
+	if mcp.MaxBatchSize < 0 {
+		return fmt.Errorf("server.mcp.max_batch_size must be non-negative")
+	}
+	if mcp.BatchConcurrency < 0 {
+		return fmt.Errorf("server.mcp.batch_concurrency must be non-negative")
+	}
+	if mcp.MaxSessions < 0 {
+		return fmt.Errorf("server.mcp.max_sessions must be non-negative")
+	}
+
+	return nil
+}
+
+var apiKeyHashPattern = regexp.MustCompile(`^sha256\$[0-9a-f]{32}\$[0-9a-f]{64}$`)
+
+func validateAuthentication(auth AuthenticationConfig) error {
+	if auth.HeaderName == "" {
+		return fmt.Errorf("header_name cannot be empty")
+	}
+	if auth.Token == "" && len(auth.APIKeys) == 0 && !auth.JWT.Enabled {
+		return fmt.Errorf("api_keys cannot be empty when authentication is enabled")
+	}
+	if auth.JWT.Enabled {
+		if err := validateJWT(auth.JWT); err != nil {
+			return fmt.Errorf("jwt.%v", err)
+		}
+	}
+
+	for _, scope := range auth.AnonymousScopes {
+		switch scope {
+		case "execute", "schema", "audit", "admin":
+		default:
+			return fmt.Errorf("anonymous_scopes: unsupported scope '%s'", scope)
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, key := range auth.APIKeys {
+		if key.Name == "" {
+			return fmt.Errorf("api_keys[%d].name cannot be empty", i)
+		}
+		if names[key.Name] {
+			return fmt.Errorf("api_keys[%d]: duplicate key '%s'", i, key.Name)
+		}
+		names[key.Name] = true
+
+		if !apiKeyHashPattern.MatchString(key.Hash) {
+			return fmt.Errorf("api_keys[%d].hash must have the form sha256$<salt>$<digest>", i)
+		}
+		if len(key.Scopes) == 0 {
+			return fmt.Errorf("api_keys[%d].scopes cannot be empty", i)
+		}
+		for _, scope := range key.Scopes {
+			switch scope {
+			case "execute", "schema", "audit", "admin":
+			default:
+				return fmt.Errorf("api_keys[%d]: unsupported scope '%s'", i, scope)
+			}
+		}
+		if key.ExpiresAt != "" {
+			if _, err := time.Parse(time.RFC3339, key.ExpiresAt); err != nil {
+				return fmt.Errorf("api_keys[%d].expires_at: %v", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validateJWT(jwt JWTConfig) error {
+	if jwt.JWKSFile == "" && jwt.JWKSURL == "" {
+		return fmt.Errorf("jwks_file or jwks_url is required")
+	}
+	if jwt.JWKSURL != "" && !strings.HasPrefix(jwt.JWKSURL, "https://") && !strings.HasPrefix(jwt.JWKSURL, "http://") {
+		return fmt.Errorf("jwks_url must be an http(s) URL")
+	}
+	if jwt.Issuer == "" {
+		return fmt.Errorf("issuer cannot be empty")
+	}
+	if len(jwt.Audiences) == 0 {
+		return fmt.Errorf("audiences cannot be empty")
+	}
+	for _, alg := range jwt.Algorithms {
+		switch alg {
+		case "RS256", "RS384", "RS512", "ES256", "ES384", "ES512":
+		default:
+			return fmt.Errorf("unsupported algorithm '%s'", alg)
+		}
+	}
+	for _, scope := range jwt.DefaultScopes {
+		switch scope {
+		case "execute", "schema", "audit", "admin":
+		default:
+			return fmt.Errorf("default_scopes: unsupported scope '%s'", scope)
+		}
+	}
+	for name, value := range map[string]string{"cache_ttl": jwt.CacheTTL, "clock_skew": jwt.ClockSkew} {
+		if value != "" {
+			if _, err := parseDuration(value); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// tlsCipherSuites 允许配置的 TLS 1.2 套件，仅包含前向安全的 AEAD 套件
+var tlsCipherSuites = map[string]bool{
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256":       true,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384":       true,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256": true,
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":         true,
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":         true,
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256":   true,
+}
+
+func validateServerTLS(t ServerTLSConfig) error {
+	if t.CertFile == "" || t.KeyFile == "" {
+		return fmt.Errorf("cert_file and key_file are required")
+	}
+	switch t.MinVersion {
+	case "", "1.2", "1.3":
+	default:
+		return fmt.Errorf("min_version must be '1.2' or '1.3'")
+	}
+	for _, suite := range t.CipherSuites {
+		if !tlsCipherSuites[suite] {
+			return fmt.Errorf("cipher_suites: unsupported cipher suite '%s'", suite)
+		}
+	}
+	if t.ReloadInterval != "" {
+		if _, err := parseDuration(t.ReloadInterval); err != nil {
+			return fmt.Errorf("reload_interval: %v", err)
+		}
+	}
+
+	client := t.ClientAuth
+	switch client.Mode {
+	case "", "none":
+		return nil
+	case "optional", "required":
+	default:
+		return fmt.Errorf("client_auth.mode must be 'none', 'optional' or 'required'")
+	}
+	if client.CAFile == "" {
+		return fmt.Errorf("client_auth.ca_file is required when client_auth is enabled")
+	}
+	switch client.UserField {
+	case "", "cn", "email", "dns", "uri":
+	default:
+		return fmt.Errorf("client_auth.user_field must be one of: cn, email, dns, uri")
+	}
+	if client.RolesField != "" && client.RolesField != "ou" {
+		return fmt.Errorf("client_auth.roles_field must be 'ou' or empty")
+	}
+	if client.TenantField != "" && client.TenantField != "o" {
+		return fmt.Errorf("client_auth.tenant_field must be 'o' or empty")
+	}
+	for _, scope := range client.Scopes {
+		switch scope {
+		case "execute", "schema", "audit", "admin":
+		default:
+			return fmt.Errorf("client_auth.scopes: unsupported scope '%s'", scope)
+		}
+	}
+	return nil
+}
+
+func validateRateLimit(rl RateLimitConfig) error {
+	for i, rule := range rl.Rules {
+		switch rule.Scope {
+		case "user", "tenant", "api_key":
+		default:
+			return fmt.Errorf("rules[%d].scope must be 'user', 'tenant' or 'api_key'", i)
+		}
+		if _, err := path.Match(rule.Match, ""); err != nil {
+			return fmt.Errorf("rules[%d].match: invalid pattern '%s'", i, rule.Match)
+		}
+		if rule.RequestsPerSecond < 0 || rule.Burst < 0 {
+			return fmt.Errorf("rules[%d]: requests_per_second and burst cannot be negative", i)
+		}
+		if rule.DailyQueries < 0 || rule.DailyRows < 0 {
+			return fmt.Errorf("rules[%d]: daily quotas cannot be negative", i)
+		}
+		if rule.DailyDBTime != "" {
+			if _, err := parseDuration(rule.DailyDBTime); err != nil {
+				return fmt.Errorf("rules[%d].daily_db_time: %v", i, err)
+			}
+		}
+	}
+	if rl.Endpoint.RequestsPerSecond < 0 || rl.Endpoint.Burst < 0 {
+		return fmt.Errorf("endpoint: requests_per_second and burst cannot be negative")
+	}
+	if rl.PersistInterval != "" {
+		if _, err := parseDuration(rl.PersistInterval); err != nil {
+			return fmt.Errorf("persist_interval: %v", err)
+		}
+	}
+	return nil
+}
+
+var tenantNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+func validateMultiTenancy(cfg *Config) error {
+	if len(cfg.MultiTenancy.Tenants) == 0 {
+		return fmt.Errorf("tenants cannot be empty")
+	}
+
+	names := make(map[string]bool)
+	for i, tenant := range cfg.MultiTenancy.Tenants {
+		// 租户名用于审计路径，只允许字母、数字、下划线和连字符
+		if !tenantNamePattern.MatchString(tenant.Name) {
+			return fmt.Errorf("tenants[%d].name '%s' must contain only letters, digits, '_' or '-'", i, tenant.Name)
+		}
+		if names[tenant.Name] {
+			return fmt.Errorf("tenants[%d]: duplicate tenant '%s'", i, tenant.Name)
+		}
+		names[tenant.Name] = true
+
+		derived, err := cfg.ForTenant(tenant.Name)
+		if err != nil {
+			return fmt.Errorf("tenants[%d]: %v", i, err)
+		}
+		if err := ValidateConfig(derived); err != nil {
+			return fmt.Errorf("tenants[%d] (%s): %v", i, tenant.Name, err)
+		}
+	}
+
+	if cfg.MultiTenancy.DefaultTenant != "" && !names[cfg.MultiTenancy.DefaultTenant] {
+		return fmt.Errorf("default_tenant '%s' is not defined", cfg.MultiTenancy.DefaultTenant)
+	}
+	return nil
+}
+
+// validateAuditExporter 验证单个审计导出器配置
+func validateAuditExporter(exporter AuditExporterConfig) error {
+	switch exporter.Type {
+	case "syslog":
+		switch exporter.Network {
+		case "udp", "tcp", "tls":
+		default:
+			return fmt.Errorf("syslog network must be 'udp', 'tcp', or 'tls'")
+		}
+		if exporter.Address == "" {
+			return fmt.Errorf("syslog address cannot be empty")
+		}
+		if exporter.Facility < 0 || exporter.Facility > 23 {
+			return fmt.Errorf("syslog facility must be between 0 and 23")
+		}
+	case "otlp", "webhook":
+		if exporter.Endpoint == "" {
+			return fmt.Errorf("%s endpoint cannot be empty", exporter.Type)
+		}
+	default:
+		return fmt.Errorf("type must be 'syslog', 'otlp', or 'webhook'")
+	}
+
+	if exporter.Timeout != "" {
+		if _, err := parseDuration(exporter.Timeout); err != nil {
+			return fmt.Errorf("timeout: %v", err)
+		}
+	}
+	if exporter.QueueSize < 0 {
+		return fmt.Errorf("queue_size cannot be negative")
+	}
+	if exporter.Retry.Enabled {
+		if exporter.Retry.MaxAttempts <= 0 {
+			return fmt.Errorf("retry.max_attempts must be positive when retry is enabled")
+		}
+		if _, err := parseDuration(exporter.Retry.InitialBackoff); err != nil {
+			return fmt.Errorf("retry.initial_backoff: %v", err)
+		}
+		if _, err := parseDuration(exporter.Retry.MaxBackoff); err != nil {
+			return fmt.Errorf("retry.max_backoff: %v", err)
+		}
+		if exporter.Retry.BackoffMultiplier <= 0 {
+			return fmt.Errorf("retry.backoff_multiplier must be positive")
+		}
+	}
+	return nil
+}
+
+func validSeverity(severity string) bool {
+	switch severity {
+	case "low", "medium", "high":
+		return true
+	}
+	return false
+}
+
+func validateInjectionGuard(guard InjectionGuard) error {
+	if guard.BlockSeverity != "" && !validSeverity(guard.BlockSeverity) {
+		return fmt.Errorf("block_severity must be one of: low, medium, high")
+	}
+	names := make(map[string]bool)
+	for i, rule := range guard.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("rules[%d].name cannot be empty", i)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("rules[%d]: duplicate rule '%s'", i, rule.Name)
+		}
+		names[rule.Name] = true
+		if _, err := regexp.Compile(rule.Pattern); err != nil || rule.Pattern == "" {
+			return fmt.Errorf("rules[%d].pattern is not a valid regular expression", i)
+		}
+		if !validSeverity(rule.Severity) {
+			return fmt.Errorf("rules[%d].severity must be one of: low, medium, high", i)
+		}
+	}
+	return nil
+}
+
+func validateRBAC(rbac RBACConfig) error {
+	policy, err := rbac.LoadPolicy()
+	if err != nil {
+		return fmt.Errorf("policy_file: %v", err)
+	}
+
+	roles := make(map[string]bool)
+	for _, role := range policy.Roles {
+		if role.Name == "" {
+			return fmt.Errorf("role name cannot be empty")
+		}
+		if roles[role.Name] {
+			return fmt.Errorf("duplicate role '%s'", role.Name)
+		}
+		roles[role.Name] = true
+
+		for _, grant := range role.Grants {
+			if grant.Table == "" {
+				return fmt.Errorf("role '%s': grant table cannot be empty", role.Name)
+			}
+			for _, pattern := range append([]string{grant.Schema, grant.Table}, grant.Columns...) {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return fmt.Errorf("role '%s': invalid pattern '%s'", role.Name, pattern)
+				}
+			}
+			for _, op := range grant.Operations {
+				switch strings.ToUpper(op) {
+				case "SELECT", "INSERT", "UPDATE", "DELETE":
+				default:
+					return fmt.Errorf("role '%s': unsupported operation '%s'", role.Name, op)
+				}
+			}
+		}
+
+		for table, filter := range role.RowFilters {
+			if table == "" || strings.Count(table, ".") > 1 {
+				return fmt.Errorf("role '%s': invalid row filter table '%s'", role.Name, table)
+			}
+			if strings.TrimSpace(filter) == "" || strings.Contains(filter, ";") {
+				return fmt.Errorf("role '%s': invalid row filter for '%s'", role.Name, table)
+			}
+		}
+	}
+
+	if rbac.DefaultRole != "" && !roles[rbac.DefaultRole] {
+		return fmt.Errorf("default_role '%s' is not defined", rbac.DefaultRole)
+	}
+	for user, userRoles := range policy.Users {
+		for _, role := range userRoles {
+			if !roles[role] {
+				return fmt.Errorf("user '%s': role '%s' is not defined", user, role)
+			}
+		}
+	}
+	return nil
+}
+
+func validateMaskingPolicy(policy MaskingPolicy) error {
+	if policy.Table == "" || policy.Column == "" {
+		return fmt.Errorf("table and column are required")
+	}
+	for _, pattern := range []string{policy.Table, policy.Column} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern '%s'", pattern)
+		}
+	}
+	switch policy.Type {
+	case "redact", "hash":
+	case "partial":
+		if policy.ShowFirst < 0 || policy.ShowLast < 0 {
+			return fmt.Errorf("show_first and show_last cannot be negative")
+		}
+	case "bucket":
+		if policy.BucketSize <= 0 {
+			return fmt.Errorf("bucket_size must be positive")
+		}
+	default:
+		return fmt.Errorf("type must be 'redact', 'partial', 'hash', or 'bucket'")
+	}
 	return nil
 }
@@ -0,0 +1,196 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"text2sql-skill/config"
+)
+
+// AccessPolicy 基于角色的表、列访问策略
+type AccessPolicy struct {
+	roles       map[string][]accessGrant
+	rowFilters  map[string][]rowFilter
+	users       map[string][]string
+	defaultRole string
+}
+
+type accessGrant struct {
+	schema     string
+	table      string
+	columns    []string // nil 表示全部列
+	operations map[string]bool
+}
+
+// NewAccessPolicy 根据 security.rbac 创建访问策略，未启用时返回 nil
+func NewAccessPolicy(cfg config.RBACConfig) (*AccessPolicy, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	policy, err := cfg.LoadPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &AccessPolicy{
+		roles:       make(map[string][]accessGrant),
+		rowFilters:  make(map[string][]rowFilter),
+		users:       policy.Users,
+		defaultRole: cfg.DefaultRole,
+	}
+	for _, role := range policy.Roles {
+		for _, g := range role.Grants {
+			grant := accessGrant{
+				schema:     strings.ToLower(g.Schema),
+				table:      strings.ToLower(g.Table),
+				operations: make(map[string]bool),
+			}
+			for _, column := range g.Columns {
+				grant.columns = append(grant.columns, strings.ToLower(column))
+			}
+			for _, op := range g.Operations {
+				grant.operations[strings.ToUpper(op)] = true
+			}
+			if len(grant.operations) == 0 {
+				grant.operations["SELECT"] = true
+			}
+			p.roles[role.Name] = append(p.roles[role.Name], grant)
+		}
+		if _, ok := p.roles[role.Name]; !ok {
+			p.roles[role.Name] = nil
+		}
+		for table, expr := range role.RowFilters {
+			filter, err := parseRowFilter(table, expr)
+			if err != nil {
+				return nil, fmt.Errorf("role %s: row filter on %s: %v", role.Name, table, err)
+			}
+			p.rowFilters[role.Name] = append(p.rowFilters[role.Name], filter)
+		}
+	}
+	return p, nil
+}
+
+// RolesFor 返回调用方的有效角色：自身携带的角色加上配置绑定的角色，
+// 都没有时使用默认角色
+func (p *AccessPolicy) RolesFor(principal *Principal) []string {
+	seen := make(map[string]bool)
+	var roles []string
+	add := func(names []string) {
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				roles = append(roles, name)
+			}
+		}
+	}
+
+	if principal != nil {
+		add(principal.Roles)
+		add(p.users[principal.User])
+	}
+	if len(roles) == 0 && p.defaultRole != "" {
+		add([]string{p.defaultRole})
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// Authorize 检查角色对解析后 SQL 的访问权限，返回被拒绝的对象
+func (p *AccessPolicy) Authorize(roles []string, analysis *SQLAnalysis) []string {
+	var denied []string
+	seen := make(map[string]bool)
+	deny := func(object string) {
+		if !seen[object] {
+			seen[object] = true
+			denied = append(denied, object)
+		}
+	}
+
+	for _, ref := range analysis.Tables {
+		if _, ok := p.allowedColumns(roles, ref); !ok {
+			if ref.Operation == "SELECT" {
+				deny(ref.QualifiedName())
+			} else {
+				deny(ref.Operation + " " + ref.QualifiedName())
+			}
+		}
+	}
+
+	for _, col := range analysis.Columns {
+		for _, ref := range col.Tables {
+			allowed, ok := p.allowedColumns(roles, ref)
+			if !ok || allowed == nil {
+				// 表本身被拒绝时已记录
+				continue
+			}
+			if col.Star || col.WholeRow {
+				deny(ref.QualifiedName() + ".*")
+				continue
+			}
+			if !matchAny(allowed, col.Name) {
+				deny(ref.QualifiedName() + "." + col.Name)
+			}
+		}
+	}
+	return denied
+}
+
+// allowedColumns 返回角色对表的可访问列；nil 表示全部列，ok 为 false 表示无权访问该表
+func (p *AccessPolicy) allowedColumns(roles []string, ref *SQLTableRef) ([]string, bool) {
+	var columns []string
+	granted := false
+	for _, role := range roles {
+		for _, grant := range p.roles[role] {
+			if !grant.operations[ref.Operation] || !grant.matches(ref) {
+				continue
+			}
+			if grant.columns == nil {
+				return nil, true
+			}
+			granted = true
+			columns = append(columns, grant.columns...)
+		}
+	}
+	return columns, granted
+}
+
+func (g accessGrant) matches(ref *SQLTableRef) bool {
+	if g.schema == "" {
+		if ref.Schema != "" {
+			return false
+		}
+	} else if ok, _ := path.Match(g.schema, ref.Schema); !ok {
+		return false
+	}
+	ok, _ := path.Match(g.table, ref.Name)
+	return ok
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
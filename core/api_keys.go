@@ -0,0 +1,268 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"text2sql-skill/config"
+)
+
+// API key 权限范围
+const (
+	ScopeExecute = "execute"
+	ScopeSchema  = "schema"
+	ScopeAudit   = "audit"
+	ScopeAdmin   = "admin" // 包含其他全部权限
+)
+
+const apiKeyTokenPrefix = "t2s_"
+
+var (
+	// ErrMissingCredentials 请求未携带令牌
+	ErrMissingCredentials = errors.New("missing credentials")
+	// ErrInvalidKey 令牌不匹配任何 API key
+	ErrInvalidKey = errors.New("invalid api key")
+	// ErrKeyExpired API key 已过期
+	ErrKeyExpired = errors.New("api key expired")
+)
+
+// APIKey 已认证的 API key
+type APIKey struct {
+	Name      string
+	Scopes    []string
+	Tenant    string
+	Roles     []string
+	ExpiresAt time.Time // 零值表示不过期
+}
+
+// HasScope 是否拥有指定权限，admin 拥有全部权限
+func (k *APIKey) HasScope(scope string) bool {
+	return hasScope(k.Scopes, scope)
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired 在 now 时是否已过期
+func (k *APIKey) Expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+// KeyStore API key 查找接口，可以替换为数据库、密钥管理服务等外部存储。
+// 实现应以常量时间比较令牌，未找到时返回 ErrInvalidKey。
+type KeyStore interface {
+	LookupKey(token string) (*APIKey, error)
+}
+
+// GenerateAPIKey 生成随机令牌及其加盐哈希，令牌只在生成时可见
+func GenerateAPIKey() (token string, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	token = apiKeyTokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	hash, err = HashAPIKey(token)
+	return token, hash, err
+}
+
+// HashAPIKey 以随机盐计算令牌哈希，格式为 sha256$<salt>$<digest>
+func HashAPIKey(token string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return formatKeyHash(salt, token), nil
+}
+
+func formatKeyHash(salt []byte, token string) string {
+	return "sha256$" + hex.EncodeToString(salt) + "$" + hex.EncodeToString(keyDigest(salt, token))
+}
+
+func keyDigest(salt []byte, token string) []byte {
+	sum := sha256.Sum256(append(append([]byte{}, salt...), token...))
+	return sum[:]
+}
+
+type storedKey struct {
+	key    *APIKey
+	salt   []byte
+	digest []byte
+}
+
+// StaticKeyStore 基于 authentication 配置的 API key 存储
+type StaticKeyStore struct {
+	keys []storedKey
+}
+
+// NewStaticKeyStore 从配置加载 API key。旧配置中的明文 token 作为拥有 admin 权限的 default key
+func NewStaticKeyStore(cfg config.AuthenticationConfig) (*StaticKeyStore, error) {
+	store := &StaticKeyStore{}
+	for _, kc := range cfg.APIKeys {
+		parts := strings.Split(kc.Hash, "$")
+		if len(parts) != 3 || parts[0] != "sha256" {
+			return nil, fmt.Errorf("api key '%s': invalid hash", kc.Name)
+		}
+		salt, err := hex.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("api key '%s': invalid salt", kc.Name)
+		}
+		digest, err := hex.DecodeString(parts[2])
+		if err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("api key '%s': invalid digest", kc.Name)
+		}
+
+		key := &APIKey{Name: kc.Name, Scopes: kc.Scopes, Tenant: kc.Tenant, Roles: kc.Roles}
+		if kc.ExpiresAt != "" {
+			if key.ExpiresAt, err = time.Parse(time.RFC3339, kc.ExpiresAt); err != nil {
+				return nil, fmt.Errorf("api key '%s': %v", kc.Name, err)
+			}
+		}
+		store.keys = append(store.keys, storedKey{key: key, salt: salt, digest: digest})
+	}
+
+	if cfg.Token != "" {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		store.keys = append(store.keys, storedKey{
+			key:    &APIKey{Name: "default", Scopes: []string{ScopeAdmin}},
+			salt:   salt,
+			digest: keyDigest(salt, cfg.Token),
+		})
+	}
+	return store, nil
+}
+
+// LookupKey 依次比较全部 key，不因提前命中而缩短耗时
+func (s *StaticKeyStore) LookupKey(token string) (*APIKey, error) {
+	var found *APIKey
+	for _, stored := range s.keys {
+		if subtle.ConstantTimeCompare(keyDigest(stored.salt, token), stored.digest) == 1 && found == nil {
+			found = stored.key
+		}
+	}
+	if found == nil {
+		return nil, ErrInvalidKey
+	}
+	return found, nil
+}
+
+// Authenticator 校验请求令牌并生成调用方身份
+type Authenticator struct {
+	store        KeyStore
+	jwt          *JWTVerifier
+	validateOnly bool
+	now          func() time.Time
+}
+
+// NewAuthenticator 创建认证器，store 为 nil 时使用配置中的 API key。
+// 启用 jwt 时同时加载 JWKS，JWT 格式的令牌交由 JWTVerifier 校验。
+func NewAuthenticator(cfg config.AuthenticationConfig, store KeyStore) (*Authenticator, error) {
+	if store == nil {
+		static, err := NewStaticKeyStore(cfg)
+		if err != nil {
+			return nil, err
+		}
+		store = static
+	}
+	a := &Authenticator{store: store, validateOnly: cfg.ValidateOnly, now: time.Now}
+	if cfg.JWT.Enabled {
+		verifier, err := NewJWTVerifier(cfg.JWT, nil)
+		if err != nil {
+			return nil, err
+		}
+		a.jwt = verifier
+	}
+	return a, nil
+}
+
+// SetClock 替换过期检查使用的时间源，主要用于测试
+func (a *Authenticator) SetClock(now func() time.Time) {
+	if now == nil {
+		now = time.Now
+	}
+	a.now = now
+	if a.jwt != nil {
+		a.jwt.SetClock(now)
+	}
+}
+
+// Authenticate 校验请求头中的令牌，支持 "Bearer <token>" 形式。
+// validate_only 模式下未携带令牌时返回 nil 身份和 nil key，表示匿名调用。
+func (a *Authenticator) Authenticate(header string) (*Principal, *APIKey, error) {
+	token := strings.TrimSpace(header)
+	if len(token) > 7 && strings.EqualFold(token[:7], "bearer ") {
+		token = strings.TrimSpace(token[7:])
+	}
+	if token == "" {
+		if a.validateOnly {
+			return nil, nil, nil
+		}
+		return nil, nil, ErrMissingCredentials
+	}
+
+	// API key 不含 '.'，三段式令牌按 JWT 处理
+	if a.jwt != nil && strings.Count(token, ".") == 2 {
+		principal, scopes, expiresAt, err := a.jwt.Verify(token)
+		if err != nil {
+			return nil, nil, err
+		}
+		principal.AuthMethod = AuthMethodJWT
+		principal.Scopes = scopes
+		return principal, &APIKey{
+			Name:      principal.User,
+			Scopes:    scopes,
+			Tenant:    principal.Tenant,
+			Roles:     principal.Roles,
+			ExpiresAt: expiresAt,
+		}, nil
+	}
+
+	key, err := a.store.LookupKey(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if key.Expired(a.now()) {
+		return nil, nil, ErrKeyExpired
+	}
+
+	return &Principal{
+		User:       key.Name,
+		Roles:      key.Roles,
+		Tenant:     key.Tenant,
+		Scopes:     key.Scopes,
+		APIKey:     key.Name,
+		AuthMethod: AuthMethodAPIKey,
+	}, key, nil
+}
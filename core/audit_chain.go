@@ -0,0 +1,418 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// auditRecord 是 AuditEntry 的序列化形式，字段顺序必须与 AuditEntry 保持一致，
+// 校验时以原始 JSON 形式保留 Data，避免数值类型在往返解析中发生变化。
+type auditRecord struct {
+	Timestamp time.Time
+	QueryID   string
+	EventType string
+	Data      json.RawMessage
+	Seq       uint64
+	PrevHash  string
+	Hash      string
+}
+
+// auditChain 维护审计记录的序号和哈希链
+type auditChain struct {
+	key      []byte
+	seq      uint64
+	lastHash string
+}
+
+func newAuditChain(key []byte) *auditChain {
+	return &auditChain{key: key}
+}
+
+// auditChainAnchor 由保存链锚点的存储实现，尾部被截断时从锚点继续编号，
+// 使截断在日志中留下序号缺口而不是被新记录覆盖
+type auditChainAnchor interface {
+	chainAnchor() (seq uint64, hash string)
+}
+
+// resume 从已有的最后一条记录继续哈希链
+func (c *auditChain) resume(last *AuditEntry) {
+	if last == nil {
+		return
+	}
+	c.seq = last.Seq
+	c.lastHash = last.Hash
+}
+
+// resumeAnchor 锚点位于已有记录之后时从锚点继续
+func (c *auditChain) resumeAnchor(seq uint64, hash string) {
+	if seq > c.seq {
+		c.seq = seq
+		c.lastHash = hash
+	}
+}
+
+// seal 为记录分配序号、前序哈希并计算本条哈希
+func (c *auditChain) seal(entry *AuditEntry) error {
+	data, err := json.Marshal(entry.Data)
+	if err != nil {
+		return err
+	}
+
+	rec := auditRecord{
+		Timestamp: entry.Timestamp,
+		QueryID:   entry.QueryID,
+		EventType: entry.EventType,
+		Data:      data,
+		Seq:       c.seq + 1,
+		PrevHash:  c.lastHash,
+	}
+	hash, err := hashAuditRecord(rec, c.key)
+	if err != nil {
+		return err
+	}
+
+	c.seq = rec.Seq
+	c.lastHash = hash
+	entry.Seq = rec.Seq
+	entry.PrevHash = rec.PrevHash
+	entry.Hash = hash
+	return nil
+}
+
+// hashAuditRecord 计算记录哈希：配置了密钥时为 HMAC-SHA256，否则为 SHA-256
+func hashAuditRecord(rec auditRecord, key []byte) (string, error) {
+	rec.Hash = ""
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return "", err
+	}
+
+	if len(key) > 0 {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(payload)
+		return hex.EncodeToString(mac.Sum(nil)), nil
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// auditCheckpointFile 审计目录中的链锚点文件
+const auditCheckpointFile = "audit.checkpoint"
+
+// auditCheckpoint 哈希链锚点：保留策略删除的最后一条记录，以及关闭时写入的最后一条记录。
+// 校验时据此发现头部备份被删除和尾部被截断
+type auditCheckpoint struct {
+	PrunedSeq  uint64 `json:"pruned_seq"`
+	PrunedHash string `json:"pruned_hash"`
+	LastSeq    uint64 `json:"last_seq"`
+	LastHash   string `json:"last_hash"`
+	Signature  string `json:"signature"`
+}
+
+// sign 计算检查点签名，密钥规则与记录哈希相同
+func (c auditCheckpoint) sign(key []byte) (string, error) {
+	c.Signature = ""
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	if len(key) > 0 {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(payload)
+		return hex.EncodeToString(mac.Sum(nil)), nil
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// loadAuditCheckpoint 读取目录中的检查点，不存在时返回 nil
+func loadAuditCheckpoint(dir string) (*auditCheckpoint, error) {
+	data, err := os.ReadFile(filepath.Join(dir, auditCheckpointFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var checkpoint auditCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("%s: %w", auditCheckpointFile, err)
+	}
+	return &checkpoint, nil
+}
+
+// saveAuditCheckpoint 签名并原子替换目录中的检查点
+func saveAuditCheckpoint(dir string, checkpoint auditCheckpoint, key []byte) error {
+	signature, err := checkpoint.sign(key)
+	if err != nil {
+		return err
+	}
+	checkpoint.Signature = signature
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, auditCheckpointFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// lastAuditRecord 返回文件中最后一条属于哈希链的记录
+func lastAuditRecord(path string) (*auditRecord, error) {
+	var last *auditRecord
+	err := readAuditRecords(path, func(_ int, _ []byte, rec *auditRecord) {
+		if rec != nil && rec.Seq > 0 {
+			last = rec
+		}
+	})
+	return last, err
+}
+
+// AuditVerifyProblem 校验发现的问题
+type AuditVerifyProblem struct {
+	File   string
+	Line   int
+	Seq    uint64
+	Reason string
+}
+
+func (p AuditVerifyProblem) String() string {
+	return fmt.Sprintf("%s:%d (seq %d): %s", p.File, p.Line, p.Seq, p.Reason)
+}
+
+// AuditVerifyResult 审计日志校验结果
+type AuditVerifyResult struct {
+	Files    []string
+	Entries  int
+	FirstSeq uint64
+	LastSeq  uint64
+	Problems []AuditVerifyProblem
+}
+
+// OK 表示未发现任何篡改、缺失或乱序
+func (r *AuditVerifyResult) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// VerifyAuditLog 校验未签名（SHA-256）审计日志的哈希链
+func VerifyAuditLog(path string) (*AuditVerifyResult, error) {
+	return VerifyAuditLogWithKey(path, nil)
+}
+
+// VerifyAuditLogWithKey 校验审计日志的哈希链。
+//
+// path 可以是审计目录（按时间顺序依次校验轮转备份和当前文件）或单个文件。
+// 校验目录时，第一条记录须紧接检查点中保留策略删除的最后一条记录，没有检查点时
+// 须从序号 1 开始；检查点中关闭时记录的最后一条记录须仍然存在，否则视为尾部被截断。
+// 单个文件只校验文件内部的链。
+func VerifyAuditLogWithKey(path string, key []byte) (*AuditVerifyResult, error) {
+	files, err := auditLogFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &AuditVerifyResult{Files: files}
+	var prev *auditRecord
+
+	var checkpoint *auditCheckpoint
+	checkpointPath := filepath.Join(path, auditCheckpointFile)
+	anchored := false
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		anchored = true
+		if checkpoint, err = loadAuditCheckpoint(path); err != nil {
+			return nil, err
+		}
+	}
+	checkpointProblem := func(seq uint64, reason string) {
+		result.Problems = append(result.Problems, AuditVerifyProblem{File: checkpointPath, Seq: seq, Reason: reason})
+	}
+	if checkpoint != nil {
+		if signature, err := checkpoint.sign(key); err != nil || !hmac.Equal([]byte(signature), []byte(checkpoint.Signature)) {
+			checkpointProblem(checkpoint.LastSeq, "checkpoint signature mismatch: checkpoint modified or signed with a different key")
+		}
+	}
+	lastFound := false
+
+	for _, file := range files {
+		err := readAuditRecords(file, func(line int, raw []byte, rec *auditRecord) {
+			problem := func(reason string) {
+				result.Problems = append(result.Problems, AuditVerifyProblem{
+					File: file, Line: line, Seq: rec.Seq, Reason: reason,
+				})
+			}
+
+			if rec == nil {
+				rec = &auditRecord{}
+				problem("malformed record: " + string(raw))
+				return
+			}
+			result.Entries++
+
+			if rec.Seq == 0 || rec.Hash == "" {
+				problem("record is not part of the hash chain")
+				return
+			}
+
+			if hash, err := hashAuditRecord(*rec, key); err != nil || !hmac.Equal([]byte(hash), []byte(rec.Hash)) {
+				problem("hash mismatch: record modified or signed with a different key")
+			}
+
+			if checkpoint != nil && checkpoint.LastSeq == rec.Seq {
+				lastFound = true
+				if rec.Hash != checkpoint.LastHash {
+					problem("record differs from the checkpoint")
+				}
+			}
+
+			if prev == nil {
+				result.FirstSeq = rec.Seq
+				if anchored {
+					verifyChainHead(rec, checkpoint, problem)
+				}
+			} else {
+				switch {
+				case rec.Seq <= prev.Seq:
+					problem(fmt.Sprintf("sequence out of order: %d after %d", rec.Seq, prev.Seq))
+				case rec.Seq != prev.Seq+1:
+					problem(fmt.Sprintf("sequence gap: %d missing record(s) after %d", rec.Seq-prev.Seq-1, prev.Seq))
+				case rec.PrevHash != prev.Hash:
+					problem("previous hash mismatch: chain broken")
+				}
+			}
+
+			result.LastSeq = rec.Seq
+			prev = rec
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if checkpoint != nil && checkpoint.LastSeq > 0 {
+		switch {
+		case result.LastSeq < checkpoint.LastSeq:
+			checkpointProblem(checkpoint.LastSeq, fmt.Sprintf("tail truncated: log ends at seq %d, checkpoint records seq %d", result.LastSeq, checkpoint.LastSeq))
+		case !lastFound:
+			checkpointProblem(checkpoint.LastSeq, "checkpoint record missing from the log")
+		}
+	}
+
+	return result, nil
+}
+
+// verifyChainHead 校验第一条记录与检查点中已删除的记录相连，没有删除记录时须从序号 1 开始
+func verifyChainHead(rec *auditRecord, checkpoint *auditCheckpoint, problem func(string)) {
+	var prunedSeq uint64
+	var prunedHash string
+	if checkpoint != nil {
+		prunedSeq, prunedHash = checkpoint.PrunedSeq, checkpoint.PrunedHash
+	}
+	switch {
+	case rec.Seq > prunedSeq+1 && prunedSeq == 0:
+		problem(fmt.Sprintf("chain starts at seq %d and no checkpoint records pruned files: %d record(s) missing", rec.Seq, rec.Seq-1))
+	case rec.Seq > prunedSeq+1:
+		problem(fmt.Sprintf("head deleted: %d record(s) missing after checkpoint seq %d", rec.Seq-prunedSeq-1, prunedSeq))
+	case rec.Seq <= prunedSeq:
+		problem(fmt.Sprintf("record seq %d was already pruned at checkpoint seq %d", rec.Seq, prunedSeq))
+	case rec.PrevHash != prunedHash:
+		problem("previous hash mismatch: chain does not continue from the checkpoint")
+	}
+}
+
+// auditLogFiles 返回需要按顺序读取的审计文件
+func auditLogFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	backups, err := listAuditBackups(path, "audit")
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(backups)+1)
+	for i := len(backups) - 1; i >= 0; i-- {
+		files = append(files, backups[i].path)
+	}
+	active := filepath.Join(path, "audit.log")
+	if fileExists(active) {
+		files = append(files, active)
+	}
+	return files, nil
+}
+
+// readAuditRecords 逐行读取审计文件（支持 .gz），无法解析的行以 nil 记录回调
+func readAuditRecords(path string, fn func(line int, raw []byte, rec *auditRecord)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var reader io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := scanner.Bytes()
+		if len(strings.TrimSpace(string(raw))) == 0 {
+			continue
+		}
+		var rec auditRecord
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			fn(line, raw, nil)
+			continue
+		}
+		fn(line, raw, &rec)
+	}
+	return scanner.Err()
+}
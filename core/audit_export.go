@@ -0,0 +1,379 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"text2sql-skill/config"
+)
+
+const (
+	defaultExporterQueueSize = 10000
+	defaultExporterTimeout   = 10 * time.Second
+)
+
+// AuditExporter 将一批审计记录发送到外部系统（SIEM、日志平台等）
+type AuditExporter interface {
+	Name() string
+	Export(ctx context.Context, batch []*AuditEntry) error
+	Close() error
+}
+
+// permanentError 不可重试的导出错误（如 4xx 响应）
+type permanentError struct {
+	err error
+}
+
+func (p *permanentError) Error() string { return p.err.Error() }
+func (p *permanentError) Unwrap() error { return p.err }
+
+// Permanent 将错误标记为不可重试
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// ExporterStats 导出器运行状态
+type ExporterStats struct {
+	Exported uint64 `json:"exported"`
+	Failed   uint64 `json:"failed"`
+	Dropped  uint64 `json:"dropped"`
+	Retries  uint64 `json:"retries"`
+}
+
+// BatchOptions 批量导出参数
+type BatchOptions struct {
+	BatchSize     int
+	FlushInterval time.Duration
+	QueueSize     int
+	Timeout       time.Duration
+	Retry         config.RetryConfig
+}
+
+// BatchOptionsFromConfig 根据 performance.batch_processing 和导出器配置生成批量参数
+func BatchOptionsFromConfig(perf config.BatchProcessing, exporter config.AuditExporterConfig) BatchOptions {
+	opts := BatchOptions{
+		BatchSize:     1,
+		FlushInterval: 0,
+		QueueSize:     exporter.QueueSize,
+		Timeout:       defaultExporterTimeout,
+		Retry:         exporter.Retry,
+	}
+	if perf.Enabled {
+		opts.BatchSize = perf.BatchSize
+		if d, err := time.ParseDuration(perf.FlushInterval); err == nil {
+			opts.FlushInterval = d
+		}
+	}
+	if exporter.Timeout != "" {
+		if d, err := time.ParseDuration(exporter.Timeout); err == nil {
+			opts.Timeout = d
+		}
+	}
+	return opts
+}
+
+// BatchingSink 以 AuditSink 的形式包装导出器：异步排队、按批量大小或刷新间隔发送、失败重试
+type BatchingSink struct {
+	exporter AuditExporter
+	opts     BatchOptions
+	queue    chan *AuditEntry
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	closeMu  sync.RWMutex
+	closed   bool
+
+	exported atomic.Uint64
+	failed   atomic.Uint64
+	dropped  atomic.Uint64
+	retries  atomic.Uint64
+}
+
+func NewBatchingSink(exporter AuditExporter, opts BatchOptions) *BatchingSink {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultExporterQueueSize
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultExporterTimeout
+	}
+
+	b := &BatchingSink{
+		exporter: exporter,
+		opts:     opts,
+		queue:    make(chan *AuditEntry, opts.QueueSize),
+		stopChan: make(chan struct{}),
+	}
+	b.wg.Add(1)
+	go b.run()
+	return b
+}
+
+// Write 将记录放入导出队列，队列满时丢弃并计数，不阻塞主审计流程
+func (b *BatchingSink) Write(entry *AuditEntry) error {
+	b.closeMu.RLock()
+	defer b.closeMu.RUnlock()
+
+	if b.closed {
+		b.dropped.Add(1)
+		return fmt.Errorf("%s exporter closed", b.exporter.Name())
+	}
+
+	select {
+	case b.queue <- entry:
+		return nil
+	default:
+		b.dropped.Add(1)
+		return fmt.Errorf("%s exporter queue full", b.exporter.Name())
+	}
+}
+
+// Stats 返回导出计数
+func (b *BatchingSink) Stats() ExporterStats {
+	return ExporterStats{
+		Exported: b.exported.Load(),
+		Failed:   b.failed.Load(),
+		Dropped:  b.dropped.Load(),
+		Retries:  b.retries.Load(),
+	}
+}
+
+// Name 返回导出器名称
+func (b *BatchingSink) Name() string {
+	return b.exporter.Name()
+}
+
+// Close 发送剩余记录后关闭导出器
+func (b *BatchingSink) Close() error {
+	b.closeMu.Lock()
+	if b.closed {
+		b.closeMu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.closeMu.Unlock()
+
+	close(b.stopChan)
+	b.wg.Wait()
+	return b.exporter.Close()
+}
+
+func (b *BatchingSink) run() {
+	defer b.wg.Done()
+
+	var flush <-chan time.Time
+	if b.opts.FlushInterval > 0 && b.opts.BatchSize > 1 {
+		ticker := time.NewTicker(b.opts.FlushInterval)
+		defer ticker.Stop()
+		flush = ticker.C
+	}
+
+	batch := make([]*AuditEntry, 0, b.opts.BatchSize)
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		b.export(batch)
+		batch = make([]*AuditEntry, 0, b.opts.BatchSize)
+	}
+
+	for {
+		select {
+		case entry := <-b.queue:
+			batch = append(batch, entry)
+			if len(batch) >= b.opts.BatchSize {
+				send()
+			}
+		case <-flush:
+			send()
+		case <-b.stopChan:
+			for {
+				select {
+				case entry := <-b.queue:
+					batch = append(batch, entry)
+					if len(batch) >= b.opts.BatchSize {
+						send()
+					}
+				default:
+					send()
+					return
+				}
+			}
+		}
+	}
+}
+
+// export 按重试策略发送一批记录
+func (b *BatchingSink) export(batch []*AuditEntry) {
+	attempts := 1
+	backoff := 100 * time.Millisecond
+	maxBackoff := 2 * time.Second
+	multiplier := 2.0
+	if retry := b.opts.Retry; retry.Enabled {
+		attempts = retry.MaxAttempts
+		if d, err := time.ParseDuration(retry.InitialBackoff); err == nil {
+			backoff = d
+		}
+		if d, err := time.ParseDuration(retry.MaxBackoff); err == nil {
+			maxBackoff = d
+		}
+		if retry.BackoffMultiplier > 0 {
+			multiplier = retry.BackoffMultiplier
+		}
+	}
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), b.opts.Timeout)
+		err = b.exporter.Export(ctx, batch)
+		cancel()
+		if err == nil {
+			b.exported.Add(uint64(len(batch)))
+			return
+		}
+
+		var perm *permanentError
+		if errors.As(err, &perm) || attempt == attempts {
+			break
+		}
+
+		b.retries.Add(1)
+		select {
+		case <-time.After(backoff):
+		case <-b.stopChan:
+			// 关闭过程中仍按策略重试，但不再等待退避
+		}
+		backoff = time.Duration(float64(backoff) * multiplier)
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+
+	b.failed.Add(uint64(len(batch)))
+	log.Printf("WARN: audit exporter %s failed to export %d entries: %v", b.exporter.Name(), len(batch), err)
+}
+
+// MultiAuditSink 将记录写入主存储并分发给各导出器，查询由主存储负责
+type MultiAuditSink struct {
+	primary AuditSink
+	others  []AuditSink
+}
+
+func NewMultiAuditSink(primary AuditSink, others ...AuditSink) *MultiAuditSink {
+	return &MultiAuditSink{primary: primary, others: others}
+}
+
+// Write 只返回主存储的错误，导出器的丢弃和失败计入各自的 ExporterStats
+func (m *MultiAuditSink) Write(entry *AuditEntry) error {
+	for _, sink := range m.others {
+		sink.Write(entry)
+	}
+	if m.primary == nil {
+		return nil
+	}
+	return m.primary.Write(entry)
+}
+
+func (m *MultiAuditSink) Query(filter AuditFilter) ([]*AuditEntry, error) {
+	querier, ok := m.primary.(AuditQuerier)
+	if !ok {
+		return nil, ErrAuditQueryUnsupported
+	}
+	return querier.Query(filter)
+}
+
+// ExporterStats 返回各导出器的计数
+func (m *MultiAuditSink) chainAnchor() (uint64, string) {
+	if anchor, ok := m.primary.(auditChainAnchor); ok {
+		return anchor.chainAnchor()
+	}
+	return 0, ""
+}
+
+func (m *MultiAuditSink) ExporterStats() map[string]ExporterStats {
+	stats := make(map[string]ExporterStats)
+	for _, sink := range m.others {
+		if b, ok := sink.(*BatchingSink); ok {
+			stats[b.Name()] = b.Stats()
+		}
+	}
+	return stats
+}
+
+func (m *MultiAuditSink) Close() error {
+	var errs []error
+	for _, sink := range m.others {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if m.primary != nil {
+		if err := m.primary.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NewAuditExporters 根据 audit.exporters 创建导出器
+func NewAuditExporters(cfg *config.Config) ([]AuditExporter, error) {
+	var exporters []AuditExporter
+	for i, ec := range cfg.Audit.Exporters {
+		if ec.Name == "" {
+			ec.Name = fmt.Sprintf("%s-%d", ec.Type, i)
+		}
+		if ec.AppName == "" {
+			ec.AppName = cfg.App.Name
+		}
+
+		var exporter AuditExporter
+		var err error
+		switch ec.Type {
+		case "syslog":
+			exporter, err = NewSyslogExporter(ec)
+		case "otlp":
+			exporter, err = NewOTLPExporter(ec)
+		case "webhook":
+			exporter, err = NewWebhookExporter(ec)
+		default:
+			err = fmt.Errorf("unsupported audit exporter type: %s", ec.Type)
+		}
+		if err != nil {
+			for _, created := range exporters {
+				created.Close()
+			}
+			return nil, fmt.Errorf("audit exporter %s: %w", ec.Name, err)
+		}
+		exporters = append(exporters, exporter)
+	}
+	return exporters, nil
+}
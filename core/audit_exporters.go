@@ -0,0 +1,440 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"text2sql-skill/config"
+)
+
+const (
+	syslogFacilityLogAudit = 13
+	syslogSeverityWarning  = 4
+	syslogSeverityInfo     = 6
+
+	// RFC 5424 SD-ID，使用 RFC 5612 保留给文档示例的企业号
+	syslogSDID = "audit@32473"
+
+	WebhookSignatureHeader = "X-Text2SQL-Signature"
+	WebhookTimestampHeader = "X-Text2SQL-Timestamp"
+)
+
+// auditSeverityWarning 需要以告警级别导出的事件
+var auditSeverityWarning = map[string]bool{
+	"rejected":        true,
+	"execution_error": true,
+	"topology_error":  true,
+}
+
+func auditSyslogSeverity(entry *AuditEntry) int {
+	if auditSeverityWarning[entry.EventType] {
+		return syslogSeverityWarning
+	}
+	return syslogSeverityInfo
+}
+
+// buildClientTLSConfig 根据导出器 TLS 配置创建客户端 tls.Config
+func buildClientTLSConfig(cfg config.ExporterTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// SyslogExporter 以 RFC 5424 格式通过 UDP、TCP 或 TLS 发送审计记录。
+// TCP/TLS 使用 RFC 6587 octet-counting 分帧。
+type SyslogExporter struct {
+	mu        sync.Mutex
+	cfg       config.AuditExporterConfig
+	tlsConfig *tls.Config
+	hostname  string
+	conn      net.Conn
+}
+
+func NewSyslogExporter(cfg config.AuditExporterConfig) (*SyslogExporter, error) {
+	if cfg.Facility == 0 {
+		cfg.Facility = syslogFacilityLogAudit
+	}
+
+	exporter := &SyslogExporter{cfg: cfg}
+	exporter.hostname, _ = os.Hostname()
+	if exporter.hostname == "" {
+		exporter.hostname = "-"
+	}
+
+	if cfg.Network == "tls" {
+		tlsConfig, err := buildClientTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		exporter.tlsConfig = tlsConfig
+	}
+	return exporter, nil
+}
+
+func (s *SyslogExporter) Name() string {
+	return s.cfg.Name
+}
+
+func (s *SyslogExporter) Export(ctx context.Context, batch []*AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.connect(ctx); err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		s.conn.SetWriteDeadline(deadline)
+	}
+
+	for _, entry := range batch {
+		msg, err := s.format(entry)
+		if err != nil {
+			return Permanent(err)
+		}
+		if s.cfg.Network != "udp" {
+			msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+		}
+		if _, err := s.conn.Write(msg); err != nil {
+			// 连接异常时丢弃连接，下次重试重新建立
+			s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SyslogExporter) connect(ctx context.Context) error {
+	if s.conn != nil {
+		return nil
+	}
+
+	dialer := &net.Dialer{}
+	var conn net.Conn
+	var err error
+	switch s.cfg.Network {
+	case "tls":
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: s.tlsConfig}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", s.cfg.Address)
+	default:
+		conn, err = dialer.DialContext(ctx, s.cfg.Network, s.cfg.Address)
+	}
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	return nil
+}
+
+// format 生成 RFC 5424 消息：<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD] MSG
+func (s *SyslogExporter) format(entry *AuditEntry) ([]byte, error) {
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	pri := s.cfg.Facility*8 + auditSyslogSeverity(entry)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<%d>1 %s %s %s %d %s [%s query_id=\"%s\" event_type=\"%s\" seq=\"%d\"] ",
+		pri,
+		entry.Timestamp.UTC().Format(time.RFC3339Nano),
+		syslogHeaderField(s.hostname, 255),
+		syslogHeaderField(s.cfg.AppName, 48),
+		os.Getpid(),
+		syslogHeaderField(entry.EventType, 32),
+		syslogSDID,
+		syslogParamValue(entry.QueryID),
+		syslogParamValue(entry.EventType),
+		entry.Seq,
+	)
+	buf.Write(body)
+	return buf.Bytes(), nil
+}
+
+func (s *SyslogExporter) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		err := s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+// syslogHeaderField 头部字段只允许可打印 ASCII，为空时使用 NILVALUE
+func syslogHeaderField(value string, maxLen int) string {
+	var b strings.Builder
+	for _, r := range value {
+		if r > 32 && r < 127 {
+			b.WriteRune(r)
+		}
+		if b.Len() >= maxLen {
+			break
+		}
+	}
+	if b.Len() == 0 {
+		return "-"
+	}
+	return b.String()
+}
+
+// syslogParamValue 转义结构化数据中的 '"', '\' 和 ']'
+func syslogParamValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
+
+// httpExporter OTLP 和 Webhook 导出器共用的 HTTP 发送逻辑
+type httpExporter struct {
+	cfg    config.AuditExporterConfig
+	client *http.Client
+}
+
+func newHTTPExporter(cfg config.AuditExporterConfig) (*httpExporter, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if strings.HasPrefix(cfg.Endpoint, "https://") {
+		tlsConfig, err := buildClientTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	return &httpExporter{cfg: cfg, client: &http.Client{Transport: transport}}, nil
+}
+
+// post 发送请求；4xx（除 408/429）视为不可重试错误
+func (h *httpExporter) post(ctx context.Context, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range h.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("%s returned HTTP %d", h.cfg.Endpoint, resp.StatusCode)
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
+
+func (h *httpExporter) Close() error {
+	h.client.CloseIdleConnections()
+	return nil
+}
+
+// OTLPExporter 以 OTLP/HTTP JSON 编码发送日志记录（POST /v1/logs）
+type OTLPExporter struct {
+	*httpExporter
+}
+
+func NewOTLPExporter(cfg config.AuditExporterConfig) (*OTLPExporter, error) {
+	h, err := newHTTPExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &OTLPExporter{httpExporter: h}, nil
+}
+
+func (o *OTLPExporter) Name() string {
+	return o.cfg.Name
+}
+
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         string         `json:"timeUnixNano"`
+	ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+	SeverityNumber       int            `json:"severityNumber"`
+	SeverityText         string         `json:"severityText"`
+	Body                 otlpAnyValue   `json:"body"`
+	Attributes           []otlpKeyValue `json:"attributes"`
+}
+
+func otlpString(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: &value}}
+}
+
+func otlpInt(key string, value uint64) otlpKeyValue {
+	s := strconv.FormatUint(value, 10)
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{IntValue: &s}}
+}
+
+func (o *OTLPExporter) Export(ctx context.Context, batch []*AuditEntry) error {
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	records := make([]otlpLogRecord, 0, len(batch))
+	for _, entry := range batch {
+		body, err := json.Marshal(entry)
+		if err != nil {
+			return Permanent(err)
+		}
+		bodyStr := string(body)
+
+		// OTLP 严重级别：INFO=9, WARN=13
+		severity, severityText := 9, "INFO"
+		if auditSyslogSeverity(entry) == syslogSeverityWarning {
+			severity, severityText = 13, "WARN"
+		}
+
+		records = append(records, otlpLogRecord{
+			TimeUnixNano:         strconv.FormatInt(entry.Timestamp.UnixNano(), 10),
+			ObservedTimeUnixNano: now,
+			SeverityNumber:       severity,
+			SeverityText:         severityText,
+			Body:                 otlpAnyValue{StringValue: &bodyStr},
+			Attributes: []otlpKeyValue{
+				otlpString("audit.query_id", entry.QueryID),
+				otlpString("audit.event_type", entry.EventType),
+				otlpInt("audit.seq", entry.Seq),
+				otlpString("audit.hash", entry.Hash),
+			},
+		})
+	}
+
+	payload := map[string]interface{}{
+		"resourceLogs": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []otlpKeyValue{otlpString("service.name", o.cfg.AppName)},
+				},
+				"scopeLogs": []interface{}{
+					map[string]interface{}{
+						"scope":      map[string]string{"name": "text2sql-skill/audit"},
+						"logRecords": records,
+					},
+				},
+			},
+		},
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return Permanent(err)
+	}
+	return o.post(ctx, body, nil)
+}
+
+// WebhookExporter 以 JSON 批量推送审计记录，使用 HMAC-SHA256 签名。
+// 签名内容为 "<timestamp>.<body>"，放在 X-Text2SQL-Signature: sha256=<hex> 头中。
+type WebhookExporter struct {
+	*httpExporter
+}
+
+func NewWebhookExporter(cfg config.AuditExporterConfig) (*WebhookExporter, error) {
+	h, err := newHTTPExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &WebhookExporter{httpExporter: h}, nil
+}
+
+func (w *WebhookExporter) Name() string {
+	return w.cfg.Name
+}
+
+func (w *WebhookExporter) Export(ctx context.Context, batch []*AuditEntry) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"source":  w.cfg.AppName,
+		"entries": batch,
+	})
+	if err != nil {
+		return Permanent(err)
+	}
+
+	headers := map[string]string{}
+	if w.cfg.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		headers[WebhookTimestampHeader] = timestamp
+		headers[WebhookSignatureHeader] = "sha256=" + SignWebhookPayload([]byte(w.cfg.Secret), timestamp, body)
+	}
+	return w.post(ctx, body, headers)
+}
+
+// SignWebhookPayload 计算 Webhook 签名，接收方可用于校验
+func SignWebhookPayload(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -18,21 +18,76 @@
 package core
 
 import (
-	"encoding/json"
-	"os"
-	"path/filepath"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"text2sql-skill/config"
 )
 
+const (
+	AuditLevelNone     = "none"
+	AuditLevelBasic    = "basic"
+	AuditLevelDetailed = "detailed"
+
+	OverflowBlock = "block"
+	OverflowDrop  = "drop"
+	OverflowSpill = "spill"
+
+	defaultAuditQueueSize = 1000
+	spillReplayInterval   = time.Second
+)
+
+// basicAuditFields basic 级别保留的字段，其余字段（原始输入、SQL 模板等）仅在 detailed 级别记录
+var basicAuditFields = map[string]bool{
+	"user":            true,
+	"roles":           true,
+	"tenant":          true,
+	"auth_method":     true,
+	"status":          true,
+	"error_code":      true,
+	"reason":          true,
+	"guard":           true,
+	"phase":           true,
+	"action":          true,
+	"mode":            true,
+	"code":            true,
+	"guard_decisions": true,
+	"denied":          true,
+	"error":           true,
+	"row_count":       true,
+	"row_filters":     true,
+	"masked_columns":  true,
+	"retry_after_ms":  true,
+	"queue_wait_ms":   true,
+	"duration_ms":     true,
+	"timeout":         true,
+}
+
 type AuditLogger struct {
 	cfg      *config.Config
 	logChan  chan *AuditEntry
 	stopChan chan struct{}
 	wg       sync.WaitGroup
 	mu       sync.Mutex
+	sink     AuditSink
+	chain    *auditChain
+	spill    *auditSpill
+	redactor *Redactor
+
+	// closeMu 保证 Close 之后不会再有记录进入队列
+	closeMu      sync.RWMutex
+	closed       bool
+	overflow     string
+	blockTimeout time.Duration
+
+	dropped     atomic.Uint64
+	spilled     atomic.Uint64
+	writeErrors atomic.Uint64
 }
 
 type AuditEntry struct {
@@ -40,13 +95,107 @@ type AuditEntry struct {
 	QueryID   string
 	EventType string
 	Data      map[string]interface{}
+	Seq       uint64 // 单调递增序号，用于发现缺失和乱序
+	PrevHash  string // 前一条记录的哈希
+	Hash      string // 本条记录的 SHA-256 或 HMAC-SHA256
+}
+
+// AuditStats 审计队列运行状态，用于健康检查输出
+type AuditStats struct {
+	Level         string `json:"level"`
+	QueueLength   int    `json:"queue_length"`
+	QueueCapacity int    `json:"queue_capacity"`
+	Overflow      string `json:"overflow_policy"`
+	Dropped       uint64 `json:"dropped"`
+	Spilled       uint64 `json:"spilled"`
+	WriteErrors   uint64 `json:"write_errors"`
+
+	Exporters map[string]ExporterStats `json:"exporters,omitempty"`
+	Tenants   map[string]AuditStats    `json:"tenants,omitempty"`
 }
 
 func NewAuditLogger(cfg *config.Config) *AuditLogger {
+	if !cfg.Audit.Enabled {
+		return NewAuditLoggerWithSink(cfg, nil)
+	}
+
+	sink, err := NewAuditSink(cfg)
+	if err != nil {
+		log.Printf("WARN: failed to open audit storage %s at %s: %v", cfg.Audit.Storage.Type, cfg.Audit.Storage.Path, err)
+		sink = nil
+	}
+
+	if len(cfg.Audit.Exporters) > 0 {
+		exporters, err := NewAuditExporters(cfg)
+		if err != nil {
+			log.Printf("WARN: failed to create audit exporters: %v", err)
+		} else {
+			batching := make([]AuditSink, 0, len(exporters))
+			for i, exporter := range exporters {
+				opts := BatchOptionsFromConfig(cfg.Performance.BatchProcessing, cfg.Audit.Exporters[i])
+				batching = append(batching, NewBatchingSink(exporter, opts))
+			}
+			sink = NewMultiAuditSink(sink, batching...)
+		}
+	}
+	return NewAuditLoggerWithSink(cfg, sink)
+}
+
+// NewAuditLoggerWithSink 使用指定的存储后端创建审计日志器
+func NewAuditLoggerWithSink(cfg *config.Config, sink AuditSink) *AuditLogger {
+	queue := cfg.Audit.Queue
+	size := queue.Size
+	if size <= 0 {
+		size = defaultAuditQueueSize
+	}
+
 	logger := &AuditLogger{
 		cfg:      cfg,
-		logChan:  make(chan *AuditEntry, 1000),
+		logChan:  make(chan *AuditEntry, size),
 		stopChan: make(chan struct{}),
+		sink:     sink,
+		overflow: queue.Overflow,
+	}
+	if logger.overflow == "" {
+		logger.overflow = OverflowBlock
+	}
+	if queue.BlockTimeout != "" {
+		if d, err := time.ParseDuration(queue.BlockTimeout); err == nil {
+			logger.blockTimeout = d
+		}
+	}
+
+	redactor, err := NewRedactor(cfg.Security.Redaction)
+	if err != nil {
+		log.Printf("WARN: invalid redaction config, audit entries will not be redacted: %v", err)
+	}
+	logger.redactor = redactor
+
+	key, err := cfg.Audit.Integrity.LoadKey()
+	if err != nil {
+		log.Printf("WARN: failed to load audit HMAC key, falling back to unsigned hash chain: %v", err)
+	}
+	logger.chain = newAuditChain(key)
+
+	// 从存储中的最后一条记录继续哈希链
+	if querier, ok := sink.(AuditQuerier); ok {
+		if last, err := querier.Query(AuditFilter{Limit: 1}); err == nil && len(last) > 0 {
+			logger.chain.resume(last[0])
+		}
+	}
+	if anchor, ok := sink.(auditChainAnchor); ok {
+		logger.chain.resumeAnchor(anchor.chainAnchor())
+	}
+
+	if cfg.Audit.Enabled && logger.overflow == OverflowSpill {
+		if path := spillPath(cfg); path != "" {
+			logger.spill = newAuditSpill(path)
+			// 处理上次进程退出前未回放的溢出记录
+			logger.replaySpill()
+		} else {
+			log.Printf("WARN: audit.queue.spill_path is not set for %s storage, using overflow policy %s", cfg.Audit.Storage.Type, OverflowBlock)
+			logger.overflow = OverflowBlock
+		}
 	}
 
 	if cfg.Audit.Enabled && cfg.Performance.AsyncProcessing {
@@ -54,15 +203,11 @@ func NewAuditLogger(cfg *config.Config) *AuditLogger {
 		go logger.processLogs()
 	}
 
-	if cfg.Audit.Storage.Type == "file" {
-		os.MkdirAll(cfg.Audit.Storage.Path, 0755)
-	}
-
 	return logger
 }
 
 func (a *AuditLogger) LogEvent(queryID string, eventType string, data map[string]interface{}) {
-	if !a.cfg.Audit.Enabled {
+	if !a.cfg.Audit.Enabled || a.cfg.Audit.Level == AuditLevelNone {
 		return
 	}
 
@@ -70,63 +215,219 @@ func (a *AuditLogger) LogEvent(queryID string, eventType string, data map[string
 		Timestamp: time.Now().UTC(),
 		QueryID:   queryID,
 		EventType: eventType,
-		Data:      data,
+		Data:      a.redactor.RedactMap(selectAuditFields(a.cfg.Audit.Level, data)),
 	}
 
-	if a.cfg.Performance.AsyncProcessing {
-		select {
-		case a.logChan <- entry:
-		default:
-			// Channel full, drop entry to prevent blocking
-		}
-	} else {
+	a.closeMu.RLock()
+	defer a.closeMu.RUnlock()
+
+	if a.closed {
+		a.recordDrop(entry, "audit logger closed")
+		return
+	}
+
+	if !a.cfg.Performance.AsyncProcessing {
 		a.processSingleEntry(entry)
+		return
+	}
+
+	select {
+	case a.logChan <- entry:
+		return
+	default:
+	}
+
+	// 队列已满，按溢出策略处理
+	switch a.overflow {
+	case OverflowDrop:
+		a.recordDrop(entry, "audit queue full")
+	case OverflowSpill:
+		if err := a.spill.append(entry); err != nil {
+			a.recordDrop(entry, "audit spill failed: "+err.Error())
+			return
+		}
+		a.spilled.Add(1)
+	default:
+		a.enqueueBlocking(entry)
 	}
 }
 
+// LogEventContext 记录审计事件，并用 context 中调用方身份的 user、roles、tenant、auth_method 补充 data，
+// data 中已有的同名字段优先
+func (a *AuditLogger) LogEventContext(ctx context.Context, queryID string, eventType string, data map[string]interface{}) {
+	if principal := PrincipalFromContext(ctx); principal != nil {
+		fields := principal.auditFields()
+		for key, value := range data {
+			fields[key] = value
+		}
+		data = fields
+	}
+	a.LogEvent(queryID, eventType, data)
+}
+
+func (a *AuditLogger) enqueueBlocking(entry *AuditEntry) {
+	if a.blockTimeout <= 0 {
+		a.logChan <- entry
+		return
+	}
+
+	timer := time.NewTimer(a.blockTimeout)
+	defer timer.Stop()
+	select {
+	case a.logChan <- entry:
+	case <-timer.C:
+		a.recordDrop(entry, "audit queue full after "+a.blockTimeout.String())
+	}
+}
+
+// recordDrop 记录被丢弃的审计事件，保证丢弃行为可观测
+func (a *AuditLogger) recordDrop(entry *AuditEntry, reason string) {
+	n := a.dropped.Add(1)
+	// 避免日志风暴：首次及每 1000 次输出一次
+	if n == 1 || n%1000 == 0 {
+		log.Printf("WARN: audit event dropped (%s): %s/%s, total dropped=%d", reason, entry.QueryID, entry.EventType, n)
+	}
+}
+
+// Stats 返回审计队列和丢弃计数
+func (a *AuditLogger) Stats() AuditStats {
+	stats := AuditStats{
+		Level:         a.cfg.Audit.Level,
+		QueueLength:   len(a.logChan),
+		QueueCapacity: cap(a.logChan),
+		Overflow:      a.overflow,
+		Dropped:       a.dropped.Load(),
+		Spilled:       a.spilled.Load(),
+		WriteErrors:   a.writeErrors.Load(),
+	}
+	if multi, ok := a.sink.(*MultiAuditSink); ok {
+		stats.Exporters = multi.ExporterStats()
+	}
+	return stats
+}
+
 func (a *AuditLogger) processLogs() {
 	defer a.wg.Done()
 
+	var replay <-chan time.Time
+	if a.spill != nil {
+		ticker := time.NewTicker(spillReplayInterval)
+		defer ticker.Stop()
+		replay = ticker.C
+	}
+
 	for {
 		select {
 		case entry := <-a.logChan:
 			a.processSingleEntry(entry)
+		case <-replay:
+			if len(a.logChan) == 0 {
+				a.replaySpill()
+			}
 		case <-a.stopChan:
+			a.drain()
 			return
 		}
 	}
 }
 
-func (a *AuditLogger) processSingleEntry(entry *AuditEntry) {
-	switch a.cfg.Audit.Storage.Type {
-	case "file":
-		a.writeToFile(entry)
-	default:
-		// For sqlite and memory storage types, use file storage as fallback
-		a.writeToFile(entry)
+// drain 在关闭时写完队列和溢出文件中剩余的记录
+func (a *AuditLogger) drain() {
+	for {
+		select {
+		case entry := <-a.logChan:
+			a.processSingleEntry(entry)
+		default:
+			a.replaySpill()
+			return
+		}
 	}
 }
 
-func (a *AuditLogger) writeToFile(entry *AuditEntry) {
+func (a *AuditLogger) replaySpill() {
+	if a.spill == nil {
+		return
+	}
+	err := a.spill.replay(func(entry *AuditEntry) {
+		a.processSingleEntry(entry)
+	}, func(line int, err error) {
+		n := a.dropped.Add(1)
+		log.Printf("WARN: audit event dropped (malformed spill record at %s:%d: %v), total dropped=%d", a.spill.path, line, err, n)
+	})
+	if err != nil {
+		log.Printf("WARN: failed to replay audit spill file: %v", err)
+	}
+}
+
+func (a *AuditLogger) processSingleEntry(entry *AuditEntry) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	day := entry.Timestamp.Format("2006-01-02")
-	filename := filepath.Join(a.cfg.Audit.Storage.Path, "audit_"+day+".log")
+	if err := a.chain.seal(entry); err != nil {
+		a.writeErrors.Add(1)
+		log.Printf("WARN: failed to seal audit entry %s/%s: %v", entry.QueryID, entry.EventType, err)
+		return
+	}
 
-	file, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-	if err != nil {
+	if a.sink == nil {
 		return
 	}
-	defer file.Close()
+	if err := a.sink.Write(entry); err != nil {
+		a.writeErrors.Add(1)
+		log.Printf("WARN: failed to write audit entry %s/%s: %v", entry.QueryID, entry.EventType, err)
+	}
+}
 
-	line, _ := json.Marshal(entry)
-	file.Write(append(line, '\n'))
+// Query 按条件查询审计记录，存储后端不支持查询时返回 ErrAuditQueryUnsupported
+func (a *AuditLogger) Query(filter AuditFilter) ([]*AuditEntry, error) {
+	querier, ok := a.sink.(AuditQuerier)
+	if !ok {
+		return nil, ErrAuditQueryUnsupported
+	}
+	return querier.Query(filter)
 }
 
+// Close 停止接收新记录，写完队列中已缓冲的记录后关闭存储
 func (a *AuditLogger) Close() {
-	if a.cfg.Performance.AsyncProcessing {
+	a.closeMu.Lock()
+	if a.closed {
+		a.closeMu.Unlock()
+		return
+	}
+	a.closed = true
+	a.closeMu.Unlock()
+
+	if a.cfg.Audit.Enabled && a.cfg.Performance.AsyncProcessing {
 		close(a.stopChan)
 		a.wg.Wait()
+	} else {
+		a.replaySpill()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.sink != nil {
+		a.sink.Close()
+	}
+}
+
+// selectAuditFields 按审计级别选择需要记录的字段
+func selectAuditFields(level string, data map[string]interface{}) map[string]interface{} {
+	if level != AuditLevelBasic || data == nil {
+		return data
+	}
+
+	selected := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		if basicAuditFields[key] {
+			selected[key] = value
+		}
+	}
+	// 原始输入只保留长度和摘要，便于关联同一查询
+	if input, ok := data["input"].(string); ok {
+		sum := sha256.Sum256([]byte(input))
+		selected["input_length"] = len(input)
+		selected["input_sha256"] = hex.EncodeToString(sum[:8])
 	}
+	return selected
 }
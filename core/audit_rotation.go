@@ -0,0 +1,520 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"text2sql-skill/config"
+)
+
+const (
+	SyncAlways   = "always"
+	SyncInterval = "interval"
+	SyncNever    = "never"
+
+	backupTimeFormat  = "2006-01-02T15-04-05.000000000"
+	auditWriteBufSize = 64 * 1024
+)
+
+// RotationOptions 滚动文件选项
+type RotationOptions struct {
+	MaxSizeBytes int64         // 单文件最大字节数，0 表示不按大小轮转
+	MaxAge       time.Duration // 备份文件最长保留时间，0 表示不限
+	MaxBackups   int           // 最多保留的备份数，0 表示不限
+	Compress     bool          // 是否 gzip 压缩备份文件
+	SyncPolicy   string        // always, interval, never
+	SyncInterval time.Duration
+	Now          func() time.Time
+	BeforePrune  func(path string) error // 保留策略删除备份前调用，返回错误时停止删除
+}
+
+// RotationOptionsFromConfig 根据审计存储配置生成滚动选项
+func RotationOptionsFromConfig(storage config.AuditStorage) RotationOptions {
+	opts := RotationOptions{
+		MaxSizeBytes: int64(storage.Rotation.MaxSizeMB) * 1024 * 1024,
+		MaxAge:       time.Duration(storage.Rotation.MaxAgeDays) * 24 * time.Hour,
+		MaxBackups:   storage.Rotation.MaxBackups,
+		Compress:     storage.Rotation.Compress,
+		SyncPolicy:   storage.Fsync,
+		SyncInterval: time.Second,
+	}
+	if storage.FsyncInterval != "" {
+		if d, err := time.ParseDuration(storage.FsyncInterval); err == nil && d > 0 {
+			opts.SyncInterval = d
+		}
+	}
+	return opts
+}
+
+// RotatingFile 支持按大小/日期轮转、保留策略和压缩的审计日志文件
+//
+// 当前文件为 <dir>/<prefix>.log，轮转后的备份为
+// <dir>/<prefix>-<timestamp>.log[.gz]，时间戳可按字典序排序。
+type RotatingFile struct {
+	mu       sync.Mutex
+	dir      string
+	prefix   string
+	opts     RotationOptions
+	file     *os.File
+	writer   *bufio.Writer
+	size     int64
+	day      string
+	lastSync time.Time
+	closed   bool
+
+	millCh   chan struct{}
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+func NewRotatingFile(dir, prefix string, opts RotationOptions) (*RotatingFile, error) {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	if opts.SyncPolicy == "" {
+		opts.SyncPolicy = SyncInterval
+	}
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = time.Second
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	r := &RotatingFile{
+		dir:      dir,
+		prefix:   prefix,
+		opts:     opts,
+		millCh:   make(chan struct{}, 1),
+		stopChan: make(chan struct{}),
+	}
+
+	if err := r.openExisting(); err != nil {
+		return nil, err
+	}
+
+	r.wg.Add(1)
+	go r.millLoop()
+
+	if opts.SyncPolicy == SyncInterval {
+		r.wg.Add(1)
+		go r.syncLoop()
+	}
+
+	// 启动时执行一次保留策略，清理历史遗留的备份
+	r.triggerMill()
+
+	return r, nil
+}
+
+// Filename 返回当前活动文件路径
+func (r *RotatingFile) Filename() string {
+	return filepath.Join(r.dir, r.prefix+".log")
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+
+	now := r.opts.Now()
+	if r.file != nil {
+		overSize := r.opts.MaxSizeBytes > 0 && r.size > 0 && r.size+int64(len(p)) > r.opts.MaxSizeBytes
+		dayChanged := r.day != "" && r.day != now.Format("2006-01-02")
+		if overSize || dayChanged {
+			if err := r.rotateLocked(); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if r.file == nil {
+		if err := r.openNew(now); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.writer.Write(p)
+	r.size += int64(n)
+	if err != nil {
+		return n, err
+	}
+
+	switch r.opts.SyncPolicy {
+	case SyncAlways:
+		err = r.syncLocked()
+	case SyncInterval:
+		if now.Sub(r.lastSync) >= r.opts.SyncInterval {
+			err = r.syncLocked()
+		}
+	}
+
+	return n, err
+}
+
+// Sync 将缓冲区写入磁盘并执行 fsync
+func (r *RotatingFile) Sync() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return os.ErrClosed
+	}
+	return r.syncLocked()
+}
+
+// Rotate 立即轮转当前文件
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return os.ErrClosed
+	}
+	return r.rotateLocked()
+}
+
+// Close 刷新并关闭文件，等待后台压缩和清理完成
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	err := r.closeFileLocked()
+	close(r.stopChan)
+	r.mu.Unlock()
+
+	r.wg.Wait()
+	return err
+}
+
+func (r *RotatingFile) openExisting() error {
+	info, err := os.Stat(r.Filename())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(r.Filename(), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	r.file = file
+	r.writer = bufio.NewWriterSize(file, auditWriteBufSize)
+	r.size = info.Size()
+	r.day = info.ModTime().Format("2006-01-02")
+	r.lastSync = r.opts.Now()
+	return nil
+}
+
+func (r *RotatingFile) openNew(now time.Time) error {
+	file, err := os.OpenFile(r.Filename(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	r.file = file
+	r.writer = bufio.NewWriterSize(file, auditWriteBufSize)
+	r.size = 0
+	r.day = now.Format("2006-01-02")
+	r.lastSync = now
+	return nil
+}
+
+func (r *RotatingFile) syncLocked() error {
+	if r.file == nil {
+		return nil
+	}
+	r.lastSync = r.opts.Now()
+	if err := r.writer.Flush(); err != nil {
+		return err
+	}
+	if r.opts.SyncPolicy == SyncNever {
+		return nil
+	}
+	return r.file.Sync()
+}
+
+func (r *RotatingFile) closeFileLocked() error {
+	if r.file == nil {
+		return nil
+	}
+
+	err := r.writer.Flush()
+	if r.opts.SyncPolicy != SyncNever {
+		if syncErr := r.file.Sync(); err == nil {
+			err = syncErr
+		}
+	}
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	r.file = nil
+	r.writer = nil
+	r.size = 0
+	return err
+}
+
+func (r *RotatingFile) rotateLocked() error {
+	if r.file == nil {
+		return nil
+	}
+	if err := r.closeFileLocked(); err != nil {
+		return err
+	}
+
+	backup := r.backupName(r.opts.Now())
+	if err := os.Rename(r.Filename(), backup); err != nil {
+		return fmt.Errorf("rotate audit log: %w", err)
+	}
+
+	r.triggerMill()
+	return nil
+}
+
+func (r *RotatingFile) backupName(t time.Time) string {
+	base := filepath.Join(r.dir, r.prefix+"-"+t.UTC().Format(backupTimeFormat))
+	name := base + ".log"
+	// 同一时刻多次轮转时追加序号，避免覆盖
+	for i := 1; fileExists(name) || fileExists(name+".gz"); i++ {
+		name = fmt.Sprintf("%s.%d.log", base, i)
+	}
+	return name
+}
+
+func (r *RotatingFile) triggerMill() {
+	select {
+	case r.millCh <- struct{}{}:
+	default:
+	}
+}
+
+func (r *RotatingFile) millLoop() {
+	defer r.wg.Done()
+
+	for {
+		select {
+		case <-r.millCh:
+			r.millRun()
+		case <-r.stopChan:
+			// 关闭前处理最后一次挂起的请求
+			select {
+			case <-r.millCh:
+				r.millRun()
+			default:
+			}
+			return
+		}
+	}
+}
+
+func (r *RotatingFile) syncLoop() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.opts.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.mu.Lock()
+			if !r.closed {
+				r.syncLocked()
+			}
+			r.mu.Unlock()
+		case <-r.stopChan:
+			return
+		}
+	}
+}
+
+// backupFile 已轮转的备份文件
+type backupFile struct {
+	path      string
+	timestamp time.Time
+}
+
+// ListBackups 按时间从旧到新列出备份文件
+func (r *RotatingFile) ListBackups() ([]string, error) {
+	backups, err := listAuditBackups(r.dir, r.prefix)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(backups))
+	for i := len(backups) - 1; i >= 0; i-- {
+		paths = append(paths, backups[i].path)
+	}
+	return paths, nil
+}
+
+// listAuditBackups 返回按时间从新到旧排列的备份
+func listAuditBackups(dir, prefix string) ([]backupFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []backupFile
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		ts, ok := parseBackupTime(name, prefix)
+		if !ok {
+			continue
+		}
+		backups = append(backups, backupFile{path: filepath.Join(dir, name), timestamp: ts})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		if backups[i].timestamp.Equal(backups[j].timestamp) {
+			return backups[i].path > backups[j].path
+		}
+		return backups[i].timestamp.After(backups[j].timestamp)
+	})
+	return backups, nil
+}
+
+func parseBackupTime(name, prefix string) (time.Time, bool) {
+	if !strings.HasPrefix(name, prefix+"-") {
+		return time.Time{}, false
+	}
+	rest := strings.TrimPrefix(name, prefix+"-")
+	rest = strings.TrimSuffix(rest, ".gz")
+	if !strings.HasSuffix(rest, ".log") {
+		return time.Time{}, false
+	}
+	rest = strings.TrimSuffix(rest, ".log")
+	if len(rest) < len(backupTimeFormat) {
+		return time.Time{}, false
+	}
+	ts, err := time.Parse(backupTimeFormat, rest[:len(backupTimeFormat)])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return ts, true
+}
+
+func (r *RotatingFile) millRun() {
+	backups, err := listAuditBackups(r.dir, r.prefix)
+	if err != nil {
+		return
+	}
+
+	var keep, prune []backupFile
+	cutoff := r.opts.Now().Add(-r.opts.MaxAge)
+	for i, backup := range backups {
+		expired := r.opts.MaxAge > 0 && backup.timestamp.Before(cutoff)
+		overflow := r.opts.MaxBackups > 0 && i >= r.opts.MaxBackups
+		if expired || overflow {
+			prune = append(prune, backup)
+			continue
+		}
+		keep = append(keep, backup)
+	}
+
+	// 从最旧的备份开始删除，BeforePrune 记录的位置随删除单调推进
+	for i := len(prune) - 1; i >= 0; i-- {
+		if r.opts.BeforePrune != nil {
+			if err := r.opts.BeforePrune(prune[i].path); err != nil {
+				log.Printf("WARN: keeping audit backup %s: %v", prune[i].path, err)
+				break
+			}
+		}
+		os.Remove(prune[i].path)
+	}
+
+	if !r.opts.Compress {
+		return
+	}
+	for _, backup := range keep {
+		if strings.HasSuffix(backup.path, ".log") {
+			compressFile(backup.path)
+		}
+	}
+}
+
+// compressFile 将文件 gzip 压缩为 <src>.gz 并删除原文件
+func compressFile(src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := src + ".gz.tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		gz.Close()
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, src+".gz"); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(src)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
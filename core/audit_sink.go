@@ -0,0 +1,395 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"text2sql-skill/config"
+)
+
+const defaultAuditMemorySize = 10000
+
+// ErrAuditQueryUnsupported 当前审计存储不支持查询
+var ErrAuditQueryUnsupported = errors.New("audit storage does not support queries")
+
+// AuditSink 审计记录的存储后端
+type AuditSink interface {
+	Write(entry *AuditEntry) error
+	Close() error
+}
+
+// AuditQuerier 支持按条件查询的审计存储
+type AuditQuerier interface {
+	Query(filter AuditFilter) ([]*AuditEntry, error)
+}
+
+// AuditFilter 审计查询条件，零值字段表示不过滤
+type AuditFilter struct {
+	QueryID   string    `json:"query_id,omitempty"`
+	EventType string    `json:"event_type,omitempty"`
+	User      string    `json:"user,omitempty"`
+	Status    string    `json:"status,omitempty"`
+	Since     time.Time `json:"since,omitempty"`
+	Until     time.Time `json:"until,omitempty"`
+	Limit     int       `json:"limit,omitempty"`  // 只返回最新的 N 条，0 表示不限
+	Tenant    string    `json:"tenant,omitempty"` // 多租户模式下查询的租户
+}
+
+// Match 判断记录是否满足过滤条件
+func (f AuditFilter) Match(entry *AuditEntry) bool {
+	if f.QueryID != "" && entry.QueryID != f.QueryID {
+		return false
+	}
+	if f.EventType != "" && entry.EventType != f.EventType {
+		return false
+	}
+	if f.User != "" && entry.User() != f.User {
+		return false
+	}
+	if f.Status != "" && entry.Status() != f.Status {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !entry.Timestamp.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// User 返回记录中的调用方用户名
+func (e *AuditEntry) User() string {
+	return entryString(e.Data, "user")
+}
+
+// Status 返回记录中的执行状态
+func (e *AuditEntry) Status() string {
+	return entryString(e.Data, "status")
+}
+
+func entryString(data map[string]interface{}, key string) string {
+	if v, ok := data[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// NewAuditSink 根据 audit.storage.type 创建存储后端
+func NewAuditSink(cfg *config.Config) (AuditSink, error) {
+	storage := cfg.Audit.Storage
+	switch storage.Type {
+	case "file":
+		// 密钥加载失败时审计日志器会给出警告，检查点与哈希链同样退回 SHA-256
+		key, _ := cfg.Audit.Integrity.LoadKey()
+		return NewFileAuditSinkWithKey(storage.Path, RotationOptionsFromConfig(storage), key)
+	case "sqlite":
+		return NewSQLiteAuditSink(SQLiteAuditPath(storage.Path))
+	case "memory":
+		return NewMemoryAuditSink(storage.MemorySize), nil
+	case "console":
+		return NewConsoleAuditSink(os.Stdout), nil
+	default:
+		return nil, fmt.Errorf("unsupported audit storage type: %s", storage.Type)
+	}
+}
+
+// OpenAuditQuerier 以只读方式打开已落盘的审计存储，供离线查询使用
+func OpenAuditQuerier(cfg *config.Config) (AuditQuerier, io.Closer, error) {
+	storage := cfg.Audit.Storage
+	switch storage.Type {
+	case "file":
+		reader := fileAuditReader{dir: storage.Path}
+		return reader, reader, nil
+	case "sqlite":
+		sink, err := NewSQLiteAuditSink(SQLiteAuditPath(storage.Path))
+		if err != nil {
+			return nil, nil, err
+		}
+		return sink, sink, nil
+	default:
+		return nil, nil, fmt.Errorf("audit storage %q cannot be queried offline: %w", storage.Type, ErrAuditQueryUnsupported)
+	}
+}
+
+// SQLiteAuditPath 以 .db/.sqlite 结尾的路径视为数据库文件，否则视为目录
+func SQLiteAuditPath(path string) string {
+	if strings.HasSuffix(path, ".db") || strings.HasSuffix(path, ".sqlite") {
+		return path
+	}
+	return filepath.Join(path, "audit.db")
+}
+
+// ConsoleAuditSink 以 JSON 行输出到控制台
+type ConsoleAuditSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewConsoleAuditSink(w io.Writer) *ConsoleAuditSink {
+	return &ConsoleAuditSink{w: w}
+}
+
+func (c *ConsoleAuditSink) Write(entry *AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = c.w.Write(append(line, '\n'))
+	return err
+}
+
+func (c *ConsoleAuditSink) Close() error {
+	return nil
+}
+
+// MemoryAuditSink 固定容量的内存环形缓冲区，写满后覆盖最旧记录
+type MemoryAuditSink struct {
+	mu      sync.RWMutex
+	entries []*AuditEntry
+	next    int
+	full    bool
+}
+
+func NewMemoryAuditSink(size int) *MemoryAuditSink {
+	if size <= 0 {
+		size = defaultAuditMemorySize
+	}
+	return &MemoryAuditSink{entries: make([]*AuditEntry, size)}
+}
+
+func (m *MemoryAuditSink) Write(entry *AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries[m.next] = entry
+	m.next = (m.next + 1) % len(m.entries)
+	if m.next == 0 {
+		m.full = true
+	}
+	return nil
+}
+
+func (m *MemoryAuditSink) Query(filter AuditFilter) ([]*AuditEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var ordered []*AuditEntry
+	if m.full {
+		ordered = append(ordered, m.entries[m.next:]...)
+	}
+	ordered = append(ordered, m.entries[:m.next]...)
+
+	return filterAuditEntries(ordered, filter), nil
+}
+
+func (m *MemoryAuditSink) Close() error {
+	return nil
+}
+
+// FileAuditSink 基于 RotatingFile 的 JSON 行文件存储。
+// 保留策略删除备份前和关闭时更新目录中的检查点，供校验发现头部删除和尾部截断
+type FileAuditSink struct {
+	file   *RotatingFile
+	reader fileAuditReader
+	dir    string
+	key    []byte
+
+	mu         sync.Mutex
+	checkpoint auditCheckpoint
+}
+
+// NewFileAuditSink 创建文件存储，检查点使用 SHA-256 签名
+func NewFileAuditSink(dir string, opts RotationOptions) (*FileAuditSink, error) {
+	return NewFileAuditSinkWithKey(dir, opts, nil)
+}
+
+// NewFileAuditSinkWithKey 创建文件存储，检查点使用与哈希链相同的 HMAC 密钥签名
+func NewFileAuditSinkWithKey(dir string, opts RotationOptions, key []byte) (*FileAuditSink, error) {
+	sink := &FileAuditSink{reader: fileAuditReader{dir: dir}, dir: dir, key: key}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	checkpoint, err := loadAuditCheckpoint(dir)
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint != nil {
+		sink.checkpoint = *checkpoint
+	}
+
+	opts.BeforePrune = sink.checkpointPruned
+	file, err := NewRotatingFile(dir, "audit", opts)
+	if err != nil {
+		return nil, err
+	}
+	sink.file = file
+	return sink, nil
+}
+
+func (f *FileAuditSink) Write(entry *AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := f.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	if entry.Seq > 0 {
+		f.mu.Lock()
+		f.checkpoint.LastSeq = entry.Seq
+		f.checkpoint.LastHash = entry.Hash
+		f.mu.Unlock()
+	}
+	return nil
+}
+
+// chainAnchor 返回检查点中记录的最后一条记录
+func (f *FileAuditSink) chainAnchor() (uint64, string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.checkpoint.LastSeq, f.checkpoint.LastHash
+}
+
+// checkpointPruned 删除备份前将其中最后一条记录写入检查点
+func (f *FileAuditSink) checkpointPruned(path string) error {
+	last, err := lastAuditRecord(path)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if last != nil && last.Seq > f.checkpoint.PrunedSeq {
+		f.checkpoint.PrunedSeq = last.Seq
+		f.checkpoint.PrunedHash = last.Hash
+	}
+	return saveAuditCheckpoint(f.dir, f.checkpoint, f.key)
+}
+
+func (f *FileAuditSink) Query(filter AuditFilter) ([]*AuditEntry, error) {
+	// 先刷新缓冲区，保证刚写入的记录可见
+	if err := f.file.Sync(); err != nil {
+		return nil, err
+	}
+	return f.reader.Query(filter)
+}
+
+// Close 关闭文件并记录最后一条记录，之后的尾部截断可以被校验发现
+func (f *FileAuditSink) Close() error {
+	err := f.file.Close()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.checkpoint.LastSeq == 0 && f.checkpoint.PrunedSeq == 0 {
+		return err
+	}
+	if saveErr := saveAuditCheckpoint(f.dir, f.checkpoint, f.key); err == nil {
+		err = saveErr
+	}
+	return err
+}
+
+// fileAuditReader 扫描审计目录（含轮转备份）执行查询
+type fileAuditReader struct {
+	dir string
+}
+
+func (r fileAuditReader) Query(filter AuditFilter) ([]*AuditEntry, error) {
+	files, err := auditLogFiles(r.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 从最新的文件开始向前读取，达到 Limit 后停止
+	var result []*AuditEntry
+	for i := len(files) - 1; i >= 0; i-- {
+		var matched []*AuditEntry
+		err := readAuditRecords(files[i], func(_ int, _ []byte, rec *auditRecord) {
+			if rec == nil {
+				return
+			}
+			entry := rec.toEntry()
+			if filter.Match(entry) {
+				matched = append(matched, entry)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		result = append(matched, result...)
+		if filter.Limit > 0 && len(result) >= filter.Limit {
+			break
+		}
+	}
+
+	return applyAuditLimit(result, filter.Limit), nil
+}
+
+func (r fileAuditReader) Close() error {
+	return nil
+}
+
+func filterAuditEntries(entries []*AuditEntry, filter AuditFilter) []*AuditEntry {
+	var result []*AuditEntry
+	for _, entry := range entries {
+		if filter.Match(entry) {
+			result = append(result, entry)
+		}
+	}
+	return applyAuditLimit(result, filter.Limit)
+}
+
+func applyAuditLimit(entries []*AuditEntry, limit int) []*AuditEntry {
+	if limit > 0 && len(entries) > limit {
+		return entries[len(entries)-limit:]
+	}
+	return entries
+}
+
+// toEntry 将序列化记录还原为 AuditEntry
+func (r *auditRecord) toEntry() *AuditEntry {
+	entry := &AuditEntry{
+		Timestamp: r.Timestamp,
+		QueryID:   r.QueryID,
+		EventType: r.EventType,
+		Seq:       r.Seq,
+		PrevHash:  r.PrevHash,
+		Hash:      r.Hash,
+	}
+	if len(r.Data) > 0 {
+		json.Unmarshal(r.Data, &entry.Data)
+	}
+	return entry
+}
@@ -0,0 +1,158 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"text2sql-skill/drivers"
+)
+
+const sqliteAuditSchema = `
+CREATE TABLE IF NOT EXISTS audit_log (
+	seq        INTEGER PRIMARY KEY,
+	ts         INTEGER NOT NULL,
+	query_id   TEXT NOT NULL,
+	event_type TEXT NOT NULL,
+	user       TEXT NOT NULL DEFAULT '',
+	status     TEXT NOT NULL DEFAULT '',
+	data       TEXT,
+	prev_hash  TEXT NOT NULL,
+	hash       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_audit_query_id ON audit_log(query_id);
+CREATE INDEX IF NOT EXISTS idx_audit_ts ON audit_log(ts);
+CREATE INDEX IF NOT EXISTS idx_audit_event_type ON audit_log(event_type);
+`
+
+// SQLiteAuditSink 将审计记录写入 SQLite 数据库
+type SQLiteAuditSink struct {
+	db *sql.DB
+}
+
+func NewSQLiteAuditSink(path string) (*SQLiteAuditSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	db, err := drivers.CreateSQLiteConnection(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(sqliteAuditSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteAuditSink{db: db}, nil
+}
+
+func (s *SQLiteAuditSink) Write(entry *AuditEntry) error {
+	data, err := json.Marshal(entry.Data)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(
+		`INSERT INTO audit_log (seq, ts, query_id, event_type, user, status, data, prev_hash, hash)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.Seq, entry.Timestamp.UnixNano(), entry.QueryID, entry.EventType,
+		entry.User(), entry.Status(), string(data), entry.PrevHash, entry.Hash,
+	)
+	return err
+}
+
+func (s *SQLiteAuditSink) Query(filter AuditFilter) ([]*AuditEntry, error) {
+	var conds []string
+	var args []interface{}
+
+	if filter.QueryID != "" {
+		conds = append(conds, "query_id = ?")
+		args = append(args, filter.QueryID)
+	}
+	if filter.EventType != "" {
+		conds = append(conds, "event_type = ?")
+		args = append(args, filter.EventType)
+	}
+	if filter.User != "" {
+		conds = append(conds, "user = ?")
+		args = append(args, filter.User)
+	}
+	if filter.Status != "" {
+		conds = append(conds, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if !filter.Since.IsZero() {
+		conds = append(conds, "ts >= ?")
+		args = append(args, filter.Since.UnixNano())
+	}
+	if !filter.Until.IsZero() {
+		conds = append(conds, "ts < ?")
+		args = append(args, filter.Until.UnixNano())
+	}
+
+	query := "SELECT seq, ts, query_id, event_type, data, prev_hash, hash FROM audit_log"
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY seq DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		var ts int64
+		var data sql.NullString
+		if err := rows.Scan(&entry.Seq, &ts, &entry.QueryID, &entry.EventType, &data, &entry.PrevHash, &entry.Hash); err != nil {
+			return nil, err
+		}
+		entry.Timestamp = time.Unix(0, ts).UTC()
+		if data.Valid && data.String != "" {
+			json.Unmarshal([]byte(data.String), &entry.Data)
+		}
+		result = append(result, &entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 按时间正序返回
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result, nil
+}
+
+func (s *SQLiteAuditSink) Close() error {
+	return s.db.Close()
+}
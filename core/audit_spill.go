@@ -0,0 +1,121 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"text2sql-skill/config"
+)
+
+// auditSpill 队列满时将审计记录暂存到磁盘，待队列空闲后回放。
+// 回放的记录在写入时才分配序号，因此其序号可能晚于同时段的其他记录。
+type auditSpill struct {
+	mu   sync.Mutex
+	path string
+}
+
+func newAuditSpill(path string) *auditSpill {
+	return &auditSpill{path: path}
+}
+
+// spillPath 返回溢出文件路径，未配置时放在审计目录下；内存和控制台存储须显式配置，
+// 否则返回空字符串
+func spillPath(cfg *config.Config) string {
+	if cfg.Audit.Queue.SpillPath != "" {
+		return cfg.Audit.Queue.SpillPath
+	}
+	switch cfg.Audit.Storage.Type {
+	case "file":
+		return filepath.Join(cfg.Audit.Storage.Path, "audit.spill")
+	case "sqlite":
+		return filepath.Join(filepath.Dir(SQLiteAuditPath(cfg.Audit.Storage.Path)), "audit.spill")
+	default:
+		return ""
+	}
+}
+
+func (s *auditSpill) append(entry *AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// replay 取出溢出文件中的全部记录并逐条回调，完成后删除。
+// 无法解析的行以 malformed 回调，由调用方计入丢弃数
+func (s *auditSpill) replay(fn func(entry *AuditEntry), malformed func(line int, err error)) error {
+	replayPath := s.path + ".replay"
+
+	// 先处理上次未完成的回放文件
+	if !fileExists(replayPath) {
+		s.mu.Lock()
+		err := os.Rename(s.path, replayPath)
+		s.mu.Unlock()
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Open(replayPath)
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			malformed(line, err)
+			continue
+		}
+		entry.Seq, entry.PrevHash, entry.Hash = 0, "", ""
+		fn(&entry)
+	}
+	file.Close()
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return os.Remove(replayPath)
+}
@@ -0,0 +1,175 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import "context"
+
+// GuardPhase 守卫运行的阶段
+type GuardPhase string
+
+const (
+	PhasePreGeneration  GuardPhase = "pre_generation"  // 自然语言输入，生成 SQL 之前
+	PhasePostGeneration GuardPhase = "post_generation" // 生成的 SQL 模板，访问控制之前
+	PhasePreExecution   GuardPhase = "pre_execution"   // 行级安全改写之后、执行之前的 SQL
+	PhasePostResult     GuardPhase = "post_result"     // 脱敏之后的查询结果
+)
+
+// GuardPhases 按执行顺序排列的全部阶段
+var GuardPhases = []GuardPhase{PhasePreGeneration, PhasePostGeneration, PhasePreExecution, PhasePostResult}
+
+// GuardAction 守卫决定的动作
+type GuardAction string
+
+const (
+	ActionAllow   GuardAction = "allow"
+	ActionDeny    GuardAction = "deny"
+	ActionWarn    GuardAction = "warn"    // 放行，决定写入结果元数据和审计
+	ActionRewrite GuardAction = "rewrite" // 用 Decision.Rewrite 替换输入或 SQL 后继续
+)
+
+// 内置守卫名称
+const (
+	GuardSemanticSafety      = "semantic_safety"
+	GuardOperationPermission = "operation_permission"
+	GuardKeywordFilter       = "keyword_filter"
+	GuardResourceControl     = "resource_control"
+	GuardExecutionSafety     = "execution_safety"
+	GuardPromptInjection     = "prompt_injection"
+	GuardCallerIdentity      = "caller_identity"
+)
+
+// Decision 守卫的结构化决定，Code 为机器可读的错误码，会出现在结果元数据和审计中
+type Decision struct {
+	Action  GuardAction `json:"action"`
+	Guard   string      `json:"guard,omitempty"` // 由守卫链填写
+	Code    string      `json:"code,omitempty"`
+	Reason  string      `json:"reason,omitempty"`
+	Rewrite string      `json:"-"`                // pre_generation 替换输入，post_generation、pre_execution 替换 SQL
+	Shadow  bool        `json:"shadow,omitempty"` // monitor 模式下本应生效但未执行的 deny 或 rewrite
+}
+
+// Allow 放行
+func Allow() Decision {
+	return Decision{Action: ActionAllow}
+}
+
+// Deny 拒绝请求
+func Deny(code, reason string) Decision {
+	return Decision{Action: ActionDeny, Code: code, Reason: reason}
+}
+
+// Warn 放行并记录告警
+func Warn(code, reason string) Decision {
+	return Decision{Action: ActionWarn, Code: code, Reason: reason}
+}
+
+// Rewrite 替换当前阶段的输入或 SQL 后继续。post_result 阶段的守卫直接修改 GuardRequest.Rows
+func Rewrite(code, reason, value string) Decision {
+	return Decision{Action: ActionRewrite, Code: code, Reason: reason, Rewrite: value}
+}
+
+// GuardRequest 守卫检查的对象，各阶段填写的字段不同
+type GuardRequest struct {
+	Input     string                   // 自然语言输入，所有阶段可用
+	SQL       string                   // post_generation: 模板；pre_execution: 最终执行的 SQL
+	Args      []interface{}            // pre_execution: 行级安全绑定的参数
+	Rows      []map[string]interface{} // post_result: 查询结果
+	Principal *Principal
+}
+
+// Guard 可插拔守卫。Check 需要并发安全
+type Guard interface {
+	Name() string
+	Phase() GuardPhase
+	Check(ctx context.Context, req *GuardRequest) Decision
+}
+
+// ConfigurableGuard 接收 security.guards 中 settings 的守卫，在注册时调用 Configure
+type ConfigurableGuard interface {
+	Guard
+	Configure(settings map[string]string) error
+}
+
+type funcGuard struct {
+	name  string
+	phase GuardPhase
+	check func(ctx context.Context, req *GuardRequest) Decision
+}
+
+// NewGuardFunc 由函数构造守卫
+func NewGuardFunc(name string, phase GuardPhase, check func(ctx context.Context, req *GuardRequest) Decision) Guard {
+	return &funcGuard{name: name, phase: phase, check: check}
+}
+
+func (f *funcGuard) Name() string      { return f.name }
+func (f *funcGuard) Phase() GuardPhase { return f.phase }
+func (f *funcGuard) Check(ctx context.Context, req *GuardRequest) Decision {
+	return f.check(ctx, req)
+}
+
+// GuardOutcome 一个阶段的检查结果
+type GuardOutcome struct {
+	Denied    *Decision  // 第一个拒绝的决定，nil 表示放行
+	Decisions []Decision // 放行过程中产生的 warn、rewrite 和影子决定
+}
+
+// Allowed 是否放行
+func (o GuardOutcome) Allowed() bool {
+	return o.Denied == nil
+}
+
+// Shadowed 返回 monitor 模式守卫本应拒绝或改写的决定
+func (o GuardOutcome) Shadowed() []Decision {
+	var shadowed []Decision
+	for _, d := range o.Decisions {
+		if d.Shadow {
+			shadowed = append(shadowed, d)
+		}
+	}
+	return shadowed
+}
+
+// GuardStats 单个守卫的运行计数，用于健康检查输出
+type GuardStats struct {
+	Phase           GuardPhase `json:"phase"`
+	Mode            string     `json:"mode"`
+	Checks          uint64     `json:"checks"`
+	Denied          uint64     `json:"denied"`
+	Warned          uint64     `json:"warned"`
+	Rewritten       uint64     `json:"rewritten"`
+	ShadowDenied    uint64     `json:"shadow_denied"`
+	ShadowRewritten uint64     `json:"shadow_rewritten"`
+}
+
+// decisionMaps 把决定转换为审计和元数据使用的结构，便于统一脱敏
+func decisionMaps(decisions []Decision) []map[string]interface{} {
+	maps := make([]map[string]interface{}, 0, len(decisions))
+	for _, d := range decisions {
+		m := map[string]interface{}{
+			"action": string(d.Action),
+			"guard":  d.Guard,
+			"code":   d.Code,
+			"reason": d.Reason,
+		}
+		if d.Shadow {
+			m["shadow"] = true
+		}
+		maps = append(maps, m)
+	}
+	return maps
+}
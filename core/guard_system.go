@@ -19,7 +19,9 @@ package core
 
 import (
 	"context"
+	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"text2sql-skill/config"
@@ -33,52 +35,334 @@ const (
 	GuardL3_KeywordFilter
 	GuardL4_ResourceControl
 	GuardL5_ExecutionSafety
+	GuardL6_PromptInjection
 )
 
 type GuardSystem struct {
 	cfg            *config.Config
 	permissionCtrl *PermissionController
 	executionCtrl  *ExecutionController
+	injectionGuard *InjectionGuard
+
+	mu      sync.RWMutex
+	builtin []Guard
+	custom  []Guard
+	chain   map[GuardPhase][]Guard
+	monitor map[string]bool // monitor 模式的守卫
+
+	statsMu sync.Mutex
+	stats   map[string]*GuardStats
 }
 
 func NewGuardSystem(cfg *config.Config, permCtrl *PermissionController, execCtrl *ExecutionController) *GuardSystem {
-	return &GuardSystem{
+	g := &GuardSystem{
 		cfg:            cfg,
 		permissionCtrl: permCtrl,
 		executionCtrl:  execCtrl,
+		stats:          make(map[string]*GuardStats),
+	}
+	g.builtin = []Guard{
+		NewGuardFunc(GuardSemanticSafety, PhasePreGeneration, g.checkSemanticSafety),
+		NewGuardFunc(GuardOperationPermission, PhasePreGeneration, g.checkOperationPermission),
+		NewGuardFunc(GuardKeywordFilter, PhasePreGeneration, g.checkKeywordFilter),
+		NewGuardFunc(GuardResourceControl, PhasePreGeneration, g.checkResourceControl),
+		NewGuardFunc(GuardExecutionSafety, PhasePreGeneration, g.checkExecutionSafety),
+		NewGuardFunc(GuardPromptInjection, PhasePreGeneration, g.checkPromptInjection),
 	}
+	g.rebuild()
+	return g
 }
 
+// SetInjectionGuard 设置提示词注入检测守卫，nil 表示不检测
+func (g *GuardSystem) SetInjectionGuard(guard *InjectionGuard) {
+	g.injectionGuard = guard
+}
+
+// InjectionGuard 返回提示词注入检测守卫，未启用时返回 nil
+func (g *GuardSystem) InjectionGuard() *InjectionGuard {
+	return g.injectionGuard
+}
+
+// Register 注册自定义守卫。security.guards 中有同名条目时按其配置启用、排序，
+// 并把 settings 传给实现了 ConfigurableGuard 的守卫
+func (g *GuardSystem) Register(guard Guard) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	switch guard.Phase() {
+	case PhasePreGeneration, PhasePostGeneration, PhasePreExecution, PhasePostResult:
+	default:
+		return fmt.Errorf("guard '%s': unknown phase '%s'", guard.Name(), guard.Phase())
+	}
+	for _, existing := range append(g.builtin, g.custom...) {
+		if existing.Name() == guard.Name() {
+			return fmt.Errorf("guard '%s' is already registered", guard.Name())
+		}
+	}
+	if configurable, ok := guard.(ConfigurableGuard); ok {
+		settings := map[string]string{}
+		if entry := g.guardConfig(guard.Name()); entry != nil && entry.Settings != nil {
+			settings = entry.Settings
+		}
+		if err := configurable.Configure(settings); err != nil {
+			return fmt.Errorf("guard '%s': %v", guard.Name(), err)
+		}
+	}
+
+	g.custom = append(g.custom, guard)
+	g.rebuildLocked()
+	return nil
+}
+
+// Chain 返回某阶段按顺序运行的已启用守卫
+func (g *GuardSystem) Chain(phase GuardPhase) []Guard {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return append([]Guard(nil), g.chain[phase]...)
+}
+
+func (g *GuardSystem) guardConfig(name string) *config.GuardConfig {
+	for i := range g.cfg.Security.Guards {
+		if g.cfg.Security.Guards[i].Name == name {
+			return &g.cfg.Security.Guards[i]
+		}
+	}
+	return nil
+}
+
+func (g *GuardSystem) rebuild() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.rebuildLocked()
+}
+
+// rebuildLocked 按 security.guards 的顺序排列守卫，未列出的守卫按默认顺序排在后面，
+// 这样新增的内置守卫不会因为配置中漏写而被关闭
+func (g *GuardSystem) rebuildLocked() {
+	byName := make(map[string]Guard)
+	var all []Guard
+	for _, guard := range append(append([]Guard(nil), g.builtin...), g.custom...) {
+		byName[guard.Name()] = guard
+		all = append(all, guard)
+	}
+
+	var ordered []Guard
+	listed := make(map[string]bool)
+	for _, entry := range g.cfg.Security.Guards {
+		listed[entry.Name] = true
+		if guard, ok := byName[entry.Name]; ok && entry.IsEnabled() {
+			ordered = append(ordered, guard)
+		}
+	}
+	for _, guard := range all {
+		if !listed[guard.Name()] {
+			ordered = append(ordered, guard)
+		}
+	}
+
+	g.chain = make(map[GuardPhase][]Guard)
+	for _, guard := range ordered {
+		g.chain[guard.Phase()] = append(g.chain[guard.Phase()], guard)
+	}
+	g.monitor = make(map[string]bool)
+	for _, entry := range g.cfg.Security.Guards {
+		if entry.IsMonitor() {
+			g.monitor[entry.Name] = true
+		}
+	}
+}
+
+// Mode 返回守卫的运行模式：enforce 或 monitor
+func (g *GuardSystem) Mode(name string) string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.monitor[name] {
+		return "monitor"
+	}
+	return "enforce"
+}
+
+// Stats 返回已启用守卫的运行计数
+func (g *GuardSystem) Stats() map[string]GuardStats {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	g.statsMu.Lock()
+	defer g.statsMu.Unlock()
+
+	stats := make(map[string]GuardStats)
+	for _, phase := range GuardPhases {
+		for _, guard := range g.chain[phase] {
+			var s GuardStats
+			if counted := g.stats[guard.Name()]; counted != nil {
+				s = *counted
+			}
+			s.Phase = phase
+			s.Mode = "enforce"
+			if g.monitor[guard.Name()] {
+				s.Mode = "monitor"
+			}
+			stats[guard.Name()] = s
+		}
+	}
+	return stats
+}
+
+func (g *GuardSystem) record(decision Decision) {
+	g.statsMu.Lock()
+	defer g.statsMu.Unlock()
+
+	s := g.stats[decision.Guard]
+	if s == nil {
+		s = &GuardStats{}
+		g.stats[decision.Guard] = s
+	}
+	s.Checks++
+	switch {
+	case decision.Shadow && decision.Action == ActionDeny:
+		s.ShadowDenied++
+	case decision.Shadow:
+		s.ShadowRewritten++
+	case decision.Action == ActionDeny:
+		s.Denied++
+	case decision.Action == ActionWarn:
+		s.Warned++
+	case decision.Action == ActionRewrite:
+		s.Rewritten++
+	}
+}
+
+// shadowRequest 复制请求供 monitor 模式守卫检查，避免其直接修改参数或结果行
+func shadowRequest(req *GuardRequest) *GuardRequest {
+	copied := *req
+	copied.Args = append([]interface{}(nil), req.Args...)
+	if req.Rows != nil {
+		copied.Rows = make([]map[string]interface{}, len(req.Rows))
+		for i, row := range req.Rows {
+			copiedRow := make(map[string]interface{}, len(row))
+			for k, v := range row {
+				copiedRow[k] = v
+			}
+			copied.Rows[i] = copiedRow
+		}
+	}
+	return &copied
+}
+
+// Run 依次运行某阶段的守卫。rewrite 决定会更新 req 供后续守卫和执行流程使用，
+// 遇到第一个 deny 时停止。monitor 模式守卫的 deny 和 rewrite 只作为影子决定记录
+func (g *GuardSystem) Run(ctx context.Context, phase GuardPhase, req *GuardRequest) GuardOutcome {
+	g.mu.RLock()
+	chain := g.chain[phase]
+	monitor := g.monitor
+	g.mu.RUnlock()
+
+	var outcome GuardOutcome
+	for _, guard := range chain {
+		var decision Decision
+		if monitor[guard.Name()] {
+			decision = guard.Check(ctx, shadowRequest(req))
+			decision.Shadow = decision.Action == ActionDeny || decision.Action == ActionRewrite
+		} else {
+			decision = guard.Check(ctx, req)
+		}
+		decision.Guard = guard.Name()
+		g.record(decision)
+
+		if decision.Shadow {
+			outcome.Decisions = append(outcome.Decisions, decision)
+			continue
+		}
+		switch decision.Action {
+		case ActionDeny:
+			outcome.Denied = &decision
+			return outcome
+		case ActionRewrite:
+			switch phase {
+			case PhasePreGeneration:
+				req.Input = decision.Rewrite
+			case PhasePostGeneration, PhasePreExecution:
+				req.SQL = decision.Rewrite
+			}
+			outcome.Decisions = append(outcome.Decisions, decision)
+		case ActionWarn:
+			outcome.Decisions = append(outcome.Decisions, decision)
+		}
+	}
+	return outcome
+}
+
+// CheckCaller 检查 context 中的调用方身份：启用 require_identity 时拒绝匿名调用
+func (g *GuardSystem) CheckCaller(ctx context.Context) (bool, string) {
+	if g.cfg.Security.RequireIdentity && PrincipalFromContext(ctx) == nil {
+		return false, "L2: caller identity required"
+	}
+	return true, ""
+}
+
+// CheckAllGuards 运行调用方身份检查和 pre_generation 阶段的守卫
 func (g *GuardSystem) CheckAllGuards(ctx context.Context, input string) (bool, string) {
-	inputBytes := []byte(input)
+	if allowed, reason := g.CheckCaller(ctx); !allowed {
+		return false, reason
+	}
+
+	outcome := g.Run(ctx, PhasePreGeneration, &GuardRequest{Input: input, Principal: PrincipalFromContext(ctx)})
+	if !outcome.Allowed() {
+		return false, outcome.Denied.Reason
+	}
+	return true, ""
+}
 
-	// L1: Semantic Safety
-	if !g.permissionCtrl.CheckSemanticSafety(inputBytes) {
-		return false, "L1: semantic safety violation - entropy or ratio out of configured range"
+// L1: Semantic Safety
+func (g *GuardSystem) checkSemanticSafety(_ context.Context, req *GuardRequest) Decision {
+	if !g.permissionCtrl.CheckSemanticSafety([]byte(req.Input)) {
+		return Deny("SEMANTIC_SAFETY", "L1: semantic safety violation - entropy or ratio out of configured range")
 	}
+	return Allow()
+}
 
-	// L2: Operation Permission
-	operation := g.detectOperationType(inputBytes)
+// L2: Operation Permission
+func (g *GuardSystem) checkOperationPermission(_ context.Context, req *GuardRequest) Decision {
+	operation := g.detectOperationType([]byte(req.Input))
 	if !g.permissionCtrl.CheckOperationPermission(operation) {
-		return false, "L2: operation not allowed in current execution mode"
+		return Deny("OPERATION_NOT_ALLOWED", "L2: operation not allowed in current execution mode")
 	}
+	return Allow()
+}
 
-	// L3: Keyword Filter
-	if keyword := g.permissionCtrl.CheckForbiddenKeywords(inputBytes); keyword != "" {
-		return false, "L3: forbidden keyword detected: " + keyword
+// L3: Keyword Filter
+func (g *GuardSystem) checkKeywordFilter(_ context.Context, req *GuardRequest) Decision {
+	if keyword := g.permissionCtrl.CheckForbiddenKeywords([]byte(req.Input)); keyword != "" {
+		return Deny("FORBIDDEN_KEYWORD", "L3: forbidden keyword detected: "+keyword)
 	}
+	return Allow()
+}
 
-	// L4: Resource Control
-	if !g.checkResourceLimits(inputBytes) {
-		return false, "L4: resource limits exceeded"
+// L4: Resource Control
+func (g *GuardSystem) checkResourceControl(_ context.Context, req *GuardRequest) Decision {
+	if !g.checkResourceLimits([]byte(req.Input)) {
+		return Deny("RESOURCE_LIMIT", "L4: resource limits exceeded")
 	}
+	return Allow()
+}
 
-	// L5: Execution Safety
-	if err := g.checkExecutionSafety(ctx); err != nil {
-		return false, "L5: " + err.Error()
+// L5: Execution Safety
+func (g *GuardSystem) checkExecutionSafety(ctx context.Context, _ *GuardRequest) Decision {
+	if err := g.checkDeadline(ctx); err != nil {
+		return Deny("EXECUTION_SAFETY", "L5: "+err.Error())
 	}
+	return Allow()
+}
 
-	return true, ""
+// L6: Prompt Injection，低于拦截级别的命中作为告警
+func (g *GuardSystem) checkPromptInjection(ctx context.Context, req *GuardRequest) Decision {
+	allowed, reason, findings := g.injectionGuard.Check(ctx, req.Input)
+	if !allowed {
+		return Deny("PROMPT_INJECTION", "L6: "+reason)
+	}
+	if len(findings) > 0 {
+		return Warn("PROMPT_INJECTION_SUSPECTED", fmt.Sprintf("L6: suspicious input: %s (%s)", findings[0].Rule, findings[0].Severity))
+	}
+	return Allow()
 }
 
 func (g *GuardSystem) detectOperationType(input []byte) string {
@@ -101,7 +385,7 @@ func (g *GuardSystem) checkResourceLimits(input []byte) bool {
 	return g.executionCtrl.CheckResourceLimits(inputSize, estimatedRows, estimatedMemoryMB)
 }
 
-func (g *GuardSystem) checkExecutionSafety(ctx context.Context) error {
+func (g *GuardSystem) checkDeadline(ctx context.Context) error {
 	if deadline, ok := ctx.Deadline(); ok {
 		remaining := time.Until(deadline)
 		// 解析超时时间，使用总超时的一半作为最小要求
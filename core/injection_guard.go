@@ -0,0 +1,270 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+
+	"text2sql-skill/config"
+)
+
+// Severity 注入检测结果的严重级别
+type Severity int
+
+const (
+	SeverityLow Severity = iota + 1
+	SeverityMedium
+	SeverityHigh
+)
+
+// ParseSeverity 解析 low、medium、high
+func ParseSeverity(s string) (Severity, error) {
+	switch strings.ToLower(s) {
+	case "low":
+		return SeverityLow, nil
+	case "medium":
+		return SeverityMedium, nil
+	case "high":
+		return SeverityHigh, nil
+	}
+	return 0, fmt.Errorf("unknown severity '%s'", s)
+}
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityLow:
+		return "low"
+	case SeverityMedium:
+		return "medium"
+	case SeverityHigh:
+		return "high"
+	}
+	return "none"
+}
+
+// InjectionFinding 一条命中的检测结果
+type InjectionFinding struct {
+	Rule     string
+	Severity Severity
+	Match    string // 命中的文本片段
+}
+
+// InjectionClassifier 注入检测分类器，可接入外部模型或服务。
+// 输入已经过规范化（小写、全角转半角、去除零宽字符、合并空白）。
+type InjectionClassifier interface {
+	Classify(ctx context.Context, input string) ([]InjectionFinding, error)
+}
+
+type injectionRule struct {
+	name     string
+	pattern  *regexp.Regexp
+	severity Severity
+}
+
+// builtinInjectionRules 内置规则，作用于规范化后的输入
+var builtinInjectionRules = []struct {
+	name     string
+	pattern  string
+	severity Severity
+}{
+	// 覆盖先前指令
+	{"instruction_override", `\b(ignore|disregard|forget|override)\b.{0,30}\b(previous|prior|above|earlier|all|any|your|system)\b.{0,20}\b(instructions?|rules?|prompts?|directions?|guidelines?|constraints?)\b`, SeverityHigh},
+	{"instruction_override_zh", `(忽略|无视|忘记|忘掉|不要理会)掉?你?(之前|以上|前面|上面|上述|所有|全部|原有|系统)的?.{0,4}(指令|指示|规则|要求|提示|限制|约束)`, SeverityHigh},
+	// 越狱
+	{"jailbreak", `\b(jailbreak|jailbroken|dan mode|developer mode|do anything now|god mode)\b`, SeverityHigh},
+	{"jailbreak_zh", `(越狱|开发者模式|无限制模式|上帝模式)`, SeverityHigh},
+	// 自然语言中夹带的 SQL 语句
+	{"stacked_statement", `;\s*(drop|delete|truncate|alter|update|insert|create|grant|revoke|exec|execute|shutdown)\b`, SeverityHigh},
+	{"union_select", `\bunion\b\s+(all\s+)?\bselect\b`, SeverityHigh},
+	{"tautology", `['"]\s*or\s+['"]?(\w+)['"]?\s*=\s*['"]?(\w+)`, SeverityHigh},
+	{"sql_comment", `(--\s*$|/\*.*\*/)`, SeverityMedium},
+	// 角色扮演与身份覆盖
+	{"role_override", `\b(you are now|from now on,? you|pretend (to be|you are)|roleplay as|you must now|act as (if you|an? (ai|assistant|dba|admin|administrator|root|superuser|unrestricted)))\b`, SeverityMedium},
+	{"role_override_zh", `(你现在是|从现在开始你|从现在起你|请?你?扮演一个|假装你是|假设你是一个)`, SeverityMedium},
+	// 套取系统提示
+	{"prompt_exfiltration", `\b(reveal|show|print|repeat|output|leak|tell me)\b.{0,20}\b(system prompt|your (instructions|prompt|rules)|initial prompt|hidden prompt)\b`, SeverityMedium},
+	{"prompt_exfiltration_zh", `(输出|显示|打印|告诉我|泄露|重复).{0,10}(系统提示|系统指令|提示词|你的指令|你的规则)`, SeverityMedium},
+	// 提示词分隔符注入
+	{"delimiter_injection", "(```|</?system>|<\\|im_(start|end)\\|>|\\[/?inst\\]|<<sys>>|###\\s*(system|instruction))", SeverityMedium},
+	// 解除限制的措辞
+	{"restriction_bypass", `\b(bypass|circumvent|disable)\b.{0,20}\b(security|safety|filters?|guards?|restrictions?|checks?)\b|\bwithout (any )?(restrictions|limits|filters)\b`, SeverityLow},
+	{"restriction_bypass_zh", `(绕过|绕开|关闭|解除).{0,6}(安全|限制|过滤|检查|防护)`, SeverityLow},
+}
+
+// RuleClassifier 基于正则规则的分类器
+type RuleClassifier struct {
+	rules []injectionRule
+}
+
+// NewRuleClassifier 由内置规则和自定义规则创建分类器，disabled 中的内置规则不启用
+func NewRuleClassifier(custom []config.InjectionRule, disabled []string) (*RuleClassifier, error) {
+	off := make(map[string]bool, len(disabled))
+	for _, name := range disabled {
+		off[name] = true
+	}
+
+	c := &RuleClassifier{}
+	known := make(map[string]bool)
+	for _, rule := range builtinInjectionRules {
+		known[rule.name] = true
+		if off[rule.name] {
+			continue
+		}
+		c.rules = append(c.rules, injectionRule{name: rule.name, pattern: regexp.MustCompile(rule.pattern), severity: rule.severity})
+	}
+	for _, name := range disabled {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown builtin rule '%s'", name)
+		}
+	}
+
+	for _, rule := range custom {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule '%s': %v", rule.Name, err)
+		}
+		severity, err := ParseSeverity(rule.Severity)
+		if err != nil {
+			return nil, fmt.Errorf("rule '%s': %v", rule.Name, err)
+		}
+		c.rules = append(c.rules, injectionRule{name: rule.Name, pattern: pattern, severity: severity})
+	}
+	return c, nil
+}
+
+// Classify 返回所有命中的规则
+func (c *RuleClassifier) Classify(_ context.Context, input string) ([]InjectionFinding, error) {
+	var findings []InjectionFinding
+	for _, rule := range c.rules {
+		if match := rule.pattern.FindString(input); match != "" {
+			findings = append(findings, InjectionFinding{Rule: rule.name, Severity: rule.severity, Match: match})
+		}
+	}
+	return findings, nil
+}
+
+// InjectionGuard 提示词注入检测守卫：依次运行内置规则分类器和注册的外部分类器，
+// 最高严重级别达到 block_severity 时拒绝
+type InjectionGuard struct {
+	blockSeverity Severity
+	failClosed    bool
+
+	mu          sync.RWMutex
+	classifiers []InjectionClassifier
+}
+
+// NewInjectionGuard 创建注入检测守卫，未启用时返回 nil
+func NewInjectionGuard(cfg config.InjectionGuard) (*InjectionGuard, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	guard := &InjectionGuard{blockSeverity: SeverityMedium, failClosed: cfg.FailClosed}
+	if cfg.BlockSeverity != "" {
+		severity, err := ParseSeverity(cfg.BlockSeverity)
+		if err != nil {
+			return nil, err
+		}
+		guard.blockSeverity = severity
+	}
+	rules, err := NewRuleClassifier(cfg.Rules, cfg.DisabledRules)
+	if err != nil {
+		return nil, err
+	}
+	guard.classifiers = []InjectionClassifier{rules}
+	return guard, nil
+}
+
+// AddClassifier 注册外部分类器，在内置规则之后运行
+func (g *InjectionGuard) AddClassifier(classifier InjectionClassifier) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.classifiers = append(g.classifiers, classifier)
+}
+
+// Check 检测输入，返回是否放行、拒绝原因和全部命中结果
+func (g *InjectionGuard) Check(ctx context.Context, input string) (bool, string, []InjectionFinding) {
+	if g == nil {
+		return true, "", nil
+	}
+	normalized := NormalizeInjectionInput(input)
+
+	g.mu.RLock()
+	classifiers := g.classifiers
+	g.mu.RUnlock()
+
+	var findings []InjectionFinding
+	for _, classifier := range classifiers {
+		result, err := classifier.Classify(ctx, normalized)
+		if err != nil {
+			if g.failClosed {
+				return false, "injection classifier unavailable", findings
+			}
+			log.Printf("WARN: 注入检测分类器出错，已跳过: %v", err)
+			continue
+		}
+		findings = append(findings, result...)
+	}
+
+	var worst *InjectionFinding
+	for i := range findings {
+		if worst == nil || findings[i].Severity > worst.Severity {
+			worst = &findings[i]
+		}
+	}
+	if worst == nil {
+		return true, "", nil
+	}
+	if worst.Severity < g.blockSeverity {
+		log.Printf("WARN: 输入命中注入检测规则 %s (%s)，低于拦截级别已放行", worst.Rule, worst.Severity)
+		return true, "", findings
+	}
+	return false, fmt.Sprintf("prompt injection detected: %s (%s)", worst.Rule, worst.Severity), findings
+}
+
+// NormalizeInjectionInput 规范化输入以抵抗简单的混淆：
+// 全角字符转半角，去除零宽字符，转为小写并合并连续空白
+func NormalizeInjectionInput(input string) string {
+	var b strings.Builder
+	b.Grow(len(input))
+	space := false
+	for _, r := range input {
+		switch {
+		case r >= 0xFF01 && r <= 0xFF5E:
+			r -= 0xFEE0
+		case r == 0x3000:
+			r = ' '
+		case r == 0x200B || r == 0x200C || r == 0x200D || r == 0x2060 || r == 0xFEFF:
+			continue
+		}
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			if !space {
+				b.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		space = false
+		b.WriteString(strings.ToLower(string(r)))
+	}
+	return strings.TrimSpace(b.String())
+}
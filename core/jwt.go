@@ -0,0 +1,479 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // RS256 / ES256
+	_ "crypto/sha512" // RS384 / RS512 / ES384 / ES512
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"text2sql-skill/config"
+)
+
+const (
+	defaultJWKSCacheTTL = 10 * time.Minute
+	defaultJWTClockSkew = time.Minute
+	// 未知 kid 触发 JWKS 刷新的最短间隔，防止伪造 kid 频繁请求 IdP
+	minJWKSRefreshInterval = 30 * time.Second
+	maxJWKSSize            = 1 << 20
+)
+
+// ErrInvalidToken JWT 格式、签名或声明校验失败
+var ErrInvalidToken = errors.New("invalid token")
+
+type jwtAlgorithm struct {
+	hash crypto.Hash
+	kty  string // RSA 或 EC
+	size int    // ES 签名中 r、s 各自的字节数
+}
+
+var jwtAlgorithms = map[string]jwtAlgorithm{
+	"RS256": {hash: crypto.SHA256, kty: "RSA"},
+	"RS384": {hash: crypto.SHA384, kty: "RSA"},
+	"RS512": {hash: crypto.SHA512, kty: "RSA"},
+	"ES256": {hash: crypto.SHA256, kty: "EC", size: 32},
+	"ES384": {hash: crypto.SHA384, kty: "EC", size: 48},
+	"ES512": {hash: crypto.SHA512, kty: "EC", size: 66},
+}
+
+// JWTVerifier 校验 JWT 签名和 iss/aud/exp/nbf，并按配置把声明映射为调用方身份
+type JWTVerifier struct {
+	cfg        config.JWTConfig
+	algorithms map[string]bool
+	cacheTTL   time.Duration
+	clockSkew  time.Duration
+	client     *http.Client
+	now        func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// NewJWTVerifier 创建 JWT 校验器并加载 JWKS。client 为 nil 时使用 10 秒超时的默认客户端
+func NewJWTVerifier(cfg config.JWTConfig, client *http.Client) (*JWTVerifier, error) {
+	v := &JWTVerifier{
+		cfg:        cfg,
+		algorithms: make(map[string]bool),
+		cacheTTL:   defaultJWKSCacheTTL,
+		clockSkew:  defaultJWTClockSkew,
+		client:     client,
+		now:        time.Now,
+	}
+	if v.client == nil {
+		v.client = &http.Client{Timeout: 10 * time.Second}
+	}
+	algorithms := cfg.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = []string{"RS256", "ES256"}
+	}
+	for _, alg := range algorithms {
+		if _, ok := jwtAlgorithms[alg]; !ok {
+			return nil, fmt.Errorf("unsupported jwt algorithm '%s'", alg)
+		}
+		v.algorithms[alg] = true
+	}
+	if cfg.CacheTTL != "" {
+		ttl, err := time.ParseDuration(cfg.CacheTTL)
+		if err != nil {
+			return nil, fmt.Errorf("jwt.cache_ttl: %v", err)
+		}
+		v.cacheTTL = ttl
+	}
+	if cfg.ClockSkew != "" {
+		skew, err := time.ParseDuration(cfg.ClockSkew)
+		if err != nil {
+			return nil, fmt.Errorf("jwt.clock_skew: %v", err)
+		}
+		v.clockSkew = skew
+	}
+
+	if err := v.refresh(); err != nil {
+		return nil, fmt.Errorf("jwks: %v", err)
+	}
+	return v, nil
+}
+
+// SetClock 替换校验使用的时间源，主要用于测试
+func (v *JWTVerifier) SetClock(now func() time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if now == nil {
+		now = time.Now
+	}
+	v.now = now
+}
+
+// Verify 校验令牌并返回调用方身份和令牌授予的权限
+func (v *JWTVerifier) Verify(token string) (*Principal, []string, time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, time.Time{}, fmt.Errorf("%w: malformed jwt", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, nil, time.Time{}, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+	// 只接受配置的非对称算法，拒绝 none 和 HS*
+	alg, ok := jwtAlgorithms[header.Alg]
+	if !ok || !v.algorithms[header.Alg] {
+		return nil, nil, time.Time{}, fmt.Errorf("%w: algorithm '%s' not allowed", ErrInvalidToken, header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, time.Time{}, fmt.Errorf("%w: signature encoding", ErrInvalidToken)
+	}
+	key, err := v.key(header.Kid)
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+	if err := verifyJWTSignature(alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, nil, time.Time{}, err
+	}
+
+	claims := make(map[string]interface{})
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, nil, time.Time{}, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+	expiresAt, err := v.checkClaims(claims)
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+
+	principal, scopes, err := v.mapClaims(claims)
+	return principal, scopes, expiresAt, err
+}
+
+func decodeJWTSegment(segment string, dst interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(dst)
+}
+
+func verifyJWTSignature(alg jwtAlgorithm, key crypto.PublicKey, signed, signature []byte) error {
+	h := alg.hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if alg.kty == "RSA" && rsa.VerifyPKCS1v15(pub, alg.hash, digest, signature) == nil {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if alg.kty == "EC" && len(signature) == 2*alg.size && (pub.Curve.Params().BitSize+7)/8 == alg.size {
+			r := new(big.Int).SetBytes(signature[:alg.size])
+			s := new(big.Int).SetBytes(signature[alg.size:])
+			if ecdsa.Verify(pub, digest, r, s) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: signature verification failed", ErrInvalidToken)
+}
+
+// checkClaims 校验 iss、aud、exp、nbf，返回过期时间
+func (v *JWTVerifier) checkClaims(claims map[string]interface{}) (time.Time, error) {
+	v.mu.Lock()
+	now := v.now()
+	v.mu.Unlock()
+
+	if iss, _ := claims["iss"].(string); iss != v.cfg.Issuer {
+		return time.Time{}, fmt.Errorf("%w: unexpected issuer '%s'", ErrInvalidToken, iss)
+	}
+
+	audiences := claimStrings(claims["aud"])
+	matched := false
+	for _, aud := range audiences {
+		for _, want := range v.cfg.Audiences {
+			if aud == want {
+				matched = true
+			}
+		}
+	}
+	if !matched {
+		return time.Time{}, fmt.Errorf("%w: audience not accepted", ErrInvalidToken)
+	}
+
+	exp, ok := claimTime(claims["exp"])
+	if !ok {
+		return time.Time{}, fmt.Errorf("%w: missing exp", ErrInvalidToken)
+	}
+	if !now.Before(exp.Add(v.clockSkew)) {
+		return time.Time{}, fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	if nbf, ok := claimTime(claims["nbf"]); ok && now.Add(v.clockSkew).Before(nbf) {
+		return time.Time{}, fmt.Errorf("%w: token not yet valid", ErrInvalidToken)
+	}
+	return exp, nil
+}
+
+// mapClaims 按 claims 配置生成调用方身份
+func (v *JWTVerifier) mapClaims(claims map[string]interface{}) (*Principal, []string, error) {
+	mapping := v.cfg.Claims
+	userClaim := mapping.User
+	if userClaim == "" {
+		userClaim = "sub"
+	}
+	rolesClaim := mapping.Roles
+	if rolesClaim == "" {
+		rolesClaim = "roles"
+	}
+	scopesClaim := mapping.Scopes
+	if scopesClaim == "" {
+		scopesClaim = "scope"
+	}
+
+	user, _ := lookupClaim(claims, userClaim).(string)
+	if user == "" {
+		return nil, nil, fmt.Errorf("%w: missing user claim '%s'", ErrInvalidToken, userClaim)
+	}
+	principal := &Principal{
+		User:  user,
+		Roles: claimStrings(lookupClaim(claims, rolesClaim)),
+	}
+	if mapping.Tenant != "" {
+		principal.Tenant, _ = lookupClaim(claims, mapping.Tenant).(string)
+	}
+	for name, claim := range mapping.Attributes {
+		if value := lookupClaim(claims, claim); value != nil {
+			if principal.Attributes == nil {
+				principal.Attributes = make(map[string]string)
+			}
+			principal.Attributes[name] = fmt.Sprint(value)
+		}
+	}
+
+	var scopes []string
+	for _, scope := range claimStrings(lookupClaim(claims, scopesClaim)) {
+		switch scope {
+		case ScopeExecute, ScopeSchema, ScopeAudit, ScopeAdmin:
+			scopes = append(scopes, scope)
+		}
+	}
+	if lookupClaim(claims, scopesClaim) == nil {
+		scopes = v.cfg.DefaultScopes
+		if len(scopes) == 0 {
+			scopes = []string{ScopeExecute}
+		}
+	}
+	return principal, scopes, nil
+}
+
+// lookupClaim 先按完整名称查找（兼容 URL 形式的声明名），再按 a.b.c 路径查找
+func lookupClaim(claims map[string]interface{}, name string) interface{} {
+	if value, ok := claims[name]; ok {
+		return value
+	}
+	var current interface{} = claims
+	for _, part := range strings.Split(name, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		if current, ok = object[part]; !ok {
+			return nil
+		}
+	}
+	return current
+}
+
+// claimStrings 把字符串数组或空格、逗号分隔的字符串转换为列表
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return strings.FieldsFunc(v, func(r rune) bool { return r == ' ' || r == ',' })
+	case []interface{}:
+		var list []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func claimTime(value interface{}) (time.Time, bool) {
+	number, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), true
+}
+
+// key 返回 kid 对应的公钥。缓存过期时刷新；未知 kid 时在限定频率内强制刷新以支持密钥轮换
+func (v *JWTVerifier) key(kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	now := v.now()
+	stale := now.Sub(v.fetchedAt) >= v.cacheTTL
+	key, found := v.lookupKeyLocked(kid)
+	canRefresh := now.Sub(v.fetchedAt) >= minJWKSRefreshInterval
+	v.mu.Unlock()
+
+	if stale || !found && canRefresh {
+		if err := v.refresh(); err != nil && !found {
+			return nil, fmt.Errorf("%w: jwks: %v", ErrInvalidToken, err)
+		}
+		v.mu.Lock()
+		key, found = v.lookupKeyLocked(kid)
+		v.mu.Unlock()
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: unknown key id '%s'", ErrInvalidToken, kid)
+	}
+	return key, nil
+}
+
+func (v *JWTVerifier) lookupKeyLocked(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	key, ok := v.keys[kid]
+	return key, ok
+}
+
+// refresh 重新加载 JWKS，失败时保留原有密钥
+func (v *JWTVerifier) refresh() error {
+	var data []byte
+	var err error
+	if v.cfg.JWKSFile != "" {
+		data, err = os.ReadFile(v.cfg.JWKSFile)
+	} else {
+		data, err = v.fetchJWKS()
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.fetchedAt = v.now()
+	if err != nil {
+		return err
+	}
+
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return err
+	}
+	v.keys = keys
+	return nil
+}
+
+func (v *JWTVerifier) fetchJWKS() ([]byte, error) {
+	resp, err := v.client.Get(v.cfg.JWKSURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", v.cfg.JWKSURL, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+}
+
+// ParseJWKS 解析 JWKS 文档中的 RSA 和 EC 签名公钥，按 kid 索引
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.Kty {
+		case "RSA":
+			n, err1 := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, err2 := base64.RawURLEncoding.DecodeString(jwk.E)
+			if err1 != nil || err2 != nil || len(e) == 0 || len(e) > 4 {
+				return nil, fmt.Errorf("key '%s': invalid RSA parameters", jwk.Kid)
+			}
+			keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch jwk.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				return nil, fmt.Errorf("key '%s': unsupported curve '%s'", jwk.Kid, jwk.Crv)
+			}
+			x, err1 := base64.RawURLEncoding.DecodeString(jwk.X)
+			y, err2 := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("key '%s': invalid EC parameters", jwk.Kid)
+			}
+			pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+			if !curve.IsOnCurve(pub.X, pub.Y) {
+				return nil, fmt.Errorf("key '%s': point is not on curve", jwk.Kid)
+			}
+			keys[jwk.Kid] = pub
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing keys")
+	}
+	return keys, nil
+}
@@ -0,0 +1,317 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"text2sql-skill/config"
+)
+
+const maskedValue = "****"
+
+// Masker 按调用方角色对结果列脱敏
+type Masker struct {
+	policies []*maskPolicy
+}
+
+type maskPolicy struct {
+	schema    string
+	table     string
+	column    string
+	typ       string
+	showFirst int
+	showLast  int
+	bucket    float64
+	salt      string
+	unmasked  map[string]bool
+}
+
+// NewMasker 根据 security.masking 创建脱敏器，未启用时返回 nil
+func NewMasker(cfg config.MaskingConfig) (*Masker, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	m := &Masker{}
+	for _, p := range cfg.Policies {
+		policy := &maskPolicy{
+			column:    strings.ToLower(p.Column),
+			typ:       p.Type,
+			showFirst: p.ShowFirst,
+			showLast:  p.ShowLast,
+			bucket:    p.BucketSize,
+			salt:      p.Salt,
+			unmasked:  make(map[string]bool),
+		}
+		table := strings.ToLower(p.Table)
+		if i := strings.Index(table, "."); i >= 0 {
+			policy.schema, policy.table = table[:i], table[i+1:]
+		} else {
+			policy.table = table
+		}
+		if policy.typ == "partial" && policy.showFirst == 0 && policy.showLast == 0 {
+			policy.showLast = 4
+		}
+		if policy.typ == "bucket" && policy.bucket <= 0 {
+			return nil, fmt.Errorf("masking policy %s.%s: bucket_size must be positive", p.Table, p.Column)
+		}
+		for _, role := range p.UnmaskedRoles {
+			policy.unmasked[role] = true
+		}
+		m.policies = append(m.policies, policy)
+	}
+	return m, nil
+}
+
+// appliesTo 调用方的任一角色在 unmasked_roles 中时不脱敏
+func (p *maskPolicy) appliesTo(roles []string) bool {
+	for _, role := range roles {
+		if p.unmasked[role] {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesTable 未指定 schema 的规则匹配任意 schema；指定 schema 时同时匹配未限定 schema 的引用
+func (p *maskPolicy) matchesTable(ref *SQLTableRef) bool {
+	if ok, _ := path.Match(p.table, ref.Name); !ok {
+		return false
+	}
+	if p.schema == "" || ref.Schema == "" {
+		return true
+	}
+	ok, _ := path.Match(p.schema, ref.Schema)
+	return ok
+}
+
+func (p *maskPolicy) matchesColumn(name string) bool {
+	ok, _ := path.Match(p.column, strings.ToLower(name))
+	return ok
+}
+
+// mask 对单个值脱敏
+func (p *maskPolicy) mask(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	switch p.typ {
+	case "partial":
+		return maskPartial(fmt.Sprint(value), p.showFirst, p.showLast)
+	case "hash":
+		sum := sha256.Sum256([]byte(p.salt + fmt.Sprint(value)))
+		return hex.EncodeToString(sum[:8])
+	case "bucket":
+		var number float64
+		switch v := value.(type) {
+		case int64:
+			number = float64(v)
+		case float64:
+			number = v
+		default:
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(fmt.Sprint(v)), 64)
+			if err != nil {
+				return maskedValue
+			}
+			number = parsed
+		}
+		low := math.Floor(number/p.bucket) * p.bucket
+		return fmt.Sprintf("%s-%s", strconv.FormatFloat(low, 'f', -1, 64), strconv.FormatFloat(low+p.bucket, 'f', -1, 64))
+	default:
+		return maskedValue
+	}
+}
+
+func maskPartial(value string, first, last int) string {
+	runes := []rune(value)
+	if first+last >= len(runes) {
+		// 值太短时整体遮盖，避免泄露全部内容
+		return strings.Repeat("*", len(runes))
+	}
+	masked := make([]rune, len(runes))
+	for i, r := range runes {
+		if i < first || i >= len(runes)-last {
+			masked[i] = r
+		} else {
+			masked[i] = '*'
+		}
+	}
+	return string(masked)
+}
+
+// MaskPlan 一次查询的脱敏计划：按输出列位置或列名脱敏
+type MaskPlan struct {
+	byPosition map[int]*maskPolicy
+	byName     []*maskPolicy
+}
+
+// Plan 根据解析后的 SQL 生成脱敏计划。被脱敏的列只能作为最外层选择列表中的单独一项，
+// 出现在表达式、过滤、连接、排序或内层查询中时返回错误，避免通过计算或比较推断原值。
+// 内层查询中的 * 会把脱敏列带入派生表，外层对同名列的引用同样按上述规则处理。
+// 整行引用和列别名清单无法按列追踪，涉及脱敏表时直接拒绝。
+func (m *Masker) Plan(roles []string, analysis *SQLAnalysis) (*MaskPlan, error) {
+	plan := &MaskPlan{byPosition: make(map[int]*maskPolicy)}
+	var tainted []*maskPolicy
+
+	for _, ref := range analysis.Tables {
+		if ref.Renamed && len(m.tablePolicies(roles, ref)) > 0 {
+			return nil, fmt.Errorf("column alias list on masked table %s is not supported", ref.QualifiedName())
+		}
+	}
+
+	for _, col := range analysis.Columns {
+		if col.WholeRow {
+			for _, ref := range col.Tables {
+				if len(m.tablePolicies(roles, ref)) > 0 {
+					return nil, fmt.Errorf("whole-row reference %s to masked table %s is not supported", col.Name, ref.QualifiedName())
+				}
+			}
+			continue
+		}
+		if col.Star {
+			for _, ref := range col.Tables {
+				policies := m.tablePolicies(roles, ref)
+				if col.TopLevel {
+					plan.byName = append(plan.byName, policies...)
+				} else {
+					tainted = append(tainted, policies...)
+				}
+			}
+			continue
+		}
+
+		for _, ref := range col.Tables {
+			if policy := m.columnPolicy(roles, ref, col.Name); policy != nil {
+				if err := plan.addColumn(col, policy, ref.QualifiedName()+"."+col.Name); err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+	}
+
+	// 经由 CTE 或派生表传递的脱敏列
+	if len(tainted) > 0 && analysis.Renamed {
+		return nil, fmt.Errorf("column alias list on a subquery with masked columns is not supported")
+	}
+	for _, col := range analysis.Columns {
+		if !col.Virtual {
+			continue
+		}
+		if col.WholeRow {
+			if len(tainted) > 0 {
+				return nil, fmt.Errorf("whole-row reference %s to a subquery with masked columns is not supported", col.Name)
+			}
+			continue
+		}
+		if col.Star {
+			if col.TopLevel {
+				plan.byName = append(plan.byName, tainted...)
+			}
+			continue
+		}
+		for _, policy := range tainted {
+			if policy.matchesColumn(col.Name) {
+				if err := plan.addColumn(col, policy, col.Name); err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+	}
+
+	if analysis.SetOp && !plan.Empty() {
+		return nil, fmt.Errorf("masked columns cannot be combined with UNION, INTERSECT or EXCEPT")
+	}
+	return plan, nil
+}
+
+func (m *Masker) tablePolicies(roles []string, ref *SQLTableRef) []*maskPolicy {
+	var policies []*maskPolicy
+	for _, policy := range m.policies {
+		if policy.appliesTo(roles) && policy.matchesTable(ref) {
+			policies = append(policies, policy)
+		}
+	}
+	return policies
+}
+
+func (m *Masker) columnPolicy(roles []string, ref *SQLTableRef, column string) *maskPolicy {
+	for _, policy := range m.tablePolicies(roles, ref) {
+		if policy.matchesColumn(column) {
+			return policy
+		}
+	}
+	return nil
+}
+
+func (plan *MaskPlan) addColumn(col SQLColumnRef, policy *maskPolicy, name string) error {
+	if col.OutputPosition == 0 {
+		return fmt.Errorf("masked column %s can only be selected directly", name)
+	}
+	plan.byPosition[col.OutputPosition-1] = policy
+	return nil
+}
+
+// Empty 是否不需要脱敏
+func (plan *MaskPlan) Empty() bool {
+	return plan == nil || len(plan.byPosition) == 0 && len(plan.byName) == 0
+}
+
+// policyFor 返回结果第 index 列（列名 name）的脱敏规则
+func (plan *MaskPlan) policyFor(index int, name string) *maskPolicy {
+	if plan.Empty() {
+		return nil
+	}
+	if policy, ok := plan.byPosition[index]; ok {
+		return policy
+	}
+	for _, policy := range plan.byName {
+		if policy.matchesColumn(name) {
+			return policy
+		}
+	}
+	return nil
+}
+
+// MaskedColumns 返回结果中被脱敏的列名
+func (plan *MaskPlan) MaskedColumns(columns []string) []string {
+	var masked []string
+	for i, name := range columns {
+		if plan.policyFor(i, name) != nil {
+			masked = append(masked, name)
+		}
+	}
+	return masked
+}
+
+// Apply 对一行结果按列位置脱敏
+func (plan *MaskPlan) Apply(columns []string, values []interface{}) {
+	for i, name := range columns {
+		if policy := plan.policyFor(i, name); policy != nil && i < len(values) {
+			values[i] = policy.mask(values[i])
+		}
+	}
+}
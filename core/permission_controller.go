@@ -18,6 +18,7 @@
 package core
 
 import (
+	"fmt"
 	"math"
 	"strings"
 	"unicode"
@@ -27,7 +28,9 @@ import (
 )
 
 type PermissionController struct {
-	cfg *config.Config
+	cfg    *config.Config
+	policy *AccessPolicy
+	masker *Masker
 }
 
 func NewPermissionController(cfg *config.Config) *PermissionController {
@@ -51,6 +54,106 @@ func (p *PermissionController) CheckOperationPermission(operation string) bool {
 	}
 }
 
+// SetAccessPolicy 设置基于角色的访问策略，nil 表示不做表、列级检查
+func (p *PermissionController) SetAccessPolicy(policy *AccessPolicy) {
+	p.policy = policy
+}
+
+// SetMasker 设置列脱敏策略，nil 表示不脱敏
+func (p *PermissionController) SetMasker(masker *Masker) {
+	p.masker = masker
+}
+
+// RolesFor 返回调用方的有效角色：启用访问策略时按策略解析，否则使用调用方自带的角色
+func (p *PermissionController) RolesFor(principal *Principal) []string {
+	if p.policy != nil {
+		return p.policy.RolesFor(principal)
+	}
+	if principal != nil {
+		return principal.Roles
+	}
+	return nil
+}
+
+// PlanMasking 根据调用方角色生成结果脱敏计划，返回 nil 表示不需要脱敏
+func (p *PermissionController) PlanMasking(principal *Principal, query string) (*MaskPlan, error) {
+	if p.masker == nil {
+		return nil, nil
+	}
+
+	analysis, err := AnalyzeSQL(query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot analyze generated SQL: %v", err)
+	}
+	plan, err := p.masker.Plan(p.RolesFor(principal), analysis)
+	if err != nil || plan.Empty() {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// CheckSQLAccess 检查调用方对生成 SQL 中表和列的访问权限，返回被拒绝的对象。
+// SQL 无法解析时返回错误，调用方应拒绝执行。
+func (p *PermissionController) CheckSQLAccess(principal *Principal, query string) ([]string, error) {
+	if p.policy == nil {
+		return nil, nil
+	}
+
+	analysis, err := AnalyzeSQL(query)
+	if err != nil {
+		return nil, fmt.Errorf("cannot analyze generated SQL: %v", err)
+	}
+	roles := p.policy.RolesFor(principal)
+	if len(roles) == 0 {
+		return nil, fmt.Errorf("no role assigned")
+	}
+	return p.policy.Authorize(roles, analysis), nil
+}
+
+// FilterSchema 去掉调用方角色无权查询的表和列
+func (p *PermissionController) FilterSchema(principal *Principal, tables []TableSchema) []TableSchema {
+	if p.policy == nil {
+		return tables
+	}
+
+	roles := p.policy.RolesFor(principal)
+	var visible []TableSchema
+	for _, table := range tables {
+		allowed, ok := p.policy.allowedColumns(roles, &SQLTableRef{Name: table.Name, Operation: "SELECT"})
+		if !ok {
+			continue
+		}
+		if allowed != nil {
+			var columns []ColumnSchema
+			for _, col := range table.Columns {
+				if matchAny(allowed, col.Name) {
+					columns = append(columns, col)
+				}
+			}
+			table.Columns = columns
+		}
+		visible = append(visible, table)
+	}
+	return visible
+}
+
+// ApplyRowSecurity 将调用方角色的行过滤条件注入 SQL，返回改写后的 SQL、绑定值和被过滤的表
+func (p *PermissionController) ApplyRowSecurity(principal *Principal, query string) (string, []interface{}, []string, error) {
+	if p.policy == nil {
+		return query, nil, nil, nil
+	}
+
+	analysis, err := AnalyzeSQL(query)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("cannot analyze generated SQL: %v", err)
+	}
+	placeholder := func(int) string { return "?" }
+	if p.cfg.Database.Driver == "postgres" {
+		placeholder = func(n int) string { return fmt.Sprintf("$%d", n) }
+	}
+	return p.policy.ApplyRowFilters(p.RolesFor(principal), principal, analysis, placeholder)
+}
+
 func (p *PermissionController) CheckSemanticSafety(input []byte) bool {
 	entropy := p.calculateEntropy(input)
 	// nonASCIIRatio := p.calculateNonASCIIRatio(input) // 新配置中移除了此检查
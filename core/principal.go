@@ -0,0 +1,128 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import "context"
+
+// 认证方式
+const (
+	AuthMethodAPIKey   = "api_key"
+	AuthMethodJWT      = "jwt"
+	AuthMethodMTLS     = "mtls"
+	AuthMethodEmbedded = "embedded" // 嵌入方直接构造的身份，未经过传输层认证
+)
+
+// Principal 调用方身份，由传输层认证后通过 context 传入 Execute，
+// 供守卫、访问控制、缓存、审计和限流使用
+type Principal struct {
+	User       string
+	Roles      []string
+	Tenant     string            // 认证得到的租户，多租户模式下优先于请求参数
+	Scopes     []string          // 认证得到的权限范围，未绑定租户时需要 admin 才能指定租户
+	APIKey     string            // 认证使用的 API key 名称
+	AuthMethod string            // api_key, jwt, mtls, embedded
+	Attributes map[string]string // 行级安全等策略使用的身份属性，例如 region
+}
+
+// NewPrincipal 为嵌入方创建调用方身份
+func NewPrincipal(user string, roles ...string) *Principal {
+	return &Principal{User: user, Roles: roles, AuthMethod: AuthMethodEmbedded}
+}
+
+// WithAttribute 返回附加了身份属性的副本，原身份不变
+func (p *Principal) WithAttribute(name, value string) *Principal {
+	clone := *p
+	clone.Attributes = make(map[string]string, len(p.Attributes)+1)
+	for k, v := range p.Attributes {
+		clone.Attributes[k] = v
+	}
+	clone.Attributes[name] = value
+	return &clone
+}
+
+// HasRole 判断调用方是否直接拥有某个角色，不包含访问策略中按用户分配的角色
+func (p *Principal) HasRole(role string) bool {
+	if p == nil {
+		return false
+	}
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope 是否拥有指定权限，admin 拥有全部权限
+func (p *Principal) HasScope(scope string) bool {
+	return p != nil && hasScope(p.Scopes, scope)
+}
+
+// Attribute 返回身份属性，nil 身份或未设置时返回空字符串
+func (p *Principal) Attribute(name string) string {
+	if p == nil {
+		return ""
+	}
+	return p.Attributes[name]
+}
+
+// auditFields 审计记录中的身份字段
+func (p *Principal) auditFields() map[string]interface{} {
+	fields := map[string]interface{}{"user": p.User}
+	if len(p.Roles) > 0 {
+		fields["roles"] = p.Roles
+	}
+	if p.Tenant != "" {
+		fields["tenant"] = p.Tenant
+	}
+	if p.AuthMethod != "" {
+		fields["auth_method"] = p.AuthMethod
+	}
+	return fields
+}
+
+type principalKey struct{}
+
+type tenantKey struct{}
+
+// WithPrincipal 将调用方身份附加到 context
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext 读取调用方身份，未设置时返回 nil
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// ContextWithUser 以嵌入方身份调用 Execute 的便捷方法，等价于 WithPrincipal(ctx, NewPrincipal(user, roles...))
+func ContextWithUser(ctx context.Context, user string, roles ...string) context.Context {
+	return WithPrincipal(ctx, NewPrincipal(user, roles...))
+}
+
+// WithTenant 将请求参数中指定的租户附加到 context
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext 读取请求指定的租户，未设置时返回空字符串
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
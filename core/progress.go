@@ -0,0 +1,57 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import "context"
+
+// ProgressStage 查询执行到达的阶段
+type ProgressStage string
+
+const (
+	ProgressGuardsPassed ProgressStage = "guards_passed" // pre_generation 守卫通过
+	ProgressSQLGenerated ProgressStage = "sql_generated" // SQL 已生成并通过访问控制
+	ProgressExecuting    ProgressStage = "executing"     // 已进入工作池，开始执行
+	ProgressRowsScanned  ProgressStage = "rows_scanned"  // 已读取的结果行数
+)
+
+// progressRowInterval 读取结果时每隔多少行报告一次进度
+const progressRowInterval = 500
+
+// ProgressEvent 执行进度
+type ProgressEvent struct {
+	QueryID string
+	Stage   ProgressStage
+	Rows    int // rows_scanned 阶段已读取的行数
+}
+
+// ProgressFunc 接收执行进度，在执行查询的 goroutine 中同步调用，不应阻塞
+type ProgressFunc func(ProgressEvent)
+
+type progressKey struct{}
+
+// WithProgress 返回在执行过程中报告进度的 context
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// reportProgress 未设置进度回调时不做任何事
+func reportProgress(ctx context.Context, event ProgressEvent) {
+	if fn, _ := ctx.Value(progressKey{}).(ProgressFunc); fn != nil {
+		fn(event)
+	}
+}
@@ -18,6 +18,9 @@
 package core
 
 import (
+	"context"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -25,19 +28,41 @@ import (
 	"text2sql-skill/interfaces"
 )
 
+const (
+	minCleanupInterval = 10 * time.Millisecond
+	maxCleanupInterval = 1 * time.Minute
+)
+
 type QueryCache struct {
 	sync.RWMutex
-	cfg    *config.Config
-	cache  map[string]interfaces.SkillResult
-	ttl    time.Duration
-	maxAge time.Time
+	cfg      *config.Config
+	cache    map[string]cacheEntry
+	ttl      time.Duration
+	interval time.Duration
+	now      func() time.Time
+	roles    func(*Principal) []string
+	perUser  bool // RBAC 开启时行过滤可能绑定调用方身份，缓存按调用方和租户区分
+
+	// janitor 生命周期：缓存非空时运行，清空后退出，下次写入时重新启动
+	janitorRunning bool
+	stopChan       chan struct{}
+	wg             sync.WaitGroup
+	closed         bool
+}
+
+type cacheEntry struct {
+	result   interfaces.SkillResult
+	storedAt time.Time
 }
 
 func NewQueryCache(cfg *config.Config) *QueryCache {
 	cache := &QueryCache{
-		cfg:   cfg,
-		cache: make(map[string]interfaces.SkillResult),
-		ttl:   5 * time.Minute,
+		cfg:      cfg,
+		cache:    make(map[string]cacheEntry),
+		ttl:      5 * time.Minute,
+		now:      time.Now,
+		perUser:  cfg.Security.RBAC.Enabled,
+		stopChan: make(chan struct{}),
 	}
 
 	// 解析 TTL
@@ -47,20 +72,85 @@ func NewQueryCache(cfg *config.Config) *QueryCache {
 		}
 	}
 
-	if cfg.Cache.Enabled && cfg.Cache.Size > 0 {
-		go cache.cleanupLoop()
+	// 清理周期取 TTL 的一半，限制在合理区间内
+	cache.interval = cache.ttl / 2
+	if cache.interval < minCleanupInterval {
+		cache.interval = minCleanupInterval
+	}
+	if cache.interval > maxCleanupInterval {
+		cache.interval = maxCleanupInterval
 	}
 
 	return cache
 }
 
+// SetClock 替换缓存使用的时间源，主要用于测试
+func (c *QueryCache) SetClock(now func() time.Time) {
+	c.Lock()
+	defer c.Unlock()
+
+	if now == nil {
+		now = time.Now
+	}
+	c.now = now
+}
+
+// SetRoleResolver 设置解析调用方有效角色的方法，未设置时使用调用方自带的角色
+func (c *QueryCache) SetRoleResolver(resolve func(*Principal) []string) {
+	c.Lock()
+	defer c.Unlock()
+	c.roles = resolve
+}
+
+// GetContext 按 context 中的调用方身份读取缓存
+func (c *QueryCache) GetContext(ctx context.Context, input string) (interfaces.SkillResult, bool) {
+	return c.Get(c.scopedKey(PrincipalFromContext(ctx), input))
+}
+
+// SetContext 按 context 中的调用方身份写入缓存
+func (c *QueryCache) SetContext(ctx context.Context, input string, result interfaces.SkillResult) {
+	c.Set(c.scopedKey(PrincipalFromContext(ctx), input), result)
+}
+
+// scopedKey 调用方有角色时按角色和身份属性区分缓存，避免不同权限的调用方共享结果。
+// RBAC 开启时行过滤可以绑定 :user.name，同角色的不同用户也不能共享结果
+func (c *QueryCache) scopedKey(principal *Principal, input string) string {
+	c.RLock()
+	resolve := c.roles
+	c.RUnlock()
+
+	var roles []string
+	if resolve != nil {
+		roles = resolve(principal)
+	} else if principal != nil {
+		roles = principal.Roles
+	}
+	if len(roles) == 0 && !c.perUser {
+		return input
+	}
+
+	key := strings.Join(roles, ",")
+	if principal != nil && (c.perUser || len(principal.Attributes) > 0) {
+		names := make([]string, 0, len(principal.Attributes))
+		for name := range principal.Attributes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		key += "\x00" + principal.User + "\x00" + principal.Tenant
+		for _, name := range names {
+			key += "\x00" + name + "=" + principal.Attributes[name]
+		}
+	}
+	return key + "\x00" + input
+}
+
 func (c *QueryCache) Get(input string) (interfaces.SkillResult, bool) {
 	c.RLock()
 	defer c.RUnlock()
 
-	result, found := c.cache[input]
-	if found && time.Now().Before(result.Timestamp.Add(c.ttl)) {
-		return result, true
+	entry, found := c.cache[input]
+	if found && c.now().Before(entry.storedAt.Add(c.ttl)) {
+		return entry.result, true
 	}
 
 	return interfaces.SkillResult{}, false
@@ -70,24 +160,62 @@ func (c *QueryCache) Set(input string, result interfaces.SkillResult) {
 	c.Lock()
 	defer c.Unlock()
 
-	if !c.cfg.Cache.Enabled {
+	if !c.cfg.Cache.Enabled || c.closed {
 		return
 	}
 
-	if len(c.cache) >= c.cfg.Cache.Size {
+	if _, exists := c.cache[input]; !exists && len(c.cache) >= c.cfg.Cache.Size {
 		c.evictOldest()
 	}
 
-	c.cache[input] = result
+	c.cache[input] = cacheEntry{result: result, storedAt: c.now()}
+
+	if !c.janitorRunning {
+		c.janitorRunning = true
+		c.wg.Add(1)
+		go c.cleanupLoop()
+	}
+}
+
+// Len 返回当前缓存条目数（包括尚未被清理的过期条目）
+func (c *QueryCache) Len() int {
+	c.RLock()
+	defer c.RUnlock()
+	return len(c.cache)
+}
+
+// Purge 立即清理所有过期条目，返回清理数量
+func (c *QueryCache) Purge() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.purgeExpired()
+}
+
+// Close 停止后台清理协程并清空缓存，可重复调用
+func (c *QueryCache) Close() {
+	c.Lock()
+	if c.closed {
+		c.Unlock()
+		return
+	}
+	c.closed = true
+	close(c.stopChan)
+	c.Unlock()
+
+	c.wg.Wait()
+
+	c.Lock()
+	c.cache = make(map[string]cacheEntry)
+	c.Unlock()
 }
 
 func (c *QueryCache) evictOldest() {
-	oldest := time.Now()
+	var oldest time.Time
 	var oldestKey string
 
-	for key, result := range c.cache {
-		if result.Timestamp.Before(oldest) {
-			oldest = result.Timestamp
+	for key, entry := range c.cache {
+		if oldestKey == "" || entry.storedAt.Before(oldest) {
+			oldest = entry.storedAt
 			oldestKey = key
 		}
 	}
@@ -97,23 +225,41 @@ func (c *QueryCache) evictOldest() {
 	}
 }
 
+func (c *QueryCache) purgeExpired() int {
+	now := c.now()
+	removed := 0
+	for key, entry := range c.cache {
+		if !now.Before(entry.storedAt.Add(c.ttl)) {
+			delete(c.cache, key)
+			removed++
+		}
+	}
+	return removed
+}
+
 func (c *QueryCache) cleanupLoop() {
-	ticker := time.NewTicker(1 * time.Minute)
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.interval)
 	defer ticker.Stop()
 
 	for {
-		<-ticker.C
-		c.Lock()
-		now := time.Now()
-		for key, result := range c.cache {
-			if now.After(result.Timestamp.Add(c.ttl)) {
-				delete(c.cache, key)
+		select {
+		case <-ticker.C:
+			c.Lock()
+			c.purgeExpired()
+			// 缓存已空时退出，并在持锁状态下复位标记，保证下次 Set 能重新启动
+			if len(c.cache) == 0 {
+				c.janitorRunning = false
+				c.Unlock()
+				return
 			}
-		}
-		c.Unlock()
-
-		if len(c.cache) == 0 {
-			break
+			c.Unlock()
+		case <-c.stopChan:
+			c.Lock()
+			c.janitorRunning = false
+			c.Unlock()
+			return
 		}
 	}
 }
@@ -0,0 +1,497 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"text2sql-skill/config"
+)
+
+const (
+	// StatusRateLimited 令牌桶限流拒绝
+	StatusRateLimited = "rate_limited"
+	// StatusQuotaExceeded 每日配额用尽拒绝
+	StatusQuotaExceeded = "quota_exceeded"
+
+	defaultPersistInterval = 10 * time.Second
+	anonymousCaller        = "anonymous"
+	maxIdleBuckets         = 10000
+)
+
+// LimitDecision 限流判定结果
+type LimitDecision struct {
+	Allowed    bool
+	Status     string // rate_limited 或 quota_exceeded
+	Reason     string
+	RetryAfter time.Duration // 建议的重试等待时间
+}
+
+// RetryAfterSeconds 向上取整的重试秒数，用于 Retry-After
+func (d LimitDecision) RetryAfterSeconds() int {
+	return int(math.Ceil(d.RetryAfter.Seconds()))
+}
+
+// tokenBucket 令牌桶
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill 按经过的时间补充令牌
+func (b *tokenBucket) refill(now time.Time, rate float64, burst int) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(burst), b.tokens+elapsed*rate)
+	}
+	b.last = now
+}
+
+// wait 距离下一个令牌可用的时间
+func (b *tokenBucket) wait(rate float64) time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+// QuotaUsage 调用方当日的配额用量
+type QuotaUsage struct {
+	Queries  int64 `json:"queries"`
+	Rows     int64 `json:"rows"`
+	DBTimeMS int64 `json:"db_time_ms"`
+}
+
+type limitRule struct {
+	config.RateLimitRule
+	burst       int
+	dailyDBTime time.Duration
+}
+
+// RateLimiter 按 user / tenant / api_key 的令牌桶限流和每日配额。
+// 配额按 UTC 自然日统计，配置 state_path 时用量写入文件，重启后继续累计。
+type RateLimiter struct {
+	mu              sync.Mutex
+	rules           []limitRule
+	buckets         map[string]*tokenBucket
+	usage           map[string]*QuotaUsage
+	day             string
+	statePath       string
+	persistInterval time.Duration
+	lastPersist     time.Time
+	dirty           bool
+	restored        *quotaState // 从 state_path 读取、尚未应用的用量
+	now             func() time.Time
+}
+
+type quotaState struct {
+	Day   string                 `json:"day"`
+	Usage map[string]*QuotaUsage `json:"usage"`
+}
+
+// NewRateLimiter 根据 rate_limit 配置创建限流器，未启用或没有规则时返回 nil
+func NewRateLimiter(cfg config.RateLimitConfig) (*RateLimiter, error) {
+	if !cfg.Enabled || len(cfg.Rules) == 0 {
+		return nil, nil
+	}
+
+	l := &RateLimiter{
+		buckets:         make(map[string]*tokenBucket),
+		usage:           make(map[string]*QuotaUsage),
+		statePath:       cfg.StatePath,
+		persistInterval: defaultPersistInterval,
+		now:             time.Now,
+	}
+	if cfg.PersistInterval != "" {
+		interval, err := time.ParseDuration(cfg.PersistInterval)
+		if err != nil {
+			return nil, fmt.Errorf("rate_limit.persist_interval: %v", err)
+		}
+		l.persistInterval = interval
+	}
+
+	for _, rule := range cfg.Rules {
+		r := limitRule{RateLimitRule: rule, burst: rule.Burst}
+		if r.Match == "" {
+			r.Match = "*"
+		}
+		if r.burst == 0 {
+			r.burst = int(math.Max(1, math.Ceil(rule.RequestsPerSecond)))
+		}
+		if rule.DailyDBTime != "" {
+			d, err := time.ParseDuration(rule.DailyDBTime)
+			if err != nil {
+				return nil, fmt.Errorf("rate_limit.daily_db_time: %v", err)
+			}
+			r.dailyDBTime = d
+		}
+		l.rules = append(l.rules, r)
+	}
+
+	if err := l.load(); err != nil {
+		return nil, fmt.Errorf("rate_limit.state_path: %v", err)
+	}
+	return l, nil
+}
+
+// SetClock 替换限流器使用的时间源，主要用于测试
+func (l *RateLimiter) SetClock(now func() time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now == nil {
+		now = time.Now
+	}
+	l.now = now
+}
+
+// callerName 返回规则作用域下的调用方名称
+func callerName(ctx context.Context, scope string) string {
+	principal := PrincipalFromContext(ctx)
+	var name string
+	switch scope {
+	case "user":
+		if principal != nil {
+			name = principal.User
+		}
+	case "tenant":
+		if principal != nil {
+			name = principal.Tenant
+		}
+		if name == "" {
+			name = TenantFromContext(ctx)
+		}
+	case "api_key":
+		if principal != nil {
+			name = principal.APIKey
+		}
+	}
+	if name == "" {
+		return anonymousCaller
+	}
+	return name
+}
+
+// matching 返回对调用方生效的规则及其计数键
+func (l *RateLimiter) matching(ctx context.Context) ([]*limitRule, []string) {
+	var rules []*limitRule
+	var keys []string
+	for i := range l.rules {
+		rule := &l.rules[i]
+		name := callerName(ctx, rule.Scope)
+		if ok, _ := path.Match(rule.Match, name); !ok {
+			continue
+		}
+		rules = append(rules, rule)
+		keys = append(keys, rule.Scope+":"+rule.Match+":"+name)
+	}
+	return rules, keys
+}
+
+// Admit 判断请求是否放行。先检查每日配额，再从所有匹配规则的令牌桶各取一个令牌；
+// 任一规则拒绝时不消耗令牌。放行的请求计入当日查询次数。
+func (l *RateLimiter) Admit(ctx context.Context) LimitDecision {
+	if l == nil {
+		return LimitDecision{Allowed: true}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.rollover(now)
+	rules, keys := l.matching(ctx)
+
+	for i, rule := range rules {
+		usage := l.usageFor(keys[i])
+		var exceeded string
+		switch {
+		case rule.DailyQueries > 0 && usage.Queries >= rule.DailyQueries:
+			exceeded = "queries"
+		case rule.DailyRows > 0 && usage.Rows >= rule.DailyRows:
+			exceeded = "rows"
+		case rule.dailyDBTime > 0 && time.Duration(usage.DBTimeMS)*time.Millisecond >= rule.dailyDBTime:
+			exceeded = "db time"
+		}
+		if exceeded != "" {
+			return LimitDecision{
+				Status:     StatusQuotaExceeded,
+				Reason:     fmt.Sprintf("daily %s quota exceeded for %s", exceeded, keys[i]),
+				RetryAfter: nextDay(now).Sub(now),
+			}
+		}
+	}
+
+	var wait time.Duration
+	var limitedKey string
+	for i, rule := range rules {
+		if rule.RequestsPerSecond <= 0 {
+			continue
+		}
+		bucket := l.bucketFor(keys[i], rule, now)
+		bucket.refill(now, rule.RequestsPerSecond, rule.burst)
+		if w := bucket.wait(rule.RequestsPerSecond); w > wait {
+			wait, limitedKey = w, keys[i]
+		}
+	}
+	if limitedKey != "" {
+		return LimitDecision{
+			Status:     StatusRateLimited,
+			Reason:     "rate limit exceeded for " + limitedKey,
+			RetryAfter: wait,
+		}
+	}
+
+	for i, rule := range rules {
+		if rule.RequestsPerSecond > 0 {
+			l.buckets[keys[i]].tokens--
+		}
+		l.usageFor(keys[i]).Queries++
+	}
+	if len(rules) > 0 {
+		l.dirty = true
+	}
+	return LimitDecision{Allowed: true}
+}
+
+// Record 记录一次执行返回的行数和数据库耗时
+func (l *RateLimiter) Record(ctx context.Context, rows int, dbTime time.Duration) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.rollover(now)
+	_, keys := l.matching(ctx)
+	for _, key := range keys {
+		usage := l.usageFor(key)
+		usage.Rows += int64(rows)
+		usage.DBTimeMS += dbTime.Milliseconds()
+	}
+	if len(keys) > 0 {
+		l.dirty = true
+	}
+
+	if l.statePath != "" && now.Sub(l.lastPersist) >= l.persistInterval {
+		l.persistLocked(now)
+	}
+}
+
+// Usage 返回调用方在各匹配规则下的当日用量，键为 scope:match:name
+func (l *RateLimiter) Usage(ctx context.Context) map[string]QuotaUsage {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rollover(l.now())
+	_, keys := l.matching(ctx)
+	usage := make(map[string]QuotaUsage, len(keys))
+	for _, key := range keys {
+		usage[key] = *l.usageFor(key)
+	}
+	return usage
+}
+
+// Close 将用量写入 state_path
+func (l *RateLimiter) Close() {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.statePath != "" {
+		l.persistLocked(l.now())
+	}
+}
+
+func (l *RateLimiter) usageFor(key string) *QuotaUsage {
+	usage, ok := l.usage[key]
+	if !ok {
+		usage = &QuotaUsage{}
+		l.usage[key] = usage
+	}
+	return usage
+}
+
+func (l *RateLimiter) bucketFor(key string, rule *limitRule, now time.Time) *tokenBucket {
+	bucket, ok := l.buckets[key]
+	if !ok {
+		// 调用方很多时清理已经回满的令牌桶，效果等同于新建
+		if len(l.buckets) >= maxIdleBuckets {
+			l.pruneBuckets(now)
+		}
+		bucket = &tokenBucket{tokens: float64(rule.burst), last: now}
+		l.buckets[key] = bucket
+	}
+	return bucket
+}
+
+func (l *RateLimiter) pruneBuckets(now time.Time) {
+	for i := range l.rules {
+		rule := &l.rules[i]
+		if rule.RequestsPerSecond <= 0 {
+			continue
+		}
+		full := time.Duration(float64(rule.burst) / rule.RequestsPerSecond * float64(time.Second))
+		prefix := rule.Scope + ":" + rule.Match + ":"
+		for key, bucket := range l.buckets {
+			if strings.HasPrefix(key, prefix) && now.Sub(bucket.last) >= full {
+				delete(l.buckets, key)
+			}
+		}
+	}
+}
+
+// rollover 跨日时清空配额用量
+func (l *RateLimiter) rollover(now time.Time) {
+	day := now.UTC().Format("2006-01-02")
+	if day != l.day {
+		l.day = day
+		l.usage = make(map[string]*QuotaUsage)
+		l.dirty = true
+		// 首次统计时恢复同一天的持久化用量
+		if l.restored != nil && l.restored.Day == day && l.restored.Usage != nil {
+			l.usage = l.restored.Usage
+			l.dirty = false
+		}
+		l.restored = nil
+	}
+}
+
+func nextDay(now time.Time) time.Time {
+	utc := now.UTC()
+	return time.Date(utc.Year(), utc.Month(), utc.Day()+1, 0, 0, 0, 0, time.UTC)
+}
+
+func (l *RateLimiter) load() error {
+	if l.statePath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(l.statePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var state quotaState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	l.restored = &state
+	return nil
+}
+
+// persistLocked 写入临时文件后重命名，避免中断时留下不完整的状态文件
+func (l *RateLimiter) persistLocked(now time.Time) {
+	l.lastPersist = now
+	if !l.dirty {
+		return
+	}
+
+	data, err := json.Marshal(quotaState{Day: l.day, Usage: l.usage})
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(l.statePath), 0755)
+	}
+	if err == nil {
+		tmp := l.statePath + ".tmp"
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, l.statePath)
+		}
+	}
+	if err != nil {
+		log.Printf("WARN: failed to persist rate limit usage to %s: %v", l.statePath, err)
+		return
+	}
+	l.dirty = false
+}
+
+// EndpointLimiter 按客户端标识的简单令牌桶，用于 HTTP 端点
+type EndpointLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   int
+	buckets map[string]*tokenBucket
+	now     func() time.Time
+}
+
+// NewEndpointLimiter 创建端点限流器，速率为 0 时返回 nil
+func NewEndpointLimiter(cfg config.EndpointLimit) *EndpointLimiter {
+	if cfg.RequestsPerSecond <= 0 {
+		return nil
+	}
+	burst := cfg.Burst
+	if burst == 0 {
+		burst = int(math.Max(1, math.Ceil(cfg.RequestsPerSecond)))
+	}
+	return &EndpointLimiter{
+		rate:    cfg.RequestsPerSecond,
+		burst:   burst,
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// Allow 为 client 取一个令牌，拒绝时返回建议的等待时间
+func (e *EndpointLimiter) Allow(client string) (bool, time.Duration) {
+	if e == nil {
+		return true, 0
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	bucket, ok := e.buckets[client]
+	if !ok {
+		if len(e.buckets) >= maxIdleBuckets {
+			full := time.Duration(float64(e.burst) / e.rate * float64(time.Second))
+			for key, b := range e.buckets {
+				if now.Sub(b.last) >= full {
+					delete(e.buckets, key)
+				}
+			}
+		}
+		bucket = &tokenBucket{tokens: float64(e.burst), last: now}
+		e.buckets[client] = bucket
+	}
+	bucket.refill(now, e.rate, e.burst)
+	if wait := bucket.wait(e.rate); wait > 0 {
+		return false, wait
+	}
+	bucket.tokens--
+	return true, 0
+}
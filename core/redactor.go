@@ -0,0 +1,250 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"text2sql-skill/config"
+)
+
+// piiDetector 敏感信息检测器：正则命中后可再经 validate 校验以减少误报
+type piiDetector struct {
+	name     string
+	pattern  *regexp.Regexp
+	validate func(match string) bool
+}
+
+// 内置检测器按顺序执行，身份证号需在银行卡号之前匹配
+var builtinDetectors = map[string]piiDetector{
+	"email": {
+		name:    "email",
+		pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	},
+	"cn_id": {
+		name:     "cn_id",
+		pattern:  regexp.MustCompile(`\b[1-9]\d{16}[\dXx]\b`),
+		validate: validChineseID,
+	},
+	"credit_card": {
+		name:     "credit_card",
+		pattern:  regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		validate: validLuhn,
+	},
+	"phone": {
+		name:    "phone",
+		pattern: regexp.MustCompile(`(?:\+\d{1,3}[ -]?)?\b1[3-9]\d{9}\b|\+\d{1,3}[ -]?\d{2,4}[ -]?\d{3,4}[ -]?\d{3,4}\b`),
+	},
+}
+
+var builtinDetectorOrder = []string{"email", "cn_id", "credit_card", "phone"}
+
+// Redactor 对审计数据、错误信息和日志中的个人敏感信息进行脱敏。
+// nil Redactor 不做任何处理。
+type Redactor struct {
+	detectors []piiDetector
+	columns   []string
+}
+
+// NewRedactor 根据配置创建脱敏器，未启用时返回 nil
+func NewRedactor(cfg config.RedactionConfig) (*Redactor, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	r := &Redactor{}
+	names := cfg.Detectors
+	if len(names) == 0 {
+		names = builtinDetectorOrder
+	}
+	enabled := make(map[string]bool, len(names))
+	for _, name := range names {
+		if _, ok := builtinDetectors[name]; !ok {
+			return nil, fmt.Errorf("unknown redaction detector: %s", name)
+		}
+		enabled[name] = true
+	}
+	for _, name := range builtinDetectorOrder {
+		if enabled[name] {
+			r.detectors = append(r.detectors, builtinDetectors[name])
+		}
+	}
+
+	for _, custom := range cfg.CustomPatterns {
+		pattern, err := regexp.Compile(custom.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redaction pattern %s: %w", custom.Name, err)
+		}
+		r.detectors = append(r.detectors, piiDetector{name: custom.Name, pattern: pattern})
+	}
+
+	for _, column := range cfg.Columns {
+		r.columns = append(r.columns, strings.ToLower(column))
+	}
+
+	return r, nil
+}
+
+// RedactString 替换字符串中检测到的敏感信息
+func (r *Redactor) RedactString(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, d := range r.detectors {
+		d := d
+		s = d.pattern.ReplaceAllStringFunc(s, func(match string) string {
+			if d.validate != nil && !d.validate(match) {
+				return match
+			}
+			return redactedMarker(d.name)
+		})
+	}
+	return s
+}
+
+// IsSensitiveColumn 判断列名/字段名是否命中列规则（支持 * 通配）
+func (r *Redactor) IsSensitiveColumn(name string) bool {
+	if r == nil {
+		return false
+	}
+	name = strings.ToLower(name)
+	for _, pattern := range r.columns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactMap 返回脱敏后的副本：命中列规则的字段整体替换，其余字符串值按检测器处理
+func (r *Redactor) RedactMap(data map[string]interface{}) map[string]interface{} {
+	if r == nil || data == nil {
+		return data
+	}
+	result := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		if r.IsSensitiveColumn(key) {
+			result[key] = redactedMarker("column")
+			continue
+		}
+		result[key] = r.redactValue(value)
+	}
+	return result
+}
+
+func (r *Redactor) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return r.RedactString(v)
+	case error:
+		return r.RedactString(v.Error())
+	case map[string]interface{}:
+		return r.RedactMap(v)
+	case []map[string]interface{}:
+		rows := make([]map[string]interface{}, len(v))
+		for i, row := range v {
+			rows[i] = r.RedactMap(row)
+		}
+		return rows
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = r.redactValue(item)
+		}
+		return items
+	case []string:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = r.RedactString(item)
+		}
+		return items
+	default:
+		return value
+	}
+}
+
+// NewRedactingWriter 包装日志输出，写入前脱敏
+func NewRedactingWriter(w io.Writer, r *Redactor) io.Writer {
+	if r == nil {
+		return w
+	}
+	return &redactingWriter{w: w, r: r}
+}
+
+type redactingWriter struct {
+	w io.Writer
+	r *Redactor
+}
+
+func (rw *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.w, rw.r.RedactString(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func redactedMarker(name string) string {
+	return "[REDACTED:" + name + "]"
+}
+
+// validChineseID 校验 18 位居民身份证号的校验位（GB 11643-1999）
+func validChineseID(id string) bool {
+	if len(id) != 18 {
+		return false
+	}
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	checks := "10X98765432"
+
+	sum := 0
+	for i := 0; i < 17; i++ {
+		sum += int(id[i]-'0') * weights[i]
+	}
+	return strings.ToUpper(id[17:]) == string(checks[sum%11])
+}
+
+// validLuhn 校验银行卡号的 Luhn 校验和
+func validLuhn(number string) bool {
+	digits := make([]int, 0, len(number))
+	for _, c := range number {
+		if c >= '0' && c <= '9' {
+			digits = append(digits, int(c-'0'))
+		}
+	}
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := digits[i]
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
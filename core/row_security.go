@@ -0,0 +1,179 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// rowFilter 行级安全过滤条件，:user.<属性> 在执行时绑定为参数
+type rowFilter struct {
+	schema string
+	table  string
+	expr   string
+	tokens []sqlToken
+}
+
+func parseRowFilter(table, expr string) (rowFilter, error) {
+	filter := rowFilter{expr: expr}
+	table = strings.ToLower(table)
+	if i := strings.Index(table, "."); i >= 0 {
+		filter.schema, filter.table = table[:i], table[i+1:]
+	} else {
+		filter.table = table
+	}
+
+	tokens, err := tokenizeSQL(expr)
+	if err != nil {
+		return filter, err
+	}
+	for _, tok := range tokens {
+		switch {
+		case tok.kind == sqlPunct && tok.value == ";":
+			return filter, fmt.Errorf("row filter must be a single expression")
+		case tok.kind == sqlParam && !strings.HasPrefix(tok.value, ":user."):
+			return filter, fmt.Errorf("unsupported parameter %s, use :user.<attribute>", tok.value)
+		}
+	}
+	filter.tokens = tokens
+	return filter, nil
+}
+
+// matches 未指定 schema 的过滤条件匹配任意 schema 下的同名表；
+// 指定 schema 时同时匹配未限定 schema 的引用，避免通过省略 schema 绕过
+func (f rowFilter) matches(ref *SQLTableRef) bool {
+	if ref.Name != f.table {
+		return false
+	}
+	return f.schema == "" || ref.Schema == "" || ref.Schema == f.schema
+}
+
+// render 将过滤条件中的身份属性替换为占位符，返回条件和绑定值
+func (f rowFilter) render(principal *Principal, placeholder func(int) string, args []interface{}) (string, []interface{}, error) {
+	var b strings.Builder
+	last := 0
+	for _, tok := range f.tokens {
+		if tok.kind != sqlParam {
+			continue
+		}
+		name := strings.TrimPrefix(tok.value, ":user.")
+		value, ok := principalAttribute(principal, name)
+		if !ok {
+			return "", nil, fmt.Errorf("missing caller attribute '%s' for row filter on %s", name, f.table)
+		}
+		b.WriteString(f.expr[last:tok.start])
+		args = append(args, value)
+		b.WriteString(placeholder(len(args)))
+		last = tok.end
+	}
+	b.WriteString(f.expr[last:])
+	return b.String(), args, nil
+}
+
+func principalAttribute(principal *Principal, name string) (string, bool) {
+	if principal == nil {
+		return "", false
+	}
+	if name == "name" || name == "user" {
+		return principal.User, principal.User != ""
+	}
+	value, ok := principal.Attributes[name]
+	return value, ok
+}
+
+// rowFiltersFor 返回角色对表的过滤条件；任一角色授权该表且没有过滤条件时不过滤
+func (p *AccessPolicy) rowFiltersFor(roles []string, ref *SQLTableRef) []rowFilter {
+	var filters []rowFilter
+	for _, role := range roles {
+		filtered := false
+		for _, filter := range p.rowFilters[role] {
+			if filter.matches(ref) {
+				filters = append(filters, filter)
+				filtered = true
+			}
+		}
+		if filtered {
+			continue
+		}
+		for _, grant := range p.roles[role] {
+			if grant.matches(ref) {
+				return nil
+			}
+		}
+	}
+	return filters
+}
+
+// ApplyRowFilters 将行过滤条件注入每个基表引用：表引用被替换为带过滤条件的派生表，
+// 保留原别名，因此连接、子查询和 CTE 中的引用都无法绕过。多个角色的条件以 OR 合并。
+// 返回改写后的 SQL、绑定值和被过滤的表。
+func (p *AccessPolicy) ApplyRowFilters(roles []string, principal *Principal, analysis *SQLAnalysis, placeholder func(int) string) (string, []interface{}, []string, error) {
+	refs := append([]*SQLTableRef(nil), analysis.Tables...)
+	sort.Slice(refs, func(i, j int) bool { return refs[i].nameStart < refs[j].nameStart })
+
+	query := analysis.SQL
+	var b strings.Builder
+	var args []interface{}
+	var tables []string
+	last := 0
+
+	for _, ref := range refs {
+		filters := p.rowFiltersFor(roles, ref)
+		if len(filters) == 0 {
+			continue
+		}
+		if ref.Operation != "SELECT" {
+			return "", nil, nil, fmt.Errorf("%s on %s is not allowed with row filters", ref.Operation, ref.QualifiedName())
+		}
+
+		conditions := make([]string, 0, len(filters))
+		for _, filter := range filters {
+			condition, bound, err := filter.render(principal, placeholder, args)
+			if err != nil {
+				return "", nil, nil, err
+			}
+			args = bound
+			conditions = append(conditions, "("+condition+")")
+		}
+
+		b.WriteString(query[last:ref.nameStart])
+		b.WriteString("(SELECT * FROM ")
+		b.WriteString(query[ref.nameStart:ref.nameEnd])
+		b.WriteString(" WHERE ")
+		b.WriteString(strings.Join(conditions, " OR "))
+		b.WriteString(") ")
+		if ref.Alias != "" {
+			b.WriteString(query[ref.aliasStart:ref.refEnd])
+		} else {
+			b.WriteString(ref.lastName)
+		}
+		last = ref.refEnd
+		tables = append(tables, ref.QualifiedName())
+	}
+
+	if len(tables) == 0 {
+		return query, nil, nil, nil
+	}
+	if analysis.Params > 0 && len(args) > 0 {
+		return "", nil, nil, fmt.Errorf("row filters cannot be combined with unbound query parameters")
+	}
+	b.WriteString(query[last:])
+	return b.String(), args, tables, nil
+}
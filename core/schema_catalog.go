@@ -0,0 +1,143 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// ColumnSchema 列结构
+type ColumnSchema struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+}
+
+// TableSchema 表结构
+type TableSchema struct {
+	Name    string         `json:"name"`
+	Columns []ColumnSchema `json:"columns"`
+}
+
+// LoadSchema 读取当前库的表结构。dialect 为 sqlite 时读取 sqlite_master，
+// 其他数据库读取 information_schema 中当前 schema 的表
+func LoadSchema(ctx context.Context, db *sql.DB, dialect string) ([]TableSchema, error) {
+	if dialect == "sqlite" {
+		return loadSQLiteSchema(ctx, db)
+	}
+
+	current := "current_schema()"
+	if dialect == "mysql" {
+		current = "DATABASE()"
+	}
+	rows, err := db.QueryContext(ctx, `SELECT table_name, column_name, data_type, is_nullable
+		FROM information_schema.columns WHERE table_schema = `+current+`
+		ORDER BY table_name, ordinal_position`)
+	if err != nil {
+		return nil, fmt.Errorf("load schema: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []TableSchema
+	for rows.Next() {
+		var table, column, dataType, nullable string
+		if err := rows.Scan(&table, &column, &dataType, &nullable); err != nil {
+			return nil, fmt.Errorf("load schema: %w", err)
+		}
+		if len(tables) == 0 || tables[len(tables)-1].Name != table {
+			tables = append(tables, TableSchema{Name: table})
+		}
+		last := &tables[len(tables)-1]
+		last.Columns = append(last.Columns, ColumnSchema{
+			Name:     column,
+			Type:     dataType,
+			Nullable: strings.EqualFold(nullable, "YES"),
+		})
+	}
+	return tables, rows.Err()
+}
+
+func loadSQLiteSchema(ctx context.Context, db *sql.DB) ([]TableSchema, error) {
+	rows, err := db.QueryContext(ctx, `SELECT name FROM sqlite_master
+		WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("load schema: %w", err)
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("load schema: %w", err)
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("load schema: %w", err)
+	}
+
+	tables := make([]TableSchema, 0, len(names))
+	for _, name := range names {
+		table := TableSchema{Name: name}
+		info, err := db.QueryContext(ctx, `PRAGMA table_info("`+strings.ReplaceAll(name, `"`, `""`)+`")`)
+		if err != nil {
+			return nil, fmt.Errorf("load schema of %s: %w", name, err)
+		}
+		for info.Next() {
+			var cid, notNull, pk int
+			var column, dataType string
+			var defaultValue sql.NullString
+			if err := info.Scan(&cid, &column, &dataType, &notNull, &defaultValue, &pk); err != nil {
+				info.Close()
+				return nil, fmt.Errorf("load schema of %s: %w", name, err)
+			}
+			table.Columns = append(table.Columns, ColumnSchema{Name: column, Type: dataType, Nullable: notNull == 0 && pk == 0})
+		}
+		info.Close()
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+// schemaDialect 按连接的驱动判断读取表结构的方式
+func schemaDialect(db *sql.DB, driver string) string {
+	if strings.Contains(strings.ToLower(fmt.Sprintf("%T", db.Driver())), "sqlite") {
+		return "sqlite"
+	}
+	return driver
+}
+
+// DescribeSchema 返回调用方有权查询的表和列，拒绝时返回 *SkillError
+func (s *Text2SQLSkill) DescribeSchema(ctx context.Context) ([]TableSchema, error) {
+	if allowed, reason := s.guardSystem.CheckCaller(ctx); !allowed {
+		return nil, &SkillError{Code: ErrCodeGuardRejected, Message: reason, Guard: GuardCallerIdentity, GuardCode: "IDENTITY_REQUIRED"}
+	}
+	if s.db == nil {
+		return nil, &SkillError{Code: ErrCodeDBError, Message: "no database connection"}
+	}
+
+	tables, err := LoadSchema(ctx, s.db, schemaDialect(s.db, s.cfg.Database.Driver))
+	if err != nil {
+		return nil, &SkillError{Code: executionErrorCode(err), Message: s.redactor.RedactString(err.Error())}
+	}
+	return s.permissionCtrl.FilterSchema(PrincipalFromContext(ctx), tables), nil
+}
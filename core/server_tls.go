@@ -0,0 +1,244 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"text2sql-skill/config"
+)
+
+const defaultCertReloadInterval = time.Minute
+
+// ServerTLS HTTPS 服务端证书管理。握手时按 reload_interval 检查证书、私钥和客户端 CA 文件，
+// 发生变化时热加载，加载失败则继续使用旧证书。
+type ServerTLS struct {
+	cfg      config.ServerTLSConfig
+	base     *tls.Config
+	interval time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+	checkedAt time.Time
+}
+
+// NewServerTLS 加载服务端证书并根据配置生成 TLS 参数
+func NewServerTLS(cfg config.ServerTLSConfig) (*ServerTLS, error) {
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"http/1.1"},
+	}
+	if cfg.MinVersion == "1.3" {
+		base.MinVersion = tls.VersionTLS13
+	}
+	if len(cfg.CipherSuites) > 0 {
+		ids := make(map[string]uint16)
+		for _, suite := range tls.CipherSuites() {
+			ids[suite.Name] = suite.ID
+		}
+		for _, name := range cfg.CipherSuites {
+			id, ok := ids[name]
+			if !ok {
+				return nil, fmt.Errorf("unsupported cipher suite '%s'", name)
+			}
+			base.CipherSuites = append(base.CipherSuites, id)
+		}
+	}
+	switch cfg.ClientAuth.Mode {
+	case "optional":
+		base.ClientAuth = tls.VerifyClientCertIfGiven
+	case "required":
+		base.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	s := &ServerTLS{cfg: cfg, base: base, interval: defaultCertReloadInterval, now: time.Now}
+	if cfg.ReloadInterval != "" {
+		interval, err := time.ParseDuration(cfg.ReloadInterval)
+		if err != nil {
+			return nil, fmt.Errorf("reload_interval: %v", err)
+		}
+		s.interval = interval
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SetClock 替换热加载检查使用的时间源，主要用于测试
+func (s *ServerTLS) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now == nil {
+		now = time.Now
+	}
+	s.now = now
+}
+
+// TLSConfig 返回用于 http.Server 的配置，每次握手使用当前加载的证书
+func (s *ServerTLS) TLSConfig() *tls.Config {
+	cfg := s.base.Clone()
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		s.maybeReload()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		conn := s.base.Clone()
+		conn.Certificates = []tls.Certificate{*s.cert}
+		conn.ClientCAs = s.clientCAs
+		return conn, nil
+	}
+	return cfg
+}
+
+// Reload 立即重新加载证书、私钥和客户端 CA
+func (s *ServerTLS) Reload() error {
+	files := s.files()
+	modTimes := make(map[string]time.Time, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(s.cfg.CertFile, s.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("load server certificate: %v", err)
+	}
+	var pool *x509.CertPool
+	if s.clientAuthEnabled() {
+		pem, err := os.ReadFile(s.cfg.ClientAuth.CAFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", s.cfg.ClientAuth.CAFile)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cert = &cert
+	s.clientCAs = pool
+	s.modTimes = modTimes
+	s.checkedAt = s.now()
+	return nil
+}
+
+// maybeReload 距上次检查超过 reload_interval 且文件有变化时重新加载
+func (s *ServerTLS) maybeReload() {
+	if s.interval <= 0 {
+		return
+	}
+	s.mu.Lock()
+	now := s.now()
+	if now.Sub(s.checkedAt) < s.interval {
+		s.mu.Unlock()
+		return
+	}
+	s.checkedAt = now
+	changed := false
+	for file, modTime := range s.modTimes {
+		if info, err := os.Stat(file); err == nil && !info.ModTime().Equal(modTime) {
+			changed = true
+		}
+	}
+	s.mu.Unlock()
+
+	if changed {
+		if err := s.Reload(); err != nil {
+			log.Printf("WARN: TLS 证书热加载失败，继续使用旧证书: %v", err)
+		}
+	}
+}
+
+func (s *ServerTLS) files() []string {
+	files := []string{s.cfg.CertFile, s.cfg.KeyFile}
+	if s.clientAuthEnabled() {
+		files = append(files, s.cfg.ClientAuth.CAFile)
+	}
+	return files
+}
+
+func (s *ServerTLS) clientAuthEnabled() bool {
+	return s.cfg.ClientAuth.Mode == "optional" || s.cfg.ClientAuth.Mode == "required"
+}
+
+// ClientIdentity 把已验证的客户端证书映射为调用方身份。
+// 未启用客户端认证、未提供证书或证书中缺少用户字段时返回 nil。
+func (s *ServerTLS) ClientIdentity(state *tls.ConnectionState) (*Principal, *APIKey) {
+	if s == nil || !s.clientAuthEnabled() || state == nil || len(state.VerifiedChains) == 0 {
+		return nil, nil
+	}
+	cert := state.VerifiedChains[0][0]
+	mapping := s.cfg.ClientAuth
+
+	var user string
+	switch mapping.UserField {
+	case "email":
+		if len(cert.EmailAddresses) > 0 {
+			user = cert.EmailAddresses[0]
+		}
+	case "dns":
+		if len(cert.DNSNames) > 0 {
+			user = cert.DNSNames[0]
+		}
+	case "uri":
+		if len(cert.URIs) > 0 {
+			user = cert.URIs[0].String()
+		}
+	default:
+		user = cert.Subject.CommonName
+	}
+	if user == "" {
+		return nil, nil
+	}
+
+	principal := &Principal{User: user, AuthMethod: AuthMethodMTLS}
+	if mapping.RolesField == "ou" {
+		principal.Roles = cert.Subject.OrganizationalUnit
+	}
+	if mapping.TenantField == "o" && len(cert.Subject.Organization) > 0 {
+		principal.Tenant = cert.Subject.Organization[0]
+	}
+	scopes := mapping.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{ScopeExecute}
+	}
+	principal.Scopes = scopes
+	return principal, &APIKey{
+		Name:      user,
+		Scopes:    scopes,
+		Tenant:    principal.Tenant,
+		Roles:     principal.Roles,
+		ExpiresAt: cert.NotAfter,
+	}
+}
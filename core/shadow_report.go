@@ -0,0 +1,105 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import (
+	"sort"
+	"time"
+)
+
+// ShadowSummary 同一守卫、动作和错误码的影子决定汇总
+type ShadowSummary struct {
+	Guard   string    `json:"guard"`
+	Phase   string    `json:"phase"`
+	Action  string    `json:"action"`
+	Code    string    `json:"code"`
+	Count   int       `json:"count"`
+	Users   int       `json:"users"` // 涉及的不同调用方数量，匿名调用不计入
+	First   time.Time `json:"first"`
+	Last    time.Time `json:"last"`
+	Example string    `json:"example"` // 最近一次决定的原因
+}
+
+// ShadowReport monitor 模式守卫的影子决定报告
+type ShadowReport struct {
+	Total     int             `json:"total"`
+	Queries   int             `json:"queries"` // 受影响的不同查询数量
+	Summaries []ShadowSummary `json:"summaries"`
+}
+
+// SummarizeShadowDecisions 汇总审计日志中的 shadow_decision 事件，按次数从多到少排序
+func SummarizeShadowDecisions(entries []*AuditEntry) ShadowReport {
+	var report ShadowReport
+	queries := make(map[string]bool)
+	groups := make(map[string]*ShadowSummary)
+	users := make(map[string]map[string]bool)
+
+	for _, entry := range entries {
+		if entry.EventType != "shadow_decision" {
+			continue
+		}
+		guard := entryString(entry.Data, "guard")
+		action := entryString(entry.Data, "action")
+		code := entryString(entry.Data, "code")
+		key := guard + "\x00" + action + "\x00" + code
+
+		summary := groups[key]
+		if summary == nil {
+			summary = &ShadowSummary{
+				Guard:  guard,
+				Phase:  entryString(entry.Data, "phase"),
+				Action: action,
+				Code:   code,
+				First:  entry.Timestamp,
+			}
+			groups[key] = summary
+			users[key] = make(map[string]bool)
+		}
+		summary.Count++
+		if entry.Timestamp.Before(summary.First) {
+			summary.First = entry.Timestamp
+		}
+		if !entry.Timestamp.Before(summary.Last) {
+			summary.Last = entry.Timestamp
+			summary.Example = entryString(entry.Data, "reason")
+		}
+		if user := entryString(entry.Data, "user"); user != "" {
+			users[key][user] = true
+		}
+
+		report.Total++
+		queries[entry.QueryID] = true
+	}
+
+	report.Queries = len(queries)
+	for key, summary := range groups {
+		summary.Users = len(users[key])
+		report.Summaries = append(report.Summaries, *summary)
+	}
+	sort.Slice(report.Summaries, func(i, j int) bool {
+		a, b := report.Summaries[i], report.Summaries[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Guard != b.Guard {
+			return a.Guard < b.Guard
+		}
+		return a.Code < b.Code
+	})
+	return report
+}
@@ -0,0 +1,150 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"text2sql-skill/interfaces"
+)
+
+// ErrorCode 机器可读的错误类型，出现在 SkillResult.Meta 的 error.code 中
+type ErrorCode string
+
+const (
+	ErrCodeGuardRejected    ErrorCode = "guard_rejected"    // 守卫链拒绝，error.guard 和 error.guard_code 给出具体守卫
+	ErrCodeAccessDenied     ErrorCode = "access_denied"     // RBAC、行级安全或列脱敏策略拒绝
+	ErrCodeGenerationFailed ErrorCode = "generation_failed" // 无法从输入生成 SQL
+	ErrCodeTimeout          ErrorCode = "timeout"
+	ErrCodeCanceled         ErrorCode = "canceled"
+	ErrCodeDBError          ErrorCode = "db_error"
+	ErrCodeRateLimited      ErrorCode = "rate_limited"
+	ErrCodeQuotaExceeded    ErrorCode = "quota_exceeded"
+	ErrCodeOverloaded       ErrorCode = "overloaded"
+	ErrCodeInvalidTenant    ErrorCode = "invalid_tenant"
+	ErrCodeInternal         ErrorCode = "internal_error"
+)
+
+// Retryable 稍后重试可能成功的错误类型
+func (c ErrorCode) Retryable() bool {
+	switch c {
+	case ErrCodeTimeout, ErrCodeRateLimited, ErrCodeQuotaExceeded, ErrCodeOverloaded:
+		return true
+	}
+	return false
+}
+
+// SkillError 结构化错误，Message 已脱敏
+type SkillError struct {
+	Code              ErrorCode `json:"code"`
+	Message           string    `json:"message"`
+	Guard             string    `json:"guard,omitempty"`      // guard_rejected: 拒绝的守卫
+	GuardCode         string    `json:"guard_code,omitempty"` // guard_rejected: 守卫给出的错误码
+	Denied            []string  `json:"denied,omitempty"`     // access_denied: 被拒绝访问的表或列
+	RetryAfterSeconds int       `json:"retry_after_seconds,omitempty"`
+}
+
+func (e *SkillError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// ResultMeta SkillResult.Meta 的 JSON 结构，成功和失败使用同一结构，失败时 Error 非空
+type ResultMeta struct {
+	Status         string      `json:"status"`
+	Timestamp      string      `json:"timestamp"`
+	InputLength    int         `json:"input_length,omitempty"`
+	TemplateUsed   string      `json:"template_used,omitempty"`
+	RowCount       int         `json:"row_count"`
+	MaskedColumns  []string    `json:"masked_columns,omitempty"`
+	GuardDecisions interface{} `json:"guard_decisions,omitempty"`
+	Error          *SkillError `json:"error,omitempty"`
+}
+
+// Marshal 编码为 SkillResult.Meta
+func (m ResultMeta) Marshal() []byte {
+	data, _ := json.Marshal(m)
+	return data
+}
+
+// ParseResultMeta 解析 SkillResult.Meta
+func ParseResultMeta(result interfaces.SkillResult) (*ResultMeta, error) {
+	var meta ResultMeta
+	if err := json.Unmarshal(result.Meta, &meta); err != nil {
+		return nil, fmt.Errorf("invalid result meta: %w", err)
+	}
+	return &meta, nil
+}
+
+// ResultError 返回失败结果的结构化错误，成功时返回 nil
+func ResultError(result interfaces.SkillResult) *SkillError {
+	if result.Status == "success" {
+		return nil
+	}
+	meta, err := ParseResultMeta(result)
+	if err != nil || meta.Error == nil {
+		message := string(result.Meta)
+		if err == nil {
+			message = result.Status
+		}
+		return &SkillError{Code: ErrCodeInternal, Message: message}
+	}
+	return meta.Error
+}
+
+// errorResult 生成失败结果，Meta 使用 ResultMeta 结构
+func errorResult(queryID, status string, skillErr *SkillError) interfaces.SkillResult {
+	now := time.Now()
+	return interfaces.SkillResult{
+		QueryID: queryID,
+		Meta: ResultMeta{
+			Status:    status,
+			Timestamp: now.UTC().Format("2006-01-02 15:04:05"),
+			Error:     skillErr,
+		}.Marshal(),
+		Timestamp: now,
+		Status:    status,
+	}
+}
+
+// executionErrorCode 区分执行超时、取消和数据库错误
+func executionErrorCode(err error) ErrorCode {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrCodeTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrCodeCanceled
+	default:
+		return ErrCodeDBError
+	}
+}
+
+// limitErrorCode 限流决定的状态对应的错误类型
+func limitErrorCode(status string) ErrorCode {
+	switch status {
+	case StatusQuotaExceeded:
+		return ErrCodeQuotaExceeded
+	case StatusOverloaded:
+		return ErrCodeOverloaded
+	default:
+		return ErrCodeRateLimited
+	}
+}
@@ -20,8 +20,9 @@ package core
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -41,6 +42,9 @@ type Text2SQLSkill struct {
 	auditLogger    *AuditLogger
 	cache          *QueryCache
 	semTopology    *SemanticTopology
+	redactor       *Redactor
+	rateLimiter    *RateLimiter
+	workerPool     *WorkerPool
 	closed         bool
 }
 
@@ -52,6 +56,30 @@ func NewText2SQLSkill(cfg *config.Config, db *sql.DB) (interfaces.Skill, error)
 	auditLogger := NewAuditLogger(cfg)
 	cache := NewQueryCache(cfg)
 	semTopology := NewSemanticTopology()
+	redactor, err := NewRedactor(cfg.Security.Redaction)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := NewAccessPolicy(cfg.Security.RBAC)
+	if err != nil {
+		return nil, err
+	}
+	permCtrl.SetAccessPolicy(policy)
+	cache.SetRoleResolver(permCtrl.RolesFor)
+	masker, err := NewMasker(cfg.Security.Masking)
+	if err != nil {
+		return nil, err
+	}
+	permCtrl.SetMasker(masker)
+	injectionGuard, err := NewInjectionGuard(cfg.Security.InjectionGuard)
+	if err != nil {
+		return nil, err
+	}
+	guardSystem.SetInjectionGuard(injectionGuard)
+	rateLimiter, err := NewRateLimiter(cfg.RateLimit)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Text2SQLSkill{
 		db:             db,
@@ -63,6 +91,9 @@ func NewText2SQLSkill(cfg *config.Config, db *sql.DB) (interfaces.Skill, error)
 		auditLogger:    auditLogger,
 		cache:          cache,
 		semTopology:    semTopology,
+		redactor:       redactor,
+		rateLimiter:    rateLimiter,
+		workerPool:     NewWorkerPool(cfg.Performance),
 	}, nil
 }
 
@@ -82,112 +113,105 @@ func (s *Text2SQLSkill) Execute(ctx context.Context, input string) (interfaces.S
 	startTime := time.Now()
 
 	if s.cfg.Audit.Enabled {
-		s.auditLogger.LogEvent(queryID, "execution_start", map[string]interface{}{
+		s.auditLogger.LogEventContext(ctx, queryID, "execution_start", map[string]interface{}{
 			"input": input,
 		})
 	}
 
 	defer func() {
-		duration := time.Since(startTime)
+		// 异步模式下 LogEventContext 只把记录放入队列，同步调用保证记录在 Close 排空队列前入队
 		if s.cfg.Audit.Enabled {
-			if s.cfg.Performance.AsyncProcessing {
-				go s.auditLogger.LogEvent(queryID, "execution_end", map[string]interface{}{
-					"duration_ms": duration.Milliseconds(),
-				})
-			} else {
-				s.auditLogger.LogEvent(queryID, "execution_end", map[string]interface{}{
-					"duration_ms": duration.Milliseconds(),
-				})
-			}
+			s.auditLogger.LogEventContext(ctx, queryID, "execution_end", map[string]interface{}{
+				"duration_ms": time.Since(startTime).Milliseconds(),
+			})
 		}
 	}()
 
+	// Caller identity is checked before the cache so anonymous requests never see cached results
+	if allowed, reason := s.guardSystem.CheckCaller(ctx); !allowed {
+		return s.rejectByGuard(ctx, queryID, input, Decision{
+			Action: ActionDeny,
+			Guard:  GuardCallerIdentity,
+			Code:   "IDENTITY_REQUIRED",
+			Reason: reason,
+		}), nil
+	}
+
+	// Rate limits and daily quotas
+	if decision := s.rateLimiter.Admit(ctx); !decision.Allowed {
+		return s.rejectByLimit(ctx, queryID, input, decision), nil
+	}
+
 	// Check cache first
 	if s.cfg.Cache.Enabled {
-		if result, found := s.cache.Get(input); found {
+		if result, found := s.cache.GetContext(ctx, input); found {
 			if s.cfg.Audit.Enabled {
-				s.auditLogger.LogEvent(queryID, "cache_hit", map[string]interface{}{
-					"input": input,
+				s.auditLogger.LogEventContext(ctx, queryID, "cache_hit", map[string]interface{}{
+					"input":  input,
+					"status": result.Status,
 				})
 			}
 			return result, nil
 		}
 	}
 
-	// Five layer guard check
-	if allowed, reason := s.guardSystem.CheckAllGuards(ctx, input); !allowed {
-		result := interfaces.SkillResult{
-			QueryID:   queryID,
-			Meta:      []byte(reason),
-			Timestamp: time.Now(),
-			Status:    "rejected",
-		}
-
-		if s.cfg.Audit.Enabled {
-			s.auditLogger.LogEvent(queryID, "rejected", map[string]interface{}{
-				"input":  input,
-				"reason": reason,
-			})
-		}
-
-		return result, nil
+	// Guards, SQL generation and access control
+	guards := s.newGuardRun(ctx, queryID, input)
+	plan, rejected := s.planQuery(ctx, queryID, input, guards)
+	if rejected != nil {
+		return *rejected, nil
 	}
+	template, query, args := plan.template, plan.query, plan.args
 
-	// Build semantic topology
-	topology := s.semTopology.BuildTopology([]byte(input))
-	if topology == nil {
-		result := interfaces.SkillResult{
-			QueryID:   queryID,
-			Meta:      []byte("topology_build_failed"),
-			Timestamp: time.Now(),
-			Status:    "error",
-		}
-
-		if s.cfg.Audit.Enabled {
-			s.auditLogger.LogEvent(queryID, "topology_error", map[string]interface{}{
-				"input": input,
-			})
+	// Admission control: bounded worker pool with priority queue
+	queueWait, err := s.workerPool.Acquire(ctx, PriorityFromContext(ctx))
+	if err != nil {
+		if errors.Is(err, ErrOverloaded) {
+			return s.rejectByLimit(ctx, queryID, input, LimitDecision{
+				Status:     StatusOverloaded,
+				Reason:     err.Error(),
+				RetryAfter: time.Second,
+			}), nil
 		}
-
-		return result, nil
+		return s.executionError(ctx, queryID, input, err), nil
 	}
-
-	// Generate query template
-	fingerprint := s.semTopology.GenerateTopologyFingerprint(topology)
-	template := s.evolver.GetQueryTemplate(fingerprint)
+	// 任何返回路径（包括 panic）都归还执行槽位
+	defer s.workerPool.Release()
 
 	// Execute with isolation
+	reportProgress(ctx, ProgressEvent{QueryID: queryID, Stage: ProgressExecuting})
 	execCtx, cancel := s.executionCtrl.GetExecutionContext(ctx)
 	defer cancel()
 
-	rows, err := s.executeQueryWithIsolation(execCtx, template, input)
+	dbStart := time.Now()
+	rows, err := s.executeQueryWithIsolation(execCtx, query, args)
 	if err != nil {
-		result := interfaces.SkillResult{
-			QueryID:   queryID,
-			Meta:      []byte("execution_failed: " + err.Error()),
-			Timestamp: time.Now(),
-			Status:    "error",
-		}
+		s.rateLimiter.Record(ctx, 0, time.Since(dbStart))
+		return s.executionError(ctx, queryID, input, err), nil
+	}
 
-		if s.cfg.Audit.Enabled {
-			s.auditLogger.LogEvent(queryID, "execution_error", map[string]interface{}{
-				"input":   input,
-				"error":   err.Error(),
-				"timeout": s.cfg.Execution.Timeout.Total,
-			})
-		}
+	// Process results
+	resultData, maskedColumns := s.processResultRows(execCtx, queryID, rows, plan.maskPlan)
+	s.rateLimiter.Record(ctx, len(resultData), time.Since(dbStart))
 
-		return result, nil
+	// 读取过程中被取消或超时，不返回不完整的结果
+	if err := execCtx.Err(); err != nil {
+		return s.executionError(ctx, queryID, input, err), nil
 	}
 
-	// Process results
-	resultData := s.processResultRows(rows)
 	// 使用安全配置中的资源限制
 	maxRows := s.cfg.Security.ResourceLimits.MaxRows
 	if len(resultData) > maxRows {
 		resultData = resultData[:maxRows]
 	}
 
+	// Guard chain: post-result
+	guards.req.Rows = resultData
+	if denied := guards.run(PhasePostResult); denied != nil {
+		return s.rejectByGuard(ctx, queryID, input, *denied), nil
+	}
+	resultData = guards.req.Rows
+
 	// Generate encrypted result
 	compress := s.cfg.Performance.Compression.Enabled
 	encryptedResult := utils.EncryptResult(resultData, compress)
@@ -196,41 +220,375 @@ func (s *Text2SQLSkill) Execute(ctx context.Context, input string) (interfaces.S
 	result := interfaces.SkillResult{
 		QueryID:   queryID,
 		Result:    encryptedResult,
-		Meta:      s.generateMetadata(input, template, len(resultData)),
+		Meta:      s.generateMetadata(input, template, len(resultData), maskedColumns, guards.decisions),
 		Timestamp: time.Now(),
 		Status:    "success",
 	}
 
 	// Cache result
 	if s.cfg.Cache.Enabled {
-		s.cache.Set(input, result)
+		s.cache.SetContext(ctx, input, result)
 	}
 
 	// Audit success
 	if s.cfg.Audit.Enabled {
-		s.auditLogger.LogEvent(queryID, "success", map[string]interface{}{
+		fields := map[string]interface{}{
 			"input":       input,
 			"template":    template,
 			"row_count":   len(resultData),
 			"duration_ms": time.Since(startTime).Milliseconds(),
-		})
+			"status":      result.Status,
+		}
+		if queueWait > 0 {
+			fields["queue_wait_ms"] = queueWait.Milliseconds()
+		}
+		if len(plan.filteredTables) > 0 {
+			fields["row_filters"] = plan.filteredTables
+		}
+		if len(maskedColumns) > 0 {
+			fields["masked_columns"] = maskedColumns
+		}
+		if len(guards.decisions) > 0 {
+			fields["guard_decisions"] = decisionMaps(guards.decisions)
+		}
+		s.auditLogger.LogEventContext(ctx, queryID, "success", fields)
 	}
 
 	return result, nil
 }
 
-func (s *Text2SQLSkill) executeQueryWithIsolation(ctx context.Context, template string, input string) (*sql.Rows, error) {
+// QueryExplanation 查询计划说明：经过守卫链和访问控制后将要执行的 SQL
+type QueryExplanation struct {
+	QueryID        string     `json:"query_id"`
+	Template       string     `json:"template"`            // 生成的 SQL 模板
+	SQL            string     `json:"sql"`                 // 行级安全改写后实际执行的 SQL
+	ArgCount       int        `json:"arg_count,omitempty"` // 绑定参数个数，参数值不返回
+	RowFilters     []string   `json:"row_filters,omitempty"`
+	GuardDecisions []Decision `json:"guard_decisions,omitempty"`
+}
+
+// Explain 生成并检查查询但不执行，拒绝时返回 *SkillError
+func (s *Text2SQLSkill) Explain(ctx context.Context, input string) (*QueryExplanation, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("skill is closed")
+	}
+	s.mu.Unlock()
+
+	queryID := utils.GenerateQueryID()
+	if allowed, reason := s.guardSystem.CheckCaller(ctx); !allowed {
+		return nil, ResultError(s.rejectByGuard(ctx, queryID, input, Decision{
+			Action: ActionDeny,
+			Guard:  GuardCallerIdentity,
+			Code:   "IDENTITY_REQUIRED",
+			Reason: reason,
+		}))
+	}
+
+	guards := s.newGuardRun(ctx, queryID, input)
+	plan, rejected := s.planQuery(ctx, queryID, input, guards)
+	if rejected != nil {
+		return nil, ResultError(*rejected)
+	}
+
+	if s.cfg.Audit.Enabled {
+		fields := map[string]interface{}{
+			"input":    input,
+			"template": plan.template,
+			"status":   "explained",
+		}
+		if len(plan.filteredTables) > 0 {
+			fields["row_filters"] = plan.filteredTables
+		}
+		s.auditLogger.LogEventContext(ctx, queryID, "explain", fields)
+	}
+
+	explanation := &QueryExplanation{
+		QueryID:    queryID,
+		Template:   plan.template,
+		SQL:        plan.query,
+		ArgCount:   len(plan.args),
+		RowFilters: plan.filteredTables,
+	}
+	for _, d := range guards.decisions {
+		d.Reason = s.redactor.RedactString(d.Reason)
+		explanation.GuardDecisions = append(explanation.GuardDecisions, d)
+	}
+	return explanation, nil
+}
+
+// guardRun 一次查询的守卫链状态，各阶段共享同一个请求并累积决定
+type guardRun struct {
+	skill     *Text2SQLSkill
+	ctx       context.Context
+	queryID   string
+	input     string
+	req       *GuardRequest
+	decisions []Decision
+}
+
+func (s *Text2SQLSkill) newGuardRun(ctx context.Context, queryID, input string) *guardRun {
+	return &guardRun{
+		skill:   s,
+		ctx:     ctx,
+		queryID: queryID,
+		input:   input,
+		req:     &GuardRequest{Input: input, Principal: PrincipalFromContext(ctx)},
+	}
+}
+
+// run 运行一个阶段的守卫，返回拒绝的决定
+func (r *guardRun) run(phase GuardPhase) *Decision {
+	outcome := r.skill.guardSystem.Run(r.ctx, phase, r.req)
+	r.decisions = append(r.decisions, outcome.Decisions...)
+	r.skill.logShadowDecisions(r.ctx, r.queryID, r.input, phase, r.req.SQL, outcome.Shadowed())
+	return outcome.Denied
+}
+
+// queryPlan 通过守卫链和访问控制、可以执行的查询
+type queryPlan struct {
+	template       string
+	query          string
+	args           []interface{}
+	filteredTables []string
+	maskPlan       *MaskPlan
+}
+
+// planQuery 运行 pre_generation 到 pre_execution 阶段的守卫，生成 SQL 并应用访问控制。
+// 被拒绝或生成失败时返回的结果非空
+func (s *Text2SQLSkill) planQuery(ctx context.Context, queryID, input string, guards *guardRun) (*queryPlan, *interfaces.SkillResult) {
+	principal := guards.req.Principal
+
+	// Guard chain: pre-generation (L1-L6 and custom guards)
+	if denied := guards.run(PhasePreGeneration); denied != nil {
+		return rejectedPlan(s.rejectByGuard(ctx, queryID, input, *denied))
+	}
+	reportProgress(ctx, ProgressEvent{QueryID: queryID, Stage: ProgressGuardsPassed})
+
+	// Build semantic topology
+	topology := s.semTopology.BuildTopology([]byte(guards.req.Input))
+	if topology == nil {
+		result := errorResult(queryID, "error", &SkillError{
+			Code:    ErrCodeGenerationFailed,
+			Message: "topology_build_failed",
+		})
+
+		if s.cfg.Audit.Enabled {
+			s.auditLogger.LogEventContext(ctx, queryID, "topology_error", map[string]interface{}{
+				"input":      input,
+				"status":     result.Status,
+				"error_code": string(ErrCodeGenerationFailed),
+			})
+		}
+
+		return nil, &result
+	}
+
+	// Generate query template
+	fingerprint := s.semTopology.GenerateTopologyFingerprint(topology)
+	template := s.evolver.GetQueryTemplate(fingerprint)
+
+	// Guard chain: post-generation
+	guards.req.SQL = template
+	if denied := guards.run(PhasePostGeneration); denied != nil {
+		return rejectedPlan(s.rejectByGuard(ctx, queryID, input, *denied))
+	}
+	template = guards.req.SQL
+
+	// Role-based access control on generated SQL
+	if denied, err := s.permissionCtrl.CheckSQLAccess(principal, template); err != nil || len(denied) > 0 {
+		reason := "RBAC: access denied to " + strings.Join(denied, ", ")
+		if err != nil {
+			reason = "RBAC: " + err.Error()
+		}
+		return rejectedPlan(s.rejectByPolicy(ctx, queryID, input, template, reason, denied))
+	}
+
+	// Row-level security filters
+	query, args, filteredTables, err := s.permissionCtrl.ApplyRowSecurity(principal, template)
+	if err != nil {
+		return rejectedPlan(s.rejectByPolicy(ctx, queryID, input, template, "RLS: "+err.Error(), nil))
+	}
+
+	// Column masking plan
+	maskPlan, err := s.permissionCtrl.PlanMasking(principal, template)
+	if err != nil {
+		return rejectedPlan(s.rejectByPolicy(ctx, queryID, input, template, "MASKING: "+err.Error(), nil))
+	}
+
+	// Guard chain: pre-execution
+	guards.req.SQL, guards.req.Args = query, args
+	if denied := guards.run(PhasePreExecution); denied != nil {
+		return rejectedPlan(s.rejectByGuard(ctx, queryID, input, *denied))
+	}
+	reportProgress(ctx, ProgressEvent{QueryID: queryID, Stage: ProgressSQLGenerated})
+
+	return &queryPlan{
+		template:       template,
+		query:          guards.req.SQL,
+		args:           args,
+		filteredTables: filteredTables,
+		maskPlan:       maskPlan,
+	}, nil
+}
+
+func rejectedPlan(result interfaces.SkillResult) (*queryPlan, *interfaces.SkillResult) {
+	return nil, &result
+}
+
+// rejectByGuard 生成守卫拒绝结果并记录审计
+func (s *Text2SQLSkill) rejectByGuard(ctx context.Context, queryID, input string, decision Decision) interfaces.SkillResult {
+	result := errorResult(queryID, "rejected", &SkillError{
+		Code:      ErrCodeGuardRejected,
+		Message:   s.redactor.RedactString(decision.Reason),
+		Guard:     decision.Guard,
+		GuardCode: decision.Code,
+	})
+
+	if s.cfg.Audit.Enabled {
+		s.auditLogger.LogEventContext(ctx, queryID, "rejected", map[string]interface{}{
+			"input":      input,
+			"reason":     decision.Reason,
+			"guard":      decision.Guard,
+			"code":       decision.Code,
+			"status":     result.Status,
+			"error_code": string(ErrCodeGuardRejected),
+		})
+	}
+
+	return result
+}
+
+// logShadowDecisions 记录 monitor 模式守卫本应拒绝或改写的决定，供 audit shadow 报告汇总
+func (s *Text2SQLSkill) logShadowDecisions(ctx context.Context, queryID, input string, phase GuardPhase, template string, decisions []Decision) {
+	if !s.cfg.Audit.Enabled {
+		return
+	}
+	for _, decision := range decisions {
+		fields := map[string]interface{}{
+			"input":  input,
+			"phase":  string(phase),
+			"guard":  decision.Guard,
+			"action": string(decision.Action),
+			"code":   decision.Code,
+			"reason": decision.Reason,
+			"mode":   "monitor",
+		}
+		if template != "" {
+			fields["template"] = template
+		}
+		s.auditLogger.LogEventContext(ctx, queryID, "shadow_decision", fields)
+	}
+}
+
+// rejectByPolicy 生成访问策略拒绝结果并记录审计
+func (s *Text2SQLSkill) rejectByPolicy(ctx context.Context, queryID, input, template, reason string, denied []string) interfaces.SkillResult {
+	result := errorResult(queryID, "rejected", &SkillError{
+		Code:    ErrCodeAccessDenied,
+		Message: s.redactor.RedactString(reason),
+		Denied:  denied,
+	})
+
+	if s.cfg.Audit.Enabled {
+		fields := map[string]interface{}{
+			"input":      input,
+			"template":   template,
+			"reason":     reason,
+			"roles":      s.permissionCtrl.RolesFor(PrincipalFromContext(ctx)),
+			"status":     result.Status,
+			"error_code": string(ErrCodeAccessDenied),
+		}
+		if len(denied) > 0 {
+			fields["denied"] = denied
+		}
+		s.auditLogger.LogEventContext(ctx, queryID, "rejected", fields)
+	}
+
+	return result
+}
+
+// rejectByLimit 生成限流或配额拒绝结果，Meta 中带有重试等待时间
+func (s *Text2SQLSkill) rejectByLimit(ctx context.Context, queryID, input string, decision LimitDecision) interfaces.SkillResult {
+	code := limitErrorCode(decision.Status)
+	result := errorResult(queryID, decision.Status, &SkillError{
+		Code:              code,
+		Message:           decision.Reason,
+		RetryAfterSeconds: decision.RetryAfterSeconds(),
+	})
+
+	if s.cfg.Audit.Enabled {
+		fields := map[string]interface{}{
+			"input":          input,
+			"reason":         decision.Reason,
+			"retry_after_ms": decision.RetryAfter.Milliseconds(),
+			"status":         result.Status,
+			"error_code":     string(code),
+		}
+		s.auditLogger.LogEventContext(ctx, queryID, "rejected", fields)
+	}
+
+	return result
+}
+
+// executionError 生成执行失败结果并记录审计
+func (s *Text2SQLSkill) executionError(ctx context.Context, queryID, input string, err error) interfaces.SkillResult {
+	code := executionErrorCode(err)
+	result := errorResult(queryID, "error", &SkillError{
+		Code:    code,
+		Message: s.redactor.RedactString("execution_failed: " + err.Error()),
+	})
+
+	if s.cfg.Audit.Enabled {
+		s.auditLogger.LogEventContext(ctx, queryID, "execution_error", map[string]interface{}{
+			"input":      input,
+			"error":      err.Error(),
+			"timeout":    s.cfg.Execution.Timeout.Total,
+			"status":     result.Status,
+			"error_code": string(code),
+		})
+	}
+
+	return result
+}
+
+// RegisterGuard 注册自定义守卫，按 security.guards 中的配置排序和启用
+func (s *Text2SQLSkill) RegisterGuard(guard Guard) error {
+	return s.guardSystem.Register(guard)
+}
+
+// AddInjectionClassifier 为提示词注入检测注册外部分类器，未启用 injection_guard 时返回错误
+func (s *Text2SQLSkill) AddInjectionClassifier(classifier InjectionClassifier) error {
+	guard := s.guardSystem.InjectionGuard()
+	if guard == nil {
+		return fmt.Errorf("injection guard is not enabled")
+	}
+	guard.AddClassifier(classifier)
+	return nil
+}
+
+// WorkerPoolStats 返回工作池状态，包括队列深度和排队时间
+func (s *Text2SQLSkill) WorkerPoolStats() WorkerPoolStats {
+	return s.workerPool.Stats()
+}
+
+// QuotaUsage 返回调用方当日的配额用量，未启用限流时返回 nil
+func (s *Text2SQLSkill) QuotaUsage(ctx context.Context) map[string]QuotaUsage {
+	return s.rateLimiter.Usage(ctx)
+}
+
+func (s *Text2SQLSkill) executeQueryWithIsolation(ctx context.Context, query string, args []interface{}) (*sql.Rows, error) {
 	switch s.executionCtrl.GetIsolationLevel() {
 	case "full":
-		return s.executeQueryWithFullIsolation(ctx, template, input)
+		return s.executeQueryWithFullIsolation(ctx, query, args)
 	case "basic":
-		return s.executeQueryWithBasicIsolation(ctx, template, input)
+		return s.executeQueryWithBasicIsolation(ctx, query, args)
 	default:
-		return s.db.QueryContext(ctx, template)
+		return s.db.QueryContext(ctx, query, args...)
 	}
 }
 
-func (s *Text2SQLSkill) executeQueryWithFullIsolation(ctx context.Context, template string, input string) (*sql.Rows, error) {
+func (s *Text2SQLSkill) executeQueryWithFullIsolation(ctx context.Context, query string, args []interface{}) (*sql.Rows, error) {
 	resultChan := make(chan struct {
 		rows *sql.Rows
 		err  error
@@ -246,7 +604,7 @@ func (s *Text2SQLSkill) executeQueryWithFullIsolation(ctx context.Context, templ
 			}
 		}()
 
-		rows, err := s.db.QueryContext(ctx, template)
+		rows, err := s.db.QueryContext(ctx, query, args...)
 		resultChan <- struct {
 			rows *sql.Rows
 			err  error
@@ -265,12 +623,12 @@ func (s *Text2SQLSkill) executeQueryWithFullIsolation(ctx context.Context, templ
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	case <-time.After(timeout):
-		return nil, fmt.Errorf("execution timeout after %v", timeout)
+		return nil, fmt.Errorf("execution timeout after %v: %w", timeout, context.DeadlineExceeded)
 	}
 }
 
-func (s *Text2SQLSkill) executeQueryWithBasicIsolation(ctx context.Context, template string, input string) (*sql.Rows, error) {
-	rows, err := s.db.QueryContext(ctx, template)
+func (s *Text2SQLSkill) executeQueryWithBasicIsolation(ctx context.Context, query string, args []interface{}) (*sql.Rows, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -288,7 +646,7 @@ func (s *Text2SQLSkill) executeQueryWithBasicIsolation(ctx context.Context, temp
 	return rows, nil
 }
 
-func (s *Text2SQLSkill) processResultRows(rows *sql.Rows) []map[string]interface{} {
+func (s *Text2SQLSkill) processResultRows(ctx context.Context, queryID string, rows *sql.Rows, maskPlan *MaskPlan) ([]map[string]interface{}, []string) {
 	defer rows.Close()
 
 	columns, _ := rows.Columns()
@@ -321,33 +679,67 @@ func (s *Text2SQLSkill) processResultRows(rows *sql.Rows) []map[string]interface
 			continue
 		}
 
-		row := make(map[string]interface{})
-		for i, col := range columns {
+		scanned := make([]interface{}, len(columns))
+		for i := range columns {
 			switch v := values[i].(type) {
 			case *int64:
-				row[col] = *v
+				scanned[i] = *v
 			case *float64:
-				row[col] = *v
+				scanned[i] = *v
 			case *string:
-				row[col] = *v
+				scanned[i] = *v
 			}
 		}
+		if maskPlan != nil {
+			maskPlan.Apply(columns, scanned)
+		}
+
+		row := make(map[string]interface{})
+		for i, col := range columns {
+			row[col] = scanned[i]
+		}
 		results = append(results, row)
+		if len(results)%progressRowInterval == 0 {
+			reportProgress(ctx, ProgressEvent{QueryID: queryID, Stage: ProgressRowsScanned, Rows: len(results)})
+		}
 	}
+	reportProgress(ctx, ProgressEvent{QueryID: queryID, Stage: ProgressRowsScanned, Rows: len(results)})
 
-	return results
+	var masked []string
+	if maskPlan != nil {
+		masked = maskPlan.MaskedColumns(columns)
+	}
+	return results, masked
 }
 
-func (s *Text2SQLSkill) generateMetadata(input string, template string, rowCount int) []byte {
-	metadata := map[string]interface{}{
-		"input_length":  len(input),
-		"template_used": template,
-		"row_count":     rowCount,
-		"timestamp":     time.Now().UTC().Format("2006-01-02 15:04:05"),
+func (s *Text2SQLSkill) generateMetadata(input string, template string, rowCount int, maskedColumns []string, guardDecisions []Decision) []byte {
+	metadata := ResultMeta{
+		Status:        "success",
+		Timestamp:     time.Now().UTC().Format("2006-01-02 15:04:05"),
+		InputLength:   len(input),
+		TemplateUsed:  template,
+		RowCount:      rowCount,
+		MaskedColumns: maskedColumns,
+	}
+	if len(guardDecisions) > 0 {
+		metadata.GuardDecisions = s.redactor.redactValue(decisionMaps(guardDecisions))
 	}
+	return metadata.Marshal()
+}
+
+// QueryAudit 查询审计记录，供 MCP 服务和管理工具使用
+func (s *Text2SQLSkill) QueryAudit(filter AuditFilter) ([]*AuditEntry, error) {
+	return s.auditLogger.Query(filter)
+}
 
-	data, _ := json.Marshal(metadata)
-	return data
+// GuardStats 返回各守卫的运行计数，包括 monitor 模式下的影子决定
+func (s *Text2SQLSkill) GuardStats() map[string]GuardStats {
+	return s.guardSystem.Stats()
+}
+
+// AuditStats 返回审计队列状态，包括被丢弃的事件数
+func (s *Text2SQLSkill) AuditStats() AuditStats {
+	return s.auditLogger.Stats()
 }
 
 func (s *Text2SQLSkill) SafeShutdown() error {
@@ -358,10 +750,16 @@ func (s *Text2SQLSkill) SafeShutdown() error {
 		return nil
 	}
 
+	if s.cache != nil {
+		s.cache.Close()
+	}
+
 	if s.auditLogger != nil {
 		s.auditLogger.Close()
 	}
 
+	s.rateLimiter.Close()
+
 	if s.db != nil {
 		s.db.Close()
 	}
@@ -0,0 +1,943 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type sqlTokenKind int
+
+const (
+	sqlIdent sqlTokenKind = iota
+	sqlQuotedIdent
+	sqlKeyword
+	sqlString
+	sqlNumber
+	sqlParam
+	sqlPunct
+)
+
+// sqlToken 词法单元，start/end 为在原 SQL 中的字节位置，供改写使用
+type sqlToken struct {
+	kind  sqlTokenKind
+	value string // 标识符为小写去引号后的名称，关键字为大写
+	start int
+	end   int
+}
+
+// sqlKeywords 不能作为列名解析的保留字
+var sqlKeywords = map[string]bool{
+	"ALL": true, "ALTER": true, "AND": true, "ANY": true, "AS": true, "ASC": true,
+	"BETWEEN": true, "BY": true, "CALL": true, "CASE": true, "COLLATE": true, "CREATE": true,
+	"CROSS": true, "CURRENT_DATE": true, "CURRENT_TIME": true, "CURRENT_TIMESTAMP": true,
+	"CURRENT_USER": true, "DELETE": true, "DESC": true, "DISTINCT": true, "DIV": true,
+	"DROP": true, "ELSE": true, "END": true, "ESCAPE": true, "EXCEPT": true, "EXEC": true,
+	"EXECUTE": true, "EXISTS": true, "FALSE": true, "FETCH": true, "FILTER": true,
+	"FOLLOWING": true, "FOR": true, "FROM": true, "FULL": true, "GRANT": true, "GROUP": true,
+	"HAVING": true, "ILIKE": true, "IN": true, "INNER": true, "INSERT": true, "INTERSECT": true,
+	"INTERVAL": true, "INTO": true, "IS": true, "JOIN": true, "LATERAL": true, "LEFT": true,
+	"LIKE": true, "LIMIT": true, "LOCALTIME": true, "LOCALTIMESTAMP": true, "MATERIALIZED": true,
+	"MERGE": true, "MOD": true, "NATURAL": true, "NOT": true, "NULL": true, "NULLS": true,
+	"OFFSET": true, "ON": true, "ONLY": true, "OR": true, "ORDER": true, "OUTER": true,
+	"OVER": true, "PARTITION": true, "PRECEDING": true, "RECURSIVE": true, "REGEXP": true,
+	"REPLACE": true, "RETURNING": true, "REVOKE": true, "RIGHT": true, "RLIKE": true,
+	"SELECT": true, "SESSION_USER": true, "SET": true, "SOME": true, "THEN": true,
+	"TRUE": true, "TRUNCATE": true, "UNBOUNDED": true, "UNION": true, "UPDATE": true,
+	"USING": true, "VALUES": true, "WHEN": true, "WHERE": true, "WINDOW": true, "WITH": true,
+	"WITHIN": true, "XOR": true,
+}
+
+// sqlIntervalUnits INTERVAL 表达式中的时间单位
+var sqlIntervalUnits = map[string]bool{
+	"microsecond": true, "second": true, "minute": true, "hour": true, "day": true,
+	"week": true, "month": true, "quarter": true, "year": true,
+	"seconds": true, "minutes": true, "hours": true, "days": true, "weeks": true,
+	"months": true, "years": true,
+}
+
+// tokenizeSQL 将 SQL 切分为词法单元，注释被丢弃。
+// 含反斜杠的字符串在不同方言中含义不同，为避免解析歧义直接拒绝。
+func tokenizeSQL(query string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	i := 0
+	for i < len(query) {
+		c := query[i]
+		switch {
+		case isSQLSpace(c):
+			i++
+
+		case c == '-' && strings.HasPrefix(query[i:], "--") && (i+2 == len(query) || isSQLSpace(query[i+2])):
+			// MySQL 中 "--1" 不是注释，只把后跟空白的 -- 视为注释，# 按运算符处理，保证解析范围不小于实际执行范围
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+
+		case c == '/' && strings.HasPrefix(query[i:], "/*!"):
+			return nil, fmt.Errorf("executable comment at offset %d is not supported", i)
+
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment at offset %d", i)
+			}
+			i += end + 4
+
+		case c == '\'':
+			end, err := scanQuoted(query, i, '\'')
+			if err != nil {
+				return nil, err
+			}
+			if strings.ContainsRune(query[i:end], '\\') {
+				return nil, fmt.Errorf("backslash in string literal at offset %d is not supported", i)
+			}
+			tokens = append(tokens, sqlToken{kind: sqlString, value: query[i:end], start: i, end: end})
+			i = end
+
+		case c == '"' || c == '`':
+			end, err := scanQuoted(query, i, c)
+			if err != nil {
+				return nil, err
+			}
+			name := strings.ReplaceAll(query[i+1:end-1], string([]byte{c, c}), string(c))
+			tokens = append(tokens, sqlToken{kind: sqlQuotedIdent, value: strings.ToLower(name), start: i, end: end})
+			i = end
+
+		case c == '$' && i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9':
+			j := i + 1
+			for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlParam, value: query[i:j], start: i, end: j})
+			i = j
+
+		case c == '$':
+			// PostgreSQL dollar-quoted string: $tag$ ... $tag$
+			j := i + 1
+			for j < len(query) && (isIdentByte(query[j])) {
+				j++
+			}
+			if j >= len(query) || query[j] != '$' {
+				return nil, fmt.Errorf("unexpected '$' at offset %d", i)
+			}
+			tag := query[i : j+1]
+			end := strings.Index(query[j+1:], tag)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated dollar-quoted string at offset %d", i)
+			}
+			stop := j + 1 + end + len(tag)
+			tokens = append(tokens, sqlToken{kind: sqlString, value: query[i:stop], start: i, end: stop})
+			i = stop
+
+		case c == '?':
+			tokens = append(tokens, sqlToken{kind: sqlParam, value: "?", start: i, end: i + 1})
+			i++
+
+		case c == ':' && i+1 < len(query) && query[i+1] == ':':
+			tokens = append(tokens, sqlToken{kind: sqlPunct, value: "::", start: i, end: i + 2})
+			i += 2
+
+		case c == ':' && i+1 < len(query) && isIdentStart(rune(query[i+1])):
+			j := i + 1
+			for j < len(query) && (isIdentByte(query[j]) || query[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlParam, value: query[i:j], start: i, end: j})
+			i = j
+
+		case c >= '0' && c <= '9', c == '.' && i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9':
+			j := i
+			for j < len(query) && (query[j] >= '0' && query[j] <= '9' || query[j] == '.') {
+				j++
+			}
+			if j < len(query) && (query[j] == 'e' || query[j] == 'E') {
+				k := j + 1
+				if k < len(query) && (query[k] == '+' || query[k] == '-') {
+					k++
+				}
+				if k < len(query) && query[k] >= '0' && query[k] <= '9' {
+					j = k
+					for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+						j++
+					}
+				}
+			}
+			tokens = append(tokens, sqlToken{kind: sqlNumber, value: query[i:j], start: i, end: j})
+			i = j
+
+		default:
+			r, size := utf8.DecodeRuneInString(query[i:])
+			if isIdentStart(r) {
+				j := i + size
+				for j < len(query) {
+					r, size := utf8.DecodeRuneInString(query[j:])
+					if !isIdentStart(r) && !unicode.IsDigit(r) && r != '$' {
+						break
+					}
+					j += size
+				}
+				word := query[i:j]
+				if upper := strings.ToUpper(word); sqlKeywords[upper] {
+					tokens = append(tokens, sqlToken{kind: sqlKeyword, value: upper, start: i, end: j})
+				} else {
+					tokens = append(tokens, sqlToken{kind: sqlIdent, value: strings.ToLower(word), start: i, end: j})
+				}
+				i = j
+				continue
+			}
+
+			op := query[i : i+size]
+			for _, two := range []string{"<=", ">=", "<>", "!=", "||", "->", "=>"} {
+				if strings.HasPrefix(query[i:], two) {
+					op = two
+					break
+				}
+			}
+			tokens = append(tokens, sqlToken{kind: sqlPunct, value: op, start: i, end: i + len(op)})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+func scanQuoted(query string, start int, quote byte) (int, error) {
+	i := start + 1
+	for i < len(query) {
+		if query[i] == quote {
+			if i+1 < len(query) && query[i+1] == quote {
+				i += 2
+				continue
+			}
+			return i + 1, nil
+		}
+		i++
+	}
+	return 0, fmt.Errorf("unterminated quoted string at offset %d", start)
+}
+
+func isSQLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// SQLTableRef SQL 中引用的基表
+type SQLTableRef struct {
+	Schema    string
+	Name      string
+	Alias     string
+	Operation string // 语句目标表为语句操作，其余引用为 SELECT
+	Renamed   bool   // 别名带有列别名清单，例如 t(a, b)
+
+	nameStart  int // 表名在原 SQL 中的位置
+	nameEnd    int
+	aliasStart int // 别名部分的开始位置，没有别名时等于 refEnd
+	refEnd     int // 包含别名的引用结束位置
+	lastName   string
+}
+
+// QualifiedName 返回 schema.table 或 table
+func (t *SQLTableRef) QualifiedName() string {
+	if t.Schema != "" {
+		return t.Schema + "." + t.Name
+	}
+	return t.Name
+}
+
+// SQLColumnRef SQL 中引用的列。Tables 为该列可能所属的基表：
+// 带限定符时只有一个；未限定时包含当前及外层查询的全部基表，权限检查按最严格处理。
+// 引用 CTE 或派生表的列不记录，其来源列在对应子查询中检查。
+type SQLColumnRef struct {
+	Name   string
+	Star   bool
+	Tables []*SQLTableRef
+
+	Virtual        bool // 可能引用 CTE 或派生表的列
+	WholeRow       bool // 把表别名当作值使用的整行引用，例如 row_to_json(c)
+	TopLevel       bool // 位于最外层查询块
+	OutputPosition int  // 作为最外层选择列表中单独一项时的位置（从 1 开始），否则为 0
+}
+
+// SQLAnalysis SQL 语句解析结果
+type SQLAnalysis struct {
+	SQL       string
+	Operation string
+	Tables    []*SQLTableRef
+	Columns   []SQLColumnRef
+	Params    int  // 占位符数量
+	SetOp     bool // 最外层使用了 UNION / INTERSECT / EXCEPT
+	Renamed   bool // 派生表或 CTE 使用了列别名清单
+}
+
+type sqlClause int
+
+const (
+	clauseNone sqlClause = iota
+	clauseSelect
+	clauseFrom
+	clauseOn
+	clauseExpr
+	clauseOrder // ORDER BY / GROUP BY / HAVING，可以引用输出列别名
+	clauseDeleteTargets
+)
+
+// sqlScope 一个查询块的名称作用域
+type sqlScope struct {
+	parent  *sqlScope
+	ctes    map[string]bool
+	aliases map[string]*SQLTableRef // nil 值表示 CTE 或派生表
+	tables  []*SQLTableRef
+	outputs map[string]bool
+	pending []pendingColumn
+}
+
+type pendingColumn struct {
+	parts      []string
+	star       bool
+	allowAlias bool
+	wholeRow   bool
+	top        bool
+	position   int
+}
+
+func newSQLScope(parent *sqlScope) *sqlScope {
+	return &sqlScope{
+		parent:  parent,
+		aliases: make(map[string]*SQLTableRef),
+		outputs: make(map[string]bool),
+	}
+}
+
+func (s *sqlScope) isCTE(name string) bool {
+	for scope := s; scope != nil; scope = scope.parent {
+		if scope.ctes[name] {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *sqlScope) hasVirtual() bool {
+	for _, ref := range s.aliases {
+		if ref == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *sqlScope) lookup(name string) (*SQLTableRef, bool) {
+	for scope := s; scope != nil; scope = scope.parent {
+		if ref, ok := scope.aliases[name]; ok {
+			return ref, true
+		}
+	}
+	return nil, false
+}
+
+type sqlParser struct {
+	tokens   []sqlToken
+	match    []int
+	analysis *SQLAnalysis
+}
+
+// AnalyzeSQL 解析单条 SQL 语句，提取引用的表和列。
+// 无法可靠解析的语句返回错误，调用方应按拒绝处理。
+func AnalyzeSQL(query string) (*SQLAnalysis, error) {
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		return nil, err
+	}
+
+	end := len(tokens)
+	for end > 0 && tokens[end-1].value == ";" && tokens[end-1].kind == sqlPunct {
+		end--
+	}
+	for _, tok := range tokens[:end] {
+		if tok.kind == sqlPunct && tok.value == ";" {
+			return nil, fmt.Errorf("multiple statements are not allowed")
+		}
+	}
+	if end == 0 {
+		return nil, fmt.Errorf("empty statement")
+	}
+	params := 0
+	for _, tok := range tokens[:end] {
+		if tok.kind == sqlParam {
+			params++
+		}
+	}
+
+	p := &sqlParser{
+		tokens:   tokens[:end],
+		match:    make([]int, end),
+		analysis: &SQLAnalysis{SQL: query, Params: params},
+	}
+
+	var stack []int
+	for i, tok := range p.tokens {
+		if tok.kind != sqlPunct {
+			continue
+		}
+		switch tok.value {
+		case "(":
+			stack = append(stack, i)
+		case ")":
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("unbalanced parentheses at offset %d", tok.start)
+			}
+			open := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			p.match[open] = i
+			p.match[i] = open
+		}
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("unbalanced parentheses at offset %d", p.tokens[stack[0]].start)
+	}
+
+	op, err := p.block(0, end, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	p.analysis.Operation = op
+	return p.analysis, nil
+}
+
+func (p *sqlParser) isPunct(i int, value string) bool {
+	return i < len(p.tokens) && p.tokens[i].kind == sqlPunct && p.tokens[i].value == value
+}
+
+func (p *sqlParser) isKeyword(i int, value string) bool {
+	return i < len(p.tokens) && p.tokens[i].kind == sqlKeyword && p.tokens[i].value == value
+}
+
+func (p *sqlParser) isName(i int) bool {
+	return i < len(p.tokens) && (p.tokens[i].kind == sqlIdent || p.tokens[i].kind == sqlQuotedIdent)
+}
+
+// isSubquery 判断 ( 之后是否为子查询
+func (p *sqlParser) isSubquery(open int) bool {
+	i := open + 1
+	for p.isPunct(i, "(") {
+		i++
+	}
+	return p.isKeyword(i, "SELECT") || p.isKeyword(i, "WITH")
+}
+
+// blockOperation 返回查询块的语句类型
+func (p *sqlParser) blockOperation(start, end int) (string, error) {
+	i := start
+	for i < end && p.isPunct(i, "(") {
+		i++
+	}
+	if i >= end {
+		return "", fmt.Errorf("empty statement")
+	}
+	switch tok := p.tokens[i]; {
+	case tok.kind == sqlKeyword && (tok.value == "SELECT" || tok.value == "INSERT" ||
+		tok.value == "UPDATE" || tok.value == "DELETE"):
+		return tok.value, nil
+	default:
+		return "", fmt.Errorf("unsupported statement: %s", strings.ToUpper(tok.value))
+	}
+}
+
+// block 解析 [start, end) 范围内的一个查询块（可带 WITH 子句）
+func (p *sqlParser) block(start, end int, parent *sqlScope, top bool) (string, error) {
+	i := start
+	outer := parent
+	if p.isKeyword(i, "WITH") {
+		i++
+		recursive := p.isKeyword(i, "RECURSIVE")
+		if recursive {
+			i++
+		}
+		outer = newSQLScope(parent)
+		outer.ctes = make(map[string]bool)
+		for {
+			if !p.isName(i) {
+				return "", fmt.Errorf("expected CTE name at offset %d", p.offset(i))
+			}
+			name := p.tokens[i].value
+			// 非递归 CTE 的定义体中同名引用指向真实表
+			if recursive {
+				outer.ctes[name] = true
+			}
+			i++
+			if p.isPunct(i, "(") {
+				i = p.match[i] + 1
+				p.analysis.Renamed = true
+			}
+			if !p.isKeyword(i, "AS") {
+				return "", fmt.Errorf("expected AS at offset %d", p.offset(i))
+			}
+			i++
+			if p.isKeyword(i, "NOT") {
+				i++
+			}
+			if p.isKeyword(i, "MATERIALIZED") {
+				i++
+			}
+			if !p.isPunct(i, "(") {
+				return "", fmt.Errorf("expected ( at offset %d", p.offset(i))
+			}
+			closing := p.match[i]
+			if _, err := p.block(i+1, closing, outer, false); err != nil {
+				return "", err
+			}
+			outer.ctes[name] = true
+			i = closing + 1
+			if !p.isPunct(i, ",") {
+				break
+			}
+			i++
+		}
+	}
+
+	op, err := p.blockOperation(i, end)
+	if err != nil {
+		return "", err
+	}
+	return op, p.segment(i, end, outer, op, top)
+}
+
+func (p *sqlParser) offset(i int) int {
+	if i < len(p.tokens) {
+		return p.tokens[i].start
+	}
+	if len(p.tokens) == 0 {
+		return 0
+	}
+	return p.tokens[len(p.tokens)-1].end
+}
+
+// segment 顺序扫描查询块，收集表引用和列引用
+func (p *sqlParser) segment(start, end int, parent *sqlScope, op string, top bool) error {
+	scope := newSQLScope(parent)
+	clause := clauseNone
+	item := 0
+	var clauses []sqlClause
+	expectTable := false
+	target := false
+	sawTarget := false
+
+	for i := start; i < end; {
+		tok := p.tokens[i]
+
+		switch tok.kind {
+		case sqlPunct:
+			switch tok.value {
+			case "(":
+				closing := p.match[i]
+				if p.isSubquery(i) {
+					if _, err := p.block(i+1, closing, scope, false); err != nil {
+						return err
+					}
+					i = closing + 1
+					if expectTable {
+						// 派生表，别名指向虚拟表
+						alias, renamed, next := p.alias(i)
+						if alias != "" {
+							scope.aliases[alias] = nil
+						}
+						if renamed {
+							p.analysis.Renamed = true
+						}
+						i = next
+						expectTable = false
+					}
+					continue
+				}
+				clauses = append(clauses, clause)
+				i++
+				// EXTRACT(YEAR FROM x) 中的时间单位不是列
+				if i >= 2 && p.tokens[i-2].kind == sqlIdent && p.tokens[i-2].value == "extract" && p.isName(i) {
+					i++
+				}
+				continue
+			case ")":
+				if len(clauses) > 0 {
+					clause = clauses[len(clauses)-1]
+					clauses = clauses[:len(clauses)-1]
+				}
+			case ",":
+				if len(clauses) == 0 && (clause == clauseFrom || clause == clauseOn) {
+					clause = clauseFrom
+					expectTable = true
+				}
+				if len(clauses) == 0 && clause == clauseSelect {
+					item++
+				}
+			case "*":
+				if clause == clauseSelect && i > start {
+					prev := p.tokens[i-1]
+					if prev.value == "," || prev.kind == sqlKeyword && (prev.value == "SELECT" || prev.value == "DISTINCT" || prev.value == "ALL") {
+						scope.pending = append(scope.pending, pendingColumn{star: true, top: top})
+					}
+				}
+			case "::":
+				// PostgreSQL 类型转换，跳过类型名
+				if p.isName(i + 1) {
+					i += 2
+					continue
+				}
+			}
+			i++
+
+		case sqlKeyword:
+			switch tok.value {
+			case "SELECT":
+				if op == "INSERT" && sawTarget {
+					// INSERT ... SELECT 的查询部分使用独立作用域
+					if err := p.resolve(scope); err != nil {
+						return err
+					}
+					return p.segment(i, end, parent, "SELECT", top)
+				}
+				clause = clauseSelect
+				item = 1
+			case "FROM":
+				if len(clauses) == 0 {
+					clause = clauseFrom
+					expectTable = true
+					if op == "DELETE" && !sawTarget {
+						target = true
+					}
+				}
+			case "JOIN":
+				clause = clauseFrom
+				expectTable = true
+			case "INTO":
+				if op != "INSERT" {
+					return fmt.Errorf("SELECT INTO is not supported")
+				}
+				expectTable = true
+				target = true
+			case "UPDATE":
+				if op == "UPDATE" && i == start {
+					expectTable = true
+					target = true
+					clause = clauseFrom
+				}
+			case "DELETE":
+				if op == "DELETE" && i == start {
+					clause = clauseDeleteTargets
+				}
+			case "ON", "USING":
+				// INSERT ... ON DUPLICATE KEY / ON CONFLICT 不是连接条件
+				if clause == clauseFrom && !(p.isName(i+1) && (p.tokens[i+1].value == "duplicate" || p.tokens[i+1].value == "conflict")) {
+					clause = clauseOn
+				} else {
+					clause = clauseExpr
+				}
+				expectTable = false
+			case "WHERE", "SET", "VALUES", "RETURNING", "LIMIT", "OFFSET", "WINDOW":
+				clause = clauseExpr
+				expectTable = false
+			case "GROUP", "ORDER", "HAVING":
+				clause = clauseOrder
+				expectTable = false
+			case "UNION", "INTERSECT", "EXCEPT":
+				if err := p.resolve(scope); err != nil {
+					return err
+				}
+				scope = newSQLScope(parent)
+				clause = clauseNone
+				if top {
+					p.analysis.SetOp = true
+				}
+				expectTable = false
+			case "INTERVAL":
+				i++
+				if i < end && (p.tokens[i].kind == sqlNumber || p.tokens[i].kind == sqlString || p.tokens[i].kind == sqlParam) {
+					i++
+				}
+				if p.isName(i) && sqlIntervalUnits[p.tokens[i].value] && !p.isPunct(i+1, ".") {
+					i++
+				}
+				continue
+			}
+			i++
+
+		case sqlIdent, sqlQuotedIdent:
+			parts, star, next := p.qualifiedName(i)
+
+			if expectTable {
+				if p.isPunct(next, "(") && !(target && op == "INSERT") {
+					return fmt.Errorf("table function %s is not supported", strings.Join(parts, "."))
+				}
+				if star || len(parts) > 3 {
+					return fmt.Errorf("invalid table reference at offset %d", tok.start)
+				}
+				alias, renamed, after := p.alias(next)
+				name := parts[len(parts)-1]
+				key := alias
+				if key == "" {
+					key = name
+				}
+
+				if len(parts) == 1 && scope.isCTE(name) {
+					scope.aliases[key] = nil
+				} else {
+					last := p.tokens[next-1]
+					ref := &SQLTableRef{
+						Name:       name,
+						Alias:      alias,
+						Operation:  "SELECT",
+						Renamed:    renamed,
+						nameStart:  tok.start,
+						nameEnd:    last.end,
+						aliasStart: p.tokens[after-1].end,
+						refEnd:     p.tokens[after-1].end,
+						lastName:   p.analysis.SQL[last.start:last.end],
+					}
+					if alias != "" {
+						ref.aliasStart = p.tokens[next].start
+					}
+					if len(parts) > 1 {
+						ref.Schema = parts[len(parts)-2]
+					}
+					if target {
+						ref.Operation = op
+						sawTarget = true
+					}
+					scope.aliases[key] = ref
+					scope.tables = append(scope.tables, ref)
+					p.analysis.Tables = append(p.analysis.Tables, ref)
+
+					if target && op == "INSERT" && p.isPunct(after, "(") {
+						// INSERT 列清单
+						closing := p.match[after]
+						for k := after + 1; k < closing; k++ {
+							if p.isName(k) {
+								p.analysis.Columns = append(p.analysis.Columns, SQLColumnRef{
+									Name:   p.tokens[k].value,
+									Tables: []*SQLTableRef{ref},
+								})
+							}
+						}
+						after = closing + 1
+					}
+				}
+				target = false
+				expectTable = false
+				i = after
+				continue
+			}
+
+			switch {
+			case clause == clauseDeleteTargets:
+			case p.isPunct(next, "(") && !star:
+				// 函数调用
+			case next < end && p.tokens[next].kind == sqlString && len(parts) == 1:
+				// 类型化字面量，例如 DATE '2024-01-01'
+				next++
+			case i > start && p.isKeyword(i-1, "AS"):
+				if clause == clauseSelect && len(parts) == 1 {
+					scope.outputs[parts[0]] = true
+				}
+			case clause == clauseSelect && len(parts) == 1 && len(clauses) == 0 && p.isImplicitAlias(i, next, end):
+				scope.outputs[parts[0]] = true
+			default:
+				col := pendingColumn{
+					parts:      parts,
+					star:       star,
+					allowAlias: clause == clauseOrder,
+					top:        top,
+				}
+				bare := clause == clauseSelect && len(clauses) == 0 && p.isBareItem(i, next, end)
+				if top && !star && bare {
+					col.position = item
+				}
+				// c.* 不单独作为选择项时（如 row_to_json(c.*)）整行作为一个值输出
+				if star && !bare {
+					col.wholeRow = true
+				}
+				scope.pending = append(scope.pending, col)
+			}
+			i = next
+
+		default:
+			i++
+		}
+	}
+
+	return p.resolve(scope)
+}
+
+// qualifiedName 读取 a.b.c 或 a.* 形式的名称
+func (p *sqlParser) qualifiedName(i int) ([]string, bool, int) {
+	parts := []string{p.tokens[i].value}
+	i++
+	for p.isPunct(i, ".") {
+		if p.isName(i + 1) {
+			parts = append(parts, p.tokens[i+1].value)
+			i += 2
+			continue
+		}
+		if p.isPunct(i+1, "*") {
+			return parts, true, i + 2
+		}
+		break
+	}
+	return parts, false, i
+}
+
+// alias 读取可选的 [AS] alias，以及 PostgreSQL 的列别名清单，renamed 表示带有列别名清单
+func (p *sqlParser) alias(i int) (string, bool, int) {
+	alias := ""
+	if p.isKeyword(i, "AS") && p.isName(i+1) {
+		alias = p.tokens[i+1].value
+		i += 2
+	} else if p.isName(i) {
+		alias = p.tokens[i].value
+		i++
+	}
+	if alias != "" && p.isPunct(i, "(") {
+		return alias, true, p.match[i] + 1
+	}
+	return alias, false, i
+}
+
+// isBareItem 判断名称是否单独构成选择列表中的一项（可带别名）
+func (p *sqlParser) isBareItem(i, next, end int) bool {
+	prev := p.tokens[i-1]
+	if !(prev.kind == sqlPunct && prev.value == "," ||
+		prev.kind == sqlKeyword && (prev.value == "SELECT" || prev.value == "DISTINCT" || prev.value == "ALL")) {
+		return false
+	}
+	k := next
+	if p.isKeyword(k, "AS") && p.isName(k+1) {
+		k += 2
+	} else if p.isName(k) {
+		k++
+	}
+	return k >= end || p.isPunct(k, ",") || p.isKeyword(k, "FROM")
+}
+
+// isImplicitAlias 判断选择列表中省略 AS 的列别名，例如 SUM(x) total
+func (p *sqlParser) isImplicitAlias(i, next, end int) bool {
+	if i == 0 {
+		return false
+	}
+	prev := p.tokens[i-1]
+	endsOperand := prev.kind == sqlIdent || prev.kind == sqlQuotedIdent ||
+		prev.kind == sqlString || prev.kind == sqlNumber || prev.kind == sqlParam ||
+		prev.kind == sqlPunct && prev.value == ")" ||
+		prev.kind == sqlKeyword && (prev.value == "END" || prev.value == "NULL" || prev.value == "TRUE" || prev.value == "FALSE")
+	if !endsOperand {
+		return false
+	}
+	return next >= end || p.isPunct(next, ",") || p.isKeyword(next, "FROM")
+}
+
+// resolve 将作用域内的列引用解析到基表
+func (p *sqlParser) resolve(scope *sqlScope) error {
+	for _, col := range scope.pending {
+		switch {
+		case len(col.parts) == 0:
+			// 未限定的 *，展开为当前查询块的全部基表
+			for _, ref := range scope.tables {
+				p.analysis.Columns = append(p.analysis.Columns, SQLColumnRef{Star: true, Tables: []*SQLTableRef{ref}, TopLevel: col.top})
+			}
+			if scope.hasVirtual() {
+				p.analysis.Columns = append(p.analysis.Columns, SQLColumnRef{Star: true, Virtual: true, TopLevel: col.top})
+			}
+			continue
+
+		case len(col.parts) == 1 && !col.star:
+			name := col.parts[0]
+			if col.allowAlias && scope.outputs[name] {
+				continue
+			}
+			var candidates []*SQLTableRef
+			for s := scope; s != nil; s = s.parent {
+				candidates = append(candidates, s.tables...)
+			}
+			if len(candidates) > 0 || scope.hasVirtual() {
+				p.analysis.Columns = append(p.analysis.Columns, SQLColumnRef{
+					Name:           name,
+					Tables:         candidates,
+					Virtual:        scope.hasVirtual(),
+					TopLevel:       col.top,
+					OutputPosition: col.position,
+				})
+			}
+			// PostgreSQL 中与表别名同名的未限定名称可以是整行引用
+			if ref, ok := scope.lookup(name); ok {
+				row := SQLColumnRef{Name: name, WholeRow: true, Virtual: ref == nil, TopLevel: col.top}
+				if ref != nil {
+					row.Tables = []*SQLTableRef{ref}
+				}
+				p.analysis.Columns = append(p.analysis.Columns, row)
+			}
+			continue
+		}
+
+		qualifier := col.parts
+		name := ""
+		if !col.star {
+			qualifier = col.parts[:len(col.parts)-1]
+			name = col.parts[len(col.parts)-1]
+		}
+
+		ref, err := p.resolveQualifier(scope, qualifier)
+		if err != nil {
+			return err
+		}
+		column := SQLColumnRef{Name: name, Star: col.star, WholeRow: col.wholeRow, TopLevel: col.top, OutputPosition: col.position}
+		if ref == nil {
+			// CTE 或派生表
+			column.Virtual = true
+		} else {
+			column.Tables = []*SQLTableRef{ref}
+		}
+		p.analysis.Columns = append(p.analysis.Columns, column)
+	}
+	scope.pending = nil
+	return nil
+}
+
+func (p *sqlParser) resolveQualifier(scope *sqlScope, qualifier []string) (*SQLTableRef, error) {
+	if len(qualifier) == 1 {
+		if ref, ok := scope.lookup(qualifier[0]); ok {
+			return ref, nil
+		}
+		return nil, fmt.Errorf("unknown table reference: %s", qualifier[0])
+	}
+
+	schema, table := qualifier[len(qualifier)-2], qualifier[len(qualifier)-1]
+	for s := scope; s != nil; s = s.parent {
+		for _, ref := range s.tables {
+			if ref.Name == table && ref.Schema == schema {
+				return ref, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unknown table reference: %s.%s", schema, table)
+}
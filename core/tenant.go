@@ -0,0 +1,257 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+
+	"text2sql-skill/config"
+	"text2sql-skill/interfaces"
+	"text2sql-skill/utils"
+)
+
+// TenantRouter 多租户技能，按请求的租户路由到各自独立的 Text2SQLSkill。
+// 每个租户拥有独立的数据库连接池、查询缓存、审计存储、资源限制和安全策略。
+type TenantRouter struct {
+	mu            sync.Mutex
+	cfg           *config.Config
+	defaultTenant string
+	tenants       map[string]*Text2SQLSkill
+	closed        bool
+}
+
+// NewTenantRouter 为每个租户创建技能实例。dbs 为各租户的数据库连接，
+// 关闭路由器时一并关闭
+func NewTenantRouter(cfg *config.Config, dbs map[string]*sql.DB) (*TenantRouter, error) {
+	if !cfg.MultiTenancy.Enabled {
+		return nil, fmt.Errorf("multi_tenancy is not enabled")
+	}
+
+	router := &TenantRouter{
+		cfg:           cfg,
+		defaultTenant: cfg.MultiTenancy.DefaultTenant,
+		tenants:       make(map[string]*Text2SQLSkill),
+	}
+	for _, tenant := range cfg.MultiTenancy.Tenants {
+		db, ok := dbs[tenant.Name]
+		if !ok {
+			router.SafeShutdown()
+			return nil, fmt.Errorf("tenant '%s': no database connection", tenant.Name)
+		}
+		tenantCfg, err := cfg.ForTenant(tenant.Name)
+		if err != nil {
+			router.SafeShutdown()
+			return nil, err
+		}
+		skill, err := NewText2SQLSkill(tenantCfg, db)
+		if err != nil {
+			router.SafeShutdown()
+			return nil, fmt.Errorf("tenant '%s': %v", tenant.Name, err)
+		}
+		router.tenants[tenant.Name] = skill.(*Text2SQLSkill)
+	}
+	return router, nil
+}
+
+func (r *TenantRouter) CapabilityID() string {
+	return r.cfg.App.Name + "-" + r.cfg.App.Version
+}
+
+// Tenants 返回已配置的租户名
+func (r *TenantRouter) Tenants() []string {
+	names := make([]string, 0, len(r.tenants))
+	for name := range r.tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveTenant 确定请求所属租户：认证身份中的租户优先，请求参数指定的租户
+// 与之不一致时拒绝；两者都没有时使用默认租户。未绑定租户的调用方只能使用
+// 默认租户，拥有 admin 权限时才能指定其他租户
+func (r *TenantRouter) ResolveTenant(ctx context.Context) (string, error) {
+	requested := TenantFromContext(ctx)
+	tenant := requested
+	if principal := PrincipalFromContext(ctx); principal != nil {
+		switch {
+		case principal.Tenant != "":
+			if requested != "" && requested != principal.Tenant {
+				return "", fmt.Errorf("caller is not allowed to access tenant '%s'", requested)
+			}
+			tenant = principal.Tenant
+		case requested != "" && requested != r.defaultTenant && !principal.HasScope(ScopeAdmin):
+			return "", fmt.Errorf("caller is not bound to tenant '%s'", requested)
+		}
+	}
+	if tenant == "" {
+		tenant = r.defaultTenant
+	}
+	if tenant == "" {
+		return "", fmt.Errorf("tenant is required")
+	}
+	if _, ok := r.tenants[tenant]; !ok {
+		return "", fmt.Errorf("unknown tenant '%s'", tenant)
+	}
+	return tenant, nil
+}
+
+func (r *TenantRouter) Execute(ctx context.Context, input string) (interfaces.SkillResult, error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return interfaces.SkillResult{}, fmt.Errorf("skill is closed")
+	}
+	r.mu.Unlock()
+
+	tenant, err := r.ResolveTenant(ctx)
+	if err != nil {
+		return errorResult(utils.GenerateQueryID(), "rejected", &SkillError{
+			Code:    ErrCodeInvalidTenant,
+			Message: "TENANT: " + err.Error(),
+		}), nil
+	}
+	return r.tenants[tenant].Execute(WithTenant(ctx, tenant), input)
+}
+
+// Explain 在调用方所属租户中生成并检查查询但不执行
+func (r *TenantRouter) Explain(ctx context.Context, input string) (*QueryExplanation, error) {
+	tenant, err := r.ResolveTenant(ctx)
+	if err != nil {
+		return nil, &SkillError{Code: ErrCodeInvalidTenant, Message: "TENANT: " + err.Error()}
+	}
+	return r.tenants[tenant].Explain(WithTenant(ctx, tenant), input)
+}
+
+// DescribeSchema 返回调用方所属租户中有权查询的表和列
+func (r *TenantRouter) DescribeSchema(ctx context.Context) ([]TableSchema, error) {
+	tenant, err := r.ResolveTenant(ctx)
+	if err != nil {
+		return nil, &SkillError{Code: ErrCodeInvalidTenant, Message: "TENANT: " + err.Error()}
+	}
+	return r.tenants[tenant].DescribeSchema(WithTenant(ctx, tenant))
+}
+
+// QueryAudit 查询 filter.Tenant 指定租户的审计记录，未指定时使用默认租户。
+// 不校验调用方身份，面向调用方的服务应使用 QueryAuditContext
+func (r *TenantRouter) QueryAudit(filter AuditFilter) ([]*AuditEntry, error) {
+	return r.QueryAuditContext(context.Background(), filter)
+}
+
+// QueryAuditContext 查询调用方所属租户的审计记录，filter.Tenant 与调用方租户不一致时拒绝
+func (r *TenantRouter) QueryAuditContext(ctx context.Context, filter AuditFilter) ([]*AuditEntry, error) {
+	if filter.Tenant != "" {
+		if requested := TenantFromContext(ctx); requested != "" && requested != filter.Tenant {
+			return nil, &SkillError{Code: ErrCodeInvalidTenant, Message: fmt.Sprintf("TENANT: caller is not allowed to access tenant '%s'", filter.Tenant)}
+		}
+		ctx = WithTenant(ctx, filter.Tenant)
+	}
+	tenant, err := r.ResolveTenant(ctx)
+	if err != nil {
+		return nil, &SkillError{Code: ErrCodeInvalidTenant, Message: "TENANT: " + err.Error()}
+	}
+	filter.Tenant = tenant
+	return r.tenants[tenant].QueryAudit(filter)
+}
+
+// AuditStats 汇总各租户的审计队列状态，明细见 Tenants
+func (r *TenantRouter) AuditStats() AuditStats {
+	stats := AuditStats{
+		Level:    r.cfg.Audit.Level,
+		Overflow: r.cfg.Audit.Queue.Overflow,
+		Tenants:  make(map[string]AuditStats),
+	}
+	if stats.Overflow == "" {
+		stats.Overflow = OverflowBlock
+	}
+	for name, skill := range r.tenants {
+		tenantStats := skill.AuditStats()
+		stats.QueueLength += tenantStats.QueueLength
+		stats.QueueCapacity += tenantStats.QueueCapacity
+		stats.Dropped += tenantStats.Dropped
+		stats.Spilled += tenantStats.Spilled
+		stats.WriteErrors += tenantStats.WriteErrors
+		stats.Tenants[name] = tenantStats
+	}
+	return stats
+}
+
+// WorkerPoolStats 汇总各租户工作池状态
+func (r *TenantRouter) WorkerPoolStats() WorkerPoolStats {
+	var stats WorkerPoolStats
+	var totalWait float64
+	for _, skill := range r.tenants {
+		tenantStats := skill.WorkerPoolStats()
+		stats.Size += tenantStats.Size
+		stats.Running += tenantStats.Running
+		stats.QueueCapacity += tenantStats.QueueCapacity
+		stats.QueueDepth += tenantStats.QueueDepth
+		stats.InteractiveQueued += tenantStats.InteractiveQueued
+		stats.BatchQueued += tenantStats.BatchQueued
+		stats.Admitted += tenantStats.Admitted
+		stats.Queued += tenantStats.Queued
+		stats.Shed += tenantStats.Shed
+		stats.TimedOut += tenantStats.TimedOut
+		if tenantStats.MaxWaitMS > stats.MaxWaitMS {
+			stats.MaxWaitMS = tenantStats.MaxWaitMS
+		}
+		totalWait += tenantStats.AvgWaitMS * float64(tenantStats.Queued)
+	}
+	if stats.Queued > 0 {
+		stats.AvgWaitMS = totalWait / float64(stats.Queued)
+	}
+	return stats
+}
+
+// GuardStats 汇总各租户的守卫运行计数
+func (r *TenantRouter) GuardStats() map[string]GuardStats {
+	stats := make(map[string]GuardStats)
+	for _, skill := range r.tenants {
+		for name, tenantStats := range skill.GuardStats() {
+			total := stats[name]
+			total.Phase = tenantStats.Phase
+			total.Mode = tenantStats.Mode
+			total.Checks += tenantStats.Checks
+			total.Denied += tenantStats.Denied
+			total.Warned += tenantStats.Warned
+			total.Rewritten += tenantStats.Rewritten
+			total.ShadowDenied += tenantStats.ShadowDenied
+			total.ShadowRewritten += tenantStats.ShadowRewritten
+			stats[name] = total
+		}
+	}
+	return stats
+}
+
+func (r *TenantRouter) SafeShutdown() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	for _, skill := range r.tenants {
+		skill.SafeShutdown()
+	}
+	r.closed = true
+	return nil
+}
@@ -0,0 +1,246 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"text2sql-skill/config"
+)
+
+// StatusOverloaded 准入控制拒绝：队列已满或排队超时
+const StatusOverloaded = "overloaded"
+
+// ErrOverloaded 工作池无法在限定时间内接纳请求
+var ErrOverloaded = errors.New("overloaded")
+
+// Priority 请求优先级，空闲的工作槽优先分配给 interactive 请求
+type Priority int
+
+const (
+	PriorityInteractive Priority = iota
+	PriorityBatch
+)
+
+func (p Priority) String() string {
+	if p == PriorityBatch {
+		return "batch"
+	}
+	return "interactive"
+}
+
+// ParsePriority 解析 interactive / batch，空字符串视为 interactive
+func ParsePriority(name string) (Priority, error) {
+	switch name {
+	case "", "interactive":
+		return PriorityInteractive, nil
+	case "batch":
+		return PriorityBatch, nil
+	default:
+		return PriorityInteractive, fmt.Errorf("unknown priority '%s'", name)
+	}
+}
+
+type priorityKey struct{}
+
+// WithPriority 设置请求优先级
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// PriorityFromContext 读取请求优先级，未设置时为 interactive
+func PriorityFromContext(ctx context.Context) Priority {
+	priority, _ := ctx.Value(priorityKey{}).(Priority)
+	return priority
+}
+
+// WorkerPoolStats 工作池状态
+type WorkerPoolStats struct {
+	Size              int     `json:"size"`
+	Running           int     `json:"running"`
+	QueueCapacity     int     `json:"queue_capacity"`
+	QueueDepth        int     `json:"queue_depth"`
+	InteractiveQueued int     `json:"interactive_queued"`
+	BatchQueued       int     `json:"batch_queued"`
+	Admitted          uint64  `json:"admitted"`
+	Queued            uint64  `json:"queued"` // 经过排队后被接纳的请求数
+	Shed              uint64  `json:"shed"`   // 队列已满被拒绝
+	TimedOut          uint64  `json:"timed_out"`
+	AvgWaitMS         float64 `json:"avg_wait_ms"`
+	MaxWaitMS         int64   `json:"max_wait_ms"`
+}
+
+type poolWaiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// WorkerPool 限制同时访问数据库的查询数，超出的请求按优先级排队
+type WorkerPool struct {
+	mu             sync.Mutex
+	size           int
+	running        int
+	queueSize      int
+	batchQueueSize int
+	queueTimeout   time.Duration
+	waiting        [2][]*poolWaiter // 按 Priority 分队列
+
+	admitted  uint64
+	queued    uint64
+	shed      uint64
+	timedOut  uint64
+	totalWait time.Duration
+	maxWait   time.Duration
+}
+
+// NewWorkerPool 根据 performance.worker_pool_size 和 performance.admission 创建工作池
+func NewWorkerPool(cfg config.PerformanceConfig) *WorkerPool {
+	pool := &WorkerPool{
+		size:           cfg.WorkerPoolSize,
+		queueSize:      cfg.Admission.QueueSize,
+		batchQueueSize: cfg.Admission.BatchQueueSize,
+	}
+	if pool.size <= 0 {
+		pool.size = 1
+	}
+	if pool.batchQueueSize == 0 {
+		pool.batchQueueSize = pool.queueSize
+	}
+	if cfg.Admission.QueueTimeout != "" {
+		if timeout, err := time.ParseDuration(cfg.Admission.QueueTimeout); err == nil {
+			pool.queueTimeout = timeout
+		}
+	}
+	return pool
+}
+
+// Acquire 占用一个工作槽，返回排队时间。队列已满或排队超时时返回 ErrOverloaded，
+// ctx 结束时返回 ctx 的错误。成功后必须调用 Release。
+func (p *WorkerPool) Acquire(ctx context.Context, priority Priority) (time.Duration, error) {
+	p.mu.Lock()
+	if p.running < p.size && len(p.waiting[PriorityInteractive])+len(p.waiting[PriorityBatch]) == 0 {
+		p.running++
+		p.admitted++
+		p.mu.Unlock()
+		return 0, nil
+	}
+
+	depth := len(p.waiting[PriorityInteractive]) + len(p.waiting[PriorityBatch])
+	if depth >= p.queueSize || priority == PriorityBatch && len(p.waiting[PriorityBatch]) >= p.batchQueueSize {
+		p.shed++
+		p.mu.Unlock()
+		return 0, fmt.Errorf("%w: %d queries running, %d queued", ErrOverloaded, p.size, depth)
+	}
+
+	waiter := &poolWaiter{ready: make(chan struct{})}
+	p.waiting[priority] = append(p.waiting[priority], waiter)
+	p.mu.Unlock()
+
+	start := time.Now()
+	var timeout <-chan time.Time
+	if p.queueTimeout > 0 {
+		timer := time.NewTimer(p.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var err error
+	select {
+	case <-waiter.ready:
+	case <-timeout:
+		err = fmt.Errorf("%w: queued for %v", ErrOverloaded, p.queueTimeout)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	wait := time.Since(start)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// 超时与分配同时发生时以分配为准，避免工作槽泄漏
+	if err != nil && !waiter.granted {
+		p.remove(priority, waiter)
+		if errors.Is(err, ErrOverloaded) {
+			p.timedOut++
+		}
+		return wait, err
+	}
+
+	p.admitted++
+	p.queued++
+	p.totalWait += wait
+	if wait > p.maxWait {
+		p.maxWait = wait
+	}
+	return wait, nil
+}
+
+// Release 归还工作槽，优先交给排队中的 interactive 请求
+func (p *WorkerPool) Release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, priority := range []Priority{PriorityInteractive, PriorityBatch} {
+		if queue := p.waiting[priority]; len(queue) > 0 {
+			waiter := queue[0]
+			p.waiting[priority] = queue[1:]
+			waiter.granted = true
+			close(waiter.ready)
+			return
+		}
+	}
+	p.running--
+}
+
+func (p *WorkerPool) remove(priority Priority, waiter *poolWaiter) {
+	queue := p.waiting[priority]
+	for i, w := range queue {
+		if w == waiter {
+			p.waiting[priority] = append(queue[:i], queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// Stats 返回工作池状态，包括队列深度和排队时间
+func (p *WorkerPool) Stats() WorkerPoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := WorkerPoolStats{
+		Size:              p.size,
+		Running:           p.running,
+		QueueCapacity:     p.queueSize,
+		InteractiveQueued: len(p.waiting[PriorityInteractive]),
+		BatchQueued:       len(p.waiting[PriorityBatch]),
+		Admitted:          p.admitted,
+		Queued:            p.queued,
+		Shed:              p.shed,
+		TimedOut:          p.timedOut,
+		MaxWaitMS:         p.maxWait.Milliseconds(),
+	}
+	stats.QueueDepth = stats.InteractiveQueued + stats.BatchQueued
+	if p.queued > 0 {
+		stats.AvgWaitMS = float64(p.totalWait) / float64(time.Millisecond) / float64(p.queued)
+	}
+	return stats
+}
@@ -0,0 +1,55 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package drivers
+
+import (
+	"database/sql"
+	"fmt"
+
+	// 引入纯 Go 实现的 SQLite 驱动（无需 CGO）
+	_ "modernc.org/sqlite"
+)
+
+// RegisterSQLiteDriver 返回 SQLite 驱动名称
+func RegisterSQLiteDriver() string {
+	// modernc.org/sqlite 驱动已经自动注册为 "sqlite"
+	return "sqlite"
+}
+
+// CreateSQLiteConnection 打开 SQLite 数据库文件，启用 WAL 和忙等待
+func CreateSQLiteConnection(path string) (*sql.DB, error) {
+	if path == "" {
+		return nil, fmt.Errorf("SQLite path cannot be empty")
+	}
+
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open(RegisterSQLiteDriver(), dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+
+	// SQLite 同一时刻只允许一个写连接
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping SQLite database: %w", err)
+	}
+
+	return db, nil
+}
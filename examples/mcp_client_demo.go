@@ -26,6 +26,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync/atomic"
 	"time"
 )
 
@@ -49,6 +50,7 @@ type MCPClientResponse struct {
 type Text2SQLMCPClient struct {
 	baseURL string
 	client  *http.Client
+	nextID  int64
 }
 
 // NewText2SQLMCPClient 创建新的 MCP 客户端
@@ -66,7 +68,7 @@ func (c *Text2SQLMCPClient) Call(method string, params interface{}) (interface{}
 	req := MCPClientRequest{
 		Method:  method,
 		Params:  params,
-		ID:      1,
+		ID:      int(atomic.AddInt64(&c.nextID, 1)),
 		JSONRPC: "2.0",
 	}
 
@@ -98,17 +100,26 @@ func (c *Text2SQLMCPClient) Call(method string, params interface{}) (interface{}
 	return mcpResp.Result, nil
 }
 
-// Execute 执行 Text2SQL 查询
-func (c *Text2SQLMCPClient) Execute(query string) (interface{}, error) {
-	params := map[string]interface{}{
-		"query": query,
-	}
-	return c.Call("text2sql/execute", params)
+// Initialize 协商协议版本并获取服务端能力
+func (c *Text2SQLMCPClient) Initialize() (interface{}, error) {
+	return c.Call("initialize", map[string]interface{}{
+		"protocolVersion": "2025-06-18",
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]string{"name": "text2sql-mcp-client-demo", "version": "1.0.0"},
+	})
 }
 
-// GetCapabilities 获取技能能力
-func (c *Text2SQLMCPClient) GetCapabilities() (interface{}, error) {
-	return c.Call("text2sql/capabilities", nil)
+// ListTools 列出可用的工具
+func (c *Text2SQLMCPClient) ListTools() (interface{}, error) {
+	return c.Call("tools/list", nil)
+}
+
+// Execute 通过 execute_query 工具执行 Text2SQL 查询，被拒绝的查询返回 isError 结果
+func (c *Text2SQLMCPClient) Execute(query string) (interface{}, error) {
+	return c.Call("tools/call", map[string]interface{}{
+		"name":      "execute_query",
+		"arguments": map[string]interface{}{"query": query},
+	})
 }
 
 // GetHealth 获取健康状态
@@ -141,15 +152,23 @@ func main() {
 	}
 	fmt.Printf("✅ 健康状态: %v\n", health)
 
-	// 2. 获取能力信息
-	fmt.Println("\n2. 📋 获取技能能力...")
-	capabilities, err := client.GetCapabilities()
+	// 2. 初始化并获取工具列表
+	fmt.Println("\n2. 📋 初始化会话...")
+	capabilities, err := client.Initialize()
 	if err != nil {
-		fmt.Printf("❌ 获取能力失败: %v\n", err)
+		fmt.Printf("❌ 初始化失败: %v\n", err)
 		return
 	}
 	capJSON, _ := json.MarshalIndent(capabilities, "", "  ")
-	fmt.Printf("✅ 技能能力:\n%s\n", string(capJSON))
+	fmt.Printf("✅ 服务端能力:\n%s\n", string(capJSON))
+
+	tools, err := client.ListTools()
+	if err != nil {
+		fmt.Printf("❌ 获取工具列表失败: %v\n", err)
+		return
+	}
+	toolsJSON, _ := json.MarshalIndent(tools, "", "  ")
+	fmt.Printf("✅ 可用工具:\n%s\n", string(toolsJSON))
 
 	// 3. 获取配置信息
 	fmt.Println("\n3. ⚙️ 获取配置信息...")
@@ -80,7 +80,8 @@ func main() {
 		"分析产品库存情况",
 	}
 
-	ctx := context.Background()
+	// 嵌入调用时通过 context 传入调用方身份，用于审计、访问控制和限流
+	ctx := core.ContextWithUser(context.Background(), "demo", "analyst")
 
 	for i, query := range examples {
 		fmt.Printf("\n🔍 示例 %d: %s\n", i+1, query)
@@ -142,8 +143,8 @@ func main() {
 		}
 
 		fmt.Printf("📊 状态: %s\n", result.Status)
-		if result.Status == "rejected" {
-			fmt.Printf("✅ 成功拦截: %s\n", string(result.Meta))
+		if skillErr := core.ResultError(result); skillErr != nil {
+			fmt.Printf("✅ 成功拦截: [%s %s] %s\n", skillErr.Code, skillErr.GuardCode, skillErr.Message)
 		}
 	}
 
@@ -22,6 +22,7 @@ import (
 	"database/sql"
 	"flag"
 	"log"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
@@ -33,6 +34,18 @@ import (
 )
 
 func main() {
+	// Subcommands (子命令)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "audit":
+			os.Exit(runAuditCommand(os.Args[2:]))
+		case "apikey":
+			os.Exit(runAPIKeyCommand(os.Args[2:]))
+		case "mcp":
+			os.Exit(runMCPCommand(os.Args[2:]))
+		}
+	}
+
 	configPath := flag.String("config", "./config.yaml", "Path to configuration file")
 	flag.Parse()
 
@@ -41,14 +54,104 @@ func main() {
 		log.Fatalf("ERROR: Failed to load config: %v", err)
 	}
 
+	if err := setupLogging(cfg); err != nil {
+		log.Fatalf("ERROR: Invalid redaction config: %v", err)
+	}
+
 	log.Printf("INFO: Config loaded: %s v%s", cfg.App.Name, cfg.App.Version)
 	log.Printf("INFO: Environment: %s", cfg.App.Environment)
 
 	// Get active database configuration (获取激活的数据库配置)
-	dbDriver, dbDSN := cfg.GetActiveDatabaseConfig()
+	dbDriver, _ := cfg.GetActiveDatabaseConfig()
 	poolConfig := cfg.GetActivePoolConfig()
 	timeoutConfig := cfg.GetActiveTimeoutConfig()
 
+	// Create skill (创建技能)
+	skill, err := newSkill(cfg)
+	if err != nil {
+		log.Fatalf("ERROR: Failed to create skill: %v", err)
+	}
+
+	// Setup graceful shutdown (设置优雅关闭)
+	shutdownCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-shutdownCtx.Done()
+		log.Println("INFO: Shutting down gracefully...")
+		if err := skill.SafeShutdown(); err != nil {
+			log.Printf("WARN: Error during shutdown: %v", err)
+		}
+	}()
+
+	// Display startup information (显示启动信息)
+	log.Println("============================================================")
+	log.Printf("INFO: Text2SQL Skill Engine Started")
+	log.Printf("INFO: Name: %s v%s", cfg.App.Name, cfg.App.Version)
+	log.Printf("INFO: Environment: %s", cfg.App.Environment)
+	log.Printf("INFO: Description: %s", cfg.App.Description)
+	log.Println("----------------------------------------")
+	log.Printf("INFO: Database: %s", dbDriver)
+	log.Printf("INFO: Connections: %d open, %d idle", poolConfig.MaxOpenConnections, poolConfig.MaxIdleConnections)
+	log.Printf("INFO: Query timeout: %s", timeoutConfig.Query)
+	if cfg.MultiTenancy.Enabled {
+		log.Printf("INFO: Tenants: %d (default: %q)", len(cfg.MultiTenancy.Tenants), cfg.MultiTenancy.DefaultTenant)
+	}
+	log.Println("----------------------------------------")
+	log.Printf("INFO: Security mode: %s", cfg.Security.Mode)
+	log.Printf("INFO: Allowed operations: %v", cfg.Security.AllowedOperations)
+	log.Printf("INFO: Forbidden keywords: %d keywords", len(cfg.Security.ForbiddenKeywords))
+	log.Println("----------------------------------------")
+	log.Printf("INFO: Cache: %v (size: %d, TTL: %s)", cfg.Cache.Enabled, cfg.Cache.Size, cfg.Cache.TTL)
+	log.Printf("INFO: Audit logging: %v (level: %s)", cfg.Audit.Enabled, cfg.Audit.Level)
+	log.Printf("INFO: Performance: async=%v, workers=%d", cfg.Performance.AsyncProcessing, cfg.Performance.WorkerPoolSize)
+	log.Println("============================================================")
+	log.Println("INFO: Service is ready and waiting for requests...")
+	log.Println("INFO: Press Ctrl+C to shutdown")
+
+	// Keep the service running (保持服务运行)
+	<-shutdownCtx.Done()
+	log.Println("INFO: Service stopped gracefully")
+}
+
+// setupLogging 日志写到标准错误并脱敏 (Redact PII in application logs)
+func setupLogging(cfg *config.Config) error {
+	redactor, err := core.NewRedactor(cfg.Security.Redaction)
+	if err != nil {
+		return err
+	}
+	log.SetOutput(core.NewRedactingWriter(os.Stderr, redactor))
+	return nil
+}
+
+// newSkill 按配置创建技能，多租户模式下每个租户使用独立的连接池
+func newSkill(cfg *config.Config) (interfaces.Skill, error) {
+	if !cfg.MultiTenancy.Enabled {
+		db := connectDatabase(cfg)
+
+		log.Println("INFO: Creating Text2SQL skill...")
+		return core.NewText2SQLSkill(cfg, db)
+	}
+
+	dbs := make(map[string]*sql.DB)
+	for _, tenant := range cfg.MultiTenancy.Tenants {
+		tenantCfg, err := cfg.ForTenant(tenant.Name)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("INFO: Tenant %s:", tenant.Name)
+		dbs[tenant.Name] = connectDatabase(tenantCfg)
+	}
+
+	log.Println("INFO: Creating multi-tenant Text2SQL skill...")
+	return core.NewTenantRouter(cfg, dbs)
+}
+
+// connectDatabase 按配置打开数据库连接并验证连通性，失败时退出
+func connectDatabase(cfg *config.Config) *sql.DB {
+	dbDriver, dbDSN := cfg.GetActiveDatabaseConfig()
+	poolConfig := cfg.GetActivePoolConfig()
+
 	log.Printf("INFO: Database driver: %s", dbDriver)
 
 	// Register database driver (注册数据库驱动)
@@ -70,7 +173,6 @@ func main() {
 	if err != nil {
 		log.Fatalf("ERROR: Failed to open database connection: %v", err)
 	}
-	defer db.Close()
 
 	// Set connection pool settings (设置连接池配置)
 	db.SetMaxOpenConns(poolConfig.MaxOpenConnections)
@@ -112,51 +214,7 @@ func main() {
 	}
 
 	log.Println("INFO: Database connection successful")
-
-	// Create skill (创建技能)
-	log.Println("INFO: Creating Text2SQL skill...")
-	skill, err := core.NewText2SQLSkill(cfg, db)
-	if err != nil {
-		log.Fatalf("ERROR: Failed to create skill: %v", err)
-	}
-
-	// Setup graceful shutdown (设置优雅关闭)
-	shutdownCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer stop()
-
-	go func() {
-		<-shutdownCtx.Done()
-		log.Println("INFO: Shutting down gracefully...")
-		if err := skill.(interfaces.Skill).SafeShutdown(); err != nil {
-			log.Printf("WARN: Error during shutdown: %v", err)
-		}
-	}()
-
-	// Display startup information (显示启动信息)
-	log.Println("============================================================")
-	log.Printf("INFO: Text2SQL Skill Engine Started")
-	log.Printf("INFO: Name: %s v%s", cfg.App.Name, cfg.App.Version)
-	log.Printf("INFO: Environment: %s", cfg.App.Environment)
-	log.Printf("INFO: Description: %s", cfg.App.Description)
-	log.Println("----------------------------------------")
-	log.Printf("INFO: Database: %s", dbDriver)
-	log.Printf("INFO: Connections: %d open, %d idle", poolConfig.MaxOpenConnections, poolConfig.MaxIdleConnections)
-	log.Printf("INFO: Query timeout: %s", timeoutConfig.Query)
-	log.Println("----------------------------------------")
-	log.Printf("INFO: Security mode: %s", cfg.Security.Mode)
-	log.Printf("INFO: Allowed operations: %v", cfg.Security.AllowedOperations)
-	log.Printf("INFO: Forbidden keywords: %d keywords", len(cfg.Security.ForbiddenKeywords))
-	log.Println("----------------------------------------")
-	log.Printf("INFO: Cache: %v (size: %d, TTL: %s)", cfg.Cache.Enabled, cfg.Cache.Size, cfg.Cache.TTL)
-	log.Printf("INFO: Audit logging: %v (level: %s)", cfg.Audit.Enabled, cfg.Audit.Level)
-	log.Printf("INFO: Performance: async=%v, workers=%d", cfg.Performance.AsyncProcessing, cfg.Performance.WorkerPoolSize)
-	log.Println("============================================================")
-	log.Println("INFO: Service is ready and waiting for requests...")
-	log.Println("INFO: Press Ctrl+C to shutdown")
-
-	// Keep the service running (保持服务运行)
-	<-shutdownCtx.Done()
-	log.Println("INFO: Service stopped gracefully")
+	return db
 }
 
 func init() {
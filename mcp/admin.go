@@ -0,0 +1,208 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"text2sql-skill/core"
+)
+
+// skillErrorCodes 技能错误类型对应的 JSON-RPC 错误码，使用 -32000 到 -32099 的服务端保留区间
+var skillErrorCodes = map[core.ErrorCode]int{
+	core.ErrCodeInternal:         -32000,
+	core.ErrCodeGuardRejected:    -32010,
+	core.ErrCodeAccessDenied:     -32011,
+	core.ErrCodeGenerationFailed: -32012,
+	core.ErrCodeTimeout:          -32013,
+	core.ErrCodeCanceled:         -32014,
+	core.ErrCodeDBError:          -32015,
+	core.ErrCodeRateLimited:      -32020,
+	core.ErrCodeQuotaExceeded:    -32021,
+	core.ErrCodeOverloaded:       -32022,
+	core.ErrCodeInvalidTenant:    -32030,
+}
+
+// rpcErrorCode 返回技能错误类型的 JSON-RPC 错误码，未知类型按内部错误处理
+func rpcErrorCode(code core.ErrorCode) int {
+	if rpcCode, ok := skillErrorCodes[code]; ok {
+		return rpcCode
+	}
+	return skillErrorCodes[core.ErrCodeInternal]
+}
+
+// legacyExecute text2sql/execute 扩展方法，拒绝和失败映射为带结构化数据的 JSON-RPC 错误
+func (s *Server) legacyExecute(ctx context.Context, raw json.RawMessage) (interface{}, *Error) {
+	ctx, cancel, args, rpcErr := queryContext(ctx, raw)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	defer cancel()
+
+	startTime := time.Now()
+	result, err := s.skill.Execute(ctx, args.Query)
+	elapsed := time.Since(startTime)
+	if err != nil {
+		return nil, &Error{Code: rpcErrorCode(core.ErrCodeInternal), Message: "Execution failed", Data: err.Error()}
+	}
+
+	fields, skillErr := resultFields(result)
+	fields["duration_ms"] = elapsed.Milliseconds()
+	if skillErr != nil {
+		return nil, &Error{Code: rpcErrorCode(skillErr.Code), Message: skillErr.Message, Data: fields}
+	}
+	fields["timestamp"] = result.Timestamp.UTC().Format("2006-01-02 15:04:05")
+	return fields, nil
+}
+
+// auditStatsReporter 可以报告审计队列状态的技能实现
+type auditStatsReporter interface {
+	AuditStats() core.AuditStats
+}
+
+// workerPoolReporter 可以报告工作池状态的技能实现
+type workerPoolReporter interface {
+	WorkerPoolStats() core.WorkerPoolStats
+}
+
+// guardStatsReporter 可以报告守卫运行计数的技能实现
+type guardStatsReporter interface {
+	GuardStats() map[string]core.GuardStats
+}
+
+// health text2sql/health 扩展方法。无需权限即可获取状态和版本；队列、工作池和守卫计数
+// 可用于探测守卫行为，只返回给拥有 audit 或 admin 权限的调用方
+func (s *Server) health(ctx context.Context) interface{} {
+	status := "healthy"
+	details := map[string]interface{}{}
+
+	// 审计事件被丢弃或写入失败时标记为降级
+	if reporter, ok := s.skill.(auditStatsReporter); ok {
+		stats := reporter.AuditStats()
+		details["audit"] = stats
+		if stats.Dropped > 0 || stats.WriteErrors > 0 {
+			status = "degraded"
+		}
+	}
+
+	// 等待队列已满时新请求会被拒绝
+	if reporter, ok := s.skill.(workerPoolReporter); ok {
+		stats := reporter.WorkerPoolStats()
+		details["worker_pool"] = stats
+		if stats.QueueDepth >= stats.QueueCapacity && stats.Running >= stats.Size {
+			status = "degraded"
+		}
+	}
+
+	// 包括 monitor 模式守卫的影子决定计数
+	if reporter, ok := s.skill.(guardStatsReporter); ok {
+		details["guards"] = reporter.GuardStats()
+	}
+
+	health := map[string]interface{}{
+		"status":  status,
+		"version": s.cfg.App.Version,
+	}
+	if !s.hasScope(ctx, core.ScopeAudit) {
+		return health
+	}
+	health["timestamp"] = time.Now().UTC().Format("2006-01-02 15:04:05")
+	health["skill"] = s.skill.CapabilityID()
+	for key, value := range details {
+		health[key] = value
+	}
+	return health
+}
+
+// configInfo text2sql/config 扩展方法
+func (s *Server) configInfo() interface{} {
+	return map[string]interface{}{
+		"app": map[string]interface{}{
+			"name":        s.cfg.App.Name,
+			"version":     s.cfg.App.Version,
+			"environment": s.cfg.App.Environment,
+		},
+		"security": map[string]interface{}{
+			"mode":               s.cfg.Security.Mode,
+			"max_input_length":   s.cfg.Security.InputValidation.MaxLength,
+			"max_rows":           s.cfg.Security.ResourceLimits.MaxRows,
+			"max_memory_mb":      s.cfg.Security.ResourceLimits.MaxMemoryMB,
+			"max_result_size_mb": s.cfg.Security.ResourceLimits.MaxResultSizeMB,
+		},
+		"authentication": map[string]interface{}{
+			"enabled":       s.cfg.Authentication.Enabled,
+			"header_name":   s.cfg.Authentication.HeaderName,
+			"validate_only": s.cfg.Authentication.ValidateOnly,
+		},
+		"performance": map[string]interface{}{
+			"cache_enabled":       s.cfg.Cache.Enabled,
+			"cache_size":          s.cfg.Cache.Size,
+			"cache_ttl":           s.cfg.Cache.TTL,
+			"async_processing":    s.cfg.Performance.AsyncProcessing,
+			"worker_pool_size":    s.cfg.Performance.WorkerPoolSize,
+			"compression_enabled": s.cfg.Performance.Compression.Enabled,
+		},
+		"multi_tenancy": map[string]interface{}{
+			"enabled":        s.cfg.MultiTenancy.Enabled,
+			"tenant_param":   "tenant",
+			"default_tenant": s.cfg.MultiTenancy.DefaultTenant != "",
+		},
+	}
+}
+
+// auditQueryable 支持审计查询的技能实现
+type auditQueryable interface {
+	QueryAudit(filter core.AuditFilter) ([]*core.AuditEntry, error)
+}
+
+// tenantAuditQueryable 按调用方租户查询审计记录的技能实现
+type tenantAuditQueryable interface {
+	QueryAuditContext(ctx context.Context, filter core.AuditFilter) ([]*core.AuditEntry, error)
+}
+
+// queryAudit text2sql/audit 扩展方法，多租户时只能查询调用方所属租户
+func (s *Server) queryAudit(ctx context.Context, raw json.RawMessage) (interface{}, *Error) {
+	var filter core.AuditFilter
+	if err := decodeParams(raw, &filter); err != nil {
+		return nil, err
+	}
+	if filter.Limit <= 0 || filter.Limit > 1000 {
+		filter.Limit = 100
+	}
+
+	var entries []*core.AuditEntry
+	var err error
+	switch querier := s.skill.(type) {
+	case tenantAuditQueryable:
+		entries, err = querier.QueryAuditContext(ctx, filter)
+	case auditQueryable:
+		entries, err = querier.QueryAudit(filter)
+	default:
+		return nil, &Error{Code: rpcErrorCode(core.ErrCodeInternal), Message: "Audit query not supported"}
+	}
+	if err != nil {
+		skillErr := asSkillError(err)
+		return nil, &Error{Code: rpcErrorCode(skillErr.Code), Message: "Audit query failed", Data: skillErr.Message}
+	}
+	return map[string]interface{}{
+		"count":   len(entries),
+		"entries": entries,
+	}, nil
+}
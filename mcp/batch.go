@@ -0,0 +1,154 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"text2sql-skill/config"
+)
+
+// limits MCP 请求处理限制，配置为 0 时使用默认值
+type limits struct {
+	maxRequestBytes  int64
+	maxBatchSize     int
+	batchConcurrency int
+	maxSessions      int
+}
+
+func newLimits(cfg config.MCPServerConfig) limits {
+	l := limits{maxRequestBytes: 1 << 20, maxBatchSize: 50, batchConcurrency: 4, maxSessions: 1000}
+	if cfg.MaxRequestBytes > 0 {
+		l.maxRequestBytes = cfg.MaxRequestBytes
+	}
+	if cfg.MaxBatchSize > 0 {
+		l.maxBatchSize = cfg.MaxBatchSize
+	}
+	if cfg.BatchConcurrency > 0 {
+		l.batchConcurrency = cfg.BatchConcurrency
+	}
+	if cfg.MaxSessions > 0 {
+		l.maxSessions = cfg.MaxSessions
+	}
+	return l
+}
+
+func parseError(err error) *Response {
+	return &Response{JSONRPC: JSONRPCVersion, Error: &Error{Code: CodeParseError, Message: "Parse error", Data: err.Error()}}
+}
+
+func invalidRequest(id json.RawMessage, reason string) *Response {
+	return &Response{JSONRPC: JSONRPCVersion, ID: id, Error: &Error{Code: CodeInvalidRequest, Message: "Invalid Request", Data: reason}}
+}
+
+func requestTooLarge(limit int64) *Response {
+	return invalidRequest(nil, fmt.Sprintf("request exceeds max_request_bytes %d", limit))
+}
+
+// isBatch 载荷是否为 JSON 数组
+func isBatch(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && data[0] == '['
+}
+
+// validID JSON-RPC 的 ID 只能是字符串、数字或 null
+func validID(id json.RawMessage) bool {
+	id = bytes.TrimSpace(id)
+	if len(id) == 0 {
+		return true
+	}
+	switch c := id[0]; {
+	case c == '"', c == '-', c >= '0' && c <= '9':
+		return true
+	}
+	return string(id) == "null"
+}
+
+// handlePayload 处理一个 JSON-RPC 载荷：单条消息或批量数组。
+// 批量数组中的消息并发处理，只包含通知时没有响应，返回 nil
+func (s *Server) handlePayload(ctx context.Context, session *Session, data []byte) interface{} {
+	if !isBatch(data) {
+		if resp := s.handleMessage(ctx, session, data); resp != nil {
+			return resp
+		}
+		return nil
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(data, &batch); err != nil {
+		return parseError(err)
+	}
+	if len(batch) == 0 {
+		return invalidRequest(nil, "empty batch")
+	}
+	if len(batch) > s.limits.maxBatchSize {
+		return invalidRequest(nil, fmt.Sprintf("batch of %d messages exceeds max_batch_size %d", len(batch), s.limits.maxBatchSize))
+	}
+
+	responses := make([]*Response, len(batch))
+	sem := make(chan struct{}, s.limits.batchConcurrency)
+	var wg sync.WaitGroup
+	for i, raw := range batch {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, raw json.RawMessage) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			responses[i] = s.handleMessage(ctx, session, raw)
+		}(i, raw)
+	}
+	wg.Wait()
+
+	// 响应顺序与请求一致，通知没有响应
+	var replies []*Response
+	for _, resp := range responses {
+		if resp != nil {
+			replies = append(replies, resp)
+		}
+	}
+	if len(replies) == 0 {
+		return nil
+	}
+	return replies
+}
+
+// handleMessage 解析并校验一条消息，无效的消息即使没有 ID 也返回错误
+func (s *Server) handleMessage(ctx context.Context, session *Session, raw json.RawMessage) *Response {
+	var req Request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		if !json.Valid(raw) {
+			return parseError(err)
+		}
+		// 合法的 JSON 但不是请求对象
+		return invalidRequest(nil, err.Error())
+	}
+	if !validID(req.ID) {
+		return invalidRequest(nil, "id must be a string, number or null")
+	}
+	if req.JSONRPC != JSONRPCVersion {
+		return invalidRequest(req.ID, `jsonrpc must be "2.0"`)
+	}
+	if req.Method == "" {
+		return invalidRequest(req.ID, "method is required")
+	}
+	return s.Handle(ctx, session, &req)
+}
@@ -0,0 +1,291 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"text2sql-skill/core"
+)
+
+// ServeHTTP 实现 MCP Streamable HTTP：POST 发送消息，DELETE 结束会话。
+// initialize 创建会话并通过 Mcp-Session-Id 响应头返回，不带会话 ID 的请求使用共享的无状态会话。
+// 客户端接受 text/event-stream 时以 SSE 返回，执行过程中的进度通知先于响应发送；
+// 批量请求以 JSON 数组返回，无法解析的请求体返回 -32700，超过大小限制返回 413
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 按客户端地址限流，认证之前执行以限制暴力尝试
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		client = r.RemoteAddr
+	}
+	if ok, wait := s.limiter.Allow(client); !ok {
+		retryAfter := core.LimitDecision{RetryAfter: wait}.RetryAfterSeconds()
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		writeJSON(w, http.StatusTooManyRequests, &Response{
+			JSONRPC: JSONRPCVersion,
+			Error: &Error{
+				Code:    rpcErrorCode(core.ErrCodeRateLimited),
+				Message: "Rate limit exceeded",
+				Data: map[string]interface{}{
+					"error": &core.SkillError{
+						Code:              core.ErrCodeRateLimited,
+						Message:           "retry after " + strconv.Itoa(retryAfter) + "s",
+						RetryAfterSeconds: retryAfter,
+					},
+				},
+			},
+		})
+		return
+	}
+
+	ctx, rpcErr := s.identify(r)
+	if rpcErr != nil {
+		writeJSON(w, http.StatusUnauthorized, &Response{JSONRPC: JSONRPCVersion, Error: rpcErr})
+		return
+	}
+	if version := r.Header.Get(HeaderProtocolVersion); version != "" && !SupportsVersion(version) {
+		writeJSON(w, http.StatusBadRequest, &Response{
+			JSONRPC: JSONRPCVersion,
+			Error:   &Error{Code: CodeInvalidRequest, Message: "Unsupported protocol version", Data: version},
+		})
+		return
+	}
+
+	// 会话不存在、已过期或属于其他调用方时返回 404，客户端需要重新 initialize
+	sessionID := r.Header.Get(HeaderSessionID)
+	if r.Method == http.MethodDelete {
+		if sessionID == "" || s.lookupSession(ctx, sessionID) == nil {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		s.deleteSession(sessionID)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.limits.maxRequestBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSON(w, http.StatusRequestEntityTooLarge, requestTooLarge(s.limits.maxRequestBytes))
+			return
+		}
+		http.Error(w, "Failed to read request", http.StatusBadRequest)
+		return
+	}
+
+	// 单条请求先解析以选择会话和响应方式，批量请求使用 JSON 响应
+	var req Request
+	single := !isBatch(body) && json.Unmarshal(body, &req) == nil && req.JSONRPC == JSONRPCVersion && validID(req.ID)
+
+	session := s.stateless
+	switch {
+	case sessionID != "":
+		if session = s.lookupSession(ctx, sessionID); session == nil {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+	case single && req.Method == "initialize":
+		if session, err = s.createSession(ctx); err != nil {
+			status, code := http.StatusInternalServerError, rpcErrorCode(core.ErrCodeInternal)
+			if errors.Is(err, errTooManySessions) {
+				status, code = http.StatusServiceUnavailable, rpcErrorCode(core.ErrCodeOverloaded)
+			}
+			writeJSON(w, status, &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Error: &Error{Code: code, Message: "Cannot create session", Data: err.Error()}})
+			return
+		}
+	}
+
+	// initialize 不产生通知，总是以 JSON 返回
+	flusher, canStream := w.(http.Flusher)
+	if single && !req.IsNotification() && req.Method != "" && req.Method != "initialize" && canStream && acceptsEventStream(r) {
+		s.serveEventStream(ctx, w, flusher, session, &req)
+		return
+	}
+
+	reply := s.handlePayload(ctx, session, body)
+	if session.id != "" {
+		// initialize 失败时不保留会话
+		if resp, ok := reply.(*Response); ok && single && req.Method == "initialize" && resp.Error != nil {
+			s.deleteSession(session.id)
+		} else {
+			w.Header().Set(HeaderSessionID, session.id)
+		}
+	}
+	if reply == nil {
+		// 只包含通知
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	writeJSON(w, http.StatusOK, reply)
+}
+
+func acceptsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// serveEventStream 以 SSE 返回请求执行过程中的通知和最终响应。
+// 客户端断开连接时请求的 context 被取消，执行中的查询随之中止
+func (s *Server) serveEventStream(ctx context.Context, w http.ResponseWriter, flusher http.Flusher, session *Session, req *Request) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	if session.id != "" {
+		w.Header().Set(HeaderSessionID, session.id)
+	}
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var mu sync.Mutex
+	send := func(v interface{}) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+		flusher.Flush()
+	}
+	ctx = withNotifier(ctx, func(method string, params interface{}) {
+		send(Notification{JSONRPC: JSONRPCVersion, Method: method, Params: params})
+	})
+	send(s.Handle(ctx, session, req))
+}
+
+// identify 根据客户端证书或认证请求头确定调用方身份
+func (s *Server) identify(r *http.Request) (context.Context, *Error) {
+	ctx := r.Context()
+	certPrincipal, certKey := s.tls.ClientIdentity(r.TLS)
+	header := ""
+	if s.cfg.Authentication.Enabled {
+		header = r.Header.Get(s.cfg.Authentication.HeaderName)
+	}
+	if certPrincipal != nil && header == "" {
+		// 已验证的客户端证书即可作为身份，请求头中的令牌优先
+		return WithAPIKey(core.WithPrincipal(ctx, certPrincipal), certKey), nil
+	}
+	if !s.cfg.Authentication.Enabled {
+		return ctx, nil
+	}
+
+	principal, key, err := s.authenticate(header)
+	if err != nil {
+		message, data := "Authentication failed", "Invalid token"
+		switch {
+		case errors.Is(err, core.ErrMissingCredentials):
+			message, data = "Authentication required", "Missing Authorization header"
+		case errors.Is(err, core.ErrKeyExpired):
+			data = "Token expired"
+		}
+		return nil, &Error{Code: CodeInvalidRequest, Message: message, Data: data}
+	}
+	// validate_only 模式下未携带令牌的请求以匿名身份继续
+	if principal != nil {
+		ctx = WithAPIKey(core.WithPrincipal(ctx, principal), key)
+	}
+	return ctx, nil
+}
+
+// authenticate 校验令牌，API key 加载失败时拒绝所有请求
+func (s *Server) authenticate(header string) (*core.Principal, *core.APIKey, error) {
+	if s.auth == nil {
+		return nil, nil, s.authErr
+	}
+	return s.auth.Authenticate(header)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// StartServer 启动 MCP 服务器，启用 server.tls 时使用 HTTPS
+func (s *Server) StartServer(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", s)
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "healthy"})
+	})
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	if s.cfg.Server.TLS.Enabled {
+		serverTLS, err := core.NewServerTLS(s.cfg.Server.TLS)
+		if err != nil {
+			return err
+		}
+		s.tls = serverTLS
+		server.TLSConfig = serverTLS.TLSConfig()
+
+		log.Printf("MCP 服务器启动在 %s (HTTPS)", addr)
+		return server.ListenAndServeTLS("", "")
+	}
+
+	log.Printf("MCP 服务器启动在 %s", addr)
+	return server.ListenAndServe()
+}
+
+// StartUnixSocketServer 启动 Unix Socket 服务器，每个连接是一个独立会话
+func (s *Server) StartUnixSocketServer(socketPath string) error {
+	// 尝试创建监听器，如果socket文件已存在，会返回错误
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		// 如果是因为socket文件已存在而失败，记录错误但不删除文件
+		log.Printf("ERROR: 无法创建Unix socket监听器: %v", err)
+		log.Printf("INFO: 如果socket文件 %s 已存在，请手动删除或使用不同的路径", socketPath)
+		return err
+	}
+	defer listener.Close()
+
+	log.Printf("MCP Unix Socket 服务器启动在 %s", socketPath)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Printf("接受连接错误: %v", err)
+			continue
+		}
+
+		go s.handleSocketConnection(conn)
+	}
+}
+
+// handleSocketConnection 处理 Socket 连接
+func (s *Server) handleSocketConnection(conn net.Conn) {
+	defer conn.Close()
+
+	if err := s.ServeStream(context.Background(), conn, conn); err != nil {
+		log.Printf("Socket 连接错误: %v", err)
+	}
+}
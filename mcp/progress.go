@@ -0,0 +1,86 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"text2sql-skill/core"
+)
+
+// notifyFunc 向发出当前请求的客户端发送通知，由支持流式响应的传输方式提供
+type notifyFunc func(method string, params interface{})
+
+type notifierKey struct{}
+
+type progressTokenKey struct{}
+
+// withNotifier 返回可以在请求处理过程中发送通知的 context
+func withNotifier(ctx context.Context, notify notifyFunc) context.Context {
+	return context.WithValue(ctx, notifierKey{}, notify)
+}
+
+// withProgressToken 记录请求参数 _meta.progressToken
+func withProgressToken(ctx context.Context, raw json.RawMessage) context.Context {
+	var params struct {
+		Meta *RequestMeta `json:"_meta"`
+	}
+	if len(raw) == 0 || json.Unmarshal(raw, &params) != nil || params.Meta == nil || len(params.Meta.ProgressToken) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, progressTokenKey{}, params.Meta.ProgressToken)
+}
+
+// skillProgress 请求携带 progressToken 且传输方式支持通知时，把技能执行进度转换为 notifications/progress
+func skillProgress(ctx context.Context) context.Context {
+	notify, _ := ctx.Value(notifierKey{}).(notifyFunc)
+	token, _ := ctx.Value(progressTokenKey{}).(json.RawMessage)
+	if notify == nil || len(token) == 0 {
+		return ctx
+	}
+
+	var mu sync.Mutex
+	var progress float64
+	return core.WithProgress(ctx, func(event core.ProgressEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		progress++
+		notify("notifications/progress", ProgressParams{
+			ProgressToken: token,
+			Progress:      progress,
+			Message:       progressMessage(event),
+		})
+	})
+}
+
+func progressMessage(event core.ProgressEvent) string {
+	switch event.Stage {
+	case core.ProgressGuardsPassed:
+		return "guards passed"
+	case core.ProgressSQLGenerated:
+		return "SQL generated"
+	case core.ProgressExecuting:
+		return "executing"
+	case core.ProgressRowsScanned:
+		return fmt.Sprintf("rows scanned: %d", event.Rows)
+	}
+	return string(event.Stage)
+}
@@ -0,0 +1,170 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"text2sql-skill/core"
+)
+
+// 表结构资源
+const (
+	schemaURI       = "text2sql://schema"
+	schemaURIPrefix = schemaURI + "/"
+)
+
+func (s *Server) loadSchema(ctx context.Context) ([]core.TableSchema, *Error) {
+	describer, ok := s.skill.(schemaDescriber)
+	if !ok {
+		return nil, nil
+	}
+	tables, err := describer.DescribeSchema(ctx)
+	if err != nil {
+		skillErr := asSkillError(err)
+		return nil, &Error{Code: rpcErrorCode(skillErr.Code), Message: skillErr.Message, Data: map[string]interface{}{"error": skillErr}}
+	}
+	return tables, nil
+}
+
+// listResources 列出全部表结构和调用方可见的每张表
+func (s *Server) listResources(ctx context.Context) (interface{}, *Error) {
+	resources := []Resource{}
+	if _, ok := s.skill.(schemaDescriber); ok {
+		tables, rpcErr := s.loadSchema(ctx)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		resources = append(resources, Resource{
+			URI:         schemaURI,
+			Name:        "schema",
+			Description: "Tables and columns available to the caller",
+			MimeType:    "application/json",
+		})
+		for _, table := range tables {
+			resources = append(resources, Resource{
+				URI:      schemaURIPrefix + table.Name,
+				Name:     table.Name,
+				MimeType: "application/json",
+			})
+		}
+	}
+	return map[string]interface{}{"resources": resources}, nil
+}
+
+func (s *Server) listResourceTemplates() interface{} {
+	templates := []ResourceTemplate{}
+	if _, ok := s.skill.(schemaDescriber); ok {
+		templates = append(templates, ResourceTemplate{
+			URITemplate: schemaURIPrefix + "{table}",
+			Name:        "table",
+			Description: "Columns of one table",
+			MimeType:    "application/json",
+		})
+	}
+	return map[string]interface{}{"resourceTemplates": templates}
+}
+
+func (s *Server) readResource(ctx context.Context, raw json.RawMessage) (interface{}, *Error) {
+	var params ReadResourceParams
+	if err := decodeParams(raw, &params); err != nil {
+		return nil, err
+	}
+	notFound := &Error{Code: CodeResourceNotFound, Message: "Resource not found", Data: map[string]string{"uri": params.URI}}
+	if params.URI != schemaURI && !strings.HasPrefix(params.URI, schemaURIPrefix) {
+		return nil, notFound
+	}
+	if _, ok := s.skill.(schemaDescriber); !ok {
+		return nil, notFound
+	}
+
+	tables, rpcErr := s.loadSchema(ctx)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	var content interface{} = map[string]interface{}{"tables": tables}
+	if name := strings.TrimPrefix(params.URI, schemaURIPrefix); params.URI != schemaURI {
+		content = nil
+		for _, table := range tables {
+			if table.Name == name {
+				content = table
+			}
+		}
+		if content == nil {
+			return nil, notFound
+		}
+	}
+
+	text, _ := json.Marshal(content)
+	return map[string]interface{}{
+		"contents": []ResourceContents{{URI: params.URI, MimeType: "application/json", Text: string(text)}},
+	}, nil
+}
+
+// prompts 内置提示词模板
+var prompts = []Prompt{
+	{
+		Name:        "ask_database",
+		Description: "Answer a question with data from the database",
+		Arguments: []PromptArgument{
+			{Name: "question", Description: "Question in natural language", Required: true},
+		},
+	},
+	{
+		Name:        "explore_schema",
+		Description: "Summarize the tables available to the caller",
+	},
+}
+
+func (s *Server) listPrompts() interface{} {
+	return map[string]interface{}{"prompts": prompts}
+}
+
+func (s *Server) getPrompt(raw json.RawMessage) (interface{}, *Error) {
+	var params GetPromptParams
+	if err := decodeParams(raw, &params); err != nil {
+		return nil, err
+	}
+
+	var text string
+	switch params.Name {
+	case "ask_database":
+		question := strings.TrimSpace(params.Arguments["question"])
+		if question == "" {
+			return nil, &Error{Code: CodeInvalidParams, Message: "Invalid params", Data: "argument 'question' is required"}
+		}
+		text = "Use the execute_query tool to answer the question below. If you are unsure which tables exist, call describe_schema first. " +
+			"If the query is rejected, report the error code and reason instead of guessing.\n\nQuestion: " + question
+	case "explore_schema":
+		text = "Call the describe_schema tool and summarize the available tables, their columns and how they are likely related."
+	default:
+		return nil, &Error{Code: CodeInvalidParams, Message: "Invalid params", Data: "unknown prompt '" + params.Name + "'"}
+	}
+
+	for _, prompt := range prompts {
+		if prompt.Name == params.Name {
+			return GetPromptResult{
+				Description: prompt.Description,
+				Messages:    []PromptMessage{{Role: "user", Content: TextContent(text)}},
+			}, nil
+		}
+	}
+	return nil, &Error{Code: CodeInternalError, Message: "Internal error"}
+}
@@ -0,0 +1,245 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+	"text2sql-skill/interfaces"
+)
+
+// Server MCP 服务端，方法处理与传输方式无关
+type Server struct {
+	skill interfaces.Skill
+	cfg   *config.Config
+	info  Implementation
+
+	limiter   *core.EndpointLimiter
+	auth      *core.Authenticator
+	authErr   error
+	anonymous *core.APIKey // 认证开启时未携带凭证的调用方权限
+	tls       *core.ServerTLS
+	limits    limits
+	stateless *Session // 不使用会话的 HTTP 请求共享的会话
+
+	sessionsMu sync.Mutex
+	sessions   map[string]*Session // Streamable HTTP 会话，按 Mcp-Session-Id 索引
+}
+
+// NewServer 创建 MCP 服务端
+func NewServer(cfg *config.Config, skill interfaces.Skill) *Server {
+	server := &Server{
+		skill:  skill,
+		cfg:    cfg,
+		info:   Implementation{Name: cfg.App.Name, Title: "Text2SQL Skill Engine", Version: cfg.App.Version},
+		limits: newLimits(cfg.Server.MCP),
+
+		sessions: make(map[string]*Session),
+	}
+	if cfg.RateLimit.Enabled {
+		server.limiter = core.NewEndpointLimiter(cfg.RateLimit.Endpoint)
+	}
+	if cfg.Authentication.Enabled {
+		// 加载失败时拒绝所有请求
+		server.auth, server.authErr = core.NewAuthenticator(cfg.Authentication, nil)
+		if server.authErr != nil {
+			log.Printf("ERROR: 加载认证配置失败: %v", server.authErr)
+		}
+		server.anonymous = &core.APIKey{Name: "anonymous", Scopes: cfg.Authentication.AnonymousScopes}
+	}
+	server.stateless = &Session{protocolVersion: LatestProtocolVersion, initialized: true, stateless: true}
+	return server
+}
+
+// SetKeyStore 使用自定义的 API key 存储
+func (s *Server) SetKeyStore(store core.KeyStore) error {
+	auth, err := core.NewAuthenticator(s.cfg.Authentication, store)
+	if err != nil {
+		return err
+	}
+	s.auth, s.authErr = auth, nil
+	return nil
+}
+
+type apiKeyContextKey struct{}
+
+// WithAPIKey 返回携带已认证 API key 的 context，用于方法权限检查
+func WithAPIKey(ctx context.Context, key *core.APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, key)
+}
+
+// APIKeyFromContext 返回 context 中的 API key，未认证时返回 nil
+func APIKeyFromContext(ctx context.Context) *core.APIKey {
+	key, _ := ctx.Value(apiKeyContextKey{}).(*core.APIKey)
+	return key
+}
+
+// hasScope 只有认证关闭时才放行未携带凭证的调用，认证开启时按 anonymous_scopes 检查
+func (s *Server) hasScope(ctx context.Context, scope string) bool {
+	if scope == "" {
+		return true
+	}
+	key := APIKeyFromContext(ctx)
+	if key == nil {
+		if s.anonymous == nil {
+			return true
+		}
+		key = s.anonymous
+	}
+	return key.HasScope(scope)
+}
+
+// methodScopes 各方法所需的 API key 权限，未列出的方法不需要权限。
+// tools/call 和 resources/read 按工具和资源单独检查
+var methodScopes = map[string]string{
+	"resources/list":           core.ScopeSchema,
+	"resources/templates/list": core.ScopeSchema,
+	"resources/read":           core.ScopeSchema,
+	"text2sql/execute":         core.ScopeExecute,
+	"text2sql/config":          core.ScopeAdmin,
+	"text2sql/audit":           core.ScopeAudit,
+}
+
+// Handle 处理一条 JSON-RPC 消息，通知返回 nil。
+// 请求执行期间可以被同一会话中的 notifications/cancelled 取消
+func (s *Server) Handle(ctx context.Context, session *Session, req *Request) *Response {
+	if !req.IsNotification() {
+		var done func()
+		ctx, done = session.track(ctx, req.ID)
+		defer done()
+		ctx = withProgressToken(ctx, req.Params)
+	}
+
+	result, rpcErr := s.dispatch(ctx, session, req)
+	if req.IsNotification() {
+		return nil
+	}
+	if rpcErr != nil {
+		return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Error: rpcErr}
+	}
+	return &Response{JSONRPC: JSONRPCVersion, ID: req.ID, Result: result}
+}
+
+func (s *Server) dispatch(ctx context.Context, session *Session, req *Request) (interface{}, *Error) {
+	switch req.Method {
+	case "initialize":
+		return s.initialize(session, req.Params)
+	case "notifications/initialized":
+		session.mu.Lock()
+		session.ready = session.initialized
+		session.mu.Unlock()
+		return nil, nil
+	case "ping":
+		return struct{}{}, nil
+	case "notifications/cancelled":
+		var params CancelledParams
+		if decodeParams(req.Params, &params) == nil && len(params.RequestID) > 0 {
+			session.cancelRequest(params.RequestID)
+		}
+		return nil, nil
+	}
+	if req.IsNotification() {
+		// 未知通知直接忽略
+		return nil, nil
+	}
+	if !session.isInitialized() {
+		return nil, &Error{Code: CodeInvalidRequest, Message: "Session not initialized", Data: "send initialize first"}
+	}
+	if scope := methodScopes[req.Method]; !s.hasScope(ctx, scope) {
+		return nil, forbidden(scope)
+	}
+
+	switch req.Method {
+	case "tools/list":
+		return s.listTools(ctx), nil
+	case "tools/call":
+		return s.callTool(ctx, req.Params)
+	case "resources/list":
+		return s.listResources(ctx)
+	case "resources/templates/list":
+		return s.listResourceTemplates(), nil
+	case "resources/read":
+		return s.readResource(ctx, req.Params)
+	case "prompts/list":
+		return s.listPrompts(), nil
+	case "prompts/get":
+		return s.getPrompt(req.Params)
+	case "text2sql/execute":
+		return s.legacyExecute(ctx, req.Params)
+	case "text2sql/health":
+		return s.health(ctx), nil
+	case "text2sql/config":
+		return s.configInfo(), nil
+	case "text2sql/audit":
+		return s.queryAudit(ctx, req.Params)
+	default:
+		return nil, &Error{Code: CodeMethodNotFound, Message: "Method not found", Data: req.Method}
+	}
+}
+
+// initialize 协商协议版本并声明服务端能力
+func (s *Server) initialize(session *Session, raw json.RawMessage) (interface{}, *Error) {
+	var params InitializeParams
+	if err := decodeParams(raw, &params); err != nil {
+		return nil, err
+	}
+	if params.ProtocolVersion == "" {
+		return nil, &Error{Code: CodeInvalidParams, Message: "Invalid params", Data: "protocolVersion is required"}
+	}
+
+	// 共享的无状态会话只协商版本，不记录客户端信息
+	version := NegotiateVersion(params.ProtocolVersion)
+	if !session.stateless {
+		session.mu.Lock()
+		session.protocolVersion = version
+		session.clientInfo = params.ClientInfo
+		session.initialized = true
+		session.mu.Unlock()
+	}
+
+	return InitializeResult{
+		ProtocolVersion: version,
+		Capabilities: ServerCapabilities{
+			Tools:     &ListChangedCapability{},
+			Resources: &ResourcesCapability{},
+			Prompts:   &ListChangedCapability{},
+		},
+		ServerInfo:   s.info,
+		Instructions: "Ask questions about the database in natural language with execute_query. Use describe_schema or the text2sql://schema resource to see available tables, and explain_query to preview the SQL without running it.",
+	}, nil
+}
+
+// decodeParams 解析参数，空参数视为空对象
+func decodeParams(raw json.RawMessage, v interface{}) *Error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return &Error{Code: CodeInvalidParams, Message: "Invalid params", Data: err.Error()}
+	}
+	return nil
+}
+
+func forbidden(scope string) *Error {
+	return &Error{Code: CodeForbidden, Message: "Forbidden", Data: "api key lacks scope '" + scope + "'"}
+}
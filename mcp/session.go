@@ -0,0 +1,215 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"text2sql-skill/core"
+)
+
+// sessionIdleTimeout Streamable HTTP 会话空闲多久后被清理
+const sessionIdleTimeout = 30 * time.Minute
+
+// Session 一个客户端连接的协议状态
+type Session struct {
+	mu              sync.Mutex
+	protocolVersion string
+	clientInfo      Implementation
+	initialized     bool // 已响应 initialize
+	ready           bool // 已收到 notifications/initialized
+
+	id        string
+	owner     string // 创建会话的调用方，其他调用方不能使用该会话
+	lastSeen  time.Time
+	stateless bool                        // 多个客户端共享，不支持按请求 ID 取消
+	inflight  map[string]*inflightRequest // 执行中的请求，按请求 ID 索引
+}
+
+type inflightRequest struct {
+	cancel context.CancelFunc
+}
+
+// NewSession 创建新会话，initialize 之前只接受 initialize 和 ping
+func (s *Server) NewSession() *Session {
+	return &Session{}
+}
+
+// ID Streamable HTTP 会话 ID，其他传输方式为空
+func (sess *Session) ID() string {
+	return sess.id
+}
+
+// ProtocolVersion 协商后的协议版本
+func (sess *Session) ProtocolVersion() string {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.protocolVersion
+}
+
+// ClientInfo 客户端在 initialize 中报告的名称和版本
+func (sess *Session) ClientInfo() Implementation {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.clientInfo
+}
+
+// Ready 是否已完成初始化握手
+func (sess *Session) Ready() bool {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.ready
+}
+
+func (sess *Session) isInitialized() bool {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.initialized
+}
+
+// requestKey 按 JSON 表示区分请求 ID，数字 1 和字符串 "1" 是不同的 ID
+func requestKey(id json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, id); err != nil {
+		return string(id)
+	}
+	return buf.String()
+}
+
+// track 登记执行中的请求，返回的函数在请求结束时调用
+func (sess *Session) track(ctx context.Context, id json.RawMessage) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	if sess.stateless {
+		return ctx, cancel
+	}
+
+	key := requestKey(id)
+	req := &inflightRequest{cancel: cancel}
+	sess.mu.Lock()
+	if sess.inflight == nil {
+		sess.inflight = make(map[string]*inflightRequest)
+	}
+	sess.inflight[key] = req
+	sess.mu.Unlock()
+
+	return ctx, func() {
+		sess.mu.Lock()
+		if sess.inflight[key] == req {
+			delete(sess.inflight, key)
+		}
+		sess.mu.Unlock()
+		cancel()
+	}
+}
+
+// cancelRequest 处理 notifications/cancelled，请求已结束或不存在时忽略
+func (sess *Session) cancelRequest(id json.RawMessage) bool {
+	sess.mu.Lock()
+	req := sess.inflight[requestKey(id)]
+	sess.mu.Unlock()
+	if req == nil {
+		return false
+	}
+	req.cancel()
+	return true
+}
+
+// close 取消会话中所有执行中的请求
+func (sess *Session) close() {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	for _, req := range sess.inflight {
+		req.cancel()
+	}
+}
+
+// callerName 会话归属的调用方，匿名调用为空
+func callerName(ctx context.Context) string {
+	if principal := core.PrincipalFromContext(ctx); principal != nil {
+		return principal.User
+	}
+	return ""
+}
+
+// errTooManySessions 会话数达到 server.mcp.max_sessions
+var errTooManySessions = errors.New("too many sessions")
+
+// createSession 为 initialize 请求创建 Streamable HTTP 会话，同时清理空闲会话。
+// 清理后会话数仍达到上限时返回 errTooManySessions
+func (s *Server) createSession(ctx context.Context) (*Session, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("generate session id: %w", err)
+	}
+	now := time.Now()
+	session := &Session{id: hex.EncodeToString(buf), owner: callerName(ctx), lastSeen: now}
+
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	for id, idle := range s.sessions {
+		idle.mu.Lock()
+		expired := now.Sub(idle.lastSeen) > sessionIdleTimeout
+		idle.mu.Unlock()
+		if expired {
+			delete(s.sessions, id)
+			idle.close()
+		}
+	}
+	if len(s.sessions) >= s.limits.maxSessions {
+		return nil, errTooManySessions
+	}
+	s.sessions[session.id] = session
+	return session, nil
+}
+
+// lookupSession 返回调用方自己的会话，不存在、已过期或属于其他调用方时返回 nil
+func (s *Server) lookupSession(ctx context.Context, id string) *Session {
+	s.sessionsMu.Lock()
+	session := s.sessions[id]
+	s.sessionsMu.Unlock()
+	if session == nil || session.owner != callerName(ctx) {
+		return nil
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if time.Since(session.lastSeen) > sessionIdleTimeout {
+		return nil
+	}
+	session.lastSeen = time.Now()
+	return session
+}
+
+// deleteSession 结束会话并取消其中执行中的请求
+func (s *Server) deleteSession(id string) {
+	s.sessionsMu.Lock()
+	session := s.sessions[id]
+	delete(s.sessions, id)
+	s.sessionsMu.Unlock()
+	if session != nil {
+		session.close()
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// ServeStream 处理按行分隔的 JSON-RPC 消息，每行一条消息，响应同样按行写回。
+// stdio 和 Unix socket 共用，一个流对应一个会话，读到 EOF 并等待进行中的请求完成后返回 nil。
+// 会话初始化后的请求并发处理，响应按完成顺序写回，执行期间仍可读取 notifications/cancelled；
+// 通知和 initialize 会改变会话状态，按到达顺序处理
+func (s *Server) ServeStream(ctx context.Context, r io.Reader, w io.Writer) error {
+	session := s.NewSession()
+	reader := bufio.NewReader(r)
+
+	// 进度通知和响应写在同一个流上
+	var writeMu sync.Mutex
+	encoder := json.NewEncoder(w)
+	write := func(v interface{}) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return encoder.Encode(v)
+	}
+	ctx = withNotifier(ctx, func(method string, params interface{}) {
+		write(Notification{JSONRPC: JSONRPCVersion, Method: method, Params: params})
+	})
+
+	// 进行中的请求数与批量请求上限一致，超过时退回顺序处理
+	inflight := make(chan struct{}, s.limits.maxBatchSize)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		line, tooLarge, readErr := readLine(reader, s.limits.maxRequestBytes)
+		line = bytes.TrimSpace(line)
+		var reply interface{}
+		switch {
+		case tooLarge:
+			reply = requestTooLarge(s.limits.maxRequestBytes)
+		case len(line) == 0:
+		case concurrentPayload(session, line) && tryAcquire(inflight):
+			wg.Add(1)
+			go func(line []byte) {
+				defer wg.Done()
+				defer func() { <-inflight }()
+				if reply := s.handlePayload(ctx, session, line); reply != nil {
+					write(reply)
+				}
+			}(line)
+		default:
+			reply = s.handlePayload(ctx, session, line)
+		}
+		if reply != nil {
+			if err := write(reply); err != nil {
+				return err
+			}
+		}
+
+		if readErr == io.EOF || ctx.Err() != nil {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+// concurrentPayload 会话已初始化时，不含通知和 initialize 的单条请求或批量请求可以并发处理。
+// 未初始化时按顺序处理，保证 initialize 之前的请求得到确定的错误
+func concurrentPayload(session *Session, data []byte) bool {
+	if !session.isInitialized() {
+		return false
+	}
+	var requests []Request
+	if isBatch(data) {
+		if json.Unmarshal(data, &requests) != nil {
+			return false
+		}
+	} else {
+		requests = make([]Request, 1)
+		if json.Unmarshal(data, &requests[0]) != nil {
+			return false
+		}
+	}
+	for i := range requests {
+		if requests[i].IsNotification() || requests[i].Method == "initialize" {
+			return false
+		}
+	}
+	return len(requests) > 0
+}
+
+func tryAcquire(sem chan struct{}) bool {
+	select {
+	case sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// readLine 读取一行，超过 limit 字节时丢弃该行剩余部分并返回 tooLarge
+func readLine(reader *bufio.Reader, limit int64) ([]byte, bool, error) {
+	var line []byte
+	tooLarge := false
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !tooLarge {
+			if int64(len(line)+len(chunk)) > limit+1 { // 允许结尾的换行符
+				tooLarge, line = true, nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		if err != bufio.ErrBufferFull {
+			return line, tooLarge, err
+		}
+	}
+}
@@ -0,0 +1,298 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"text2sql-skill/core"
+	"text2sql-skill/interfaces"
+	"text2sql-skill/utils"
+)
+
+// executeTimeout 单次查询的最长时间
+const executeTimeout = 30 * time.Second
+
+// schemaDescriber 可以返回表结构的技能实现
+type schemaDescriber interface {
+	DescribeSchema(ctx context.Context) ([]core.TableSchema, error)
+}
+
+// queryExplainer 可以只生成不执行查询的技能实现
+type queryExplainer interface {
+	Explain(ctx context.Context, input string) (*core.QueryExplanation, error)
+}
+
+// toolHandler 工具实现。参数错误返回 JSON-RPC 错误，执行失败返回 IsError 的结果
+type toolHandler func(ctx context.Context, args json.RawMessage) (*CallToolResult, *Error)
+
+type toolSpec struct {
+	tool    Tool
+	scope   string
+	handler toolHandler
+}
+
+// queryArgs execute_query 和 explain_query 的参数
+type queryArgs struct {
+	Query    string `json:"query"`
+	Tenant   string `json:"tenant"`   // 多租户模式下的目标租户
+	Priority string `json:"priority"` // interactive 或 batch
+}
+
+func queryInputSchema(withPriority bool) map[string]interface{} {
+	properties := map[string]interface{}{
+		"query":  map[string]interface{}{"type": "string", "description": "Question about the data in natural language"},
+		"tenant": map[string]interface{}{"type": "string", "description": "Target tenant when multi-tenancy is enabled"},
+	}
+	if withPriority {
+		properties["priority"] = map[string]interface{}{"type": "string", "enum": []string{"interactive", "batch"}}
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   []string{"query"},
+	}
+}
+
+// tools 返回技能支持的工具，describe_schema 和 explain_query 需要技能实现相应接口
+func (s *Server) tools() []toolSpec {
+	readOnly := &ToolAnnotations{ReadOnlyHint: true}
+	tools := []toolSpec{{
+		tool: Tool{
+			Name:        "execute_query",
+			Title:       "Execute query",
+			Description: "Translate a natural-language question into SQL, check it against the security policy and run it. Returns the generated SQL and result rows.",
+			InputSchema: queryInputSchema(true),
+			Annotations: readOnly,
+		},
+		scope:   core.ScopeExecute,
+		handler: s.executeQuery,
+	}}
+	if _, ok := s.skill.(schemaDescriber); ok {
+		tools = append(tools, toolSpec{
+			tool: Tool{
+				Name:        "describe_schema",
+				Title:       "Describe schema",
+				Description: "List the tables and columns the caller is allowed to query.",
+				InputSchema: map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"table": map[string]interface{}{"type": "string", "description": "Only describe this table"},
+					},
+				},
+				Annotations: &ToolAnnotations{ReadOnlyHint: true, IdempotentHint: true},
+			},
+			scope:   core.ScopeSchema,
+			handler: s.describeSchema,
+		})
+	}
+	if _, ok := s.skill.(queryExplainer); ok {
+		tools = append(tools, toolSpec{
+			tool: Tool{
+				Name:        "explain_query",
+				Title:       "Explain query",
+				Description: "Show the SQL that execute_query would run for a question, after guards and row-level security, without executing it.",
+				InputSchema: queryInputSchema(false),
+				Annotations: &ToolAnnotations{ReadOnlyHint: true, IdempotentHint: true},
+			},
+			scope:   core.ScopeExecute,
+			handler: s.explainQuery,
+		})
+	}
+	return tools
+}
+
+// listTools 只列出调用方有权限使用的工具
+func (s *Server) listTools(ctx context.Context) interface{} {
+	tools := []Tool{}
+	for _, spec := range s.tools() {
+		if s.hasScope(ctx, spec.scope) {
+			tools = append(tools, spec.tool)
+		}
+	}
+	return map[string]interface{}{"tools": tools}
+}
+
+func (s *Server) callTool(ctx context.Context, raw json.RawMessage) (interface{}, *Error) {
+	var params CallToolParams
+	if err := decodeParams(raw, &params); err != nil {
+		return nil, err
+	}
+	for _, spec := range s.tools() {
+		if spec.tool.Name != params.Name {
+			continue
+		}
+		if !s.hasScope(ctx, spec.scope) {
+			return nil, forbidden(spec.scope)
+		}
+		return spec.handler(ctx, params.Arguments)
+	}
+	return nil, &Error{Code: CodeInvalidParams, Message: "Unknown tool", Data: params.Name}
+}
+
+// queryContext 解析查询参数并设置租户、优先级、超时和进度通知
+func queryContext(ctx context.Context, raw json.RawMessage) (context.Context, context.CancelFunc, queryArgs, *Error) {
+	var args queryArgs
+	if err := decodeParams(raw, &args); err != nil {
+		return nil, nil, args, err
+	}
+	if strings.TrimSpace(args.Query) == "" {
+		return nil, nil, args, &Error{Code: CodeInvalidParams, Message: "Invalid params", Data: "query is required"}
+	}
+	priority, err := core.ParsePriority(args.Priority)
+	if err != nil {
+		return nil, nil, args, &Error{Code: CodeInvalidParams, Message: "Invalid params", Data: err.Error()}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, executeTimeout)
+	if args.Tenant != "" {
+		ctx = core.WithTenant(ctx, args.Tenant)
+	}
+	return skillProgress(core.WithPriority(ctx, priority)), cancel, args, nil
+}
+
+func (s *Server) executeQuery(ctx context.Context, raw json.RawMessage) (*CallToolResult, *Error) {
+	ctx, cancel, args, rpcErr := queryContext(ctx, raw)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	defer cancel()
+
+	result, err := s.skill.Execute(ctx, args.Query)
+	if err != nil {
+		return toolError(&core.SkillError{Code: core.ErrCodeInternal, Message: err.Error()}, map[string]interface{}{}), nil
+	}
+	fields, skillErr := resultFields(result)
+	if skillErr != nil {
+		return toolError(skillErr, fields), nil
+	}
+	return toolResult(fields), nil
+}
+
+// resultFields 把技能结果转换为工具输出：元数据、解码后的结果行或结构化错误。
+// 执行失败或结果行无法解码时返回对应的错误
+func resultFields(result interfaces.SkillResult) (map[string]interface{}, *core.SkillError) {
+	fields := map[string]interface{}{
+		"query_id": result.QueryID,
+		"status":   result.Status,
+	}
+	if skillErr := core.ResultError(result); skillErr != nil {
+		fields["error"] = skillErr
+		return fields, skillErr
+	}
+
+	if meta, err := core.ParseResultMeta(result); err == nil {
+		fields["sql"] = meta.TemplateUsed
+		fields["row_count"] = meta.RowCount
+		if len(meta.MaskedColumns) > 0 {
+			fields["masked_columns"] = meta.MaskedColumns
+		}
+		if meta.GuardDecisions != nil {
+			fields["guard_decisions"] = meta.GuardDecisions
+		}
+	}
+	rows, err := utils.DecryptResult(result.Result)
+	if err != nil {
+		skillErr := &core.SkillError{Code: core.ErrCodeInternal, Message: "decode result rows: " + err.Error()}
+		fields["error"] = skillErr
+		return fields, skillErr
+	}
+	fields["rows"] = rows
+	return fields, nil
+}
+
+func (s *Server) describeSchema(ctx context.Context, raw json.RawMessage) (*CallToolResult, *Error) {
+	var args struct {
+		Table string `json:"table"`
+	}
+	if err := decodeParams(raw, &args); err != nil {
+		return nil, err
+	}
+
+	tables, err := s.skill.(schemaDescriber).DescribeSchema(ctx)
+	if err != nil {
+		return toolError(asSkillError(err), map[string]interface{}{}), nil
+	}
+	if args.Table != "" {
+		var selected []core.TableSchema
+		for _, table := range tables {
+			if strings.EqualFold(table.Name, args.Table) {
+				selected = append(selected, table)
+			}
+		}
+		if len(selected) == 0 {
+			return toolError(&core.SkillError{
+				Code:    core.ErrCodeAccessDenied,
+				Message: "table '" + args.Table + "' does not exist or is not accessible",
+			}, map[string]interface{}{}), nil
+		}
+		tables = selected
+	}
+	if tables == nil {
+		tables = []core.TableSchema{}
+	}
+	return toolResult(map[string]interface{}{"tables": tables}), nil
+}
+
+func (s *Server) explainQuery(ctx context.Context, raw json.RawMessage) (*CallToolResult, *Error) {
+	ctx, cancel, args, rpcErr := queryContext(ctx, raw)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	defer cancel()
+
+	explanation, err := s.skill.(queryExplainer).Explain(ctx, args.Query)
+	if err != nil {
+		return toolError(asSkillError(err), map[string]interface{}{}), nil
+	}
+	return toolResult(explanation), nil
+}
+
+// asSkillError 非结构化错误按内部错误处理
+func asSkillError(err error) *core.SkillError {
+	var skillErr *core.SkillError
+	if errors.As(err, &skillErr) {
+		return skillErr
+	}
+	return &core.SkillError{Code: core.ErrCodeInternal, Message: err.Error()}
+}
+
+// toolResult 结构化输出同时以 JSON 文本返回，兼容只读取 content 的客户端
+func toolResult(structured interface{}) *CallToolResult {
+	text, _ := json.Marshal(structured)
+	return &CallToolResult{
+		Content:           []Content{TextContent(string(text))},
+		StructuredContent: structured,
+	}
+}
+
+// toolError 工具执行失败，错误码和原因写入内容供模型读取
+func toolError(skillErr *core.SkillError, fields map[string]interface{}) *CallToolResult {
+	if _, ok := fields["error"]; !ok {
+		fields["error"] = skillErr
+	}
+	return &CallToolResult{
+		Content:           []Content{TextContent(skillErr.Error())},
+		StructuredContent: fields,
+		IsError:           true,
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package tests
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+)
+
+func newAPIKeyConfig(t *testing.T) (config.AuthenticationConfig, map[string]string) {
+	t.Helper()
+	tokens := make(map[string]string)
+	auth := config.AuthenticationConfig{Enabled: true, HeaderName: "Authorization"}
+	for _, key := range []config.APIKeyConfig{
+		{Name: "reporting", Scopes: []string{"execute", "schema"}, Tenant: "finance", Roles: []string{"analyst"}},
+		{Name: "auditor", Scopes: []string{"audit"}, ExpiresAt: "2025-06-01T00:00:00Z"},
+		{Name: "ops", Scopes: []string{"admin"}},
+	} {
+		token, hash, err := core.GenerateAPIKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		key.Hash = hash
+		tokens[key.Name] = token
+		auth.APIKeys = append(auth.APIKeys, key)
+	}
+	return auth, tokens
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	auth, tokens := newAPIKeyConfig(t)
+	cfg := newAuditSinkConfig("memory", "")
+	cfg.Authentication = auth
+	if err := config.ValidateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(auth.APIKeys[0].Hash, tokens["reporting"]) {
+		t.Fatal("hash must not contain the token")
+	}
+
+	authenticator, err := core.NewAuthenticator(auth, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator.SetClock(func() time.Time { return time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC) })
+
+	principal, key, err := authenticator.Authenticate("Bearer " + tokens["reporting"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.User != "reporting" || principal.APIKey != "reporting" || principal.Tenant != "finance" || principal.Roles[0] != "analyst" {
+		t.Errorf("unexpected principal: %+v", principal)
+	}
+	if !key.HasScope(core.ScopeExecute) || key.HasScope(core.ScopeAudit) {
+		t.Errorf("unexpected scopes: %v", key.Scopes)
+	}
+
+	// admin 拥有全部权限
+	_, ops, err := authenticator.Authenticate(tokens["ops"])
+	if err != nil || !ops.HasScope(core.ScopeAudit) || !ops.HasScope(core.ScopeExecute) {
+		t.Errorf("admin key should have every scope: %v %v", ops, err)
+	}
+
+	if _, _, err := authenticator.Authenticate(tokens["reporting"] + "x"); !errors.Is(err, core.ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey, got %v", err)
+	}
+	if _, _, err := authenticator.Authenticate(""); !errors.Is(err, core.ErrMissingCredentials) {
+		t.Errorf("expected ErrMissingCredentials, got %v", err)
+	}
+
+	authenticator.SetClock(func() time.Time { return time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC) })
+	if _, _, err := authenticator.Authenticate(tokens["auditor"]); !errors.Is(err, core.ErrKeyExpired) {
+		t.Errorf("expected ErrKeyExpired, got %v", err)
+	}
+}
+
+func TestAPIKeyValidateOnlyAndLegacyToken(t *testing.T) {
+	auth := config.AuthenticationConfig{Enabled: true, HeaderName: "Authorization", Token: "legacy-token", ValidateOnly: true}
+	authenticator, err := core.NewAuthenticator(auth, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// validate_only：未携带令牌时匿名放行，错误令牌仍然拒绝
+	principal, key, err := authenticator.Authenticate("")
+	if err != nil || principal != nil || key != nil {
+		t.Errorf("anonymous request should pass in validate_only mode: %v %v %v", principal, key, err)
+	}
+	if _, _, err := authenticator.Authenticate("wrong-token"); !errors.Is(err, core.ErrInvalidKey) {
+		t.Errorf("invalid token should be rejected in validate_only mode, got %v", err)
+	}
+
+	principal, key, err = authenticator.Authenticate("legacy-token")
+	if err != nil || principal.User != "default" || !key.HasScope(core.ScopeAdmin) {
+		t.Errorf("legacy token should map to the default admin key: %v %v %v", principal, key, err)
+	}
+}
+
+// mapKeyStore 自定义存储示例
+type mapKeyStore map[string]*core.APIKey
+
+func (m mapKeyStore) LookupKey(token string) (*core.APIKey, error) {
+	if key, ok := m[token]; ok {
+		return key, nil
+	}
+	return nil, core.ErrInvalidKey
+}
+
+func TestAPIKeyCustomStore(t *testing.T) {
+	store := mapKeyStore{"external": {Name: "svc", Scopes: []string{core.ScopeExecute}, ExpiresAt: time.Now().Add(-time.Minute)}}
+	authenticator, err := core.NewAuthenticator(config.AuthenticationConfig{Enabled: true}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 过期检查对自定义存储同样生效
+	if _, _, err := authenticator.Authenticate("external"); !errors.Is(err, core.ErrKeyExpired) {
+		t.Errorf("expected ErrKeyExpired from custom store, got %v", err)
+	}
+}
+
+func TestAPIKeyConfigValidation(t *testing.T) {
+	cases := map[string]func(*config.AuthenticationConfig){
+		"no keys":         func(a *config.AuthenticationConfig) { a.APIKeys = nil },
+		"plaintext hash":  func(a *config.AuthenticationConfig) { a.APIKeys[0].Hash = "secret" },
+		"unknown scope":   func(a *config.AuthenticationConfig) { a.APIKeys[0].Scopes = []string{"write"} },
+		"no scopes":       func(a *config.AuthenticationConfig) { a.APIKeys[0].Scopes = nil },
+		"duplicate name":  func(a *config.AuthenticationConfig) { a.APIKeys[1].Name = "reporting" },
+		"invalid expires": func(a *config.AuthenticationConfig) { a.APIKeys[0].ExpiresAt = "tomorrow" },
+	}
+	for name, mutate := range cases {
+		auth, _ := newAPIKeyConfig(t)
+		mutate(&auth)
+		cfg := newAuditSinkConfig("memory", "")
+		cfg.Authentication = auth
+		if err := config.ValidateConfig(cfg); err == nil || !strings.HasPrefix(err.Error(), "authentication.") {
+			t.Errorf("%s: expected authentication validation error, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+)
+
+func newChainedAuditConfig(dir string, key string) *config.Config {
+	cfg := config.DefaultConfig()
+	cfg.Audit.Storage.Type = "file"
+	cfg.Audit.Storage.Path = dir
+	cfg.Audit.Storage.Fsync = "never"
+	cfg.Audit.Integrity.HMACKey = key
+	cfg.Performance.AsyncProcessing = false
+	return cfg
+}
+
+func writeAuditEvents(cfg *config.Config, entries int) {
+	logger := core.NewAuditLogger(cfg)
+	for i := 0; i < entries; i++ {
+		logger.LogEvent("q", "event", map[string]interface{}{"i": i, "input": "北京销售额"})
+	}
+	logger.Close()
+}
+
+func writeChainedAuditLog(t *testing.T, dir string, key string, entries int) {
+	t.Helper()
+	writeAuditEvents(newChainedAuditConfig(dir, key), entries)
+}
+
+// rotateAuditLog 将当前文件改名为轮转备份
+func rotateAuditLog(t *testing.T, dir string) {
+	t.Helper()
+	backup := filepath.Join(dir, "audit-"+time.Now().UTC().Format("2006-01-02T15-04-05.000000000")+".log")
+	if err := os.Rename(filepath.Join(dir, "audit.log"), backup); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// removeAuditBackups 删除全部轮转备份（含已压缩的）
+func removeAuditBackups(t *testing.T, dir string) {
+	t.Helper()
+	backups, err := filepath.Glob(filepath.Join(dir, "audit-*"))
+	if err != nil || len(backups) == 0 {
+		t.Fatalf("no audit backups to remove: %v", err)
+	}
+	for _, backup := range backups {
+		os.Remove(backup)
+	}
+}
+
+func TestAuditChainVerifies(t *testing.T) {
+	dir := t.TempDir()
+	writeChainedAuditLog(t, dir, "secret", 3)
+	// 重启后应继续原有哈希链
+	writeChainedAuditLog(t, dir, "secret", 2)
+
+	result, err := core.VerifyAuditLogWithKey(dir, []byte("secret"))
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if !result.OK() {
+		t.Fatalf("expected intact chain, got problems: %v", result.Problems)
+	}
+	if result.Entries != 5 || result.FirstSeq != 1 || result.LastSeq != 5 {
+		t.Errorf("unexpected summary: entries=%d seq=%d..%d", result.Entries, result.FirstSeq, result.LastSeq)
+	}
+
+	result, err = core.VerifyAuditLogWithKey(dir, []byte("wrong"))
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if result.OK() {
+		t.Error("verification with wrong key should fail")
+	}
+}
+
+func TestAuditChainAcrossRotatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeChainedAuditLog(t, dir, "", 2)
+	rotateAuditLog(t, dir)
+	writeChainedAuditLog(t, dir, "", 2)
+
+	result, err := core.VerifyAuditLog(dir)
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if !result.OK() || len(result.Files) != 2 || result.LastSeq != 4 {
+		t.Errorf("expected chain across 2 files up to seq 4, got files=%d last=%d problems=%v",
+			len(result.Files), result.LastSeq, result.Problems)
+	}
+}
+
+func TestAuditChainDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(lines []string) []string
+		reason string
+	}{
+		{
+			name: "modified",
+			mutate: func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], "北京", "上海", 1)
+				return lines
+			},
+			reason: "hash mismatch",
+		},
+		{
+			name: "deleted",
+			mutate: func(lines []string) []string {
+				return append(lines[:1], lines[2:]...)
+			},
+			reason: "sequence gap",
+		},
+		{
+			name: "reordered",
+			mutate: func(lines []string) []string {
+				lines[1], lines[2] = lines[2], lines[1]
+				return lines
+			},
+			reason: "out of order",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeChainedAuditLog(t, dir, "secret", 4)
+
+			path := filepath.Join(dir, "audit.log")
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+			lines = tt.mutate(lines)
+			if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := core.VerifyAuditLogWithKey(dir, []byte("secret"))
+			if err != nil {
+				t.Fatalf("verify failed: %v", err)
+			}
+			if result.OK() {
+				t.Fatal("expected tampering to be detected")
+			}
+			found := false
+			for _, problem := range result.Problems {
+				if strings.Contains(problem.Reason, tt.reason) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("expected a %q problem, got %v", tt.reason, result.Problems)
+			}
+		})
+	}
+}
+
+func TestAuditChainAnchorsHeadAndTail(t *testing.T) {
+	// pruneOldest 写入两个备份后由保留策略删除较旧的一个
+	pruneOldest := func(t *testing.T, dir string) {
+		writeChainedAuditLog(t, dir, "secret", 2)
+		rotateAuditLog(t, dir)
+		writeChainedAuditLog(t, dir, "secret", 2)
+		rotateAuditLog(t, dir)
+		cfg := newChainedAuditConfig(dir, "secret")
+		cfg.Audit.Storage.Rotation.MaxBackups = 1
+		writeAuditEvents(cfg, 2)
+	}
+
+	tests := []struct {
+		name   string
+		setup  func(t *testing.T, dir string)
+		reason string
+	}{
+		{
+			name:  "pruned by retention",
+			setup: pruneOldest,
+		},
+		{
+			name: "pruned head deleted",
+			setup: func(t *testing.T, dir string) {
+				pruneOldest(t, dir)
+				removeAuditBackups(t, dir)
+			},
+			reason: "head deleted",
+		},
+		{
+			name: "head deleted without checkpoint",
+			setup: func(t *testing.T, dir string) {
+				writeChainedAuditLog(t, dir, "secret", 2)
+				rotateAuditLog(t, dir)
+				writeChainedAuditLog(t, dir, "secret", 2)
+				removeAuditBackups(t, dir)
+				os.Remove(filepath.Join(dir, "audit.checkpoint"))
+			},
+			reason: "no checkpoint records pruned files",
+		},
+		{
+			name: "tail truncated",
+			setup: func(t *testing.T, dir string) {
+				writeChainedAuditLog(t, dir, "secret", 4)
+				path := filepath.Join(dir, "audit.log")
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				lines := strings.SplitAfter(string(data), "\n")
+				if err := os.WriteFile(path, []byte(strings.Join(lines[:2], "")), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			reason: "tail truncated",
+		},
+		{
+			name: "tail truncated then appended",
+			setup: func(t *testing.T, dir string) {
+				writeChainedAuditLog(t, dir, "secret", 4)
+				path := filepath.Join(dir, "audit.log")
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				lines := strings.SplitAfter(string(data), "\n")
+				if err := os.WriteFile(path, []byte(strings.Join(lines[:2], "")), 0644); err != nil {
+					t.Fatal(err)
+				}
+				// 重启后从检查点继续编号，截断留下序号缺口
+				writeChainedAuditLog(t, dir, "secret", 3)
+			},
+			reason: "sequence gap",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.setup(t, dir)
+
+			result, err := core.VerifyAuditLogWithKey(dir, []byte("secret"))
+			if err != nil {
+				t.Fatalf("verify failed: %v", err)
+			}
+			if tt.reason == "" {
+				if !result.OK() || result.FirstSeq != 3 || result.LastSeq != 6 {
+					t.Errorf("expected intact chain from seq 3 to 6, got %d..%d %v", result.FirstSeq, result.LastSeq, result.Problems)
+				}
+				return
+			}
+			found := false
+			for _, problem := range result.Problems {
+				if strings.Contains(problem.Reason, tt.reason) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("expected a %q problem, got %v", tt.reason, result.Problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,478 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package tests
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+)
+
+// generateTestCert 生成自签名证书，返回证书和私钥文件路径
+func generateTestCert(t *testing.T, dir, commonName string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{"text2sql-test"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost", commonName},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, commonName+".crt")
+	keyFile := filepath.Join(dir, commonName+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func sampleAuditBatch(n int) []*core.AuditEntry {
+	batch := make([]*core.AuditEntry, 0, n)
+	for i := 1; i <= n; i++ {
+		batch = append(batch, &core.AuditEntry{
+			Timestamp: time.Now(),
+			QueryID:   "q" + strconv.Itoa(i),
+			EventType: "success",
+			Data:      map[string]interface{}{"user": "alice"},
+			Seq:       uint64(i),
+		})
+	}
+	return batch
+}
+
+// readOctetCounted 按 RFC 6587 octet-counting 分帧读取一条 syslog 消息
+func readOctetCounted(r *bufio.Reader) (string, error) {
+	length, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(length))
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func checkSyslogMessage(t *testing.T, msg string, seq int) {
+	t.Helper()
+	// facility 13 * 8 + info 6 = 110
+	if !strings.HasPrefix(msg, "<110>1 ") {
+		t.Errorf("unexpected syslog header: %q", msg)
+	}
+	if !strings.Contains(msg, `[audit@32473 query_id="q`+strconv.Itoa(seq)+`"`) {
+		t.Errorf("missing structured data in %q", msg)
+	}
+	body := msg[strings.Index(msg, "] ")+2:]
+	var entry core.AuditEntry
+	if err := json.Unmarshal([]byte(body), &entry); err != nil {
+		t.Fatalf("syslog body is not an audit entry: %v", err)
+	}
+	if entry.Seq != uint64(seq) {
+		t.Errorf("expected seq %d, got %d", seq, entry.Seq)
+	}
+}
+
+func TestSyslogExporterUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	exporter, err := core.NewSyslogExporter(config.AuditExporterConfig{
+		Name: "udp", Network: "udp", Address: conn.LocalAddr().String(), AppName: "text2sql",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Close()
+
+	if err := exporter.Export(context.Background(), sampleAuditBatch(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 64*1024)
+	for i := 1; i <= 2; i++ {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSyslogMessage(t, string(buf[:n]), i)
+	}
+}
+
+// serveSyslogStream 接收 TCP/TLS syslog 消息并发送到通道
+func serveSyslogStream(listener net.Listener, messages chan<- string) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func(c net.Conn) {
+			defer c.Close()
+			r := bufio.NewReader(c)
+			for {
+				msg, err := readOctetCounted(r)
+				if err != nil {
+					return
+				}
+				messages <- msg
+			}
+		}(conn)
+	}
+}
+
+func TestSyslogExporterTCPAndTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := generateTestCert(t, dir, "syslog.test")
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		network string
+		listen  func() (net.Listener, error)
+	}{
+		{"tcp", func() (net.Listener, error) { return net.Listen("tcp", "127.0.0.1:0") }},
+		{"tls", func() (net.Listener, error) {
+			return tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.network, func(t *testing.T) {
+			listener, err := tt.listen()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+
+			messages := make(chan string, 10)
+			go serveSyslogStream(listener, messages)
+
+			exporter, err := core.NewSyslogExporter(config.AuditExporterConfig{
+				Name:    tt.network,
+				Network: tt.network,
+				Address: listener.Addr().String(),
+				TLS:     config.ExporterTLSConfig{CAFile: certFile, ServerName: "syslog.test"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer exporter.Close()
+
+			if err := exporter.Export(context.Background(), sampleAuditBatch(3)); err != nil {
+				t.Fatal(err)
+			}
+			for i := 1; i <= 3; i++ {
+				select {
+				case msg := <-messages:
+					checkSyslogMessage(t, msg, i)
+				case <-time.After(2 * time.Second):
+					t.Fatalf("timed out waiting for message %d", i)
+				}
+			}
+		})
+	}
+}
+
+func TestOTLPExporterPayload(t *testing.T) {
+	var payload struct {
+		ResourceLogs []struct {
+			ScopeLogs []struct {
+				LogRecords []struct {
+					TimeUnixNano string `json:"timeUnixNano"`
+					SeverityText string `json:"severityText"`
+					Body         struct {
+						StringValue string `json:"stringValue"`
+					} `json:"body"`
+				} `json:"logRecords"`
+			} `json:"scopeLogs"`
+		} `json:"resourceLogs"`
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer otlp-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer server.Close()
+
+	exporter, err := core.NewOTLPExporter(config.AuditExporterConfig{
+		Name: "otlp", Endpoint: server.URL, AppName: "text2sql",
+		Headers: map[string]string{"Authorization": "Bearer otlp-token"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Close()
+
+	if err := exporter.Export(context.Background(), sampleAuditBatch(2)); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.ResourceLogs) != 1 || len(payload.ResourceLogs[0].ScopeLogs) != 1 {
+		t.Fatalf("unexpected OTLP payload: %+v", payload)
+	}
+	records := payload.ResourceLogs[0].ScopeLogs[0].LogRecords
+	if len(records) != 2 {
+		t.Fatalf("expected 2 log records, got %d", len(records))
+	}
+	if records[0].SeverityText != "INFO" || records[0].TimeUnixNano == "" {
+		t.Errorf("unexpected log record: %+v", records[0])
+	}
+	if !strings.Contains(records[1].Body.StringValue, `"QueryID":"q2"`) {
+		t.Errorf("log body should carry the entry JSON, got %s", records[1].Body.StringValue)
+	}
+}
+
+func TestOTLPExporterClientErrorIsPermanent(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	exporter, err := core.NewOTLPExporter(config.AuditExporterConfig{Name: "otlp", Endpoint: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := core.NewBatchingSink(exporter, core.BatchOptions{
+		BatchSize: 1,
+		Retry:     config.RetryConfig{Enabled: true, MaxAttempts: 5, InitialBackoff: "1ms", MaxBackoff: "1ms", BackoffMultiplier: 1},
+	})
+	sink.Write(sampleAuditBatch(1)[0])
+	sink.Close()
+
+	if calls.Load() != 1 {
+		t.Errorf("4xx responses should not be retried, got %d calls", calls.Load())
+	}
+	if stats := sink.Stats(); stats.Failed != 1 || stats.Retries != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestWebhookExporterSignsPayload(t *testing.T) {
+	secret := "webhook-secret"
+	var verified atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp := r.Header.Get(core.WebhookTimestampHeader)
+		expected := "sha256=" + core.SignWebhookPayload([]byte(secret), timestamp, body)
+		if r.Header.Get(core.WebhookSignatureHeader) != expected {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var payload struct {
+			Entries []core.AuditEntry `json:"entries"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil || len(payload.Entries) != 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		verified.Store(true)
+	}))
+	defer server.Close()
+
+	exporter, err := core.NewWebhookExporter(config.AuditExporterConfig{Name: "hook", Endpoint: server.URL, Secret: secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Close()
+
+	if err := exporter.Export(context.Background(), sampleAuditBatch(3)); err != nil {
+		t.Fatal(err)
+	}
+	if !verified.Load() {
+		t.Error("webhook signature was not verified")
+	}
+
+	// 错误的密钥会被接收方拒绝，且不可重试
+	wrong, _ := core.NewWebhookExporter(config.AuditExporterConfig{Name: "hook", Endpoint: server.URL, Secret: "wrong"})
+	defer wrong.Close()
+	if err := wrong.Export(context.Background(), sampleAuditBatch(3)); err == nil {
+		t.Error("expected signature mismatch to be rejected")
+	}
+}
+
+func TestBatchingSinkRetriesWithBackoff(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	exporter, err := core.NewWebhookExporter(config.AuditExporterConfig{Name: "hook", Endpoint: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := core.NewBatchingSink(exporter, core.BatchOptions{
+		BatchSize: 1,
+		Retry:     config.RetryConfig{Enabled: true, MaxAttempts: 5, InitialBackoff: "5ms", MaxBackoff: "20ms", BackoffMultiplier: 2},
+	})
+	sink.Write(sampleAuditBatch(1)[0])
+
+	if !waitFor(func() bool { return sink.Stats().Exported == 1 }, 2*time.Second) {
+		t.Fatalf("entry was not exported after retries: %+v", sink.Stats())
+	}
+	sink.Close()
+
+	if stats := sink.Stats(); stats.Retries != 2 || stats.Failed != 0 {
+		t.Errorf("expected 2 retries and no failures, got %+v", stats)
+	}
+}
+
+// recordingExporter 记录每次导出的批量大小
+type recordingExporter struct {
+	mu      sync.Mutex
+	batches []int
+}
+
+func (r *recordingExporter) Name() string { return "recording" }
+
+func (r *recordingExporter) Export(_ context.Context, batch []*core.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, len(batch))
+	return nil
+}
+
+func (r *recordingExporter) Close() error { return nil }
+
+func (r *recordingExporter) Batches() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int(nil), r.batches...)
+}
+
+func TestBatchingSinkHonorsBatchProcessing(t *testing.T) {
+	perf := config.BatchProcessing{Enabled: true, BatchSize: 3, FlushInterval: "50ms"}
+	exporter := &recordingExporter{}
+	sink := core.NewBatchingSink(exporter, core.BatchOptionsFromConfig(perf, config.AuditExporterConfig{}))
+
+	for _, entry := range sampleAuditBatch(7) {
+		sink.Write(entry)
+	}
+
+	// 两个满批次立即发送，剩余 1 条在 flush_interval 后发送
+	if !waitFor(func() bool { return len(exporter.Batches()) == 3 }, 2*time.Second) {
+		t.Fatalf("expected 3 batches, got %v", exporter.Batches())
+	}
+	if got := exporter.Batches(); got[0] != 3 || got[1] != 3 || got[2] != 1 {
+		t.Errorf("unexpected batch sizes: %v", got)
+	}
+	sink.Close()
+}
+
+func TestAuditLoggerExportsAlongsideStorage(t *testing.T) {
+	received := make(chan []byte, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+	}))
+	defer server.Close()
+
+	cfg := newAuditSinkConfig("memory", "")
+	cfg.Performance.BatchProcessing = config.BatchProcessing{Enabled: true, BatchSize: 4, FlushInterval: "1s"}
+	cfg.Audit.Exporters = []config.AuditExporterConfig{{Name: "hook", Type: "webhook", Endpoint: server.URL}}
+	if err := config.ValidateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := core.NewAuditLogger(cfg)
+	logSampleEvents(logger)
+
+	select {
+	case body := <-received:
+		var payload struct {
+			Entries []core.AuditEntry `json:"entries"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Fatal(err)
+		}
+		if len(payload.Entries) != 4 || payload.Entries[3].Seq != 4 {
+			t.Errorf("unexpected exported batch: %+v", payload.Entries)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for export")
+	}
+
+	if !waitFor(func() bool { return logger.Stats().Exporters["hook"].Exported == 4 }, 2*time.Second) {
+		t.Errorf("expected exporter stats in audit stats, got %+v", logger.Stats().Exporters)
+	}
+	entries, err := logger.Query(core.AuditFilter{})
+	if err != nil || len(entries) != 4 {
+		t.Errorf("primary storage should still be queryable, got %d entries, err=%v", len(entries), err)
+	}
+	logger.Close()
+}
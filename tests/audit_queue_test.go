@@ -0,0 +1,225 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+)
+
+// gatedSink 在 gate 关闭前阻塞写入，用于模拟慢速存储
+type gatedSink struct {
+	*core.MemoryAuditSink
+	gate chan struct{}
+}
+
+func newGatedSink() *gatedSink {
+	return &gatedSink{MemoryAuditSink: core.NewMemoryAuditSink(1000), gate: make(chan struct{})}
+}
+
+func (g *gatedSink) Write(entry *core.AuditEntry) error {
+	<-g.gate
+	return g.MemoryAuditSink.Write(entry)
+}
+
+func newQueueConfig(overflow string) *config.Config {
+	cfg := config.DefaultConfig()
+	cfg.Audit.Storage.Type = "memory"
+	cfg.Audit.Queue.Size = 1
+	cfg.Audit.Queue.Overflow = overflow
+	cfg.Performance.AsyncProcessing = true
+	return cfg
+}
+
+func TestAuditLevelSelectsFields(t *testing.T) {
+	data := map[string]interface{}{
+		"input":    "2025年北京销售额",
+		"template": "SELECT region FROM sales",
+		"status":   "success",
+	}
+
+	for _, level := range []string{"none", "basic", "detailed"} {
+		t.Run(level, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			cfg.Audit.Level = level
+			cfg.Performance.AsyncProcessing = false
+			sink := core.NewMemoryAuditSink(10)
+			logger := core.NewAuditLoggerWithSink(cfg, sink)
+			logger.LogEvent("q1", "success", data)
+			logger.Close()
+
+			entries, _ := sink.Query(core.AuditFilter{})
+			switch level {
+			case "none":
+				if len(entries) != 0 {
+					t.Fatalf("level none should not log, got %d entries", len(entries))
+				}
+			case "basic":
+				got := entries[0].Data
+				if _, ok := got["input"]; ok {
+					t.Error("basic level should not record raw input")
+				}
+				if _, ok := got["template"]; ok {
+					t.Error("basic level should not record generated SQL")
+				}
+				if got["status"] != "success" || got["input_length"] == nil || got["input_sha256"] == nil {
+					t.Errorf("basic level missing summary fields: %v", got)
+				}
+			case "detailed":
+				if entries[0].Data["input"] != data["input"] {
+					t.Errorf("detailed level should record raw input, got %v", entries[0].Data)
+				}
+			}
+		})
+	}
+}
+
+func TestAuditOverflowDropIsCounted(t *testing.T) {
+	sink := newGatedSink()
+	logger := core.NewAuditLoggerWithSink(newQueueConfig("drop"), sink)
+
+	for i := 0; i < 10; i++ {
+		logger.LogEvent("q", "event", nil)
+	}
+	stats := logger.Stats()
+	close(sink.gate)
+	logger.Close()
+
+	entries, _ := sink.Query(core.AuditFilter{})
+	if stats.Dropped == 0 {
+		t.Fatal("expected dropped events to be counted")
+	}
+	if uint64(len(entries))+stats.Dropped != 10 {
+		t.Errorf("written (%d) + dropped (%d) should account for all 10 events", len(entries), stats.Dropped)
+	}
+}
+
+func TestAuditOverflowSpillIsReplayed(t *testing.T) {
+	cfg := newQueueConfig("spill")
+	cfg.Audit.Queue.SpillPath = filepath.Join(t.TempDir(), "audit.spill")
+	sink := newGatedSink()
+	logger := core.NewAuditLoggerWithSink(cfg, sink)
+
+	for i := 0; i < 10; i++ {
+		logger.LogEvent("q", "event", nil)
+	}
+	stats := logger.Stats()
+	close(sink.gate)
+	logger.Close()
+
+	if stats.Spilled == 0 {
+		t.Fatal("expected events to spill to disk")
+	}
+	entries, _ := sink.Query(core.AuditFilter{})
+	if len(entries) != 10 || logger.Stats().Dropped != 0 {
+		t.Errorf("expected all 10 events after replay, got %d (dropped=%d)", len(entries), logger.Stats().Dropped)
+	}
+}
+
+func TestAuditSpillCountsMalformedRecords(t *testing.T) {
+	cfg := newQueueConfig("spill")
+	cfg.Audit.Queue.SpillPath = filepath.Join(t.TempDir(), "audit.spill")
+	spill := `{"QueryID":"q","EventType":"event"}` + "\n{truncated\n"
+	if err := os.WriteFile(cfg.Audit.Queue.SpillPath, []byte(spill), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// 启动时回放上次遗留的溢出文件，无法解析的行计入丢弃数
+	sink := core.NewMemoryAuditSink(10)
+	logger := core.NewAuditLoggerWithSink(cfg, sink)
+	logger.Close()
+
+	entries, _ := sink.Query(core.AuditFilter{})
+	if len(entries) != 1 || logger.Stats().Dropped != 1 {
+		t.Errorf("expected 1 replayed and 1 dropped event, got %d replayed, %d dropped", len(entries), logger.Stats().Dropped)
+	}
+}
+
+func TestAuditSpillPathRequired(t *testing.T) {
+	for _, storage := range []string{"memory", "console"} {
+		cfg := newQueueConfig("spill")
+		cfg.Audit.Storage.Type = storage
+		if err := config.ValidateConfig(cfg); err == nil || !strings.Contains(err.Error(), "audit.queue.spill_path") {
+			t.Errorf("%s: expected spill_path to be required, got %v", storage, err)
+		}
+	}
+
+	cfg := newQueueConfig("spill")
+	cfg.Audit.Storage.Type = "file"
+	cfg.Audit.Storage.Path = t.TempDir()
+	if err := config.ValidateConfig(cfg); err != nil {
+		t.Errorf("file storage should default the spill path: %v", err)
+	}
+}
+
+func TestAuditCloseDrainsQueue(t *testing.T) {
+	cfg := newQueueConfig("block")
+	cfg.Audit.Queue.Size = 500
+	sink := newGatedSink()
+	logger := core.NewAuditLoggerWithSink(cfg, sink)
+
+	for i := 0; i < 200; i++ {
+		logger.LogEvent("q", "event", nil)
+	}
+	close(sink.gate)
+	logger.Close()
+
+	entries, _ := sink.Query(core.AuditFilter{})
+	if len(entries) != 200 {
+		t.Errorf("expected Close to drain all 200 buffered events, got %d", len(entries))
+	}
+
+	logger.LogEvent("q", "after_close", nil)
+	if logger.Stats().Dropped != 1 {
+		t.Errorf("events after Close should be counted as dropped, got %d", logger.Stats().Dropped)
+	}
+}
+
+func TestExecuteAuditsBeforeShutdown(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Performance.AsyncProcessing = true
+	db := newTestDB(t, "CREATE TABLE data (id INT); INSERT INTO data VALUES (1);")
+	skill, err := core.NewText2SQLSkill(cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const runs = 20
+	for i := 0; i < runs; i++ {
+		if _, err := skill.Execute(context.Background(), testInput); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// execution_end 在 Execute 返回前入队，关闭时随队列一起写入
+	skill.SafeShutdown()
+
+	impl := skill.(*core.Text2SQLSkill)
+	entries, err := impl.QueryAudit(core.AuditFilter{EventType: "execution_end"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != runs || impl.AuditStats().Dropped != 0 {
+		t.Errorf("expected %d execution_end entries without drops, got %d (dropped=%d)", runs, len(entries), impl.AuditStats().Dropped)
+	}
+}
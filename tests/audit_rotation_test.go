@@ -0,0 +1,155 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package tests
+
+import (
+	"bufio"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+)
+
+func TestRotatingFileSizeRotationAndRetention(t *testing.T) {
+	dir := t.TempDir()
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)}
+
+	rf, err := core.NewRotatingFile(dir, "audit", core.RotationOptions{
+		MaxSizeBytes: 100,
+		MaxBackups:   2,
+		Compress:     true,
+		SyncPolicy:   core.SyncAlways,
+		Now:          clock.Now,
+	})
+	if err != nil {
+		t.Fatalf("NewRotatingFile failed: %v", err)
+	}
+
+	line := []byte(strings.Repeat("x", 59) + "\n")
+	for i := 0; i < 8; i++ {
+		if _, err := rf.Write(line); err != nil {
+			t.Fatalf("write %d failed: %v", i, err)
+		}
+		clock.Advance(time.Second)
+	}
+	if err := rf.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "audit-*"))
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 retained backups, got %d: %v", len(backups), backups)
+	}
+	for _, backup := range backups {
+		if !strings.HasSuffix(backup, ".log.gz") {
+			t.Errorf("expected compressed backup, got %s", backup)
+		}
+		if got := countGzipLines(t, backup); got != 1 {
+			t.Errorf("backup %s: expected 1 line, got %d", backup, got)
+		}
+	}
+
+	active, err := os.ReadFile(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatalf("read active file: %v", err)
+	}
+	if string(active) != string(line) {
+		t.Errorf("unexpected active file content: %q", active)
+	}
+}
+
+func TestRotatingFileDailyRotationAndMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 23, 0, 0, 0, time.UTC)}
+
+	rf, err := core.NewRotatingFile(dir, "audit", core.RotationOptions{
+		MaxAge:     36 * time.Hour,
+		SyncPolicy: core.SyncNever,
+		Now:        clock.Now,
+	})
+	if err != nil {
+		t.Fatalf("NewRotatingFile failed: %v", err)
+	}
+
+	for day := 0; day < 4; day++ {
+		if _, err := rf.Write([]byte("entry\n")); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		clock.Advance(24 * time.Hour)
+	}
+	rf.Write([]byte("last\n"))
+	if err := rf.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// 备份按轮转时间命名：01-02、01-03 两份超出 36h 保留期
+	backups, _ := filepath.Glob(filepath.Join(dir, "audit-*.log"))
+	if len(backups) != 2 {
+		t.Errorf("expected backups older than max age to be removed, got %v", backups)
+	}
+}
+
+func TestAuditLoggerWritesRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Audit.Storage.Type = "file"
+	cfg.Audit.Storage.Path = dir
+	cfg.Audit.Storage.Fsync = "never"
+	cfg.Performance.AsyncProcessing = false
+
+	logger := core.NewAuditLogger(cfg)
+	for i := 0; i < 3; i++ {
+		logger.LogEvent("q", "test_event", map[string]interface{}{"i": i})
+	}
+	logger.Close()
+
+	data, err := os.ReadFile(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatalf("read audit log: %v", err)
+	}
+	if n := strings.Count(string(data), "\n"); n != 3 {
+		t.Errorf("expected 3 audit lines after Close flush, got %d", n)
+	}
+}
+
+func countGzipLines(t *testing.T, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip reader %s: %v", path, err)
+	}
+	defer gz.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		lines++
+	}
+	return lines
+}
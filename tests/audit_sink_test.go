@@ -0,0 +1,162 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+)
+
+func newAuditSinkConfig(storageType, path string) *config.Config {
+	cfg := config.DefaultConfig()
+	cfg.Audit.Storage.Type = storageType
+	cfg.Audit.Storage.Path = path
+	cfg.Audit.Storage.Fsync = "never"
+	cfg.Performance.AsyncProcessing = false
+	return cfg
+}
+
+func logSampleEvents(logger *core.AuditLogger) {
+	logger.LogEvent("q1", "execution_start", map[string]interface{}{"user": "alice"})
+	logger.LogEvent("q1", "success", map[string]interface{}{"user": "alice", "status": "success"})
+	logger.LogEvent("q2", "execution_start", map[string]interface{}{"user": "bob"})
+	logger.LogEvent("q2", "rejected", map[string]interface{}{"user": "bob", "status": "rejected"})
+}
+
+func TestAuditSinkQueries(t *testing.T) {
+	storages := []struct {
+		typ  string
+		path string
+	}{
+		{"file", t.TempDir()},
+		{"sqlite", filepath.Join(t.TempDir(), "audit.db")},
+		{"memory", ""},
+	}
+
+	for _, storage := range storages {
+		t.Run(storage.typ, func(t *testing.T) {
+			cfg := newAuditSinkConfig(storage.typ, storage.path)
+			if err := config.ValidateConfig(cfg); err != nil {
+				t.Fatalf("config invalid: %v", err)
+			}
+
+			logger := core.NewAuditLogger(cfg)
+			defer logger.Close()
+			logSampleEvents(logger)
+
+			tests := []struct {
+				name   string
+				filter core.AuditFilter
+				want   []uint64
+			}{
+				{"all", core.AuditFilter{}, []uint64{1, 2, 3, 4}},
+				{"query id", core.AuditFilter{QueryID: "q2"}, []uint64{3, 4}},
+				{"event type", core.AuditFilter{EventType: "execution_start"}, []uint64{1, 3}},
+				{"user", core.AuditFilter{User: "alice"}, []uint64{1, 2}},
+				{"status", core.AuditFilter{Status: "rejected"}, []uint64{4}},
+				{"limit", core.AuditFilter{Limit: 2}, []uint64{3, 4}},
+				{"future", core.AuditFilter{Since: time.Now().Add(time.Hour)}, nil},
+				{"past", core.AuditFilter{Until: time.Now().Add(-time.Hour)}, nil},
+			}
+
+			for _, tt := range tests {
+				entries, err := logger.Query(tt.filter)
+				if err != nil {
+					t.Fatalf("%s: query failed: %v", tt.name, err)
+				}
+				var got []uint64
+				for _, entry := range entries {
+					got = append(got, entry.Seq)
+				}
+				if !equalSeqs(got, tt.want) {
+					t.Errorf("%s: expected seqs %v, got %v", tt.name, tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSQLiteAuditSinkResumesChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.db")
+
+	logger := core.NewAuditLogger(newAuditSinkConfig("sqlite", path))
+	logSampleEvents(logger)
+	logger.Close()
+
+	logger = core.NewAuditLogger(newAuditSinkConfig("sqlite", path))
+	logger.LogEvent("q3", "execution_start", nil)
+	entries, err := logger.Query(core.AuditFilter{QueryID: "q3"})
+	logger.Close()
+
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one q3 entry, got %v (err=%v)", entries, err)
+	}
+	if entries[0].Seq != 5 || entries[0].PrevHash == "" {
+		t.Errorf("expected chain to resume at seq 5, got seq=%d prev=%q", entries[0].Seq, entries[0].PrevHash)
+	}
+}
+
+func TestMemoryAuditSinkRingBuffer(t *testing.T) {
+	sink := core.NewMemoryAuditSink(3)
+	for i := uint64(1); i <= 5; i++ {
+		sink.Write(&core.AuditEntry{Seq: i})
+	}
+
+	entries, _ := sink.Query(core.AuditFilter{})
+	var got []uint64
+	for _, entry := range entries {
+		got = append(got, entry.Seq)
+	}
+	if !equalSeqs(got, []uint64{3, 4, 5}) {
+		t.Errorf("expected ring buffer to keep newest entries, got %v", got)
+	}
+}
+
+func TestConsoleAuditSinkNotQueryable(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := newAuditSinkConfig("console", "")
+	logger := core.NewAuditLoggerWithSink(cfg, core.NewConsoleAuditSink(&buf))
+	defer logger.Close()
+
+	logger.LogEvent("q1", "execution_start", nil)
+	if !strings.Contains(buf.String(), `"EventType":"execution_start"`) {
+		t.Errorf("expected JSON line on console, got %q", buf.String())
+	}
+	if _, err := logger.Query(core.AuditFilter{}); !errors.Is(err, core.ErrAuditQueryUnsupported) {
+		t.Errorf("expected ErrAuditQueryUnsupported, got %v", err)
+	}
+}
+
+func equalSeqs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package tests
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+	"text2sql-skill/interfaces"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
+func TestQueryCacheExpiryWithClock(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Cache.TTL = "5m"
+
+	cache := core.NewQueryCache(cfg)
+	defer cache.Close()
+
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cache.SetClock(clock.Now)
+
+	cache.Set("q1", interfaces.SkillResult{QueryID: "1", Status: "success"})
+	if _, found := cache.Get("q1"); !found {
+		t.Fatal("expected cache hit before TTL")
+	}
+
+	clock.Advance(6 * time.Minute)
+	if _, found := cache.Get("q1"); found {
+		t.Error("expected cache miss after TTL")
+	}
+	if removed := cache.Purge(); removed != 1 {
+		t.Errorf("expected 1 expired entry purged, got %d", removed)
+	}
+	if cache.Len() != 0 {
+		t.Errorf("expected empty cache, got %d entries", cache.Len())
+	}
+}
+
+func TestQueryCacheJanitorRestarts(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Cache.TTL = "30ms"
+
+	cache := core.NewQueryCache(cfg)
+	defer cache.Close()
+
+	for round := 0; round < 2; round++ {
+		cache.Set("q", interfaces.SkillResult{Status: "success"})
+		if !waitFor(func() bool { return cache.Len() == 0 }, time.Second) {
+			t.Fatalf("round %d: janitor did not purge expired entry", round)
+		}
+	}
+}
+
+func TestQueryCacheClose(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cache := core.NewQueryCache(cfg)
+
+	cache.Set("q", interfaces.SkillResult{Status: "success"})
+	cache.Close()
+	cache.Close() // 重复关闭不应 panic
+
+	cache.Set("q", interfaces.SkillResult{Status: "success"})
+	if cache.Len() != 0 {
+		t.Error("closed cache should not accept new entries")
+	}
+}
+
+func waitFor(cond func() bool, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return cond()
+}
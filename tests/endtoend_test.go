@@ -136,6 +136,7 @@ func (m *mockSkill) Execute(ctx context.Context, input string) (interfaces.Skill
 }
 
 func (m *mockSkill) SafeShutdown() error {
+	m.cache.Close()
 	m.auditLogger.Close()
 	return nil
 }
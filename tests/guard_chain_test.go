@@ -0,0 +1,261 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+	"text2sql-skill/drivers"
+)
+
+func guardNames(guards []core.Guard) string {
+	names := make([]string, 0, len(guards))
+	for _, guard := range guards {
+		names = append(names, guard.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+// thresholdGuard 通过 settings 配置的自定义守卫
+type thresholdGuard struct {
+	word string
+}
+
+func (g *thresholdGuard) Name() string           { return "word_blocker" }
+func (g *thresholdGuard) Phase() core.GuardPhase { return core.PhasePreGeneration }
+func (g *thresholdGuard) Configure(settings map[string]string) error {
+	if settings["word"] == "" {
+		return errors.New("word is required")
+	}
+	g.word = settings["word"]
+	return nil
+}
+func (g *thresholdGuard) Check(_ context.Context, req *core.GuardRequest) core.Decision {
+	if strings.Contains(req.Input, g.word) {
+		return core.Deny("WORD_BLOCKED", "blocked word: "+g.word)
+	}
+	return core.Allow()
+}
+
+func TestGuardChainOrderFromConfig(t *testing.T) {
+	cfg := config.DefaultConfig()
+	guardSystem := core.NewGuardSystem(cfg, core.NewPermissionController(cfg), core.NewExecutionController(cfg))
+	if got := guardNames(guardSystem.Chain(core.PhasePreGeneration)); got != "semantic_safety,operation_permission,keyword_filter,resource_control,execution_safety,prompt_injection" {
+		t.Errorf("unexpected default chain %s", got)
+	}
+
+	var security config.SecurityConfig
+	if err := yaml.Unmarshal([]byte(`
+guards:
+  - name: word_blocker
+    settings:
+      word: "secret"
+  - name: keyword_filter
+  - name: semantic_safety
+    enabled: false
+`), &security); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Security.Guards = security.Guards
+	if err := config.ValidateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	guardSystem = core.NewGuardSystem(cfg, core.NewPermissionController(cfg), core.NewExecutionController(cfg))
+	if err := guardSystem.Register(&thresholdGuard{}); err != nil {
+		t.Fatal(err)
+	}
+	// 列出的守卫在前，未列出的按默认顺序在后，禁用的守卫不运行
+	if got := guardNames(guardSystem.Chain(core.PhasePreGeneration)); got != "word_blocker,keyword_filter,operation_permission,resource_control,execution_safety,prompt_injection" {
+		t.Errorf("unexpected configured chain %s", got)
+	}
+	if allowed, reason := guardSystem.CheckAllGuards(context.Background(), "2025年北京secret客户"); allowed || reason != "blocked word: secret" {
+		t.Errorf("configured custom guard should deny first, got %v %q", allowed, reason)
+	}
+
+	if err := guardSystem.Register(core.NewGuardFunc("keyword_filter", core.PhasePostResult, nil)); err == nil {
+		t.Error("duplicate guard name should be rejected")
+	}
+	if err := guardSystem.Register(core.NewGuardFunc("odd", "sometime", nil)); err == nil {
+		t.Error("unknown phase should be rejected")
+	}
+
+	// settings 缺少必填项时注册失败
+	cfg.Security.Guards = nil
+	bare := core.NewGuardSystem(cfg, core.NewPermissionController(cfg), core.NewExecutionController(cfg))
+	if err := bare.Register(&thresholdGuard{}); err == nil || !strings.Contains(err.Error(), "word is required") {
+		t.Errorf("Configure error should be returned, got %v", err)
+	}
+
+	cfg.Security.Guards = []config.GuardConfig{{Name: "a"}, {Name: "a"}}
+	if err := config.ValidateConfig(cfg); err == nil || !strings.Contains(err.Error(), "duplicate guard") {
+		t.Errorf("expected duplicate guard error, got %v", err)
+	}
+}
+
+func TestGuardChainPhasesInExecute(t *testing.T) {
+	db, err := drivers.CreateSQLiteConnection(t.TempDir() + "/data.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE data (id INTEGER, secret TEXT); INSERT INTO data VALUES (1, 'classified-1'), (2, 'classified-2'), (3, 'classified-3')"); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := newAuditSinkConfig("memory", "")
+	skill, err := core.NewText2SQLSkill(cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer skill.SafeShutdown()
+	impl := skill.(*core.Text2SQLSkill)
+
+	var seen []string
+	guards := []core.Guard{
+		core.NewGuardFunc("audit_tag", core.PhasePreGeneration, func(_ context.Context, req *core.GuardRequest) core.Decision {
+			seen = append(seen, "pre_generation")
+			return core.Warn("TAGGED", "input tagged for review")
+		}),
+		core.NewGuardFunc("limit_ids", core.PhasePostGeneration, func(_ context.Context, req *core.GuardRequest) core.Decision {
+			seen = append(seen, "post_generation")
+			return core.Rewrite("SQL_REWRITTEN", "restricted to id <= 2", strings.Replace(req.SQL, "1=1", "id <= 2", 1))
+		}),
+		core.NewGuardFunc("no_full_scan", core.PhasePreExecution, func(_ context.Context, req *core.GuardRequest) core.Decision {
+			seen = append(seen, "pre_execution")
+			if strings.Contains(req.SQL, "1=1") {
+				return core.Deny("FULL_SCAN", "full table scan")
+			}
+			return core.Allow()
+		}),
+		core.NewGuardFunc("drop_secret", core.PhasePostResult, func(_ context.Context, req *core.GuardRequest) core.Decision {
+			seen = append(seen, "post_result")
+			for _, row := range req.Rows {
+				delete(row, "secret")
+			}
+			return core.Rewrite("COLUMN_DROPPED", "secret removed", "")
+		}),
+	}
+	for _, guard := range guards {
+		if err := impl.RegisterGuard(guard); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := skill.Execute(context.Background(), "2025年北京销售额超过100万的客户")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != "success" {
+		t.Fatalf("expected success, got %s: %s", result.Status, result.Meta)
+	}
+	if strings.Join(seen, ",") != "pre_generation,post_generation,pre_execution,post_result" {
+		t.Errorf("unexpected phase order %v", seen)
+	}
+
+	var meta struct {
+		RowCount       int    `json:"row_count"`
+		TemplateUsed   string `json:"template_used"`
+		GuardDecisions []struct {
+			Action string `json:"action"`
+			Guard  string `json:"guard"`
+			Code   string `json:"code"`
+		} `json:"guard_decisions"`
+	}
+	if err := json.Unmarshal(result.Meta, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.RowCount != 2 || !strings.Contains(meta.TemplateUsed, "id <= 2") {
+		t.Errorf("post_generation rewrite should apply, got %+v", meta)
+	}
+	var codes []string
+	for _, d := range meta.GuardDecisions {
+		codes = append(codes, d.Guard+":"+d.Action+":"+d.Code)
+	}
+	if strings.Join(codes, ",") != "audit_tag:warn:TAGGED,limit_ids:rewrite:SQL_REWRITTEN,drop_secret:rewrite:COLUMN_DROPPED" {
+		t.Errorf("unexpected guard decisions %v", codes)
+	}
+	if strings.Contains(string(result.Result), "classified") {
+		t.Error("post_result guard should have removed the secret column")
+	}
+
+	entries, err := impl.QueryAudit(core.AuditFilter{QueryID: result.QueryID, EventType: "success"})
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one success entry, got %d, err=%v", len(entries), err)
+	}
+	if decisions, _ := entries[0].Data["guard_decisions"].([]map[string]interface{}); len(decisions) != 3 {
+		t.Errorf("success audit should carry guard decisions: %+v", entries[0].Data)
+	}
+}
+
+func TestGuardDenialSurfacesCode(t *testing.T) {
+	db, err := drivers.CreateSQLiteConnection(t.TempDir() + "/data.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE data (id INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	skill, err := core.NewText2SQLSkill(newAuditSinkConfig("memory", ""), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer skill.SafeShutdown()
+	impl := skill.(*core.Text2SQLSkill)
+
+	if err := impl.RegisterGuard(core.NewGuardFunc("no_full_scan", core.PhasePreExecution, func(_ context.Context, req *core.GuardRequest) core.Decision {
+		if strings.Contains(req.SQL, "1=1") {
+			return core.Deny("FULL_SCAN", "full table scan")
+		}
+		return core.Allow()
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := skill.Execute(context.Background(), "2025年北京销售额超过100万的客户")
+	if err != nil {
+		t.Fatal(err)
+	}
+	skillErr := core.ResultError(result)
+	if result.Status != "rejected" || skillErr == nil || skillErr.Code != core.ErrCodeGuardRejected || skillErr.Guard != "no_full_scan" || skillErr.GuardCode != "FULL_SCAN" {
+		t.Errorf("expected structured denial, got %s: %s", result.Status, result.Meta)
+	}
+
+	entries, err := impl.QueryAudit(core.AuditFilter{QueryID: result.QueryID, EventType: "rejected"})
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one rejected entry, got %d, err=%v", len(entries), err)
+	}
+	if entries[0].Data["guard"] != "no_full_scan" || entries[0].Data["code"] != "FULL_SCAN" {
+		t.Errorf("rejected audit should carry guard and code: %+v", entries[0].Data)
+	}
+
+	// 内置守卫的拒绝同样带有错误码
+	result, err = skill.Execute(context.Background(), "2025年北京DELETE客户")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skillErr = core.ResultError(result); skillErr == nil || skillErr.Guard != core.GuardKeywordFilter || skillErr.GuardCode != "FORBIDDEN_KEYWORD" {
+		t.Errorf("expected keyword filter denial, got %s", result.Meta)
+	}
+}
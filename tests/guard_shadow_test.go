@@ -0,0 +1,190 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+	"text2sql-skill/drivers"
+)
+
+func TestGuardMonitorMode(t *testing.T) {
+	db, err := drivers.CreateSQLiteConnection(t.TempDir() + "/data.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE data (id INTEGER, secret TEXT); INSERT INTO data VALUES (1, 'classified-1'), (2, 'classified-2')"); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := newAuditSinkConfig("memory", "")
+	cfg.Security.Guards = []config.GuardConfig{
+		{Name: core.GuardKeywordFilter, Mode: "monitor"},
+		{Name: "limit_ids", Mode: "monitor"},
+		{Name: "drop_secret", Mode: "monitor"},
+	}
+	if err := config.ValidateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	skill, err := core.NewText2SQLSkill(cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer skill.SafeShutdown()
+	impl := skill.(*core.Text2SQLSkill)
+
+	if err := impl.RegisterGuard(core.NewGuardFunc("limit_ids", core.PhasePostGeneration, func(_ context.Context, req *core.GuardRequest) core.Decision {
+		return core.Rewrite("SQL_REWRITTEN", "restricted to id = 1", strings.Replace(req.SQL, "1=1", "id = 1", 1))
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if err := impl.RegisterGuard(core.NewGuardFunc("drop_secret", core.PhasePostResult, func(_ context.Context, req *core.GuardRequest) core.Decision {
+		for _, row := range req.Rows {
+			delete(row, "secret")
+		}
+		return core.Rewrite("COLUMN_DROPPED", "secret removed", "")
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	// 禁用关键字在 monitor 模式下只记录，不拒绝
+	result, err := skill.Execute(context.Background(), "2025年北京DELETE客户")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != "success" {
+		t.Fatalf("monitor-mode guard must not block, got %s: %s", result.Status, result.Meta)
+	}
+
+	var meta struct {
+		RowCount       int    `json:"row_count"`
+		TemplateUsed   string `json:"template_used"`
+		GuardDecisions []struct {
+			Action string `json:"action"`
+			Guard  string `json:"guard"`
+			Code   string `json:"code"`
+			Shadow bool   `json:"shadow"`
+		} `json:"guard_decisions"`
+	}
+	if err := json.Unmarshal(result.Meta, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.RowCount != 2 || strings.Contains(meta.TemplateUsed, "id = 1") {
+		t.Errorf("monitor-mode rewrite must not change the query, got %+v", meta)
+	}
+	if !strings.Contains(string(result.Result), "classified") {
+		t.Error("monitor-mode post_result guard must not modify rows")
+	}
+	var shadowed []string
+	for _, d := range meta.GuardDecisions {
+		if d.Shadow {
+			shadowed = append(shadowed, d.Guard+":"+d.Action+":"+d.Code)
+		}
+	}
+	if strings.Join(shadowed, ",") != "keyword_filter:deny:FORBIDDEN_KEYWORD,limit_ids:rewrite:SQL_REWRITTEN,drop_secret:rewrite:COLUMN_DROPPED" {
+		t.Errorf("unexpected shadow decisions %v", shadowed)
+	}
+
+	entries, err := impl.QueryAudit(core.AuditFilter{QueryID: result.QueryID, EventType: "shadow_decision"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 shadow_decision entries, got %d", len(entries))
+	}
+	if entries[0].Data["guard"] != core.GuardKeywordFilter || entries[0].Data["phase"] != "pre_generation" || entries[0].Data["mode"] != "monitor" {
+		t.Errorf("unexpected shadow audit entry %+v", entries[0].Data)
+	}
+
+	stats := impl.GuardStats()
+	if s := stats[core.GuardKeywordFilter]; s.Mode != "monitor" || s.ShadowDenied != 1 || s.Denied != 0 {
+		t.Errorf("unexpected keyword filter stats %+v", s)
+	}
+	if s := stats["limit_ids"]; s.ShadowRewritten != 1 || s.Phase != core.PhasePostGeneration {
+		t.Errorf("unexpected limit_ids stats %+v", s)
+	}
+	if s := stats[core.GuardSemanticSafety]; s.Mode != "enforce" || s.Checks != 1 {
+		t.Errorf("unexpected semantic safety stats %+v", s)
+	}
+
+	// 报告按守卫和错误码汇总
+	entries, err = impl.QueryAudit(core.AuditFilter{EventType: "shadow_decision"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := core.SummarizeShadowDecisions(entries)
+	if report.Total != 3 || report.Queries != 1 || len(report.Summaries) != 3 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	cfg.Security.Guards = []config.GuardConfig{{Name: core.GuardKeywordFilter, Mode: "shadow"}}
+	if err := config.ValidateConfig(cfg); err == nil || !strings.Contains(err.Error(), "security.guards[0].mode") {
+		t.Errorf("expected mode validation error, got %v", err)
+	}
+}
+
+func TestSummarizeShadowDecisions(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	shadow := func(queryID, user, guard, code, reason string, offset time.Duration) *core.AuditEntry {
+		data := map[string]interface{}{
+			"guard":  guard,
+			"phase":  "pre_generation",
+			"action": "deny",
+			"code":   code,
+			"reason": reason,
+		}
+		if user != "" {
+			data["user"] = user
+		}
+		return &core.AuditEntry{Timestamp: base.Add(offset), QueryID: queryID, EventType: "shadow_decision", Data: data}
+	}
+	entries := []*core.AuditEntry{
+		shadow("q1", "alice", "keyword_filter", "FORBIDDEN_KEYWORD", "L3: forbidden keyword detected: drop", time.Minute),
+		shadow("q2", "bob", "keyword_filter", "FORBIDDEN_KEYWORD", "L3: forbidden keyword detected: delete", 3*time.Minute),
+		shadow("q3", "alice", "keyword_filter", "FORBIDDEN_KEYWORD", "L3: forbidden keyword detected: truncate", 2*time.Minute),
+		shadow("q3", "", "prompt_injection", "PROMPT_INJECTION", "L6: jailbreak", 0),
+		{Timestamp: base, QueryID: "q4", EventType: "rejected", Data: map[string]interface{}{"guard": "keyword_filter"}},
+	}
+
+	report := core.SummarizeShadowDecisions(entries)
+	if report.Total != 4 || report.Queries != 3 {
+		t.Fatalf("unexpected totals %+v", report)
+	}
+	if len(report.Summaries) != 2 {
+		t.Fatalf("expected 2 groups, got %+v", report.Summaries)
+	}
+	top := report.Summaries[0]
+	if top.Guard != "keyword_filter" || top.Count != 3 || top.Users != 2 {
+		t.Errorf("unexpected top summary %+v", top)
+	}
+	if !top.First.Equal(base.Add(time.Minute)) || !top.Last.Equal(base.Add(3*time.Minute)) {
+		t.Errorf("unexpected time range %v..%v", top.First, top.Last)
+	}
+	if top.Example != "L3: forbidden keyword detected: delete" {
+		t.Errorf("example should be the latest reason, got %q", top.Example)
+	}
+	if report.Summaries[1].Guard != "prompt_injection" || report.Summaries[1].Users != 0 {
+		t.Errorf("unexpected second summary %+v", report.Summaries[1])
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+	"text2sql-skill/drivers"
+	"text2sql-skill/interfaces"
+)
+
+// 安全策略测试（RBAC、行级安全、脱敏、多租户）共用的测试夹具
+
+// testInput 生成 SELECT * FROM data WHERE 1=1 的自然语言输入
+const testInput = "2025年北京销售额超过100万的客户"
+
+// newTestConfig 使用内存审计存储、同步处理的基础配置
+func newTestConfig() *config.Config {
+	cfg := config.DefaultConfig()
+	cfg.Audit.Storage.Type = "memory"
+	cfg.Audit.Storage.Fsync = "never"
+	cfg.Performance.AsyncProcessing = false
+	return cfg
+}
+
+// newTestDB 创建临时 SQLite 数据库并执行 schema 中的语句，测试结束时关闭
+func newTestDB(t *testing.T, schema string) *sql.DB {
+	t.Helper()
+	db, err := drivers.CreateSQLiteConnection(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if schema != "" {
+		if _, err := db.Exec(schema); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// newTestController 校验配置并创建权限控制器，按配置加载 RBAC 策略和脱敏规则
+func newTestController(t *testing.T, cfg *config.Config) *core.PermissionController {
+	t.Helper()
+	if err := config.ValidateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	permCtrl := core.NewPermissionController(cfg)
+	policy, err := core.NewAccessPolicy(cfg.Security.RBAC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	permCtrl.SetAccessPolicy(policy)
+	masker, err := core.NewMasker(cfg.Security.Masking)
+	if err != nil {
+		t.Fatal(err)
+	}
+	permCtrl.SetMasker(masker)
+	return permCtrl
+}
+
+// newTestSkill 创建技能实例，测试结束时关闭
+func newTestSkill(t *testing.T, cfg *config.Config, db *sql.DB) interfaces.Skill {
+	t.Helper()
+	skill, err := core.NewText2SQLSkill(cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { skill.SafeShutdown() })
+	return skill
+}
+
+// executeAs 以 principal 身份执行 testInput，返回结果和解析后的元数据
+func executeAs(ctx context.Context, t *testing.T, skill interfaces.Skill, principal *core.Principal) (interfaces.SkillResult, map[string]interface{}) {
+	t.Helper()
+	if principal != nil {
+		ctx = core.WithPrincipal(ctx, principal)
+	}
+	result, err := skill.Execute(ctx, testInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta map[string]interface{}
+	if err := json.Unmarshal(result.Meta, &meta); err != nil {
+		t.Fatal(err)
+	}
+	return result, meta
+}
@@ -0,0 +1,337 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package tests
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+)
+
+const testIssuer = "https://idp.example.com/"
+
+// testIdP 模拟身份提供方：持有签名私钥并生成 JWKS
+type testIdP struct {
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testIdP{rsaKey: rsaKey, ecKey: ecKey}
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (p *testIdP) jwks() []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(p.rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(p.rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec-1", "use": "sig", "crv": "P-256", "x": b64(p.ecKey.X.FillBytes(make([]byte, 32))), "y": b64(p.ecKey.Y.FillBytes(make([]byte, 32)))},
+		},
+	})
+	return data
+}
+
+// sign 按 kid 选择算法签名，"rsa-1" 使用 RS256，"ec-1" 使用 ES256
+func (p *testIdP) sign(t *testing.T, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	alg := "RS256"
+	if kid == "ec-1" {
+		alg = "ES256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	if alg == "RS256" {
+		sig, err := rsa.SignPKCS1v15(rand.Reader, p.rsaKey, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = sig
+	} else {
+		r, s, err := ecdsa.Sign(rand.Reader, p.ecKey, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + b64(signature)
+}
+
+func baseClaims(user string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss": testIssuer,
+		"aud": "text2sql",
+		"sub": user,
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Unix(),
+	}
+}
+
+func newJWTAuthConfig(t *testing.T, idp *testIdP) config.AuthenticationConfig {
+	t.Helper()
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, idp.jwks(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return config.AuthenticationConfig{
+		Enabled:    true,
+		HeaderName: "Authorization",
+		JWT: config.JWTConfig{
+			Enabled:   true,
+			Issuer:    testIssuer,
+			Audiences: []string{"text2sql"},
+			JWKSFile:  jwksFile,
+			Claims: config.JWTClaimMapping{
+				Roles:      "realm_access.roles",
+				Tenant:     "https://example.com/tenant",
+				Attributes: map[string]string{"region": "region"},
+			},
+		},
+	}
+}
+
+func TestJWTAuthentication(t *testing.T) {
+	idp := newTestIdP(t)
+	cfg := newAuditSinkConfig("memory", "")
+	cfg.Authentication = newJWTAuthConfig(t, idp)
+	if err := config.ValidateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	auth, err := core.NewAuthenticator(cfg.Authentication, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, kid := range []string{"rsa-1", "ec-1"} {
+		claims := baseClaims("alice")
+		claims["aud"] = []string{"other", "text2sql"}
+		claims["realm_access"] = map[string]interface{}{"roles": []string{"analyst", "reader"}}
+		claims["https://example.com/tenant"] = "finance"
+		claims["region"] = "north"
+		claims["scope"] = "execute schema openid"
+
+		principal, key, err := auth.Authenticate("Bearer " + idp.sign(t, kid, claims))
+		if err != nil {
+			t.Fatalf("%s: %v", kid, err)
+		}
+		if principal.User != "alice" || principal.Tenant != "finance" || principal.Attributes["region"] != "north" {
+			t.Errorf("%s: unexpected principal %+v", kid, principal)
+		}
+		if strings.Join(principal.Roles, ",") != "analyst,reader" {
+			t.Errorf("%s: expected nested roles, got %v", kid, principal.Roles)
+		}
+		if !key.HasScope(core.ScopeSchema) || key.HasScope(core.ScopeAudit) {
+			t.Errorf("%s: unexpected scopes %v", kid, key.Scopes)
+		}
+	}
+
+	// 没有 scope 声明时使用默认权限
+	_, key, err := auth.Authenticate("Bearer " + idp.sign(t, "rsa-1", baseClaims("bob")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.HasScope(core.ScopeExecute) || key.HasScope(core.ScopeSchema) {
+		t.Errorf("expected default execute scope, got %v", key.Scopes)
+	}
+}
+
+func TestJWTRejectsInvalidTokens(t *testing.T) {
+	idp := newTestIdP(t)
+	auth, err := core.NewAuthenticator(newJWTAuthConfig(t, idp), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := idp.sign(t, "rsa-1", baseClaims("alice"))
+	parts := strings.Split(valid, ".")
+	noneHeader, _ := json.Marshal(map[string]string{"alg": "none", "kid": "rsa-1"})
+	hsHeader, _ := json.Marshal(map[string]string{"alg": "HS256", "kid": "rsa-1"})
+	tampered := baseClaims("root")
+	tamperedPayload, _ := json.Marshal(tampered)
+
+	claims := func(mutate func(map[string]interface{})) string {
+		c := baseClaims("alice")
+		mutate(c)
+		return idp.sign(t, "rsa-1", c)
+	}
+	other := newTestIdP(t)
+
+	tests := map[string]string{
+		"expired":        claims(func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }),
+		"missing exp":    claims(func(c map[string]interface{}) { delete(c, "exp") }),
+		"not yet valid":  claims(func(c map[string]interface{}) { c["nbf"] = time.Now().Add(time.Hour).Unix() }),
+		"wrong issuer":   claims(func(c map[string]interface{}) { c["iss"] = "https://evil.example.com/" }),
+		"wrong audience": claims(func(c map[string]interface{}) { c["aud"] = "other" }),
+		"missing user":   claims(func(c map[string]interface{}) { delete(c, "sub") }),
+		"alg none":       b64(noneHeader) + "." + parts[1] + ".",
+		"alg HS256":      b64(hsHeader) + "." + parts[1] + "." + parts[2],
+		"tampered":       parts[0] + "." + b64(tamperedPayload) + "." + parts[2],
+		"unknown key":    other.sign(t, "rsa-2", baseClaims("alice")),
+		"foreign key":    other.sign(t, "rsa-1", baseClaims("alice")),
+	}
+	for name, token := range tests {
+		if _, _, err := auth.Authenticate("Bearer " + token); !errors.Is(err, core.ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+
+	// 时钟容差内刚过期的令牌仍然有效
+	_, _, err = auth.Authenticate(claims(func(c map[string]interface{}) { c["exp"] = time.Now().Add(-10 * time.Second).Unix() }))
+	if err != nil {
+		t.Errorf("token within clock skew should be accepted: %v", err)
+	}
+}
+
+func TestJWKSURLCaching(t *testing.T) {
+	idp := newTestIdP(t)
+	var fetches int32
+	jwks := idp.jwks()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jwks)
+	}))
+	defer server.Close()
+
+	cfg := config.JWTConfig{
+		Enabled:   true,
+		Issuer:    testIssuer,
+		Audiences: []string{"text2sql"},
+		JWKSURL:   server.URL,
+		CacheTTL:  "5m",
+	}
+	verifier, err := core.NewJWTVerifier(cfg, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{now: time.Now()}
+	verifier.SetClock(clock.Now)
+
+	token := idp.sign(t, "ec-1", baseClaims("alice"))
+	for i := 0; i < 3; i++ {
+		if _, _, _, err := verifier.Verify(token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("expected JWKS to be fetched once, got %d", n)
+	}
+
+	// 未知 kid 在最短刷新间隔内不会重复请求
+	unknown := newTestIdP(t).sign(t, "rsa-9", baseClaims("alice"))
+	for i := 0; i < 3; i++ {
+		if _, _, _, err := verifier.Verify(unknown); !errors.Is(err, core.ErrInvalidToken) {
+			t.Fatalf("expected ErrInvalidToken, got %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("unknown kid should not refetch within the refresh interval, got %d fetches", n)
+	}
+
+	// 缓存过期后刷新；IdP 不可用时沿用已缓存的密钥
+	clock.Advance(6 * time.Minute)
+	server.Close()
+	if _, _, _, err := verifier.Verify(token); err != nil {
+		t.Errorf("cached keys should be kept when refresh fails: %v", err)
+	}
+}
+
+func TestJWTIdentityReachesExecute(t *testing.T) {
+	idp := newTestIdP(t)
+	db := newTestDB(t, "CREATE TABLE data (id INTEGER, region TEXT); INSERT INTO data VALUES (1, 'north'), (2, 'south'), (3, 'south');")
+
+	cfg := newRowSecurityConfig()
+	cfg.Authentication = newJWTAuthConfig(t, idp)
+	if err := config.ValidateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	auth, err := core.NewAuthenticator(cfg.Authentication, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skill, err := core.NewText2SQLSkill(cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer skill.SafeShutdown()
+
+	claims := baseClaims("rep-south")
+	claims["realm_access"] = map[string]interface{}{"roles": []string{"sales_rep"}}
+	claims["region"] = "south"
+	principal, _, err := auth.Authenticate("Bearer " + idp.sign(t, "rsa-1", claims))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := skill.Execute(core.WithPrincipal(context.Background(), principal), "2025年北京销售额超过100万的客户")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != "success" {
+		t.Fatalf("expected success, got %s: %s", result.Status, result.Meta)
+	}
+	var meta map[string]interface{}
+	if err := json.Unmarshal(result.Meta, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta["row_count"] != float64(2) {
+		t.Errorf("row filter should use the region claim, got %v rows", meta["row_count"])
+	}
+
+	entries, err := skill.(*core.Text2SQLSkill).QueryAudit(core.AuditFilter{QueryID: result.QueryID, EventType: "success"})
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one success audit entry, got %d, err=%v", len(entries), err)
+	}
+	if entries[0].User() != "rep-south" {
+		t.Errorf("audit entry should carry the token subject, got %q", entries[0].User())
+	}
+}
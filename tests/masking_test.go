@@ -0,0 +1,234 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+)
+
+func newMaskingConfig() *config.Config {
+	cfg := newTestConfig()
+	cfg.Security.Masking = config.MaskingConfig{
+		Enabled: true,
+		Policies: []config.MaskingPolicy{
+			{Table: "customers", Column: "email", Type: "partial", ShowFirst: 2, ShowLast: 4, UnmaskedRoles: []string{"admin"}},
+			{Table: "customers", Column: "phone", Type: "hash", Salt: "s1"},
+			{Table: "customers", Column: "ssn", Type: "redact"},
+			{Table: "sales", Column: "amount", Type: "bucket", BucketSize: 1000},
+			{Table: "data", Column: "region", Type: "redact"},
+		},
+	}
+	return cfg
+}
+
+const maskingSchema = `
+CREATE TABLE customers (id INTEGER, email TEXT, phone TEXT, ssn TEXT);
+CREATE TABLE sales (id INTEGER, amount INTEGER);
+INSERT INTO customers VALUES (1, 'alice@example.com', '555-0100', '123-45-6789');
+INSERT INTO sales VALUES (1, 1234);`
+
+// queryMasked 执行查询并按脱敏计划处理第一行结果
+func queryMasked(t *testing.T, db *sql.DB, permCtrl *core.PermissionController, principal *core.Principal, query string) (map[string]interface{}, []string) {
+	t.Helper()
+	plan, err := permCtrl.PlanMasking(principal, query)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rows.Next() {
+		t.Fatalf("%s: no rows", query)
+	}
+	values := make([]interface{}, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range values {
+		if b, ok := v.([]byte); ok {
+			values[i] = string(b)
+		}
+	}
+
+	var masked []string
+	if plan != nil {
+		plan.Apply(columns, values)
+		masked = plan.MaskedColumns(columns)
+	}
+	row := make(map[string]interface{})
+	for i, col := range columns {
+		row[col] = values[i]
+	}
+	return row, masked
+}
+
+func TestMaskingTypes(t *testing.T) {
+	db := newTestDB(t, maskingSchema)
+	permCtrl := newTestController(t, newMaskingConfig())
+	analyst := &core.Principal{Roles: []string{"analyst"}}
+	admin := &core.Principal{Roles: []string{"admin"}}
+
+	tests := []struct {
+		name      string
+		principal *core.Principal
+		query     string
+		want      map[string]interface{}
+		masked    string
+	}{
+		{"partial, redact and untouched", analyst, "SELECT id, email, ssn FROM customers",
+			map[string]interface{}{"id": int64(1), "email": "al***********.com", "ssn": "****"}, "email,ssn"},
+		{"bucket", analyst, "SELECT amount FROM sales", map[string]interface{}{"amount": "1000-2000"}, "amount"},
+		// unmasked_roles 可以看到原值
+		{"unmasked role", admin, "SELECT email FROM customers", map[string]interface{}{"email": "alice@example.com"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row, masked := queryMasked(t, db, permCtrl, tt.principal, tt.query)
+			for column, want := range tt.want {
+				if row[column] != want {
+					t.Errorf("%s: expected %v, got %v", column, want, row[column])
+				}
+			}
+			if strings.Join(masked, ",") != tt.masked {
+				t.Errorf("expected masked columns %q, got %v", tt.masked, masked)
+			}
+		})
+	}
+
+	// 哈希结果稳定，可用于关联分析
+	first, _ := queryMasked(t, db, permCtrl, analyst, "SELECT phone FROM customers")
+	again, _ := queryMasked(t, db, permCtrl, analyst, "SELECT c.phone FROM customers c")
+	if phone, _ := first["phone"].(string); len(phone) != 16 || phone == "555-0100" {
+		t.Errorf("unexpected hash mask: %v", first["phone"])
+	}
+	if again["phone"] != first["phone"] {
+		t.Errorf("hash mask should be deterministic: %v != %v", again["phone"], first["phone"])
+	}
+}
+
+func TestMaskingFollowsLineage(t *testing.T) {
+	db := newTestDB(t, maskingSchema)
+	permCtrl := newTestController(t, newMaskingConfig())
+	analyst := &core.Principal{Roles: []string{"analyst"}}
+
+	queries := map[string]string{
+		"SELECT email AS contact FROM customers":                    "contact",
+		"SELECT * FROM customers":                                   "ssn",
+		"SELECT c.* FROM customers c":                               "ssn",
+		"SELECT ssn FROM (SELECT * FROM customers) t":               "ssn",
+		"SELECT * FROM (SELECT * FROM customers) t":                 "ssn",
+		"WITH c AS (SELECT * FROM customers) SELECT id, ssn FROM c": "ssn",
+		"SELECT \"ssn\" FROM \"customers\"":                         "ssn",
+		"SELECT x.ssn FROM sales s JOIN customers x ON x.id = s.id": "ssn",
+	}
+	for query, column := range queries {
+		row, masked := queryMasked(t, db, permCtrl, analyst, query)
+		if row[column] == "123-45-6789" || row[column] == "alice@example.com" {
+			t.Errorf("%s: column %s leaked raw value %v", query, column, row[column])
+		}
+		if len(masked) == 0 {
+			t.Errorf("%s: expected masked columns in result", query)
+		}
+	}
+}
+
+func TestMaskingRejectsDerivedUse(t *testing.T) {
+	permCtrl := newTestController(t, newMaskingConfig())
+	analyst := &core.Principal{Roles: []string{"analyst"}}
+
+	queries := []string{
+		"SELECT id FROM customers WHERE ssn = '123-45-6789'",
+		"SELECT substr(ssn, 1, 3) FROM customers",
+		"SELECT id FROM customers ORDER BY email",
+		"SELECT ssn FROM customers UNION SELECT 'x'",
+		"SELECT * FROM customers UNION SELECT 1, 'a', 'b', 'c'",
+		"SELECT s FROM (SELECT ssn AS s FROM customers) t",
+		"SELECT id FROM (SELECT * FROM customers) t WHERE ssn LIKE '1%'",
+		"SELECT sum(amount) FROM sales",
+		// 整行引用
+		"SELECT c FROM customers c",
+		"SELECT customers FROM customers",
+		"SELECT row_to_json(c) FROM customers c",
+		"SELECT json_agg(c) FROM customers c",
+		"SELECT row_to_json(c.*) FROM customers c",
+		"SELECT t FROM (SELECT * FROM customers) t",
+		// 列别名清单
+		"SELECT e FROM customers AS t(i, e)",
+		"SELECT e FROM (SELECT * FROM customers) AS t(i, e)",
+		"WITH c(i, e) AS (SELECT * FROM customers) SELECT e FROM c",
+	}
+	for _, query := range queries {
+		if _, err := permCtrl.PlanMasking(analyst, query); err == nil {
+			t.Errorf("%s: expected masking rejection", query)
+		}
+	}
+
+	// 不脱敏的角色不受限制
+	if plan, err := permCtrl.PlanMasking(&core.Principal{Roles: []string{"admin"}}, "SELECT id FROM customers ORDER BY email"); err != nil || plan != nil {
+		t.Errorf("admin should not be restricted: %v %v", plan, err)
+	}
+}
+
+func TestMaskingConfigValidation(t *testing.T) {
+	for _, policy := range []config.MaskingPolicy{
+		{Table: "customers", Column: "email", Type: "scramble"},
+		{Table: "customers", Type: "redact"},
+		{Table: "sales", Column: "amount", Type: "bucket"},
+		{Table: "customers", Column: "email", Type: "partial", ShowFirst: -1},
+	} {
+		cfg := newTestConfig()
+		cfg.Security.Masking = config.MaskingConfig{Enabled: true, Policies: []config.MaskingPolicy{policy}}
+		if err := config.ValidateConfig(cfg); err == nil {
+			t.Errorf("expected validation error for %+v", policy)
+		}
+	}
+}
+
+func TestExecuteMasksResults(t *testing.T) {
+	db := newTestDB(t, maskingSchema+"CREATE TABLE data (id INTEGER, region TEXT); INSERT INTO data VALUES (1, 'north');")
+	skill := newTestSkill(t, newMaskingConfig(), db)
+
+	result, meta := executeAs(context.Background(), t, skill, &core.Principal{User: "bob", Roles: []string{"analyst"}})
+	if result.Status != "success" {
+		t.Fatalf("expected success, got %s: %s", result.Status, result.Meta)
+	}
+	masked, _ := meta["masked_columns"].([]interface{})
+	if len(masked) != 1 || masked[0] != "region" {
+		t.Errorf("expected region in masked_columns, got %v", meta["masked_columns"])
+	}
+	if strings.Contains(string(result.Result), "north") || !strings.Contains(string(result.Result), "****") {
+		t.Errorf("expected masked region in result: %q", result.Result)
+	}
+}
@@ -0,0 +1,467 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"text2sql-skill/core"
+	"text2sql-skill/mcp"
+)
+
+type mcpHTTPClient struct {
+	t   *testing.T
+	url string
+}
+
+func (c *mcpHTTPClient) do(method, sessionID, accept, body string) *http.Response {
+	c.t.Helper()
+	req, err := http.NewRequest(method, c.url, strings.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if sessionID != "" {
+		req.Header.Set(mcp.HeaderSessionID, sessionID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return resp
+}
+
+func (c *mcpHTTPClient) initialize() string {
+	c.t.Helper()
+	resp := c.do(http.MethodPost, "", "", `{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {"protocolVersion": "2025-06-18"}}`)
+	resp.Body.Close()
+	sessionID := resp.Header.Get(mcp.HeaderSessionID)
+	if resp.StatusCode != http.StatusOK || sessionID == "" {
+		c.t.Fatalf("initialize should create a session, got %d %q", resp.StatusCode, sessionID)
+	}
+	return sessionID
+}
+
+// readEvents 读取 SSE 响应中的全部消息
+func readEvents(t *testing.T, resp *http.Response) []map[string]interface{} {
+	t.Helper()
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Fatalf("expected event stream, got %q", ct)
+	}
+	var events []map[string]interface{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data := strings.TrimPrefix(scanner.Text(), "data: ")
+		if data == scanner.Text() {
+			continue
+		}
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestMCPStreamableHTTP(t *testing.T) {
+	server := httptest.NewServer(newMCPServer(t, newAuditSinkConfig("memory", "")))
+	defer server.Close()
+	client := &mcpHTTPClient{t: t, url: server.URL}
+	sessionID := client.initialize()
+	accept := "application/json, text/event-stream"
+
+	events := readEvents(t, client.do(http.MethodPost, sessionID, accept, `{"jsonrpc": "2.0", "id": 2, "method": "tools/call",
+		"params": {"name": "execute_query", "arguments": {"query": "2025年北京销售额超过100万的客户"}, "_meta": {"progressToken": "q-2"}}}`))
+	progress := func(n float64, message string) map[string]interface{} {
+		return map[string]interface{}{"method": "notifications/progress", "params": map[string]interface{}{"progressToken": "q-2", "progress": n, "message": message}}
+	}
+	want := []interface{}{
+		progress(1, "guards passed"),
+		progress(2, "SQL generated"),
+		progress(3, "executing"),
+		progress(4, "rows scanned: 2"),
+		map[string]interface{}{"id": 2.0, "result": map[string]interface{}{"structuredContent": map[string]interface{}{"status": "success", "row_count": 2.0}}},
+	}
+	got := make([]interface{}, len(events))
+	for i := range events {
+		got[i] = events[i]
+	}
+	if err := matchSubset(want, got); err != nil {
+		t.Errorf("progress stream: %v", err)
+	}
+
+	// 没有 progressToken 时只返回响应
+	events = readEvents(t, client.do(http.MethodPost, sessionID, accept, `{"jsonrpc": "2.0", "id": 3, "method": "ping"}`))
+	if len(events) != 1 || events[0]["id"] != 3.0 {
+		t.Errorf("expected only the ping response, got %v", events)
+	}
+
+	resp := client.do(http.MethodPost, sessionID, "application/json", `{"jsonrpc": "2.0", "id": 4, "method": "ping"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		t.Errorf("client without event-stream should get JSON, got %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(`{"jsonrpc": "2.0", "id": 5, "method": "ping"}`))
+	req.Header.Set(mcp.HeaderProtocolVersion, "1999-01-01")
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unsupported protocol version header should get 400, got %v %v", resp, err)
+	}
+	if resp, err := http.Get(server.URL); err != nil || resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET should not be allowed, got %v %v", resp, err)
+	}
+
+	// 结束会话后会话 ID 失效
+	for _, step := range []struct {
+		method string
+		status int
+	}{
+		{http.MethodDelete, http.StatusNoContent},
+		{http.MethodPost, http.StatusNotFound},
+		{http.MethodDelete, http.StatusNotFound},
+	} {
+		resp := client.do(step.method, sessionID, "", `{"jsonrpc": "2.0", "id": 6, "method": "ping"}`)
+		resp.Body.Close()
+		if resp.StatusCode != step.status {
+			t.Errorf("%s after delete: expected %d, got %d", step.method, step.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestMCPCancelledNotification(t *testing.T) {
+	cfg := newAuditSinkConfig("memory", "")
+	skill := newMCPSkill(t, cfg)
+	started := make(chan struct{})
+	var once sync.Once
+	if err := skill.RegisterGuard(core.NewGuardFunc("hold", core.PhasePreExecution, func(ctx context.Context, _ *core.GuardRequest) core.Decision {
+		once.Do(func() { close(started) })
+		<-ctx.Done()
+		return core.Allow()
+	})); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(mcp.NewServer(cfg, skill))
+	defer server.Close()
+	client := &mcpHTTPClient{t: t, url: server.URL}
+	sessionID := client.initialize()
+
+	done := make(chan map[string]interface{}, 1)
+	go func() {
+		resp := client.do(http.MethodPost, sessionID, "", `{"jsonrpc": "2.0", "id": 7, "method": "tools/call",
+			"params": {"name": "execute_query", "arguments": {"query": "2025年北京销售额超过100万的客户"}}}`)
+		defer resp.Body.Close()
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		done <- result
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("query did not start")
+	}
+
+	// 其他会话不能取消这个请求
+	other := client.initialize()
+	for _, id := range []string{other, sessionID} {
+		resp := client.do(http.MethodPost, id, "", `{"jsonrpc": "2.0", "method": "notifications/cancelled", "params": {"requestId": 7, "reason": "user aborted"}}`)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("notification should get 202, got %d", resp.StatusCode)
+		}
+		if id == other {
+			select {
+			case result := <-done:
+				t.Fatalf("cancel from another session should be ignored, got %v", result)
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+
+	select {
+	case result := <-done:
+		want := map[string]interface{}{"id": 7.0, "result": map[string]interface{}{
+			"isError":           true,
+			"structuredContent": map[string]interface{}{"error": map[string]interface{}{"code": "canceled"}},
+		}}
+		if err := matchSubset(want, result); err != nil {
+			t.Errorf("cancelled query: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("query was not cancelled")
+	}
+}
+
+func TestMCPSessionLimit(t *testing.T) {
+	cfg := newAuditSinkConfig("memory", "")
+	cfg.Server.MCP.MaxSessions = 2
+	server := httptest.NewServer(newMCPServer(t, cfg))
+	defer server.Close()
+	client := &mcpHTTPClient{t: t, url: server.URL}
+
+	first := client.initialize()
+	client.initialize()
+
+	// 达到上限后拒绝新会话，结束一个会话后可以再创建
+	resp, reply := postJSON(t, server.URL, `{"jsonrpc": "2.0", "id": 3, "method": "initialize", "params": {"protocolVersion": "2025-06-18"}}`)
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get(mcp.HeaderSessionID) != "" {
+		t.Errorf("initialize beyond max_sessions should get 503 without a session, got %d %q", resp.StatusCode, resp.Header.Get(mcp.HeaderSessionID))
+	}
+	if err := matchSubset(map[string]interface{}{"id": 3.0, "error": map[string]interface{}{"code": -32022.0}}, reply); err != nil {
+		t.Errorf("session limit error: %v", err)
+	}
+
+	resp = client.do(http.MethodDelete, first, "", "")
+	resp.Body.Close()
+	client.initialize()
+}
+
+func TestMCPStreamCancellation(t *testing.T) {
+	cfg := newAuditSinkConfig("memory", "")
+	skill := newMCPSkill(t, cfg)
+	started := make(chan struct{})
+	var once sync.Once
+	if err := skill.RegisterGuard(core.NewGuardFunc("hold", core.PhasePreExecution, func(ctx context.Context, _ *core.GuardRequest) core.Decision {
+		once.Do(func() { close(started) })
+		<-ctx.Done()
+		return core.Allow()
+	})); err != nil {
+		t.Fatal(err)
+	}
+	server := mcp.NewServer(cfg, skill)
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		served <- server.ServeStream(context.Background(), inR, outW)
+		outW.Close()
+	}()
+	responses := make(chan map[string]interface{}, 8)
+	go func() {
+		scanner := bufio.NewScanner(outR)
+		for scanner.Scan() {
+			var msg map[string]interface{}
+			if json.Unmarshal(scanner.Bytes(), &msg) == nil && msg["id"] != nil {
+				responses <- msg
+			}
+		}
+		close(responses)
+	}()
+	send := func(line string) {
+		if _, err := io.WriteString(inW, line+"\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	send(`{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {"protocolVersion": "2025-06-18"}}`)
+	send(`{"jsonrpc": "2.0", "method": "notifications/initialized"}`)
+	send(`{"jsonrpc": "2.0", "id": 7, "method": "tools/call", "params": {"name": "execute_query", "arguments": {"query": "2025年北京销售额超过100万的客户"}}}`)
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("query did not start")
+	}
+
+	// 查询执行期间流仍在读取：ping 先于查询返回，取消通知可以送达
+	send(`{"jsonrpc": "2.0", "id": 8, "method": "ping"}`)
+	send(`{"jsonrpc": "2.0", "method": "notifications/cancelled", "params": {"requestId": 7}}`)
+	inW.Close()
+
+	var order []interface{}
+	for msg := range responses {
+		order = append(order, msg["id"])
+		if msg["id"] == 7.0 {
+			want := map[string]interface{}{"result": map[string]interface{}{
+				"isError":           true,
+				"structuredContent": map[string]interface{}{"error": map[string]interface{}{"code": "canceled"}},
+			}}
+			if err := matchSubset(want, msg); err != nil {
+				t.Errorf("cancelled query: %v", err)
+			}
+		}
+	}
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+	if err := matchSubset([]interface{}{1.0, 8.0, 7.0}, order); err != nil {
+		t.Errorf("response order: %v", err)
+	}
+}
+
+func postJSON(t *testing.T, url, body string) (*http.Response, interface{}) {
+	t.Helper()
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var reply interface{}
+	json.NewDecoder(resp.Body).Decode(&reply)
+	return resp, reply
+}
+
+func TestMCPBatchRequests(t *testing.T) {
+	cfg := newAuditSinkConfig("memory", "")
+	cfg.Cache.Enabled = false
+	cfg.Server.MCP.MaxBatchSize = 8
+	cfg.Server.MCP.BatchConcurrency = 2
+	cfg.Server.MCP.MaxRequestBytes = 4096
+	skill := newMCPSkill(t, cfg)
+
+	// 记录同时执行的查询数
+	var mu sync.Mutex
+	running, peak := 0, 0
+	if err := skill.RegisterGuard(core.NewGuardFunc("track", core.PhasePreExecution, func(context.Context, *core.GuardRequest) core.Decision {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+		time.Sleep(30 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return core.Allow()
+	})); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(mcp.NewServer(cfg, skill))
+	defer server.Close()
+
+	call := func(id int) string {
+		return `{"jsonrpc": "2.0", "id": ` + strconv.Itoa(id) + `, "method": "tools/call", "params": {"name": "execute_query", "arguments": {"query": "2025年北京销售额超过100万的客户"}}}`
+	}
+	resp, reply := postJSON(t, server.URL, `[`+call(1)+`, `+call(2)+`, `+call(3)+`, `+call(4)+`,
+		{"jsonrpc": "2.0", "method": "notifications/initialized"},
+		{"jsonrpc": "2.0", "id": "p", "method": "ping"},
+		{"jsonrpc": "1.0", "id": 5, "method": "ping"},
+		42]`)
+	success := map[string]interface{}{"result": map[string]interface{}{"structuredContent": map[string]interface{}{"status": "success"}}}
+	want := []interface{}{
+		success, success, success, success,
+		map[string]interface{}{"id": "p", "result": map[string]interface{}{}},
+		map[string]interface{}{"id": 5.0, "error": map[string]interface{}{"code": float64(mcp.CodeInvalidRequest)}},
+		map[string]interface{}{"id": nil, "error": map[string]interface{}{"code": float64(mcp.CodeInvalidRequest)}},
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("batch should get 200, got %d", resp.StatusCode)
+	}
+	if err := matchSubset(want, reply); err != nil {
+		t.Errorf("batch responses: %v", err)
+	}
+	for i, item := range reply.([]interface{})[:4] {
+		if id := item.(map[string]interface{})["id"]; id != float64(i+1) {
+			t.Errorf("responses should keep request order, got id %v at %d", id, i)
+		}
+	}
+	if peak != 2 {
+		t.Errorf("batch should run at most 2 queries at once and use both slots, peak was %d", peak)
+	}
+
+	cases := []struct {
+		name   string
+		body   string
+		status int
+		want   interface{}
+	}{
+		{"notifications only", `[{"jsonrpc": "2.0", "method": "notifications/initialized"}]`, http.StatusAccepted, nil},
+		{"parse error", `{"jsonrpc": "2.0", "id": 1, "method": `, http.StatusOK,
+			map[string]interface{}{"id": nil, "error": map[string]interface{}{"code": float64(mcp.CodeParseError)}}},
+		{"empty batch", `[]`, http.StatusOK,
+			map[string]interface{}{"error": map[string]interface{}{"code": float64(mcp.CodeInvalidRequest)}}},
+		{"missing version", `{"id": 1, "method": "ping"}`, http.StatusOK,
+			map[string]interface{}{"id": 1.0, "error": map[string]interface{}{"code": float64(mcp.CodeInvalidRequest)}}},
+		{"invalid notification", `{"jsonrpc": "2.0"}`, http.StatusOK,
+			map[string]interface{}{"error": map[string]interface{}{"code": float64(mcp.CodeInvalidRequest)}}},
+		{"object id", `{"jsonrpc": "2.0", "id": {"n": 1}, "method": "ping"}`, http.StatusOK,
+			map[string]interface{}{"id": nil, "error": map[string]interface{}{"code": float64(mcp.CodeInvalidRequest)}}},
+		{"batch too large", "[" + strings.Repeat(`{"jsonrpc": "2.0", "id": 1, "method": "ping"}, `, 8) + `{"jsonrpc": "2.0", "id": 1, "method": "ping"}]`, http.StatusOK,
+			map[string]interface{}{"error": map[string]interface{}{"code": float64(mcp.CodeInvalidRequest)}}},
+		{"request too large", `{"jsonrpc": "2.0", "id": 1, "method": "ping", "params": {"pad": "` + strings.Repeat("x", 4096) + `"}}`, http.StatusRequestEntityTooLarge,
+			map[string]interface{}{"error": map[string]interface{}{"code": float64(mcp.CodeInvalidRequest)}}},
+	}
+	for _, tc := range cases {
+		resp, reply := postJSON(t, server.URL, tc.body)
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.status, resp.StatusCode)
+		}
+		if tc.want == nil {
+			if reply != nil {
+				t.Errorf("%s: expected no body, got %v", tc.name, reply)
+			}
+			continue
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: expected JSON error, got %q", tc.name, ct)
+		}
+		if err := matchSubset(tc.want, reply); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+	}
+}
+
+func TestMCPStreamLimits(t *testing.T) {
+	cfg := newAuditSinkConfig("memory", "")
+	cfg.Server.MCP.MaxRequestBytes = 128
+	server := newMCPServer(t, cfg)
+	input := strings.Join([]string{
+		`{"jsonrpc": "2.0", "id": 1, "method": "ping", "params": {"pad": "` + strings.Repeat("x", 8192) + `"}}`,
+		`[{"jsonrpc": "2.0", "id": 2, "method": "ping"}, {"jsonrpc": "2.0", "method": "notifications/initialized"}]`,
+		`[{"jsonrpc": "2.0", "method": "notifications/initialized"}]`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "ping"}`,
+	}, "\n")
+
+	var output bytes.Buffer
+	if err := server.ServeStream(context.Background(), strings.NewReader(input), &output); err != nil {
+		t.Fatal(err)
+	}
+	var got []interface{}
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var reply interface{}
+		if err := json.Unmarshal([]byte(line), &reply); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, reply)
+	}
+	want := []interface{}{
+		map[string]interface{}{"id": nil, "error": map[string]interface{}{"code": float64(mcp.CodeInvalidRequest)}},
+		[]interface{}{map[string]interface{}{"id": 2.0, "result": map[string]interface{}{}}},
+		map[string]interface{}{"id": 3.0, "result": map[string]interface{}{}},
+	}
+	if err := matchSubset(want, got); err != nil {
+		t.Errorf("stream limits: %v", err)
+	}
+}
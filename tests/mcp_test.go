@@ -0,0 +1,478 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+	"text2sql-skill/drivers"
+	"text2sql-skill/mcp"
+	"text2sql-skill/utils"
+)
+
+type mcpStep struct {
+	Send   json.RawMessage `json:"send"`
+	Expect interface{}     `json:"expect"`
+}
+
+func newMCPSkill(t *testing.T, cfg *config.Config) *core.Text2SQLSkill {
+	t.Helper()
+	db, err := drivers.CreateSQLiteConnection(t.TempDir() + "/data.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE data (id INT, name TEXT);
+		INSERT INTO data VALUES (1, 'alpha'), (2, 'beta');
+		CREATE TABLE customers (id INTEGER, name TEXT, region TEXT, email TEXT);
+		CREATE TABLE sales (amount REAL, region TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	skill, err := core.NewText2SQLSkill(cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { skill.SafeShutdown() })
+	return skill.(*core.Text2SQLSkill)
+}
+
+func newMCPServer(t *testing.T, cfg *config.Config) *mcp.Server {
+	t.Helper()
+	return mcp.NewServer(cfg, newMCPSkill(t, cfg))
+}
+
+// matchSubset 期望中的每个字段都必须出现在实际值中，数组按下标逐个比较
+func matchSubset(expect, actual interface{}) error {
+	switch want := expect.(type) {
+	case map[string]interface{}:
+		got, ok := actual.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected object, got %v", actual)
+		}
+		for key, value := range want {
+			if err := matchSubset(value, got[key]); err != nil {
+				return fmt.Errorf("%s: %v", key, err)
+			}
+		}
+	case []interface{}:
+		got, ok := actual.([]interface{})
+		if !ok || len(got) != len(want) {
+			return fmt.Errorf("expected %d elements, got %v", len(want), actual)
+		}
+		for i := range want {
+			if err := matchSubset(want[i], got[i]); err != nil {
+				return fmt.Errorf("[%d]: %v", i, err)
+			}
+		}
+	default:
+		if !reflect.DeepEqual(expect, actual) {
+			return fmt.Errorf("expected %#v, got %#v", expect, actual)
+		}
+	}
+	return nil
+}
+
+func loadMCPScript(t *testing.T) []mcpStep {
+	t.Helper()
+	f, err := os.Open("testdata/mcp_script.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var steps []mcpStep
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var step mcpStep
+		if err := json.Unmarshal(scanner.Bytes(), &step); err != nil {
+			t.Fatal(err)
+		}
+		steps = append(steps, step)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return steps
+}
+
+func TestMCPScript(t *testing.T) {
+	server := httptest.NewServer(newMCPServer(t, newAuditSinkConfig("memory", "")))
+	defer server.Close()
+
+	for i, step := range loadMCPScript(t) {
+		resp, err := http.Post(server.URL, "application/json", bytes.NewReader(step.Send))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var actual interface{}
+		json.NewDecoder(resp.Body).Decode(&actual)
+		resp.Body.Close()
+
+		if step.Expect == nil {
+			if resp.StatusCode != http.StatusAccepted || actual != nil {
+				t.Errorf("step %d: notification should get 202 without body, got %d %v", i+1, resp.StatusCode, actual)
+			}
+			continue
+		}
+		if err := matchSubset(step.Expect, actual); err != nil {
+			t.Errorf("step %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestMCPScriptOverStream(t *testing.T) {
+	server := newMCPServer(t, newAuditSinkConfig("memory", ""))
+	steps := loadMCPScript(t)
+
+	var input bytes.Buffer
+	for _, step := range steps {
+		input.Write(step.Send)
+		input.WriteByte('\n')
+	}
+	var output bytes.Buffer
+	if err := server.ServeStream(context.Background(), &input, &output); err != nil {
+		t.Fatal(err)
+	}
+
+	// 初始化后的请求并发处理，响应按 ID 对应；通知没有响应
+	responses := make(map[string]interface{})
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var resp map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Fatal(err)
+		}
+		responses[fmt.Sprint(resp["id"])] = resp
+	}
+	for i, step := range steps {
+		if step.Expect == nil {
+			continue
+		}
+		var req struct {
+			ID interface{} `json:"id"`
+		}
+		if err := json.Unmarshal(step.Send, &req); err != nil {
+			t.Fatal(err)
+		}
+		actual, ok := responses[fmt.Sprint(req.ID)]
+		if !ok {
+			t.Fatalf("step %d: missing response", i+1)
+		}
+		delete(responses, fmt.Sprint(req.ID))
+		if err := matchSubset(step.Expect, actual); err != nil {
+			t.Errorf("step %d: %v", i+1, err)
+		}
+	}
+	if len(responses) != 0 {
+		t.Errorf("unexpected extra responses %v", responses)
+	}
+}
+
+func TestMCPStreamSession(t *testing.T) {
+	server := newMCPServer(t, newAuditSinkConfig("memory", ""))
+	input := strings.Join([]string{
+		`{"jsonrpc": "2.0", "id": 1, "method": "tools/list"}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "initialize", "params": {"protocolVersion": "2025-03-26"}}`,
+		`not json`,
+		``,
+		`{"jsonrpc": "2.0", "id": 3, "method": "tools/list"}`,
+	}, "\n")
+
+	var output bytes.Buffer
+	if err := server.ServeStream(context.Background(), strings.NewReader(input), &output); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []interface{}{
+		map[string]interface{}{"id": 1.0, "error": map[string]interface{}{"code": float64(mcp.CodeInvalidRequest)}},
+		map[string]interface{}{"id": 2.0, "result": map[string]interface{}{"protocolVersion": "2025-03-26"}},
+		map[string]interface{}{"id": nil, "error": map[string]interface{}{"code": float64(mcp.CodeParseError)}},
+		map[string]interface{}{"id": 3.0, "result": map[string]interface{}{}},
+	}
+	var got []interface{}
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var resp interface{}
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, resp)
+	}
+	if err := matchSubset(want, got); err != nil {
+		t.Errorf("stream session: %v", err)
+	}
+}
+
+func callMCP(t *testing.T, server *mcp.Server, ctx context.Context, session *mcp.Session, method string, params interface{}) *mcp.Response {
+	t.Helper()
+	raw, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server.Handle(ctx, session, &mcp.Request{JSONRPC: mcp.JSONRPCVersion, ID: json.RawMessage(`1`), Method: method, Params: raw})
+}
+
+// decodeMCPResult 通过 JSON 往返把结果转换为通用结构
+func decodeMCPResult(t *testing.T, resp *mcp.Response) map[string]interface{} {
+	t.Helper()
+	if resp.Error != nil {
+		t.Fatalf("unexpected error %+v", resp.Error)
+	}
+	raw, _ := json.Marshal(resp.Result)
+	var result map[string]interface{}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestMCPSessionLifecycle(t *testing.T) {
+	server := newMCPServer(t, newAuditSinkConfig("memory", ""))
+	ctx := context.Background()
+	session := server.NewSession()
+
+	if resp := callMCP(t, server, ctx, session, "tools/list", nil); resp.Error == nil || resp.Error.Code != mcp.CodeInvalidRequest {
+		t.Fatalf("tools/list before initialize should fail, got %+v", resp)
+	}
+	if resp := callMCP(t, server, ctx, session, "ping", nil); resp.Error != nil {
+		t.Fatalf("ping should work before initialize, got %+v", resp.Error)
+	}
+	if resp := callMCP(t, server, ctx, session, "initialize", map[string]interface{}{}); resp.Error == nil || resp.Error.Code != mcp.CodeInvalidParams {
+		t.Fatalf("initialize without protocolVersion should fail, got %+v", resp)
+	}
+
+	result := decodeMCPResult(t, callMCP(t, server, ctx, session, "initialize", map[string]interface{}{
+		"protocolVersion": "2024-11-05",
+		"clientInfo":      map[string]string{"name": "legacy", "version": "0.1"},
+	}))
+	if result["protocolVersion"] != "2024-11-05" || session.ProtocolVersion() != "2024-11-05" || session.ClientInfo().Name != "legacy" {
+		t.Errorf("supported older version should be kept, got %v", result["protocolVersion"])
+	}
+	if session.Ready() {
+		t.Error("session should not be ready before notifications/initialized")
+	}
+	if resp := server.Handle(ctx, session, &mcp.Request{JSONRPC: mcp.JSONRPCVersion, Method: "notifications/initialized"}); resp != nil {
+		t.Errorf("notification should not get a response, got %+v", resp)
+	}
+	if !session.Ready() {
+		t.Error("session should be ready after notifications/initialized")
+	}
+	if resp := callMCP(t, server, ctx, session, "tools/list", nil); resp.Error != nil {
+		t.Errorf("tools/list after initialize failed: %+v", resp.Error)
+	}
+
+	other := server.NewSession()
+	result = decodeMCPResult(t, callMCP(t, server, ctx, other, "initialize", map[string]interface{}{"protocolVersion": "1999-01-01"}))
+	if result["protocolVersion"] != mcp.LatestProtocolVersion {
+		t.Errorf("unsupported version should negotiate to latest, got %v", result["protocolVersion"])
+	}
+}
+
+func TestMCPSchemaFollowsRBAC(t *testing.T) {
+	server := newMCPServer(t, newRBACConfig())
+	session := server.NewSession()
+	callMCP(t, server, context.Background(), session, "initialize", map[string]interface{}{"protocolVersion": mcp.LatestProtocolVersion})
+	ctx := core.WithPrincipal(context.Background(), core.NewPrincipal("alice", "analyst"))
+
+	result := decodeMCPResult(t, callMCP(t, server, ctx, session, "tools/call", map[string]interface{}{"name": "describe_schema"}))
+	want := map[string]interface{}{"tables": []interface{}{
+		map[string]interface{}{"name": "customers", "columns": []interface{}{
+			map[string]interface{}{"name": "id"}, map[string]interface{}{"name": "name"}, map[string]interface{}{"name": "region"},
+		}},
+		map[string]interface{}{"name": "sales"},
+	}}
+	if err := matchSubset(want, result["structuredContent"]); err != nil {
+		t.Errorf("analyst should only see granted tables and columns: %v", err)
+	}
+
+	if resp := callMCP(t, server, ctx, session, "resources/read", map[string]string{"uri": "text2sql://schema/data"}); resp.Error == nil || resp.Error.Code != mcp.CodeResourceNotFound {
+		t.Errorf("ungranted table should not be readable, got %+v", resp)
+	}
+
+	result = decodeMCPResult(t, callMCP(t, server, ctx, session, "tools/call", map[string]interface{}{
+		"name":      "explain_query",
+		"arguments": map[string]string{"query": "2025年北京销售额超过100万的客户"},
+	}))
+	if result["isError"] != true || matchSubset(map[string]interface{}{"error": map[string]interface{}{"code": "access_denied"}}, result["structuredContent"]) != nil {
+		t.Errorf("explain of ungranted table should be access_denied, got %v", result)
+	}
+}
+
+func TestMCPToolScopes(t *testing.T) {
+	server := newMCPServer(t, newAuditSinkConfig("memory", ""))
+	session := server.NewSession()
+	callMCP(t, server, context.Background(), session, "initialize", map[string]interface{}{"protocolVersion": mcp.LatestProtocolVersion})
+	ctx := mcp.WithAPIKey(context.Background(), &core.APIKey{Name: "catalog", Scopes: []string{core.ScopeSchema}})
+
+	result := decodeMCPResult(t, callMCP(t, server, ctx, session, "tools/list", nil))
+	if err := matchSubset(map[string]interface{}{"tools": []interface{}{map[string]interface{}{"name": "describe_schema"}}}, result); err != nil {
+		t.Errorf("schema key should only list describe_schema: %v", err)
+	}
+
+	resp := callMCP(t, server, ctx, session, "tools/call", map[string]interface{}{
+		"name":      "execute_query",
+		"arguments": map[string]string{"query": "2025年北京销售额超过100万的客户"},
+	})
+	if resp.Error == nil || resp.Error.Code != mcp.CodeForbidden {
+		t.Errorf("execute_query without execute scope should be forbidden, got %+v", resp)
+	}
+	if resp := callMCP(t, server, ctx, session, "resources/list", nil); resp.Error != nil {
+		t.Errorf("schema key should list resources, got %+v", resp.Error)
+	}
+
+	// text2sql/health 的队列和守卫计数只返回给 audit/admin 权限
+	health := decodeMCPResult(t, callMCP(t, server, ctx, session, "text2sql/health", nil))
+	if health["status"] != "healthy" || health["version"] == nil || health["guards"] != nil || health["audit"] != nil || health["worker_pool"] != nil {
+		t.Errorf("health without audit scope should only report status and version, got %v", health)
+	}
+	auditor := mcp.WithAPIKey(context.Background(), &core.APIKey{Name: "ops", Scopes: []string{core.ScopeAudit}})
+	health = decodeMCPResult(t, callMCP(t, server, auditor, session, "text2sql/health", nil))
+	if health["guards"] == nil || health["audit"] == nil || health["worker_pool"] == nil {
+		t.Errorf("health with audit scope should include detailed stats, got %v", health)
+	}
+}
+
+func TestMCPAnonymousScopes(t *testing.T) {
+	cfg := newAuditSinkConfig("memory", "")
+	cfg.Authentication = config.AuthenticationConfig{
+		Enabled: true, HeaderName: "Authorization", Token: "secret", ValidateOnly: true,
+		AnonymousScopes: []string{core.ScopeSchema},
+	}
+	server := newMCPServer(t, cfg)
+	session := server.NewSession()
+	callMCP(t, server, context.Background(), session, "initialize", map[string]interface{}{"protocolVersion": mcp.LatestProtocolVersion})
+
+	// validate_only 下匿名调用只有 anonymous_scopes 中的权限，不能多于携带令牌的调用
+	anonymous := context.Background()
+	for _, tc := range []struct {
+		method string
+		params interface{}
+		allow  bool
+	}{
+		{"text2sql/audit", nil, false},
+		{"text2sql/config", nil, false},
+		{"text2sql/execute", map[string]string{"query": "2025年北京销售额超过100万的客户"}, false},
+		{"tools/call", map[string]interface{}{"name": "execute_query", "arguments": map[string]string{"query": "2025年北京销售额超过100万的客户"}}, false},
+		{"tools/call", map[string]interface{}{"name": "describe_schema"}, true},
+		{"resources/list", nil, true},
+	} {
+		resp := callMCP(t, server, anonymous, session, tc.method, tc.params)
+		if forbidden := resp.Error != nil && resp.Error.Code == mcp.CodeForbidden; forbidden == tc.allow {
+			t.Errorf("anonymous %s %v: expected allowed=%v, got %+v", tc.method, tc.params, tc.allow, resp.Error)
+		}
+	}
+
+	result := decodeMCPResult(t, callMCP(t, server, anonymous, session, "tools/list", nil))
+	if err := matchSubset(map[string]interface{}{"tools": []interface{}{map[string]interface{}{"name": "describe_schema"}}}, result); err != nil {
+		t.Errorf("anonymous caller should only list describe_schema: %v", err)
+	}
+
+	auditor := mcp.WithAPIKey(context.Background(), &core.APIKey{Name: "auditor", Scopes: []string{core.ScopeAudit}})
+	if resp := callMCP(t, server, auditor, session, "text2sql/audit", nil); resp.Error != nil {
+		t.Errorf("audit key should query audit log, got %+v", resp.Error)
+	}
+}
+
+func TestMCPResultRowsWithNonASCIIColumns(t *testing.T) {
+	db, err := drivers.CreateSQLiteConnection(t.TempDir() + "/data.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE data ("客户名称" TEXT, "Ϊê" TEXT, "µ" INT);
+		INSERT INTO data VALUES ('北京', 'a` + "\x1e" + `b', 7)`); err != nil {
+		t.Fatal(err)
+	}
+	cfg := newAuditSinkConfig("memory", "")
+	skill, err := core.NewText2SQLSkill(cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer skill.SafeShutdown()
+	server := mcp.NewServer(cfg, skill)
+	session := server.NewSession()
+	callMCP(t, server, context.Background(), session, "initialize", map[string]interface{}{"protocolVersion": mcp.LatestProtocolVersion})
+
+	result := decodeMCPResult(t, callMCP(t, server, context.Background(), session, "tools/call", map[string]interface{}{
+		"name":      "execute_query",
+		"arguments": map[string]string{"query": "2025年北京销售额超过100万的客户"},
+	}))
+	want := map[string]interface{}{"structuredContent": map[string]interface{}{
+		"row_count": 1.0,
+		"rows":      []interface{}{map[string]interface{}{"客户名称": "北京", "Ϊê": "a\x1eb", "µ": 7.0}},
+	}}
+	if result["isError"] == true || matchSubset(want, result) != nil {
+		t.Errorf("rows with non-ASCII columns should be returned intact, got %v", result)
+	}
+}
+
+func TestDecryptResultRoundTrip(t *testing.T) {
+	rows := []map[string]interface{}{}
+	for i := 0; i < 200; i++ {
+		rows = append(rows, map[string]interface{}{"id": int64(i), "score": float64(i) / 2, "name": fmt.Sprintf("row-%d", i)})
+	}
+	for _, compress := range []bool{false, true} {
+		decoded, err := utils.DecryptResult(utils.EncryptResult(rows, compress))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, rows) {
+			t.Errorf("compress=%v: round trip mismatch", compress)
+		}
+	}
+
+	// 列名和值可以包含任意字节，包括 UTF-8 中常见的 0xAA 和旧格式的分隔符
+	special := []map[string]interface{}{
+		{"客户名称": "北京", "Ϊê": "a\x1eb\x1fc\x00d", "µ": int64(-1), "": nil},
+		{},
+	}
+	decoded, err := utils.DecryptResult(utils.EncryptResult(special, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, special) {
+		t.Errorf("non-ASCII round trip mismatch: %q", decoded)
+	}
+
+	// 不带版本号的旧分隔符格式仍可解码
+	legacy := []byte{0x7F, 0x01}
+	for _, c := range "id" {
+		legacy = append(legacy, byte(c)^0xAA)
+	}
+	legacy = append(legacy, 0x1F, 0x02, 7, 0, 0, 0, 0, 0, 0, 0, 0x1E, 0x00)
+	sum := sha256.Sum256(legacy)
+	decoded, err = utils.DecryptResult(append(legacy, sum[:4]...))
+	if err != nil || !reflect.DeepEqual(decoded, []map[string]interface{}{{"id": int64(7)}}) {
+		t.Errorf("legacy encoding should decode, got %v %v", decoded, err)
+	}
+
+	encoded := utils.EncryptResult(rows[:1], false)
+	encoded[len(encoded)-1] ^= 0xFF
+	if _, err := utils.DecryptResult(encoded); err == nil {
+		t.Error("corrupted checksum should be rejected")
+	}
+}
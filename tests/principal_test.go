@@ -0,0 +1,175 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+	"text2sql-skill/drivers"
+	"text2sql-skill/interfaces"
+)
+
+func TestPrincipalHelpers(t *testing.T) {
+	base := core.NewPrincipal("alice", "analyst")
+	if base.AuthMethod != core.AuthMethodEmbedded || !base.HasRole("analyst") || base.HasRole("admin") {
+		t.Fatalf("unexpected principal %+v", base)
+	}
+
+	scoped := base.WithAttribute("region", "north")
+	if scoped.Attribute("region") != "north" || base.Attribute("region") != "" {
+		t.Error("WithAttribute should return a copy and leave the original unchanged")
+	}
+	if scoped.WithAttribute("team", "a").Attribute("region") != "north" {
+		t.Error("WithAttribute should keep existing attributes")
+	}
+
+	var nobody *core.Principal
+	if nobody.HasRole("analyst") || nobody.Attribute("region") != "" {
+		t.Error("nil principal should have no roles or attributes")
+	}
+
+	ctx := core.ContextWithUser(context.Background(), "bob", "reader")
+	if p := core.PrincipalFromContext(ctx); p == nil || p.User != "bob" || !p.HasRole("reader") {
+		t.Errorf("ContextWithUser should attach the principal, got %+v", p)
+	}
+}
+
+func TestAuthenticatorSetsAuthMethod(t *testing.T) {
+	auth, tokens := newAPIKeyConfig(t)
+	authenticator, err := core.NewAuthenticator(auth, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	principal, _, err := authenticator.Authenticate("Bearer " + tokens["ops"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.AuthMethod != core.AuthMethodAPIKey || principal.APIKey != "ops" {
+		t.Errorf("unexpected principal %+v", principal)
+	}
+
+	idp := newTestIdP(t)
+	authenticator, err = core.NewAuthenticator(newJWTAuthConfig(t, idp), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	principal, _, err = authenticator.Authenticate("Bearer " + idp.sign(t, "rsa-1", baseClaims("alice")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.AuthMethod != core.AuthMethodJWT {
+		t.Errorf("expected jwt auth method, got %q", principal.AuthMethod)
+	}
+}
+
+func TestQueryCacheScopedByPrincipal(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Cache.Enabled = true
+	cache := core.NewQueryCache(cfg)
+	defer cache.Close()
+
+	analyst := core.ContextWithUser(context.Background(), "alice", "analyst")
+	cache.SetContext(analyst, "q", interfaces.SkillResult{QueryID: "analyst"})
+
+	if result, found := cache.GetContext(core.ContextWithUser(context.Background(), "carol", "analyst"), "q"); !found || result.QueryID != "analyst" {
+		t.Error("callers with the same roles should share cache entries")
+	}
+	if _, found := cache.GetContext(core.ContextWithUser(context.Background(), "bob", "reader"), "q"); found {
+		t.Error("callers with different roles must not share cache entries")
+	}
+	if _, found := cache.GetContext(context.Background(), "q"); found {
+		t.Error("anonymous callers must not read role-scoped entries")
+	}
+
+	// 有身份属性时按用户区分
+	north := core.WithPrincipal(context.Background(), core.NewPrincipal("alice", "analyst").WithAttribute("region", "north"))
+	cache.SetContext(north, "r", interfaces.SkillResult{QueryID: "north"})
+	south := core.WithPrincipal(context.Background(), core.NewPrincipal("dave", "analyst").WithAttribute("region", "south"))
+	if _, found := cache.GetContext(south, "r"); found {
+		t.Error("callers with different attributes must not share cache entries")
+	}
+
+	// 自定义角色解析
+	cache.SetRoleResolver(func(p *core.Principal) []string { return []string{"everyone"} })
+	cache.SetContext(context.Background(), "s", interfaces.SkillResult{QueryID: "resolved"})
+	if result, found := cache.GetContext(core.ContextWithUser(context.Background(), "eve"), "s"); !found || result.QueryID != "resolved" {
+		t.Error("role resolver should decide the cache scope")
+	}
+}
+
+func TestExecuteAuditsPrincipal(t *testing.T) {
+	db, err := drivers.CreateSQLiteConnection(t.TempDir() + "/data.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE data (id INTEGER); INSERT INTO data VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := newAuditSinkConfig("memory", "")
+	cfg.Cache.Enabled = true
+	cfg.Security.RequireIdentity = true
+	skill, err := core.NewText2SQLSkill(cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer skill.SafeShutdown()
+
+	input := "2025年北京销售额超过100万的客户"
+	ctx := core.WithPrincipal(context.Background(), &core.Principal{
+		User: "alice", Tenant: "finance", AuthMethod: core.AuthMethodJWT,
+	})
+	result, err := skill.Execute(ctx, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != "success" {
+		t.Fatalf("expected success, got %s: %s", result.Status, result.Meta)
+	}
+
+	entries, err := skill.(*core.Text2SQLSkill).QueryAudit(core.AuditFilter{QueryID: result.QueryID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.EventType == "execution_end" {
+			continue
+		}
+		events[entry.EventType] = true
+		if entry.User() != "alice" || entry.Data["auth_method"] != core.AuthMethodJWT || entry.Data["tenant"] != "finance" {
+			t.Errorf("%s entry should carry the caller identity: %+v", entry.EventType, entry.Data)
+		}
+	}
+	if !events["execution_start"] || !events["success"] {
+		t.Errorf("expected execution_start and success entries, got %v", events)
+	}
+
+	// 匿名调用在读取缓存之前被拒绝
+	anonymous, err := skill.Execute(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if anonymous.Status != "rejected" || !strings.Contains(string(anonymous.Meta), "caller identity required") {
+		t.Errorf("anonymous call should be rejected, got %s: %s", anonymous.Status, anonymous.Meta)
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package tests
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+)
+
+func newRateLimiter(t *testing.T, cfg config.RateLimitConfig, clock *fakeClock) *core.RateLimiter {
+	t.Helper()
+	cfg.Enabled = true
+	full := newAuditSinkConfig("memory", "")
+	full.RateLimit = cfg
+	if err := config.ValidateConfig(full); err != nil {
+		t.Fatal(err)
+	}
+	limiter, err := core.NewRateLimiter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter.SetClock(clock.Now)
+	return limiter
+}
+
+func userCtx(user string) context.Context {
+	return core.WithPrincipal(context.Background(), &core.Principal{User: user})
+}
+
+func TestRateLimiterTokenBucket(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	limiter := newRateLimiter(t, config.RateLimitConfig{
+		Rules: []config.RateLimitRule{{Scope: "user", RequestsPerSecond: 1, Burst: 2}},
+	}, clock)
+
+	alice := userCtx("alice")
+	for i := 0; i < 2; i++ {
+		if d := limiter.Admit(alice); !d.Allowed {
+			t.Fatalf("request %d within burst rejected: %+v", i, d)
+		}
+	}
+	d := limiter.Admit(alice)
+	if d.Allowed || d.Status != core.StatusRateLimited || d.RetryAfterSeconds() != 1 {
+		t.Fatalf("expected rate_limited with 1s retry, got %+v", d)
+	}
+
+	// 其他调用方有独立的令牌桶
+	if d := limiter.Admit(userCtx("bob")); !d.Allowed {
+		t.Errorf("bob should not share alice's bucket: %+v", d)
+	}
+
+	clock.Advance(time.Second)
+	if d := limiter.Admit(alice); !d.Allowed {
+		t.Errorf("token should be refilled after 1s: %+v", d)
+	}
+}
+
+func TestRateLimiterDailyQuotas(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 18, 0, 0, 0, time.UTC)}
+	limiter := newRateLimiter(t, config.RateLimitConfig{
+		Rules: []config.RateLimitRule{
+			{Scope: "user", DailyQueries: 3, DailyRows: 10},
+			{Scope: "tenant", Match: "finance", DailyDBTime: "1s"},
+		},
+	}, clock)
+
+	alice := userCtx("alice")
+	limiter.Admit(alice)
+	limiter.Record(alice, 10, 0)
+	d := limiter.Admit(alice)
+	if d.Status != core.StatusQuotaExceeded || d.RetryAfter != 6*time.Hour {
+		t.Fatalf("expected row quota exceeded until midnight, got %+v", d)
+	}
+
+	bob := userCtx("bob")
+	for i := 0; i < 3; i++ {
+		limiter.Admit(bob)
+	}
+	if d := limiter.Admit(bob); d.Status != core.StatusQuotaExceeded {
+		t.Errorf("expected query quota exceeded, got %+v", d)
+	}
+	if usage := limiter.Usage(bob); usage["user:*:bob"].Queries != 3 {
+		t.Errorf("rejected requests should not be counted: %+v", usage)
+	}
+
+	// tenant 规则只对匹配的租户生效
+	carol := core.WithTenant(userCtx("carol"), "finance")
+	limiter.Admit(carol)
+	limiter.Record(carol, 1, 2*time.Second)
+	if d := limiter.Admit(carol); d.Status != core.StatusQuotaExceeded {
+		t.Errorf("expected finance db time quota exceeded, got %+v", d)
+	}
+	dave := core.WithTenant(userCtx("dave"), "retail")
+	limiter.Admit(dave)
+	limiter.Record(dave, 1, 2*time.Second)
+	if d := limiter.Admit(dave); !d.Allowed {
+		t.Errorf("retail should not be limited by the finance rule: %+v", d)
+	}
+
+	// 跨日后配额重置
+	clock.Advance(6 * time.Hour)
+	if d := limiter.Admit(alice); !d.Allowed {
+		t.Errorf("quota should reset on a new day: %+v", d)
+	}
+}
+
+func TestRateLimiterPersistsUsage(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "quota", "usage.json")
+	cfg := config.RateLimitConfig{
+		StatePath: statePath,
+		Rules:     []config.RateLimitRule{{Scope: "user", DailyQueries: 2}},
+	}
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)}
+
+	limiter := newRateLimiter(t, cfg, clock)
+	alice := userCtx("alice")
+	limiter.Admit(alice)
+	limiter.Admit(alice)
+	limiter.Record(alice, 5, 0)
+	limiter.Close()
+
+	// 重启后同一天继续累计
+	restarted := newRateLimiter(t, cfg, clock)
+	if d := restarted.Admit(alice); d.Status != core.StatusQuotaExceeded {
+		t.Errorf("quota usage should survive restarts, got %+v", d)
+	}
+	if usage := restarted.Usage(alice); usage["user:*:alice"].Rows != 5 {
+		t.Errorf("unexpected restored usage: %+v", usage)
+	}
+
+	// 状态文件属于前一天时不恢复
+	clock.Advance(24 * time.Hour)
+	nextDay := newRateLimiter(t, cfg, clock)
+	if d := nextDay.Admit(alice); !d.Allowed {
+		t.Errorf("usage from a previous day should be discarded: %+v", d)
+	}
+}
+
+func TestEndpointLimiter(t *testing.T) {
+	limiter := core.NewEndpointLimiter(config.EndpointLimit{RequestsPerSecond: 0.5, Burst: 1})
+	if ok, _ := limiter.Allow("10.0.0.1"); !ok {
+		t.Fatal("first request should be allowed")
+	}
+	if ok, wait := limiter.Allow("10.0.0.1"); ok || wait <= 0 {
+		t.Errorf("second request should be limited, got %v %v", ok, wait)
+	}
+	if ok, _ := limiter.Allow("10.0.0.2"); !ok {
+		t.Error("other clients should have their own bucket")
+	}
+	if core.NewEndpointLimiter(config.EndpointLimit{}) != nil {
+		t.Error("zero rate should disable the endpoint limiter")
+	}
+}
+
+func TestRateLimitConfigValidation(t *testing.T) {
+	for _, rule := range []config.RateLimitRule{
+		{Scope: "ip"},
+		{Scope: "user", Match: "["},
+		{Scope: "user", RequestsPerSecond: -1},
+		{Scope: "user", DailyQueries: -1},
+		{Scope: "user", DailyDBTime: "ten minutes"},
+	} {
+		cfg := newAuditSinkConfig("memory", "")
+		cfg.RateLimit = config.RateLimitConfig{Enabled: true, Rules: []config.RateLimitRule{rule}}
+		if err := config.ValidateConfig(cfg); err == nil {
+			t.Errorf("expected validation error for %+v", rule)
+		}
+	}
+}
+
+func TestExecuteEnforcesQuota(t *testing.T) {
+	cfg := newAuditSinkConfig("memory", "")
+	cfg.RateLimit = config.RateLimitConfig{
+		Enabled: true,
+		Rules:   []config.RateLimitRule{{Scope: "user", DailyQueries: 1}},
+	}
+	skill, err := core.NewText2SQLSkill(cfg, newTenantDB(t, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer skill.SafeShutdown()
+
+	ctx := userCtx("alice")
+	result, err := skill.Execute(ctx, "2025年北京销售额超过100万的客户")
+	if err != nil || result.Status != "success" {
+		t.Fatalf("first query should succeed: %v %s %s", err, result.Status, result.Meta)
+	}
+	usage := skill.(interface {
+		QuotaUsage(context.Context) map[string]core.QuotaUsage
+	}).QuotaUsage(ctx)
+	if usage["user:*:alice"].Rows != 3 {
+		t.Errorf("rows returned should be counted, got %+v", usage)
+	}
+
+	result, err = skill.Execute(ctx, "2025年北京销售额超过100万的客户")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != core.StatusQuotaExceeded {
+		t.Fatalf("expected quota_exceeded, got %s", result.Status)
+	}
+	if skillErr := core.ResultError(result); skillErr == nil || skillErr.Code != core.ErrCodeQuotaExceeded || skillErr.RetryAfterSeconds <= 0 {
+		t.Errorf("expected retry_after_seconds in meta, got %s", result.Meta)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+)
+
+func TestAnalyzeSQLReferences(t *testing.T) {
+	tests := []struct {
+		query   string
+		tables  []string
+		wantErr bool
+	}{
+		{"SELECT name FROM customers c JOIN sales s ON c.id = s.customer_id WHERE s.year = ?", []string{"customers", "sales"}, false},
+		{"SELECT * FROM (SELECT id FROM hr.employees) e", []string{"hr.employees"}, false},
+		{"WITH recent AS (SELECT * FROM orders) SELECT * FROM recent r JOIN items i ON r.id = i.order_id", []string{"orders", "items"}, false},
+		{"SELECT a FROM t WHERE EXISTS (SELECT 1 FROM u WHERE u.x = t.y) UNION SELECT b FROM v", []string{"t", "u", "v"}, false},
+		{"SELECT EXTRACT(YEAR FROM created_at) y FROM t WHERE ts > NOW() - INTERVAL 1 DAY", []string{"t"}, false},
+		{"SELECT 1 --1 FROM secret", []string{"secret"}, false},
+		{"SELECT 1 /* hidden */ FROM visible", []string{"visible"}, false},
+		{"DROP TABLE sales", nil, true},
+		{"SELECT 1; DELETE FROM sales", nil, true},
+		{"SELECT * FROM t WHERE name = 'a\\' OR 1=1'", nil, true},
+		{"SELECT /*! 1 FROM secret */ 1", nil, true},
+		{"SELECT x FROM t WHERE (a = 1", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			analysis, err := core.AnalyzeSQL(tt.query)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var tables []string
+			for _, ref := range analysis.Tables {
+				tables = append(tables, ref.QualifiedName())
+			}
+			if !reflect.DeepEqual(tables, tt.tables) {
+				t.Errorf("expected tables %v, got %v", tt.tables, tables)
+			}
+		})
+	}
+}
+
+func newRBACConfig() *config.Config {
+	cfg := newTestConfig()
+	cfg.Security.RBAC = config.RBACConfig{
+		Enabled: true,
+		Roles: []config.RoleConfig{
+			{Name: "analyst", Grants: []config.GrantConfig{
+				{Table: "sales"},
+				{Table: "customers", Columns: []string{"id", "name", "region"}},
+			}},
+			{Name: "hr", Grants: []config.GrantConfig{
+				{Schema: "hr", Table: "*"},
+			}},
+			{Name: "writer", Grants: []config.GrantConfig{
+				{Table: "sales", Operations: []string{"SELECT", "UPDATE"}},
+			}},
+		},
+		Users: map[string][]string{"carol": {"hr"}},
+	}
+	return cfg
+}
+
+func TestAccessPolicyDeniesObjects(t *testing.T) {
+	permCtrl := newTestController(t, newRBACConfig())
+
+	analyst := &core.Principal{User: "alice", Roles: []string{"analyst"}}
+	tests := []struct {
+		name      string
+		principal *core.Principal
+		query     string
+		denied    []string
+	}{
+		{"allowed join", analyst, "SELECT c.name, s.amount FROM customers c JOIN sales s ON c.id = s.customer_id", nil},
+		{"denied column", analyst, "SELECT name, email FROM customers", []string{"customers.email"}},
+		{"star on restricted table", analyst, "SELECT * FROM customers", []string{"customers.*"}},
+		{"unqualified column in join", analyst, "SELECT amount, phone FROM customers c JOIN sales s ON c.id = s.customer_id", []string{"customers.amount", "customers.phone"}},
+		{"ungranted table", analyst, "SELECT salary FROM hr.employees", []string{"hr.employees"}},
+		{"denied operation", analyst, "DELETE FROM sales WHERE id = 1", []string{"DELETE sales"}},
+		{"granted operation", &core.Principal{Roles: []string{"writer"}}, "UPDATE sales SET amount = 0 WHERE id = 1", nil},
+		{"role from user binding", &core.Principal{User: "carol"}, "SELECT salary FROM hr.employees", nil},
+		{"derived table alias", analyst, "SELECT d.email FROM (SELECT email FROM customers) d", []string{"customers.email"}},
+		{"cte shadowing table", analyst, "WITH customers AS (SELECT * FROM customers) SELECT email FROM customers", []string{"customers.*"}},
+		{"correlated subquery", analyst, "SELECT id FROM sales s WHERE EXISTS (SELECT 1 FROM customers c WHERE c.email = s.contact)", []string{"customers.email"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			denied, err := permCtrl.CheckSQLAccess(tt.principal, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(denied, tt.denied) {
+				t.Errorf("expected denied %v, got %v", tt.denied, denied)
+			}
+		})
+	}
+
+	rejected := []struct {
+		name      string
+		principal *core.Principal
+		query     string
+	}{
+		{"caller without roles", &core.Principal{User: "mallory"}, "SELECT 1 FROM sales"},
+		{"unparseable SQL", analyst, "SELECT 1 FROM sales; DROP TABLE sales"},
+	}
+	for _, tt := range rejected {
+		if _, err := permCtrl.CheckSQLAccess(tt.principal, tt.query); err == nil {
+			t.Errorf("%s should be rejected", tt.name)
+		}
+	}
+}
+
+func TestRBACPolicyFile(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.yaml")
+	policy := `
+roles:
+  - name: viewer
+    grants:
+      - table: "sales"
+        columns: ["region", "amount"]
+users:
+  dave: ["viewer"]
+`
+	if err := os.WriteFile(policyFile, []byte(policy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Security.RBAC = config.RBACConfig{Enabled: true, PolicyFile: policyFile, DefaultRole: "viewer"}
+	if err := config.ValidateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	access, err := core.NewAccessPolicy(cfg.Security.RBAC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roles := access.RolesFor(nil); !reflect.DeepEqual(roles, []string{"viewer"}) {
+		t.Errorf("anonymous caller should get the default role, got %v", roles)
+	}
+	if roles := access.RolesFor(&core.Principal{User: "dave"}); !reflect.DeepEqual(roles, []string{"viewer"}) {
+		t.Errorf("expected roles from policy file, got %v", roles)
+	}
+
+	cfg.Security.RBAC.DefaultRole = "missing"
+	if err := config.ValidateConfig(cfg); err == nil {
+		t.Error("undefined default role should fail validation")
+	}
+}
+
+func TestExecuteEnforcesRBAC(t *testing.T) {
+	db := newTestDB(t, "CREATE TABLE data (id INTEGER, region TEXT); INSERT INTO data VALUES (1, 'north')")
+	cfg := newRBACConfig()
+	cfg.Cache.Enabled = true
+	cfg.Security.RBAC.Roles = append(cfg.Security.RBAC.Roles, config.RoleConfig{
+		Name: "reader", Grants: []config.GrantConfig{{Table: "data"}},
+	})
+	skill := newTestSkill(t, cfg, db)
+
+	// 按顺序执行：同样的输入不能从其他角色的缓存中取得结果
+	tests := []struct {
+		principal *core.Principal
+		status    string
+		reason    string
+	}{
+		{&core.Principal{User: "bob", Roles: []string{"reader"}}, "success", ""},
+		{&core.Principal{User: "alice", Roles: []string{"analyst"}}, "rejected", "RBAC: access denied to data"},
+	}
+	for _, tt := range tests {
+		result, _ := executeAs(context.Background(), t, skill, tt.principal)
+		if result.Status != tt.status || !strings.Contains(string(result.Meta), tt.reason) {
+			t.Fatalf("%s: expected %s, got %s: %s", tt.principal.User, tt.status, result.Status, result.Meta)
+		}
+		if tt.status != "rejected" {
+			continue
+		}
+
+		entries, err := skill.(*core.Text2SQLSkill).QueryAudit(core.AuditFilter{QueryID: result.QueryID, EventType: "rejected"})
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("expected one rejected audit entry, got %d, err=%v", len(entries), err)
+		}
+		if entries[0].User() != tt.principal.User || !strings.Contains(entries[0].Data["reason"].(string), "data") {
+			t.Errorf("audit entry should name the user and denied table: %+v", entries[0].Data)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package tests
+
+import (
+	"bytes"
+	"testing"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+)
+
+func newTestRedactor(t *testing.T) *core.Redactor {
+	t.Helper()
+	cfg := config.DefaultConfig().Security.Redaction
+	cfg.Enabled = true
+	cfg.CustomPatterns = []config.RedactionRegexp{{Name: "employee_id", Pattern: `EMP\d{6}`}}
+	cfg.Columns = append(cfg.Columns, "salary")
+
+	redactor, err := core.NewRedactor(cfg)
+	if err != nil {
+		t.Fatalf("NewRedactor failed: %v", err)
+	}
+	return redactor
+}
+
+func TestRedactString(t *testing.T) {
+	redactor := newTestRedactor(t)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"联系 alice@example.com 获取", "联系 [REDACTED:email] 获取"},
+		{"手机13812345678的客户", "手机[REDACTED:phone]的客户"},
+		{"call +1 415 555 2671 now", "call [REDACTED:phone] now"},
+		{"身份证11010519491231002X号", "身份证[REDACTED:cn_id]号"},
+		{"身份证110105194912310021号", "身份证110105194912310021号"}, // 校验位错误
+		{"card 4111 1111 1111 1111 used", "card [REDACTED:credit_card] used"},
+		{"card 4111 1111 1111 1112 used", "card 4111 1111 1111 1112 used"}, // Luhn 校验失败
+		{"员工 EMP123456 的记录", "员工 [REDACTED:employee_id] 的记录"},
+		{"2025年北京销售额超过100万的客户", "2025年北京销售额超过100万的客户"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := redactor.RedactString(tt.input); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRedactMapColumns(t *testing.T) {
+	redactor := newTestRedactor(t)
+
+	got := redactor.RedactMap(map[string]interface{}{
+		"input":        "查询 bob@example.com 的订单",
+		"salary":       12000.5,
+		"access_token": "abc",
+		"row_count":    3,
+		"rows": []map[string]interface{}{
+			{"name": "Bob", "SALARY": 9000},
+		},
+	})
+
+	if got["input"] != "查询 [REDACTED:email] 的订单" {
+		t.Errorf("unexpected input: %v", got["input"])
+	}
+	if got["salary"] != "[REDACTED:column]" || got["access_token"] != "[REDACTED:column]" {
+		t.Errorf("sensitive columns not redacted: %v", got)
+	}
+	if got["row_count"] != 3 {
+		t.Errorf("non-sensitive value changed: %v", got["row_count"])
+	}
+	rows := got["rows"].([]map[string]interface{})
+	if rows[0]["SALARY"] != "[REDACTED:column]" || rows[0]["name"] != "Bob" {
+		t.Errorf("nested rows not redacted by column: %v", rows[0])
+	}
+}
+
+func TestAuditEntriesAreRedacted(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Performance.AsyncProcessing = false
+	cfg.Security.Redaction.Enabled = true
+	sink := core.NewMemoryAuditSink(10)
+	logger := core.NewAuditLoggerWithSink(cfg, sink)
+	logger.LogEvent("q1", "execution_error", map[string]interface{}{
+		"input": "手机13812345678的订单",
+		"error": "duplicate key alice@example.com",
+	})
+	logger.Close()
+
+	entries, _ := sink.Query(core.AuditFilter{})
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	if entries[0].Data["input"] != "手机[REDACTED:phone]的订单" || entries[0].Data["error"] != "duplicate key [REDACTED:email]" {
+		t.Errorf("audit data not redacted: %v", entries[0].Data)
+	}
+}
+
+func TestRedactingWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := core.NewRedactingWriter(&buf, newTestRedactor(t))
+	w.Write([]byte("login failed for alice@example.com\n"))
+	if buf.String() != "login failed for [REDACTED:email]\n" {
+		t.Errorf("log line not redacted: %q", buf.String())
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+)
+
+const rowSecuritySchema = `
+CREATE TABLE sales (id INTEGER, region TEXT, amount INTEGER, customer_id INTEGER);
+CREATE TABLE customers (id INTEGER, name TEXT, region TEXT);
+INSERT INTO sales VALUES (1, 'north', 100, 1), (2, 'south', 200, 2), (3, 'north', 300, 2);
+INSERT INTO customers VALUES (1, 'alice', 'north'), (2, 'bob', 'south');`
+
+func newRowSecurityConfig() *config.Config {
+	cfg := newTestConfig()
+	cfg.Security.RBAC = config.RBACConfig{
+		Enabled: true,
+		Roles: []config.RoleConfig{
+			{
+				Name:   "sales_rep",
+				Grants: []config.GrantConfig{{Table: "sales"}, {Table: "customers"}, {Table: "data"}},
+				RowFilters: map[string]string{
+					"sales":     "region = :user.region",
+					"customers": "region = :user.region",
+					"data":      "region = :user.region",
+				},
+			},
+			{
+				Name:       "big_deals",
+				Grants:     []config.GrantConfig{{Table: "sales"}},
+				RowFilters: map[string]string{"sales": "amount >= 300"},
+			},
+			{Name: "manager", Grants: []config.GrantConfig{{Table: "*"}}},
+			{
+				Name:       "owner",
+				Grants:     []config.GrantConfig{{Table: "data"}},
+				RowFilters: map[string]string{"data": "owner = :user.name"},
+			},
+		},
+	}
+	return cfg
+}
+
+// queryRegions 执行改写后的 SQL，返回第一列的全部值
+func queryRegions(t *testing.T, db *sql.DB, permCtrl *core.PermissionController, principal *core.Principal, query string) []string {
+	t.Helper()
+	rewritten, args, _, err := permCtrl.ApplyRowSecurity(principal, query)
+	if err != nil {
+		t.Fatalf("rewrite %q: %v", query, err)
+	}
+	rows, err := db.Query(rewritten, args...)
+	if err != nil {
+		t.Fatalf("query %q: %v", rewritten, err)
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+func TestRowFiltersCannotBeBypassed(t *testing.T) {
+	db := newTestDB(t, rowSecuritySchema)
+	permCtrl := newTestController(t, newRowSecurityConfig())
+	rep := &core.Principal{User: "alice", Roles: []string{"sales_rep"}, Attributes: map[string]string{"region": "north"}}
+
+	queries := []string{
+		"SELECT region FROM sales",
+		"SELECT s.region FROM sales AS s",
+		"SELECT x.region FROM sales x WHERE 1 = 1 OR region = 'south'",
+		"SELECT c.region FROM customers c JOIN sales s ON c.id = s.customer_id",
+		"SELECT s.region FROM sales s, customers c WHERE s.customer_id = c.id",
+		"SELECT region FROM (SELECT * FROM sales) d",
+		"SELECT region FROM customers WHERE id IN (SELECT customer_id FROM sales)",
+		"WITH s AS (SELECT * FROM sales) SELECT region FROM s",
+		"WITH sales AS (SELECT * FROM customers) SELECT region FROM sales",
+		"WITH RECURSIVE r(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM r WHERE n < 2) SELECT sales.region FROM sales, r",
+		"SELECT region FROM sales UNION ALL SELECT region FROM customers",
+		`SELECT "region" FROM "sales"`,
+		"SELECT region FROM main.sales",
+		"SELECT region FROM SALES -- comment",
+	}
+
+	for _, query := range queries {
+		t.Run(query, func(t *testing.T) {
+			regions := queryRegions(t, db, permCtrl, rep, query)
+			if len(regions) == 0 {
+				t.Fatal("expected rows for the caller's region")
+			}
+			for _, region := range regions {
+				if region != "north" {
+					t.Fatalf("row filter bypassed, got region %q in %v", region, regions)
+				}
+			}
+		})
+	}
+}
+
+func TestRowFiltersCombineRoles(t *testing.T) {
+	db := newTestDB(t, rowSecuritySchema)
+	permCtrl := newTestController(t, newRowSecurityConfig())
+
+	tests := []struct {
+		name  string
+		roles []string
+		query string
+		want  []string
+	}{
+		// 多个角色的过滤条件以 OR 合并
+		{"filters combined with OR", []string{"sales_rep", "big_deals"}, "SELECT CAST(id AS TEXT) FROM sales ORDER BY id", []string{"2", "3"}},
+		// 没有过滤条件的授权角色可以看到全部行
+		{"unfiltered grant sees all rows", []string{"manager", "sales_rep"}, "SELECT CAST(id AS TEXT) FROM sales ORDER BY id", []string{"1", "2", "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal := &core.Principal{Roles: tt.roles, Attributes: map[string]string{"region": "south"}}
+			if got := queryRegions(t, db, permCtrl, principal, tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected rows %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRowFiltersFailClosed(t *testing.T) {
+	permCtrl := newTestController(t, newRowSecurityConfig())
+	rep := &core.Principal{Roles: []string{"sales_rep"}, Attributes: map[string]string{"region": "north"}}
+
+	rejected := []struct {
+		name      string
+		principal *core.Principal
+		query     string
+	}{
+		{"missing caller attribute", &core.Principal{Roles: []string{"sales_rep"}}, "SELECT * FROM sales"},
+		{"write to filtered table", rep, "DELETE FROM sales WHERE id = 1"},
+		{"unbound parameter mixed with bindings", rep, "SELECT * FROM sales WHERE id = ?"},
+	}
+	for _, tt := range rejected {
+		if _, _, _, err := permCtrl.ApplyRowSecurity(tt.principal, tt.query); err == nil {
+			t.Errorf("%s should be rejected", tt.name)
+		}
+	}
+
+	rewrites := []struct {
+		driver string
+		query  string
+		want   string
+	}{
+		{"mysql", "SELECT * FROM sales s WHERE s.amount > 10", "SELECT * FROM (SELECT * FROM sales WHERE (region = ?)) s WHERE s.amount > 10"},
+		{"postgres", "SELECT * FROM sales", "SELECT * FROM (SELECT * FROM sales WHERE (region = $1)) sales"},
+	}
+	for _, tt := range rewrites {
+		cfg := newRowSecurityConfig()
+		cfg.Database.Driver = tt.driver
+		query, args, tables, err := newTestController(t, cfg).ApplyRowSecurity(rep, tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query != tt.want || len(args) != 1 || args[0] != "north" || len(tables) != 1 {
+			t.Errorf("%s: unexpected rewrite: %q %v %v", tt.driver, query, args, tables)
+		}
+	}
+}
+
+func TestExecuteAppliesRowFilters(t *testing.T) {
+	db := newTestDB(t, rowSecuritySchema+`
+CREATE TABLE data (id INTEGER, region TEXT, owner TEXT);
+INSERT INTO data VALUES (1, 'north', 'alice'), (2, 'south', 'bob'), (3, 'south', 'bob');`)
+	cfg := newRowSecurityConfig()
+	cfg.Cache.Enabled = true
+	skill := newTestSkill(t, cfg, db)
+
+	// 按顺序执行且启用缓存：同角色的不同调用方不能取得彼此的行过滤结果
+	tests := []struct {
+		name      string
+		principal *core.Principal
+		want      float64
+	}{
+		{"north rep", &core.Principal{User: "rep-north", Roles: []string{"sales_rep"}, Attributes: map[string]string{"region": "north"}}, 1},
+		{"south rep", &core.Principal{User: "rep-south", Roles: []string{"sales_rep"}, Attributes: map[string]string{"region": "south"}}, 2},
+		{"owner alice", &core.Principal{User: "alice", Roles: []string{"owner"}}, 1},
+		{"owner bob", &core.Principal{User: "bob", Roles: []string{"owner"}}, 2},
+		{"owner alice again", &core.Principal{User: "alice", Roles: []string{"owner"}}, 1},
+	}
+	for _, tt := range tests {
+		result, meta := executeAs(context.Background(), t, skill, tt.principal)
+		if result.Status != "success" {
+			t.Fatalf("%s: expected success, got %s: %s", tt.name, result.Status, result.Meta)
+		}
+		if meta["row_count"] != tt.want {
+			t.Errorf("%s: expected %v rows, got %v", tt.name, tt.want, meta["row_count"])
+		}
+	}
+}
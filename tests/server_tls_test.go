@@ -0,0 +1,370 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+)
+
+// generateClientCert 用 generateTestCert 生成的 CA 签发客户端证书
+func generateClientCert(t *testing.T, dir, caCertFile, caKeyFile string, subject pkix.Name) tls.Certificate {
+	t.Helper()
+	ca, err := tls.LoadX509KeyPair(caCertFile, caKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(time.Now().UnixNano()),
+		Subject:        subject,
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		EmailAddresses: []string{subject.CommonName + "@example.com"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, ca.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// startTLSServer 使用 ServerTLS 启动 HTTPS 测试服务，响应中返回客户端证书身份
+func startTLSServer(t *testing.T, serverTLS *core.ServerTLS) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, key := serverTLS.ClientIdentity(r.TLS)
+		body := map[string]interface{}{}
+		if principal != nil {
+			body["user"] = principal.User
+			body["roles"] = principal.Roles
+			body["tenant"] = principal.Tenant
+			body["scopes"] = key.Scopes
+		}
+		json.NewEncoder(w).Encode(body)
+	}))
+	server.TLS = serverTLS.TLSConfig()
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func tlsClient(t *testing.T, caFile string, mutate func(*tls.Config)) *http.Client {
+	t.Helper()
+	pemData, err := os.ReadFile(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(pemData)
+	cfg := &tls.Config{RootCAs: pool}
+	if mutate != nil {
+		mutate(cfg)
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: cfg, DisableKeepAlives: true}}
+}
+
+func TestServerTLSVersionAndCiphers(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := generateTestCert(t, dir, "localhost")
+
+	cfg := config.DefaultConfig()
+	cfg.Server.TLS = config.ServerTLSConfig{
+		Enabled:      true,
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		MinVersion:   "1.2",
+		CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+	}
+	if err := config.ValidateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	serverTLS, err := core.NewServerTLS(cfg.Server.TLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := startTLSServer(t, serverTLS)
+
+	resp, err := tlsClient(t, certFile, func(c *tls.Config) { c.MaxVersion = tls.VersionTLS12 }).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.TLS.CipherSuite != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("unexpected cipher suite %s", tls.CipherSuiteName(resp.TLS.CipherSuite))
+	}
+
+	// 客户端只提供未允许的套件时握手失败
+	_, err = tlsClient(t, certFile, func(c *tls.Config) {
+		c.MaxVersion = tls.VersionTLS12
+		c.CipherSuites = []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}
+	}).Get(server.URL)
+	if err == nil {
+		t.Error("handshake with a disallowed cipher suite should fail")
+	}
+
+	// min_version 1.3 拒绝 TLS 1.2 客户端
+	cfg.Server.TLS.MinVersion = "1.3"
+	strict, err := core.NewServerTLS(cfg.Server.TLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strictServer := startTLSServer(t, strict)
+	if _, err := tlsClient(t, certFile, func(c *tls.Config) { c.MaxVersion = tls.VersionTLS12 }).Get(strictServer.URL); err == nil {
+		t.Error("TLS 1.2 client should be rejected by min_version 1.3")
+	}
+	resp, err = tlsClient(t, certFile, nil).Get(strictServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.TLS.Version != tls.VersionTLS13 {
+		t.Errorf("expected TLS 1.3, got %x", resp.TLS.Version)
+	}
+}
+
+func TestServerTLSHotReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := generateTestCert(t, dir, "localhost")
+	serverTLS, err := core.NewServerTLS(config.ServerTLSConfig{
+		Enabled:        true,
+		CertFile:       certFile,
+		KeyFile:        keyFile,
+		ReloadInterval: "1m",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{now: time.Now()}
+	serverTLS.SetClock(clock.Now)
+	server := startTLSServer(t, serverTLS)
+
+	serial := func(caFile string) string {
+		t.Helper()
+		resp, err := tlsClient(t, caFile, nil).Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.TLS.PeerCertificates[0].SerialNumber.String()
+	}
+	first := serial(certFile)
+	oldCert, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldCA := filepath.Join(t.TempDir(), "old.crt")
+	if err := os.WriteFile(oldCA, oldCert, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// 替换证书文件，修改时间设为将来以确保变化可见
+	newCert, newKey := generateTestCert(t, t.TempDir(), "localhost")
+	replace := func(src, dst string, offset time.Duration) {
+		t.Helper()
+		data, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(dst, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		future := time.Now().Add(offset)
+		if err := os.Chtimes(dst, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+	replace(newCert, certFile, time.Minute)
+	replace(newKey, keyFile, time.Minute)
+
+	// 检查间隔内继续使用旧证书
+	if got := serial(oldCA); got != first {
+		t.Errorf("certificate should not change within reload_interval")
+	}
+
+	clock.Advance(2 * time.Minute)
+	rotated := serial(newCert)
+	if rotated == first {
+		t.Fatal("certificate should be reloaded after reload_interval")
+	}
+
+	// 新证书无效时保留当前证书
+	broken := filepath.Join(t.TempDir(), "broken.crt")
+	if err := os.WriteFile(broken, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	replace(broken, certFile, 2*time.Minute)
+	clock.Advance(2 * time.Minute)
+	if got := serial(newCert); got != rotated {
+		t.Errorf("invalid certificate should not replace the current one")
+	}
+}
+
+func TestClientCertificateIdentity(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := generateTestCert(t, dir, "localhost")
+	caFile, caKey := generateTestCert(t, dir, "clients-ca")
+	clientCert := generateClientCert(t, dir, caFile, caKey, pkix.Name{
+		CommonName:         "svc-report",
+		Organization:       []string{"finance"},
+		OrganizationalUnit: []string{"analyst", "reader"},
+	})
+	// 由其他 CA 签发的证书不被信任
+	otherCA, otherKey := generateTestCert(t, t.TempDir(), "other-ca")
+	foreignCert := generateClientCert(t, dir, otherCA, otherKey, pkix.Name{CommonName: "intruder"})
+
+	cfg := config.DefaultConfig()
+	cfg.Server.TLS = config.ServerTLSConfig{
+		Enabled:  true,
+		CertFile: certFile,
+		KeyFile:  keyFile,
+		ClientAuth: config.ClientCertConfig{
+			Mode:        "required",
+			CAFile:      caFile,
+			RolesField:  "ou",
+			TenantField: "o",
+			Scopes:      []string{"execute", "schema"},
+		},
+	}
+	if err := config.ValidateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	serverTLS, err := core.NewServerTLS(cfg.Server.TLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := startTLSServer(t, serverTLS)
+
+	identity := func(cert *tls.Certificate) (map[string]interface{}, error) {
+		client := tlsClient(t, certFile, func(c *tls.Config) {
+			if cert != nil {
+				c.Certificates = []tls.Certificate{*cert}
+			}
+		})
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		body := make(map[string]interface{})
+		return body, json.NewDecoder(resp.Body).Decode(&body)
+	}
+
+	body, err := identity(&clientCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body["user"] != "svc-report" || body["tenant"] != "finance" {
+		t.Errorf("unexpected identity %v", body)
+	}
+	if roles, _ := json.Marshal(body["roles"]); !strings.Contains(string(roles), `"analyst"`) || !strings.Contains(string(roles), `"reader"`) {
+		t.Errorf("expected OUs as roles, got %s", roles)
+	}
+	if scopes, _ := json.Marshal(body["scopes"]); string(scopes) != `["execute","schema"]` {
+		t.Errorf("unexpected scopes %s", scopes)
+	}
+
+	if _, err := identity(nil); err == nil {
+		t.Error("required mode should reject clients without a certificate")
+	}
+	if _, err := identity(&foreignCert); err == nil {
+		t.Error("certificate from an untrusted CA should be rejected")
+	}
+
+	// optional 模式允许无证书连接，此时没有证书身份
+	cfg.Server.TLS.ClientAuth.Mode = "optional"
+	cfg.Server.TLS.ClientAuth.UserField = "email"
+	optional, err := core.NewServerTLS(cfg.Server.TLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server = startTLSServer(t, optional)
+	if body, err := identity(nil); err != nil || len(body) != 0 {
+		t.Errorf("anonymous connection should have no identity: %v %v", body, err)
+	}
+	if body, err := identity(&clientCert); err != nil || body["user"] != "svc-report@example.com" {
+		t.Errorf("expected email identity, got %v %v", body, err)
+	}
+}
+
+func TestServerTLSConfigValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*config.ServerTLSConfig)
+		want   string
+	}{
+		{"missing cert", func(c *config.ServerTLSConfig) { c.CertFile = "" }, "cert_file"},
+		{"bad version", func(c *config.ServerTLSConfig) { c.MinVersion = "1.0" }, "min_version"},
+		{"weak cipher", func(c *config.ServerTLSConfig) { c.CipherSuites = []string{"TLS_RSA_WITH_AES_128_CBC_SHA"} }, "cipher_suites"},
+		{"bad interval", func(c *config.ServerTLSConfig) { c.ReloadInterval = "soon" }, "reload_interval"},
+		{"bad mode", func(c *config.ServerTLSConfig) { c.ClientAuth.Mode = "always" }, "client_auth.mode"},
+		{"missing ca", func(c *config.ServerTLSConfig) { c.ClientAuth.Mode = "required" }, "client_auth.ca_file"},
+		{"bad field", func(c *config.ServerTLSConfig) {
+			c.ClientAuth = config.ClientCertConfig{Mode: "optional", CAFile: "ca.crt", UserField: "serial"}
+		}, "client_auth.user_field"},
+	}
+	for _, tt := range tests {
+		cfg := config.DefaultConfig()
+		cfg.Server.TLS.Enabled = true
+		cfg.Server.TLS.CertFile = "server.crt"
+		cfg.Server.TLS.KeyFile = "server.key"
+		tt.mutate(&cfg.Server.TLS)
+		err := config.ValidateConfig(cfg)
+		if err == nil || !strings.Contains(err.Error(), "server.tls."+tt.want) {
+			t.Errorf("%s: expected server.tls.%s error, got %v", tt.name, tt.want, err)
+		}
+	}
+}
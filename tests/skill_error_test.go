@@ -0,0 +1,145 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+	"text2sql-skill/drivers"
+	"text2sql-skill/interfaces"
+)
+
+func TestResultErrorCodes(t *testing.T) {
+	input := "2025年北京销售额超过100万的客户"
+	newSkill := func(t *testing.T, cfg *config.Config, schema string) *core.Text2SQLSkill {
+		t.Helper()
+		db, err := drivers.CreateSQLiteConnection(t.TempDir() + "/data.db")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if schema != "" {
+			if _, err := db.Exec(schema); err != nil {
+				t.Fatal(err)
+			}
+		}
+		skill, err := core.NewText2SQLSkill(cfg, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { skill.SafeShutdown() })
+		return skill.(*core.Text2SQLSkill)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		skill := newSkill(t, newAuditSinkConfig("memory", ""), "CREATE TABLE data (id INTEGER); INSERT INTO data VALUES (1)")
+		result, err := skill.Execute(context.Background(), input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if skillErr := core.ResultError(result); skillErr != nil {
+			t.Fatalf("unexpected error %v", skillErr)
+		}
+		meta, err := core.ParseResultMeta(result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta.Status != "success" || meta.RowCount != 1 || meta.TemplateUsed == "" || meta.Error != nil {
+			t.Errorf("unexpected success meta %+v", meta)
+		}
+	})
+
+	t.Run("guard_rejected", func(t *testing.T) {
+		skill := newSkill(t, newAuditSinkConfig("memory", ""), "")
+		result, err := skill.Execute(context.Background(), "2025年北京DROP客户")
+		if err != nil {
+			t.Fatal(err)
+		}
+		skillErr := core.ResultError(result)
+		if skillErr == nil || skillErr.Code != core.ErrCodeGuardRejected || skillErr.Guard != core.GuardKeywordFilter {
+			t.Fatalf("expected guard_rejected, got %s: %s", result.Status, result.Meta)
+		}
+		entries, err := skill.QueryAudit(core.AuditFilter{QueryID: result.QueryID, EventType: "rejected"})
+		if err != nil || len(entries) != 1 || entries[0].Data["error_code"] != "guard_rejected" {
+			t.Errorf("rejected audit should carry error_code, got %v %v", entries, err)
+		}
+	})
+
+	t.Run("access_denied", func(t *testing.T) {
+		skill := newSkill(t, newRBACConfig(), "CREATE TABLE data (id INTEGER)")
+		ctx := core.WithPrincipal(context.Background(), core.NewPrincipal("alice", "analyst"))
+		result, err := skill.Execute(ctx, input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		skillErr := core.ResultError(result)
+		if result.Status != "rejected" || skillErr == nil || skillErr.Code != core.ErrCodeAccessDenied || strings.Join(skillErr.Denied, ",") != "data" {
+			t.Fatalf("expected access_denied on data, got %s: %s", result.Status, result.Meta)
+		}
+	})
+
+	t.Run("db_error", func(t *testing.T) {
+		skill := newSkill(t, newAuditSinkConfig("memory", ""), "")
+		result, err := skill.Execute(context.Background(), input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		skillErr := core.ResultError(result)
+		if result.Status != "error" || skillErr == nil || skillErr.Code != core.ErrCodeDBError || !strings.HasPrefix(skillErr.Message, "execution_failed: ") {
+			t.Fatalf("expected db_error, got %s: %s", result.Status, result.Meta)
+		}
+		if skillErr.Code.Retryable() {
+			t.Error("db_error should not be retryable")
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		cfg := newAuditSinkConfig("memory", "")
+		cfg.Execution.Timeout.Total = "1ns"
+		skill := newSkill(t, cfg, "CREATE TABLE data (id INTEGER)")
+		result, err := skill.Execute(context.Background(), input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		skillErr := core.ResultError(result)
+		if skillErr == nil || skillErr.Code != core.ErrCodeTimeout || !skillErr.Code.Retryable() {
+			t.Fatalf("expected timeout, got %s: %s", result.Status, result.Meta)
+		}
+	})
+
+	t.Run("invalid_tenant", func(t *testing.T) {
+		router := newTenantRouter(t, newTenantConfig())
+		result, err := router.Execute(core.WithTenant(context.Background(), "unknown"), input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if skillErr := core.ResultError(result); skillErr == nil || skillErr.Code != core.ErrCodeInvalidTenant {
+			t.Fatalf("expected invalid_tenant, got %s: %s", result.Status, result.Meta)
+		}
+	})
+
+	t.Run("unstructured", func(t *testing.T) {
+		skillErr := core.ResultError(interfaces.SkillResult{Status: "error", Meta: []byte("mock_failure")})
+		if skillErr == nil || skillErr.Code != core.ErrCodeInternal || skillErr.Message != "mock_failure" {
+			t.Errorf("non-JSON meta should map to internal_error, got %+v", skillErr)
+		}
+	})
+}
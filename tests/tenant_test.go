@@ -0,0 +1,260 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+	"text2sql-skill/mcp"
+)
+
+func newTenantConfig() *config.Config {
+	cfg := newTestConfig()
+	cfg.MultiTenancy = config.MultiTenancyConfig{
+		Enabled:       true,
+		DefaultTenant: "retail",
+		Tenants: []config.TenantConfig{
+			{Name: "retail"},
+			{Name: "finance", ResourceLimits: &config.ResourceLimits{MaxMemoryMB: 64, MaxRows: 2, MaxResultSizeMB: 1}},
+		},
+	}
+	return cfg
+}
+
+// newTenantDB 创建包含 rows 行 data 表的 SQLite 数据库
+func newTenantDB(t *testing.T, rows int) *sql.DB {
+	t.Helper()
+	db := newTestDB(t, "CREATE TABLE data (id INTEGER, region TEXT)")
+	for i := 0; i < rows; i++ {
+		if _, err := db.Exec("INSERT INTO data VALUES (?, ?)", i, fmt.Sprintf("r%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func newTenantRouter(t *testing.T, cfg *config.Config) *core.TenantRouter {
+	t.Helper()
+	if err := config.ValidateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	router, err := core.NewTenantRouter(cfg, map[string]*sql.DB{
+		"retail":  newTenantDB(t, 1),
+		"finance": newTenantDB(t, 3),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { router.SafeShutdown() })
+	return router
+}
+
+func tenantRowCount(t *testing.T, router *core.TenantRouter, ctx context.Context) (string, float64) {
+	t.Helper()
+	result, meta := executeAs(ctx, t, router, nil)
+	rows, _ := meta["row_count"].(float64)
+	return result.Status, rows
+}
+
+func TestTenantConfigDerivation(t *testing.T) {
+	cfg := newAuditSinkConfig("sqlite", "/var/log/text2sql/audit.db")
+	cfg.Audit.Exporters = []config.AuditExporterConfig{{Name: "siem", Type: "webhook", Endpoint: "http://127.0.0.1/audit"}}
+	cfg.MultiTenancy = newTenantConfig().MultiTenancy
+
+	finance, err := cfg.ForTenant("finance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if finance.Security.ResourceLimits.MaxRows != 2 || cfg.Security.ResourceLimits.MaxRows == 2 {
+		t.Errorf("resource limits should be overridden for the tenant only")
+	}
+	if finance.Audit.Storage.Path != filepath.Join("/var/log/text2sql", "tenants", "finance", "audit.db") {
+		t.Errorf("unexpected tenant audit path: %s", finance.Audit.Storage.Path)
+	}
+	if finance.Audit.Exporters[0].AppName != cfg.App.Name+"-finance" || cfg.Audit.Exporters[0].AppName != "" {
+		t.Errorf("unexpected exporter app name: %q", finance.Audit.Exporters[0].AppName)
+	}
+	if finance.MultiTenancy.Enabled {
+		t.Error("derived tenant config should not be multi-tenant")
+	}
+
+	retail, _ := cfg.ForTenant("retail")
+	if retail.Database.MySQL.DSN != cfg.Database.MySQL.DSN || retail.Security.ResourceLimits != cfg.Security.ResourceLimits {
+		t.Error("unset tenant sections should inherit the global config")
+	}
+	if _, err := cfg.ForTenant("unknown"); err == nil {
+		t.Error("expected error for unknown tenant")
+	}
+}
+
+func TestTenantConfigValidation(t *testing.T) {
+	cases := map[string]func(*config.MultiTenancyConfig){
+		"no tenants":      func(m *config.MultiTenancyConfig) { m.Tenants = nil },
+		"bad name":        func(m *config.MultiTenancyConfig) { m.Tenants[0].Name = "../retail" },
+		"duplicate":       func(m *config.MultiTenancyConfig) { m.Tenants[1].Name = "retail" },
+		"unknown default": func(m *config.MultiTenancyConfig) { m.DefaultTenant = "wholesale" },
+		"invalid limits": func(m *config.MultiTenancyConfig) {
+			m.Tenants[1].ResourceLimits = &config.ResourceLimits{MaxMemoryMB: 1, MaxResultSizeMB: 1}
+		},
+	}
+	for name, mutate := range cases {
+		cfg := newTenantConfig()
+		mutate(&cfg.MultiTenancy)
+		err := config.ValidateConfig(cfg)
+		if err == nil || !strings.HasPrefix(err.Error(), "multi_tenancy.") {
+			t.Errorf("%s: expected multi_tenancy validation error, got %v", name, err)
+		}
+	}
+	if err := config.ValidateConfig(newTenantConfig()); err != nil {
+		t.Errorf("valid config rejected: %v", err)
+	}
+}
+
+func TestTenantRouterIsolation(t *testing.T) {
+	cfg := newTenantConfig()
+	cfg.Cache.Enabled = true
+	router := newTenantRouter(t, cfg)
+
+	principal := core.WithPrincipal(context.Background(), &core.Principal{User: "eve", Tenant: "finance"})
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		status string
+		rows   float64
+	}{
+		// 缓存按租户隔离，同一输入在不同租户得到各自数据库的结果
+		{"retail", core.WithTenant(context.Background(), "retail"), "success", 1},
+		{"finance capped by tenant max_rows", core.WithTenant(context.Background(), "finance"), "success", 2},
+		{"default tenant", context.Background(), "success", 1},
+		// 认证身份中的租户优先，请求参数与之不一致时拒绝
+		{"principal tenant", principal, "success", 2},
+		{"cross-tenant request", core.WithTenant(principal, "retail"), "rejected", 0},
+		{"unknown tenant", core.WithTenant(context.Background(), "wholesale"), "rejected", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, rows := tenantRowCount(t, router, tt.ctx)
+			if status != tt.status || rows != tt.rows {
+				t.Errorf("expected %s with %v rows, got %s with %v", tt.status, tt.rows, status, rows)
+			}
+		})
+	}
+
+	// 审计记录写入各自租户的存储
+	for _, tenant := range []string{"retail", "finance"} {
+		for _, event := range []string{"success", "cache_hit"} {
+			entries, err := router.QueryAudit(core.AuditFilter{Tenant: tenant, EventType: event})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("%s: expected 1 %s entry, got %d", tenant, event, len(entries))
+			}
+		}
+	}
+	stats := router.AuditStats()
+	if len(stats.Tenants) != 2 {
+		t.Errorf("expected per-tenant audit stats, got %+v", stats)
+	}
+}
+
+func TestTenantRouterRequiresTenant(t *testing.T) {
+	cfg := newTenantConfig()
+	cfg.MultiTenancy.DefaultTenant = ""
+	router := newTenantRouter(t, cfg)
+
+	if status, _ := tenantRowCount(t, router, context.Background()); status != "rejected" {
+		t.Errorf("request without tenant should be rejected, got %s", status)
+	}
+	if _, err := core.NewTenantRouter(cfg, map[string]*sql.DB{"retail": newTenantDB(t, 1)}); err == nil {
+		t.Error("expected error when a tenant has no database connection")
+	}
+}
+
+func TestTenantRouterRequiresBinding(t *testing.T) {
+	router := newTenantRouter(t, newTenantConfig())
+	unbound := core.WithPrincipal(context.Background(), &core.Principal{User: "mallory", Scopes: []string{core.ScopeExecute, core.ScopeAudit}})
+	admin := core.WithPrincipal(context.Background(), &core.Principal{User: "ops", Scopes: []string{core.ScopeAdmin}})
+
+	// 未绑定租户的调用方只能使用默认租户，admin 可以指定租户
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		status string
+	}{
+		{"unbound caller on default tenant", unbound, "success"},
+		{"unbound caller naming default tenant", core.WithTenant(unbound, "retail"), "success"},
+		{"unbound caller on other tenant", core.WithTenant(unbound, "finance"), "rejected"},
+		{"admin on other tenant", core.WithTenant(admin, "finance"), "success"},
+	}
+	for _, tt := range tests {
+		if status, _ := tenantRowCount(t, router, tt.ctx); status != tt.status {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.status, status)
+		}
+	}
+}
+
+func TestTenantAuditIsolation(t *testing.T) {
+	router := newTenantRouter(t, newTenantConfig())
+	for _, tenant := range []string{"retail", "finance"} {
+		if status, _ := tenantRowCount(t, router, core.WithTenant(context.Background(), tenant)); status != "success" {
+			t.Fatalf("%s: expected success, got %s", tenant, status)
+		}
+	}
+
+	// 调用方只能查询自己租户的审计记录
+	finance := core.WithPrincipal(context.Background(), &core.Principal{User: "eve", Tenant: "finance"})
+	if _, err := router.QueryAuditContext(finance, core.AuditFilter{Tenant: "retail"}); err == nil {
+		t.Error("cross-tenant audit query should be rejected")
+	}
+	if _, err := router.QueryAuditContext(core.WithTenant(context.Background(), "finance"), core.AuditFilter{Tenant: "retail"}); err == nil {
+		t.Error("audit filter tenant differing from the request tenant should be rejected")
+	}
+	unbound := core.WithPrincipal(context.Background(), &core.Principal{User: "mallory", Scopes: []string{core.ScopeAudit}})
+	if _, err := router.QueryAuditContext(unbound, core.AuditFilter{Tenant: "finance"}); err == nil {
+		t.Error("caller without a tenant should not read another tenant's audit log")
+	}
+	entries, err := router.QueryAuditContext(finance, core.AuditFilter{EventType: "success"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected the caller's own tenant entries, got %d", len(entries))
+	}
+
+	// MCP text2sql/audit 同样按调用方租户检查
+	server := mcp.NewServer(newTenantConfig(), router)
+	session := server.NewSession()
+	callMCP(t, server, context.Background(), session, "initialize", map[string]interface{}{"protocolVersion": mcp.LatestProtocolVersion})
+	ctx := mcp.WithAPIKey(finance, &core.APIKey{Name: "auditor", Scopes: []string{core.ScopeAudit}})
+	resp := callMCP(t, server, ctx, session, "text2sql/audit", map[string]string{"tenant": "retail"})
+	if resp.Error == nil || !strings.Contains(fmt.Sprint(resp.Error.Data), "retail") {
+		t.Errorf("cross-tenant text2sql/audit should be rejected, got %+v", resp)
+	}
+	result := decodeMCPResult(t, callMCP(t, server, ctx, session, "text2sql/audit", map[string]string{"event_type": "success"}))
+	if result["count"] != float64(1) {
+		t.Errorf("expected the caller's own tenant entries over MCP, got %v", result["count"])
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2024 Text2SQL Skill Engine
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Author: Jaco Liu (Jianqiu Liu) <ljqlab@gmail.com>
+// GitHub: https://github.com/ljq
+
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"text2sql-skill/config"
+	"text2sql-skill/core"
+)
+
+func newWorkerPool(size, queue, batchQueue int, timeout string) *core.WorkerPool {
+	return core.NewWorkerPool(config.PerformanceConfig{
+		WorkerPoolSize: size,
+		Admission:      config.AdmissionConfig{QueueSize: queue, BatchQueueSize: batchQueue, QueueTimeout: timeout},
+	})
+}
+
+// acquireAsync 在后台排队，返回接收结果的通道
+func acquireAsync(pool *core.WorkerPool, ctx context.Context, priority core.Priority) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := pool.Acquire(ctx, priority)
+		done <- err
+	}()
+	return done
+}
+
+func TestWorkerPoolBoundsConcurrency(t *testing.T) {
+	pool := newWorkerPool(2, 10, 0, "")
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if wait, err := pool.Acquire(ctx, core.PriorityInteractive); err != nil || wait != 0 {
+			t.Fatalf("acquire %d: %v %v", i, wait, err)
+		}
+	}
+
+	queued := acquireAsync(pool, ctx, core.PriorityInteractive)
+	waitFor(func() bool { return pool.Stats().QueueDepth == 1 }, time.Second)
+	select {
+	case <-queued:
+		t.Fatal("third request should wait for a free worker")
+	default:
+	}
+
+	pool.Release()
+	if err := <-queued; err != nil {
+		t.Fatal(err)
+	}
+	stats := pool.Stats()
+	if stats.Running != 2 || stats.QueueDepth != 0 || stats.Admitted != 3 || stats.Queued != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestWorkerPoolPrefersInteractive(t *testing.T) {
+	pool := newWorkerPool(1, 10, 0, "")
+	ctx := context.Background()
+	pool.Acquire(ctx, core.PriorityInteractive)
+
+	batch := acquireAsync(pool, ctx, core.PriorityBatch)
+	waitFor(func() bool { return pool.Stats().BatchQueued == 1 }, time.Second)
+	interactive := acquireAsync(pool, ctx, core.PriorityInteractive)
+	waitFor(func() bool { return pool.Stats().InteractiveQueued == 1 }, time.Second)
+
+	pool.Release()
+	if err := <-interactive; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-batch:
+		t.Fatal("batch request should wait while interactive requests are queued")
+	default:
+	}
+
+	pool.Release()
+	if err := <-batch; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWorkerPoolShedsLoad(t *testing.T) {
+	pool := newWorkerPool(1, 2, 1, "50ms")
+	ctx := context.Background()
+	pool.Acquire(ctx, core.PriorityInteractive)
+
+	batch := acquireAsync(pool, ctx, core.PriorityBatch)
+	waitFor(func() bool { return pool.Stats().BatchQueued == 1 }, time.Second)
+
+	// batch 请求只能占用 batch_queue_size 个位置
+	if _, err := pool.Acquire(ctx, core.PriorityBatch); !errors.Is(err, core.ErrOverloaded) {
+		t.Errorf("expected batch queue to be full, got %v", err)
+	}
+
+	interactive := acquireAsync(pool, ctx, core.PriorityInteractive)
+	waitFor(func() bool { return pool.Stats().QueueDepth == 2 }, time.Second)
+	if _, err := pool.Acquire(ctx, core.PriorityInteractive); !errors.Is(err, core.ErrOverloaded) {
+		t.Errorf("expected queue to be full, got %v", err)
+	}
+
+	// 排队超时
+	for _, done := range []<-chan error{batch, interactive} {
+		if err := <-done; !errors.Is(err, core.ErrOverloaded) {
+			t.Errorf("expected queue timeout, got %v", err)
+		}
+	}
+
+	stats := pool.Stats()
+	if stats.Shed != 2 || stats.TimedOut != 2 || stats.QueueDepth != 0 || stats.Running != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestWorkerPoolHonorsContext(t *testing.T) {
+	pool := newWorkerPool(1, 10, 0, "")
+	pool.Acquire(context.Background(), core.PriorityInteractive)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := acquireAsync(pool, ctx, core.PriorityInteractive)
+	waitFor(func() bool { return pool.Stats().QueueDepth == 1 }, time.Second)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	// 取消的请求不占用工作槽
+	pool.Release()
+	if stats := pool.Stats(); stats.Running != 0 || stats.QueueDepth != 0 {
+		t.Errorf("unexpected stats after cancel: %+v", stats)
+	}
+}
+
+// blockingDriver 查询阻塞直到 release 关闭，用于占满工作池
+type blockingDriver struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (d *blockingDriver) Open(string) (driver.Conn, error) { return &blockingConn{d: d}, nil }
+
+type blockingConn struct{ d *blockingDriver }
+
+func (c *blockingConn) Prepare(query string) (driver.Stmt, error) { return &blockingStmt{d: c.d}, nil }
+func (c *blockingConn) Close() error                              { return nil }
+func (c *blockingConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+type blockingStmt struct{ d *blockingDriver }
+
+func (s *blockingStmt) Close() error  { return nil }
+func (s *blockingStmt) NumInput() int { return -1 }
+func (s *blockingStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s *blockingStmt) Query([]driver.Value) (driver.Rows, error) {
+	s.d.started <- struct{}{}
+	<-s.d.release
+	return &blockingRows{}, nil
+}
+
+type blockingRows struct{ done bool }
+
+func (r *blockingRows) Columns() []string { return []string{"id"} }
+func (r *blockingRows) Close() error      { return nil }
+func (r *blockingRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+var registerBlockingDriver sync.Once
+var blocking = &blockingDriver{started: make(chan struct{}, 1), release: make(chan struct{})}
+
+func TestExecuteReturnsOverloaded(t *testing.T) {
+	registerBlockingDriver.Do(func() { sql.Register("text2sql-blocking", blocking) })
+	db, err := sql.Open("text2sql-blocking", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := newAuditSinkConfig("memory", "")
+	cfg.Performance.WorkerPoolSize = 1
+	cfg.Performance.Admission = config.AdmissionConfig{QueueSize: 0}
+	skill, err := core.NewText2SQLSkill(cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer skill.SafeShutdown()
+
+	first := make(chan string, 1)
+	go func() {
+		result, _ := skill.Execute(context.Background(), "2025年北京销售额超过100万的客户")
+		first <- result.Status
+	}()
+	<-blocking.started
+
+	result, err := skill.Execute(context.Background(), "2025年北京销售额超过100万的客户")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != core.StatusOverloaded {
+		t.Errorf("expected overloaded while the worker is busy, got %s: %s", result.Status, result.Meta)
+	}
+
+	close(blocking.release)
+	if status := <-first; status != "success" {
+		t.Errorf("first query should succeed, got %s", status)
+	}
+	stats := skill.(interface{ WorkerPoolStats() core.WorkerPoolStats }).WorkerPoolStats()
+	if stats.Shed != 1 || stats.Running != 0 {
+		t.Errorf("unexpected pool stats: %+v", stats)
+	}
+}
@@ -22,54 +22,64 @@ import (
 	"compress/zlib"
 	"crypto/sha256"
 	"encoding/binary"
+	"errors"
+	"io"
 	"math"
 )
 
+// ErrInvalidResult 结果数据格式或校验和错误
+var ErrInvalidResult = errors.New("invalid result encoding")
+
+const (
+	resultMagic = 0x7F
+	// resultVersion 长度前缀格式的版本号，紧跟在 magic 之后。旧的分隔符格式在 magic 之后
+	// 直接是行起始字节 0x01（或空结果的校验和），不会出现 0x02
+	resultVersion = 0x02
+)
+
+// EncryptResult 编码查询结果。magic 和版本号之后，每行以 0x01 开头，随后是字段数；
+// 每个字段为带长度前缀的列名（按字节异或混淆）、类型字节和值，字符串值同样带长度前缀，
+// 列名和值可以包含任意字节。不支持的类型编码为 null，末尾附加 4 字节校验和
 func EncryptResult(data []map[string]interface{}, compress bool) []byte {
-	buf := bytes.NewBuffer(nil)
-	buf.WriteByte(0x7F) // magic number
+	buf := []byte{resultMagic, resultVersion}
 
 	for _, row := range data {
-		buf.WriteByte(0x01) // row start
+		buf = append(buf, 0x01) // row start
+		buf = binary.AppendUvarint(buf, uint64(len(row)))
 		for k, v := range row {
 			// Key obfuscation
-			ks := []byte(k)
-			for i := range ks {
-				ks[i] ^= 0xAA
+			buf = binary.AppendUvarint(buf, uint64(len(k)))
+			for i := 0; i < len(k); i++ {
+				buf = append(buf, k[i]^0xAA)
 			}
-			buf.Write(ks)
-			buf.WriteByte(0x1F) // key-value separator
 
 			// Value encoding
 			switch val := v.(type) {
 			case int64:
-				buf.WriteByte(0x02) // INT type
-				var b [8]byte
-				binary.LittleEndian.PutUint64(b[:], uint64(val))
-				buf.Write(b[:])
+				buf = append(buf, 0x02) // INT type
+				buf = binary.LittleEndian.AppendUint64(buf, uint64(val))
 			case float64:
-				buf.WriteByte(0x03) // FLOAT type
-				var b [8]byte
-				binary.LittleEndian.PutUint64(b[:], math.Float64bits(val))
-				buf.Write(b[:])
+				buf = append(buf, 0x03) // FLOAT type
+				buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(val))
 			case string:
-				buf.WriteByte(0x04) // STRING type
-				buf.Write([]byte(val))
+				buf = append(buf, 0x04) // STRING type
+				buf = binary.AppendUvarint(buf, uint64(len(val)))
+				buf = append(buf, val...)
+			default:
+				buf = append(buf, 0x00) // NULL
 			}
-			buf.WriteByte(0x1E) // field end
 		}
-		buf.WriteByte(0x00) // row end
 	}
 
 	// Add checksum
-	checksum := sha256.Sum256(buf.Bytes())
-	buf.Write(checksum[:4])
+	checksum := sha256.Sum256(buf)
+	buf = append(buf, checksum[:4]...)
 
-	if compress && buf.Len() > 1024 {
-		return compressData(buf.Bytes())
+	if compress && len(buf) > 1024 {
+		return compressData(buf)
 	}
 
-	return buf.Bytes()
+	return buf
 }
 
 func compressData(data []byte) []byte {
@@ -79,3 +89,179 @@ func compressData(data []byte) []byte {
 	w.Close()
 	return buf.Bytes()
 }
+
+// DecryptResult 解码 EncryptResult 的输出，同时兼容不带版本号的旧分隔符格式。
+// 格式或校验和错误时返回 ErrInvalidResult
+func DecryptResult(data []byte) ([]map[string]interface{}, error) {
+	if len(data) > 0 && data[0] != resultMagic {
+		r, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrInvalidResult
+		}
+		defer r.Close()
+		if data, err = io.ReadAll(r); err != nil {
+			return nil, ErrInvalidResult
+		}
+	}
+	if len(data) < 5 || data[0] != resultMagic {
+		return nil, ErrInvalidResult
+	}
+	body := data[:len(data)-4]
+	checksum := sha256.Sum256(body)
+	if !bytes.Equal(checksum[:4], data[len(data)-4:]) {
+		return nil, ErrInvalidResult
+	}
+	if len(body) < 2 || body[1] != resultVersion {
+		return decodeLegacyResult(body)
+	}
+
+	d := &resultDecoder{body: body, pos: 2}
+	rows := []map[string]interface{}{}
+	for d.pos < len(body) {
+		if d.byte() != 0x01 {
+			return nil, ErrInvalidResult
+		}
+		fields := d.uvarint()
+		if d.err != nil || fields > uint64(len(body)) {
+			return nil, ErrInvalidResult
+		}
+		row := make(map[string]interface{}, fields)
+		for n := uint64(0); n < fields; n++ {
+			key := d.bytes()
+			for j := range key {
+				key[j] ^= 0xAA
+			}
+
+			var value interface{}
+			switch d.byte() {
+			case 0x00:
+			case 0x02:
+				value = int64(d.uint64())
+			case 0x03:
+				value = math.Float64frombits(d.uint64())
+			case 0x04:
+				value = string(d.bytes())
+			default:
+				return nil, ErrInvalidResult
+			}
+			if d.err != nil {
+				return nil, ErrInvalidResult
+			}
+			row[string(key)] = value
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// decodeLegacyResult 解码旧的分隔符格式：字段为混淆列名、0x1F、类型字节和值，
+// 以 0x1E 结束，行以 0x00 结束。列名含 0x1F 或字符串含 0x1E 时无法正确解码
+func decodeLegacyResult(body []byte) ([]map[string]interface{}, error) {
+	rows := []map[string]interface{}{}
+	for i := 1; i < len(body); {
+		if body[i] != 0x01 {
+			return nil, ErrInvalidResult
+		}
+		i++
+		row := make(map[string]interface{})
+		for i < len(body) && body[i] != 0x00 {
+			sep := bytes.IndexByte(body[i:], 0x1F)
+			if sep < 0 {
+				return nil, ErrInvalidResult
+			}
+			key := make([]byte, sep)
+			for j := range key {
+				key[j] = body[i+j] ^ 0xAA
+			}
+			i += sep + 1
+			if i >= len(body) {
+				return nil, ErrInvalidResult
+			}
+
+			var value interface{}
+			switch body[i] {
+			case 0x02, 0x03:
+				if i+9 > len(body) {
+					return nil, ErrInvalidResult
+				}
+				bits := binary.LittleEndian.Uint64(body[i+1 : i+9])
+				if body[i] == 0x02 {
+					value = int64(bits)
+				} else {
+					value = math.Float64frombits(bits)
+				}
+				i += 9
+			case 0x04:
+				end := bytes.IndexByte(body[i+1:], 0x1E)
+				if end < 0 {
+					return nil, ErrInvalidResult
+				}
+				value = string(body[i+1 : i+1+end])
+				i += 1 + end
+			}
+			if i >= len(body) || body[i] != 0x1E {
+				return nil, ErrInvalidResult
+			}
+			i++
+			row[string(key)] = value
+		}
+		if i >= len(body) {
+			return nil, ErrInvalidResult
+		}
+		i++ // row end
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// resultDecoder 顺序读取结果编码，越界时记录错误并返回零值
+type resultDecoder struct {
+	body []byte
+	pos  int
+	err  error
+}
+
+func (d *resultDecoder) byte() byte {
+	if d.err != nil || d.pos >= len(d.body) {
+		d.err = ErrInvalidResult
+		return 0
+	}
+	b := d.body[d.pos]
+	d.pos++
+	return b
+}
+
+func (d *resultDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.body[d.pos:])
+	if n <= 0 {
+		d.err = ErrInvalidResult
+		return 0
+	}
+	d.pos += n
+	return v
+}
+
+func (d *resultDecoder) uint64() uint64 {
+	if d.err != nil || len(d.body)-d.pos < 8 {
+		d.err = ErrInvalidResult
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(d.body[d.pos:])
+	d.pos += 8
+	return v
+}
+
+// bytes 读取带长度前缀的字节串，返回副本
+func (d *resultDecoder) bytes() []byte {
+	n := d.uvarint()
+	if d.err != nil || n > uint64(len(d.body)-d.pos) {
+		d.err = ErrInvalidResult
+		return nil
+	}
+	b := append([]byte(nil), d.body[d.pos:d.pos+int(n)]...)
+	d.pos += int(n)
+	return b
+}